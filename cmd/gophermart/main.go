@@ -3,73 +3,102 @@ package main
 import (
 	"context"
 	"log"
-	"net/http"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/AlenaMolokova/diploma/internal/config"
-	"github.com/AlenaMolokova/diploma/internal/handlers"
+	"github.com/AlenaMolokova/diploma/internal/logging"
 	"github.com/AlenaMolokova/diploma/internal/loyalty"
-	"github.com/AlenaMolokova/diploma/internal/middleware"
 	"github.com/AlenaMolokova/diploma/internal/migrations"
+	"github.com/AlenaMolokova/diploma/internal/router"
+	"github.com/AlenaMolokova/diploma/internal/server"
 	"github.com/AlenaMolokova/diploma/internal/storage"
-	"github.com/AlenaMolokova/diploma/internal/usecase"
-	"github.com/go-chi/chi/v5"
+	"github.com/AlenaMolokova/diploma/internal/tracing"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	cfg, err := config.NewConfig()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	if err := migrations.Apply(cfg.DatabaseURI); err != nil {
-		log.Fatalf("Failed to apply migrations: %v", err)
+	logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	slog.SetDefault(logger)
+	logger.Info("Config loaded", slog.Any("config", cfg))
+	if cfg.InsecureSecret() {
+		logger.Warn("DEV_MODE is set, signing tokens with the insecure default secret")
 	}
 
-	db, err := pgxpool.New(context.Background(), cfg.DatabaseURI)
+	shutdownTracing, err := tracing.Setup(ctx, cfg.TraceExporter, os.Stdout)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal(logger, "Failed to set up tracing", err)
 	}
-	defer db.Close()
 
-	store, err := storage.NewStorage(db)
+	if err := migrations.Apply(cfg.DatabaseURI); err != nil {
+		fatal(logger, "Failed to apply migrations", err)
+	}
+	schemaVersion, err := migrations.Latest()
 	if err != nil {
-		log.Fatalf("Failed to create storage: %v", err)
+		fatal(logger, "Failed to read migrations", err)
 	}
 
-	loyaltyClient := loyalty.NewClient(cfg.AccrualAddr)
-	loyaltyClient.SetPollInterval(cfg.PollIntervalSec)
-
-	balanceUC := usecase.NewBalanceUseCase(store)
-	withdrawalUC := usecase.NewWithdrawalUseCase(store, balanceUC)
-	orderUC := usecase.NewOrderUseCase(store, loyaltyClient, balanceUC)
-
-	registerHandler := handlers.NewRegisterHandler(store, cfg.JWTSecret)
-	loginHandler := handlers.NewLoginHandler(store, cfg.JWTSecret)
-	orderHandler := handlers.NewOrderHandler(orderUC)
-	orderGetHandler := handlers.NewOrderGetHandler(store)
-	balanceHandler := handlers.NewBalanceHandler(balanceUC)
-	withdrawHandler := handlers.NewWithdrawHandler(withdrawalUC)
-	withdrawalsHandler := handlers.NewWithdrawalsHandler(withdrawalUC)
-
-	r := chi.NewRouter()
+	poolConfig, err := pgxpool.ParseConfig(cfg.DatabaseURI)
+	if err != nil {
+		fatal(logger, "Failed to parse database URI", err)
+	}
+	poolConfig.ConnConfig.Tracer = tracing.QueryTracer{}
+	db, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		fatal(logger, "Failed to connect to database", err)
+	}
 
-	r.Post("/api/user/register", registerHandler.ServeHTTP)
-	r.Post("/api/user/login", loginHandler.ServeHTTP)
+	store, err := storage.NewStorage(db)
+	if err != nil {
+		fatal(logger, "Failed to create storage", err)
+	}
 
-	r.Group(func(r chi.Router) {
-		r.Use(middleware.AuthMiddleware(cfg.JWTSecret))
-		r.Post("/api/user/orders", orderHandler.ServeHTTP)
-		r.Get("/api/user/orders", orderGetHandler.ServeHTTP)
-		r.Get("/api/user/balance", balanceHandler.ServeHTTP)
-		r.Post("/api/user/balance/withdraw", withdrawHandler.ServeHTTP)
-		r.Get("/api/user/withdrawals", withdrawalsHandler.ServeHTTP)
+	app, err := router.SetupRoutes(cfg, router.Deps{
+		Store:         store,
+		Accrual:       loyalty.NewClient(cfg.AccrualAddr),
+		Clock:         time.Now,
+		Logger:        logger,
+		SchemaVersion: schemaVersion,
 	})
+	if err != nil {
+		fatal(logger, "Failed to set up application", err)
+	}
 
-	go loyaltyClient.StartOrderProcessing(context.Background(), store)
+	srv := server.New(cfg.RunAddr, app.Handler, time.Duration(cfg.ShutdownSec)*time.Second)
+	srv.SetDrainDelay(time.Duration(cfg.DrainSec) * time.Second)
+	srv.OnDrain(app.Drain)
+	srv.OnStop(app.Stop)
+	for _, worker := range app.Workers {
+		srv.AddWorker(worker)
+	}
+	srv.OnShutdown(db.Close)
+	srv.OnShutdown(func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("Failed to flush traces", slog.Any("error", err))
+		}
+	})
 
-	log.Printf("Starting Gophermart server on %s", cfg.RunAddr)
-	if err := http.ListenAndServe(cfg.RunAddr, r); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	logger.Info("Starting Gophermart server", slog.String("address", cfg.RunAddr))
+	if err := srv.Run(ctx); err != nil {
+		fatal(logger, "Server error", err)
 	}
 }
+
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, slog.Any("error", err))
+	os.Exit(1)
+}
@@ -0,0 +1,19 @@
+// Package audit carries request metadata that audit entries are stamped with
+// from the HTTP layer down to the storage that writes them.
+package audit
+
+import "context"
+
+type sourceIPKey struct{}
+
+// WithSourceIP returns a context whose audit entries record ip as their source.
+func WithSourceIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, sourceIPKey{}, ip)
+}
+
+// SourceIP returns the address set by WithSourceIP, or "" for work that did
+// not come from a request, such as the accrual poller.
+func SourceIP(ctx context.Context) string {
+	ip, _ := ctx.Value(sourceIPKey{}).(string)
+	return ip
+}
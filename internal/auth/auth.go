@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
+type TokenStore interface {
+	CreateRefreshToken(ctx context.Context, token models.RefreshToken) error
+	RotateRefreshToken(ctx context.Context, oldHash string, next models.RefreshToken) (models.RefreshToken, error)
+	RevokeTokenFamily(ctx context.Context, familyID string) error
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti, familyID string) (bool, error)
+	GetUserRole(ctx context.Context, userID int64) (string, error)
+	PruneExpiredTokens(ctx context.Context) (int64, error)
+}
+
+// Tokens is a freshly issued access/refresh pair. CSRFToken and
+// RefreshExpiresIn are only used for cookie sessions and are not part of the
+// JSON response.
+type Tokens struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	CSRFToken        string `json:"-"`
+	RefreshExpiresIn int64  `json:"-"`
+}
+
+// Claims are carried by access tokens. SessionID names the refresh token
+// family the access token was issued from, so revoking the family also
+// invalidates its outstanding access tokens. CSRF is the token a cookie
+// session has to echo back on state-changing requests. Role is read from the
+// user when the token is issued, so a role change takes effect on the next
+// refresh.
+type Claims struct {
+	UserID    int64  `json:"user_id"`
+	SessionID string `json:"sid"`
+	CSRF      string `json:"csrf,omitempty"`
+	Role      string `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Service issues short-lived access tokens and rotating refresh tokens.
+// Access tokens are signed with the keyring's signing key; refresh tokens are
+// opaque and stored only as SHA-256 hashes.
+type Service struct {
+	store      TokenStore
+	keys       *Keyring
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	now        func() time.Time
+}
+
+func NewService(store TokenStore, keys *Keyring, accessTTL, refreshTTL time.Duration) *Service {
+	return &Service{
+		store:      store,
+		keys:       keys,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		now:        time.Now,
+	}
+}
+
+func (s *Service) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// IssueTokens starts a new session for the user.
+func (s *Service) IssueTokens(ctx context.Context, userID int64) (Tokens, error) {
+	familyID, err := randomString(16)
+	if err != nil {
+		return Tokens{}, err
+	}
+	refresh, err := randomString(32)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	if err := s.store.CreateRefreshToken(ctx, models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: HashToken(refresh),
+		ExpiresAt: s.now().Add(s.refreshTTL),
+	}); err != nil {
+		return Tokens{}, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return s.pair(ctx, userID, familyID, refresh)
+}
+
+// Refresh exchanges a refresh token for a new pair. The presented token is
+// spent; presenting it again revokes every token of its family.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	next, err := randomString(32)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	stored, err := s.store.RotateRefreshToken(ctx, HashToken(refreshToken), models.RefreshToken{
+		TokenHash: HashToken(next),
+		ExpiresAt: s.now().Add(s.refreshTTL),
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return s.pair(ctx, stored.UserID, stored.FamilyID, next)
+}
+
+// Logout denylists the access token and revokes the session it belongs to.
+func (s *Service) Logout(ctx context.Context, claims Claims) error {
+	var expiresAt time.Time
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	if err := s.store.RevokeAccessToken(ctx, claims.ID, expiresAt); err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	if err := s.store.RevokeTokenFamily(ctx, claims.SessionID); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// PruneExpired deletes expired tokens every interval until ctx is cancelled,
+// so that the revocation lookups made on every request stay cheap.
+func (s *Service) PruneExpired(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pruned, err := s.store.PruneExpiredTokens(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.ErrorContext(ctx, "Failed to prune expired tokens", slog.Any("error", err))
+				}
+				continue
+			}
+			if pruned > 0 {
+				slog.InfoContext(ctx, "Pruned expired tokens", slog.Int64("count", pruned))
+			}
+		}
+	}
+}
+
+// ParseAccessToken verifies the signature and expiry of an access token and
+// rejects it if it or its session has been revoked.
+func (s *Service) ParseAccessToken(ctx context.Context, tokenString string) (Claims, error) {
+	var claims Claims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, s.keys.keyFunc,
+		jwt.WithValidMethods(validMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(s.now),
+	)
+	if err != nil || !token.Valid {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.ID == "" || claims.SessionID == "" || claims.UserID == 0 {
+		return Claims{}, fmt.Errorf("%w: missing claims", ErrInvalidToken)
+	}
+
+	revoked, err := s.store.IsTokenRevoked(ctx, claims.ID, claims.SessionID)
+	if err != nil {
+		return Claims{}, fmt.Errorf("failed to check revocation: %w", err)
+	}
+	if revoked {
+		return Claims{}, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+func (s *Service) pair(ctx context.Context, userID int64, familyID, refresh string) (Tokens, error) {
+	role, err := s.store.GetUserRole(ctx, userID)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("failed to get user role: %w", err)
+	}
+	jti, err := randomString(16)
+	if err != nil {
+		return Tokens{}, err
+	}
+	csrf, err := randomString(16)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	now := s.now()
+	access, err := s.keys.sign(Claims{
+		UserID:    userID,
+		SessionID: familyID,
+		CSRF:      csrf,
+		Role:      role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTTL)),
+		},
+	})
+	if err != nil {
+		return Tokens{}, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	return Tokens{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(s.accessTTL / time.Second),
+		CSRFToken:        csrf,
+		RefreshExpiresIn: int64(s.refreshTTL / time.Second),
+	}, nil
+}
+
+// GenerateToken returns a random opaque token, e.g. for password resets.
+func GenerateToken() (string, error) {
+	return randomString(32)
+}
+
+// HashToken is how opaque tokens are stored and looked up.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,199 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/auth"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/testutils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const secret = "test-secret"
+
+func TestIssueTokens(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	store := &testutils.MockTokenStore{}
+	var stored models.RefreshToken
+	store.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("models.RefreshToken")).
+		Run(func(args mock.Arguments) { stored = args.Get(1).(models.RefreshToken) }).
+		Return(nil)
+	store.On("GetUserRole", mock.Anything, int64(42)).Return("admin", nil)
+
+	service := auth.NewService(store, testutils.HMACKeyring(secret), 15*time.Minute, time.Hour)
+	service.SetClock(func() time.Time { return now })
+
+	tokens, err := service.IssueTokens(ctx, 42)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, int64(900), tokens.ExpiresIn)
+	assert.Equal(t, int64(42), stored.UserID)
+	assert.Equal(t, auth.HashToken(tokens.RefreshToken), stored.TokenHash)
+	assert.NotEqual(t, tokens.RefreshToken, stored.TokenHash, "refresh token must not be stored in plain text")
+	assert.Equal(t, now.Add(time.Hour), stored.ExpiresAt)
+
+	var claims auth.Claims
+	_, _, err = jwt.NewParser().ParseUnverified(tokens.AccessToken, &claims)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), claims.UserID)
+	assert.Equal(t, "admin", claims.Role)
+	assert.Equal(t, stored.FamilyID, claims.SessionID)
+	assert.NotEmpty(t, claims.ID)
+	assert.NotEmpty(t, claims.CSRF)
+	assert.Equal(t, tokens.CSRFToken, claims.CSRF)
+	assert.Equal(t, now.Add(15*time.Minute).Unix(), claims.ExpiresAt.Unix())
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		rotateErr   error
+		expectedErr error
+	}{
+		{name: "успешная ротация", rotateErr: nil, expectedErr: nil},
+		{name: "повторное использование", rotateErr: models.ErrRefreshTokenReused, expectedErr: models.ErrRefreshTokenReused},
+		{name: "неизвестный токен", rotateErr: models.ErrRefreshTokenInvalid, expectedErr: models.ErrRefreshTokenInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &testutils.MockTokenStore{}
+			store.On("RotateRefreshToken", mock.Anything, auth.HashToken("old-token"), mock.AnythingOfType("models.RefreshToken")).
+				Return(models.RefreshToken{UserID: 7, FamilyID: "family"}, tt.rotateErr)
+			store.On("GetUserRole", mock.Anything, int64(7)).Return("user", nil).Maybe()
+
+			service := auth.NewService(store, testutils.HMACKeyring(secret), time.Minute, time.Hour)
+			tokens, err := service.Refresh(ctx, "old-token")
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEqual(t, "old-token", tokens.RefreshToken)
+
+			var claims auth.Claims
+			_, _, err = jwt.NewParser().ParseUnverified(tokens.AccessToken, &claims)
+			require.NoError(t, err)
+			assert.Equal(t, int64(7), claims.UserID)
+			assert.Equal(t, "family", claims.SessionID)
+			assert.Equal(t, "user", claims.Role, "the role is read again on refresh")
+
+			next := store.Calls[0].Arguments.Get(2).(models.RefreshToken)
+			assert.Equal(t, auth.HashToken(tokens.RefreshToken), next.TokenHash)
+		})
+	}
+}
+
+func TestParseAccessToken(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	store := &testutils.MockTokenStore{}
+	store.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+	store.On("GetUserRole", mock.Anything, mock.Anything).Return("user", nil)
+	service := auth.NewService(store, testutils.HMACKeyring(secret), time.Minute, time.Hour)
+	service.SetClock(func() time.Time { return now })
+
+	tokens, err := service.IssueTokens(ctx, 1)
+	require.NoError(t, err)
+
+	t.Run("валидный токен", func(t *testing.T) {
+		store.On("IsTokenRevoked", mock.Anything, mock.Anything, mock.Anything).Return(false, nil).Once()
+		claims, err := service.ParseAccessToken(ctx, tokens.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), claims.UserID)
+	})
+
+	t.Run("отозванный токен", func(t *testing.T) {
+		store.On("IsTokenRevoked", mock.Anything, mock.Anything, mock.Anything).Return(true, nil).Once()
+		_, err := service.ParseAccessToken(ctx, tokens.AccessToken)
+		assert.ErrorIs(t, err, auth.ErrTokenRevoked)
+	})
+
+	t.Run("истёкший токен", func(t *testing.T) {
+		later := auth.NewService(store, testutils.HMACKeyring(secret), time.Minute, time.Hour)
+		later.SetClock(func() time.Time { return now.Add(2 * time.Minute) })
+		_, err := later.ParseAccessToken(ctx, tokens.AccessToken)
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+
+	t.Run("чужая подпись", func(t *testing.T) {
+		other := auth.NewService(store, testutils.HMACKeyring("other-secret"), time.Minute, time.Hour)
+		_, err := other.ParseAccessToken(ctx, tokens.AccessToken)
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+
+	t.Run("алгоритм none", func(t *testing.T) {
+		unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, auth.Claims{
+			UserID:           1,
+			SessionID:        "family",
+			RegisteredClaims: jwt.RegisteredClaims{ID: "jti", ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute))},
+		})
+		tokenString, err := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+		require.NoError(t, err)
+		_, err = service.ParseAccessToken(ctx, tokenString)
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+}
+
+func TestLogout(t *testing.T) {
+	ctx := context.Background()
+	exp := time.Now().Add(time.Minute).Truncate(time.Second)
+
+	store := &testutils.MockTokenStore{}
+	store.On("RevokeAccessToken", mock.Anything, "jti", exp).Return(nil)
+	store.On("RevokeTokenFamily", mock.Anything, "family").Return(nil)
+
+	service := auth.NewService(store, testutils.HMACKeyring(secret), time.Minute, time.Hour)
+	err := service.Logout(ctx, auth.Claims{
+		UserID:           1,
+		SessionID:        "family",
+		RegisteredClaims: jwt.RegisteredClaims{ID: "jti", ExpiresAt: jwt.NewNumericDate(exp)},
+	})
+
+	assert.NoError(t, err)
+	store.AssertExpectations(t)
+}
+
+func TestPruneExpired(t *testing.T) {
+	store := &testutils.MockTokenStore{}
+	pruned := make(chan struct{}, 1)
+	store.On("PruneExpiredTokens", mock.Anything).Return(int64(3), nil).
+		Run(func(mock.Arguments) {
+			select {
+			case pruned <- struct{}{}:
+			default:
+			}
+		})
+
+	service := auth.NewService(store, testutils.HMACKeyring(secret), time.Minute, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		service.PruneExpired(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	select {
+	case <-pruned:
+	case <-time.After(time.Second):
+		t.Fatal("Expected expired tokens to be pruned")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected PruneExpired to return once the context is cancelled")
+	}
+}
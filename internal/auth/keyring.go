@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultKeyID is the kid of the key built from JWT_SECRET. Tokens without a
+// kid header were signed before key rotation existed and are verified with it.
+const DefaultKeyID = "default"
+
+var ErrNoSigningKey = errors.New("no signing key configured")
+
+// validMethods are the only algorithms accepted in access tokens.
+var validMethods = []string{
+	jwt.SigningMethodHS256.Alg(),
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+}
+
+// Key is a named verification key, optionally with its signing half. Keys
+// without a signing half are only accepted, which lets a new key be published
+// before any replica starts signing with it.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+func (k Key) canSign() bool {
+	return k.signKey != nil
+}
+
+func (k Key) public() bool {
+	return k.Method != jwt.SigningMethodHS256
+}
+
+func NewHMACKey(id string, secret []byte) Key {
+	return Key{ID: id, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+// ParsePEMKey reads an RSA or Ed25519 key. A private key (PKCS#1 or PKCS#8)
+// can sign and verify; a public key (PKIX) can only verify.
+func ParsePEMKey(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("key %s: no PEM block found", id)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return Key{}, fmt.Errorf("key %s: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("key %s: %w", id, err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return Key{ID: id, Method: jwt.SigningMethodRS256, signKey: k, verifyKey: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return Key{ID: id, Method: jwt.SigningMethodRS256, verifyKey: k}, nil
+	case ed25519.PrivateKey:
+		return Key{ID: id, Method: jwt.SigningMethodEdDSA, signKey: k, verifyKey: k.Public()}, nil
+	case ed25519.PublicKey:
+		return Key{ID: id, Method: jwt.SigningMethodEdDSA, verifyKey: k}, nil
+	default:
+		return Key{}, fmt.Errorf("key %s: unsupported key type %T", id, parsed)
+	}
+}
+
+// Keyring holds every key that access tokens may be verified with and the
+// one new tokens are signed with. It is safe for concurrent use and can be
+// swapped at runtime with Replace.
+type Keyring struct {
+	mu        sync.RWMutex
+	keys      map[string]Key
+	signingID string
+}
+
+// NewKeyring builds a keyring from keys. When signingID is empty the last key
+// in keys that can sign is used.
+func NewKeyring(keys []Key, signingID string) (*Keyring, error) {
+	k := &Keyring{}
+	if err := k.Replace(keys, signingID); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Replace atomically swaps the key set. On error the keyring is unchanged.
+func (k *Keyring) Replace(keys []Key, signingID string) error {
+	byID := make(map[string]Key, len(keys))
+	for _, key := range keys {
+		if key.ID == "" {
+			return errors.New("key id is empty")
+		}
+		if _, ok := byID[key.ID]; ok {
+			return fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		byID[key.ID] = key
+	}
+
+	chosen := signingID
+	if chosen == "" {
+		for i := len(keys) - 1; i >= 0; i-- {
+			if keys[i].canSign() {
+				chosen = keys[i].ID
+				break
+			}
+		}
+	}
+	signer, ok := byID[chosen]
+	if !ok || !signer.canSign() {
+		if chosen == "" {
+			return ErrNoSigningKey
+		}
+		return fmt.Errorf("%w: key %q is missing or has no private part", ErrNoSigningKey, chosen)
+	}
+
+	k.mu.Lock()
+	k.keys = byID
+	k.signingID = chosen
+	k.mu.Unlock()
+	return nil
+}
+
+// SigningKeyID returns the kid new tokens are signed with.
+func (k *Keyring) SigningKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.signingID
+}
+
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	key := k.keys[k.signingID]
+	k.mu.RUnlock()
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
+}
+
+// keyFunc picks the verification key named by the token's kid and refuses
+// tokens whose alg does not match that key.
+func (k *Keyring) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = DefaultKeyID
+	}
+
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("key %q does not accept alg %s", kid, token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
+
+// JWK is a public key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the keyring, sorted by kid. HMAC keys are
+// secret and never published.
+func (k *Keyring) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range k.keys {
+		if !key.public() {
+			continue
+		}
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
@@ -0,0 +1,235 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/auth"
+	"github.com/AlenaMolokova/diploma/internal/testutils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func rsaPEM(t *testing.T) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func ed25519PEM(t *testing.T) (private, public []byte) {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+}
+
+func newKeyringService(t *testing.T, keys *auth.Keyring) (*auth.Service, *testutils.MockTokenStore) {
+	t.Helper()
+	store := &testutils.MockTokenStore{}
+	store.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+	store.On("GetUserRole", mock.Anything, mock.Anything).Return("user", nil)
+	store.On("IsTokenRevoked", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	return auth.NewService(store, keys, time.Minute, time.Hour), store
+}
+
+func tokenHeader(t *testing.T, tokenString string) map[string]interface{} {
+	t.Helper()
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &auth.Claims{})
+	require.NoError(t, err)
+	return token.Header
+}
+
+func TestKeyringAlgorithms(t *testing.T) {
+	ctx := context.Background()
+	edPrivate, _ := ed25519PEM(t)
+
+	tests := []struct {
+		name string
+		pem  []byte
+		alg  string
+	}{
+		{name: "RS256", pem: rsaPEM(t), alg: "RS256"},
+		{name: "EdDSA", pem: edPrivate, alg: "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := auth.ParsePEMKey("k1", tt.pem)
+			require.NoError(t, err)
+			keys, err := auth.NewKeyring([]auth.Key{key}, "")
+			require.NoError(t, err)
+			service, _ := newKeyringService(t, keys)
+
+			tokens, err := service.IssueTokens(ctx, 5)
+			require.NoError(t, err)
+
+			header := tokenHeader(t, tokens.AccessToken)
+			assert.Equal(t, tt.alg, header["alg"])
+			assert.Equal(t, "k1", header["kid"])
+
+			claims, err := service.ParseAccessToken(ctx, tokens.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, int64(5), claims.UserID)
+		})
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	ctx := context.Background()
+
+	oldKey, err := auth.ParsePEMKey("2024-01", rsaPEM(t))
+	require.NoError(t, err)
+	newKey, err := auth.ParsePEMKey("2024-02", rsaPEM(t))
+	require.NoError(t, err)
+
+	keys, err := auth.NewKeyring([]auth.Key{oldKey}, "")
+	require.NoError(t, err)
+	service, _ := newKeyringService(t, keys)
+
+	oldTokens, err := service.IssueTokens(ctx, 1)
+	require.NoError(t, err)
+
+	require.NoError(t, keys.Replace([]auth.Key{oldKey, newKey}, ""))
+	assert.Equal(t, "2024-02", keys.SigningKeyID())
+
+	newTokens, err := service.IssueTokens(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-02", tokenHeader(t, newTokens.AccessToken)["kid"])
+
+	_, err = service.ParseAccessToken(ctx, oldTokens.AccessToken)
+	assert.NoError(t, err, "tokens of the previous key stay valid while it is in the keyring")
+
+	require.NoError(t, keys.Replace([]auth.Key{newKey}, ""))
+	_, err = service.ParseAccessToken(ctx, oldTokens.AccessToken)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	_, err = service.ParseAccessToken(ctx, newTokens.AccessToken)
+	assert.NoError(t, err)
+}
+
+func TestKeyringRejectsMismatchedAlg(t *testing.T) {
+	ctx := context.Background()
+	_, edPublic := ed25519PEM(t)
+
+	rsaKey, err := auth.ParsePEMKey("rsa", rsaPEM(t))
+	require.NoError(t, err)
+	keys, err := auth.NewKeyring([]auth.Key{rsaKey, auth.NewHMACKey(auth.DefaultKeyID, []byte("secret"))}, "rsa")
+	require.NoError(t, err)
+	service, _ := newKeyringService(t, keys)
+
+	claims := auth.Claims{
+		UserID:           1,
+		SessionID:        "family",
+		RegisteredClaims: jwt.RegisteredClaims{ID: "jti", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	}
+
+	// An HS256 token claiming to be signed by the RSA key must not be checked
+	// with the RSA key's public material.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = "rsa"
+	forgedString, err := forged.SignedString(edPublic)
+	require.NoError(t, err)
+	_, err = service.ParseAccessToken(ctx, forgedString)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	unknown.Header["kid"] = "missing"
+	unknownString, err := unknown.SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = service.ParseAccessToken(ctx, unknownString)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = service.ParseAccessToken(ctx, legacy)
+	assert.NoError(t, err, "tokens without kid are checked with the default key")
+}
+
+func TestKeyringRequiresSigningKey(t *testing.T) {
+	_, edPublic := ed25519PEM(t)
+	publicOnly, err := auth.ParsePEMKey("next", edPublic)
+	require.NoError(t, err)
+
+	_, err = auth.NewKeyring([]auth.Key{publicOnly}, "")
+	assert.ErrorIs(t, err, auth.ErrNoSigningKey)
+
+	_, err = auth.NewKeyring([]auth.Key{auth.NewHMACKey("a", []byte("secret")), publicOnly}, "next")
+	assert.ErrorIs(t, err, auth.ErrNoSigningKey)
+
+	_, err = auth.NewKeyring([]auth.Key{auth.NewHMACKey("a", []byte("x")), auth.NewHMACKey("a", []byte("y"))}, "")
+	assert.Error(t, err)
+}
+
+func TestJWKS(t *testing.T) {
+	edPrivate, edPublic := ed25519PEM(t)
+	rsaKey, err := auth.ParsePEMKey("rsa", rsaPEM(t))
+	require.NoError(t, err)
+	edKey, err := auth.ParsePEMKey("ed", edPrivate)
+	require.NoError(t, err)
+	nextKey, err := auth.ParsePEMKey("next", edPublic)
+	require.NoError(t, err)
+
+	keys, err := auth.NewKeyring([]auth.Key{auth.NewHMACKey(auth.DefaultKeyID, []byte("secret")), rsaKey, edKey, nextKey}, "rsa")
+	require.NoError(t, err)
+
+	set := keys.JWKS()
+	require.Len(t, set.Keys, 3, "HMAC keys are never published")
+
+	assert.Equal(t, "ed", set.Keys[0].Kid)
+	assert.Equal(t, "OKP", set.Keys[0].Kty)
+	assert.Equal(t, "Ed25519", set.Keys[0].Crv)
+	assert.Equal(t, "EdDSA", set.Keys[0].Alg)
+	assert.NotEmpty(t, set.Keys[0].X)
+
+	assert.Equal(t, "next", set.Keys[1].Kid)
+
+	assert.Equal(t, "rsa", set.Keys[2].Kid)
+	assert.Equal(t, "RSA", set.Keys[2].Kty)
+	assert.Equal(t, "RS256", set.Keys[2].Alg)
+	assert.Equal(t, "AQAB", set.Keys[2].E)
+	assert.NotEmpty(t, set.Keys[2].N)
+}
+
+func TestLoadKeys(t *testing.T) {
+	dir := t.TempDir()
+	edPrivate, edPublic := ed25519PEM(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2024-01.pem"), rsaPEM(t), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2024-02.pem"), edPrivate, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2024-03.pem"), edPublic, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hmac.key"), []byte("dir-secret\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("ignored"), 0o600))
+
+	src := auth.KeySource{Secret: "env-secret", Dir: dir}
+	keys, err := auth.LoadKeyring(src)
+	require.NoError(t, err)
+	assert.Equal(t, "hmac", keys.SigningKeyID(), "the last signing key in name order wins")
+	assert.Len(t, keys.JWKS().Keys, 3)
+
+	src.SigningKeyID = "2024-02"
+	require.NoError(t, keys.Reload(src))
+	assert.Equal(t, "2024-02", keys.SigningKeyID())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.pem"), []byte("not a key"), 0o600))
+	assert.Error(t, keys.Reload(src))
+	assert.Equal(t, "2024-02", keys.SigningKeyID(), "a failed reload keeps the current keys")
+
+	_, err = auth.LoadKeyring(auth.KeySource{PrivateKey: "garbage", PrivateKeyID: "primary"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// KeySource says where the signing keys come from. Keys are loaded in order:
+// Secret, PrivateKey, then the files of Dir sorted by name, so unless
+// SigningKeyID is set new tokens are signed with the last private key in Dir.
+// Naming key files by date therefore makes the newest key the signing one.
+type KeySource struct {
+	// Secret is an HS256 secret, loaded with DefaultKeyID.
+	Secret string
+	// PrivateKey is a PEM encoded RSA or Ed25519 key, loaded with PrivateKeyID.
+	PrivateKey   string
+	PrivateKeyID string
+	// Dir holds <kid>.pem files with RSA or Ed25519 keys and <kid>.key files
+	// with HS256 secrets. A .pem file with only a public key is accepted for
+	// verification but never used for signing.
+	Dir          string
+	SigningKeyID string
+}
+
+func LoadKeys(src KeySource) ([]Key, error) {
+	var keys []Key
+	if src.Secret != "" {
+		keys = append(keys, NewHMACKey(DefaultKeyID, []byte(src.Secret)))
+	}
+	if src.PrivateKey != "" {
+		key, err := ParsePEMKey(src.PrivateKeyID, []byte(src.PrivateKey))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if src.Dir == "" {
+		return keys, nil
+	}
+
+	entries, err := os.ReadDir(src.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(entry.Name())
+		if ext != ".pem" && ext != ".key" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(src.Dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+
+		id := strings.TrimSuffix(entry.Name(), ext)
+		if ext == ".key" {
+			keys = append(keys, NewHMACKey(id, bytes.TrimSpace(data)))
+			continue
+		}
+		key, err := ParsePEMKey(id, data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// LoadKeyring builds a keyring from src.
+func LoadKeyring(src KeySource) (*Keyring, error) {
+	keys, err := LoadKeys(src)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(keys, src.SigningKeyID)
+}
+
+// Reload re-reads src and swaps the key set. If src cannot be loaded the
+// current keys stay in place.
+func (k *Keyring) Reload(src KeySource) error {
+	keys, err := LoadKeys(src)
+	if err != nil {
+		return err
+	}
+	return k.Replace(keys, src.SigningKeyID)
+}
+
+// Watch reloads the keyring from src every interval until ctx is done, so
+// keys can be added to and removed from the key directory without a restart.
+func (k *Keyring) Watch(ctx context.Context, src KeySource, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			previous := k.SigningKeyID()
+			if err := k.Reload(src); err != nil {
+				slog.ErrorContext(ctx, "Failed to reload signing keys, keeping the current ones", slog.Any("error", err))
+				continue
+			}
+			if current := k.SigningKeyID(); current != previous {
+				slog.InfoContext(ctx, "Signing key rotated", slog.String("from", previous), slog.String("to", current))
+			}
+		}
+	}
+}
@@ -2,9 +2,12 @@ package config
 
 import (
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/logging"
 	"github.com/caarlos0/env/v11"
 )
 
@@ -12,28 +15,142 @@ type Config struct {
 	RunAddr         string `env:"RUN_ADDRESS" envDefault:":8080"`
 	DatabaseURI     string `env:"DATABASE_URI"`
 	AccrualAddr     string `env:"ACCRUAL_SYSTEM_ADDRESS" envDefault:"http://localhost:8081"`
-	JWTSecret       string `env:"JWT_SECRET" envDefault:"supersecretkey"`
+	JWTSecret       string `env:"JWT_SECRET"`
 	PollIntervalSec int    `env:"POLL_INTERVAL" envDefault:"5"`
+	AccrualWorkers  int    `env:"ACCRUAL_WORKERS" envDefault:"4"`
+	AccrualBatch    int    `env:"ACCRUAL_BATCH_SIZE" envDefault:"100"`
+	AccrualAttempts int    `env:"ACCRUAL_MAX_ATTEMPTS" envDefault:"20"`
+	AccrualNotFound int    `env:"ACCRUAL_MAX_NOT_FOUND" envDefault:"10"`
+	ShutdownSec     int    `env:"SHUTDOWN_TIMEOUT" envDefault:"10"`
+	DrainSec        int    `env:"DRAIN_DELAY" envDefault:"5"`
+
+	AccessTokenTTL  time.Duration `env:"ACCESS_TOKEN_TTL" envDefault:"15m"`
+	RefreshTokenTTL time.Duration `env:"REFRESH_TOKEN_TTL" envDefault:"720h"`
+	TokenPrune      time.Duration `env:"TOKEN_PRUNE_INTERVAL" envDefault:"1h"`
+
+	JWTPrivateKey   string        `env:"JWT_PRIVATE_KEY"`
+	JWTPrivateKeyID string        `env:"JWT_PRIVATE_KEY_ID" envDefault:"primary"`
+	JWTKeysDir      string        `env:"JWT_KEYS_DIR"`
+	JWTSigningKeyID string        `env:"JWT_SIGNING_KEY_ID"`
+	JWTKeysReload   time.Duration `env:"JWT_KEYS_RELOAD" envDefault:"1m"`
+
+	DevMode bool `env:"DEV_MODE"`
+
+	LoginMaxFailures   int           `env:"LOGIN_MAX_FAILURES" envDefault:"10"`
+	LoginIPMaxFailures int           `env:"LOGIN_IP_MAX_FAILURES" envDefault:"50"`
+	LoginDelayAfter    int           `env:"LOGIN_DELAY_AFTER" envDefault:"3"`
+	LoginBaseDelay     time.Duration `env:"LOGIN_BASE_DELAY" envDefault:"1s"`
+	LoginLockout       time.Duration `env:"LOGIN_LOCKOUT" envDefault:"15m"`
+	LoginWindow        time.Duration `env:"LOGIN_FAILURE_WINDOW" envDefault:"15m"`
+	TrustProxyHeaders  bool          `env:"TRUST_PROXY_HEADERS"`
+
+	PasswordMinLength  int           `env:"PASSWORD_MIN_LENGTH" envDefault:"8"`
+	PasswordMaxLength  int           `env:"PASSWORD_MAX_LENGTH" envDefault:"72"`
+	PasswordMinClasses int           `env:"PASSWORD_MIN_CLASSES" envDefault:"1"`
+	PasswordBannedFile string        `env:"PASSWORD_BANNED_FILE"`
+	PasswordAllowLogin bool          `env:"PASSWORD_ALLOW_LOGIN"`
+	PasswordResetTTL   time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"1h"`
+
+	LogLevel  string `env:"LOG_LEVEL" envDefault:"info"`
+	LogFormat string `env:"LOG_FORMAT" envDefault:"text"`
+
+	TraceExporter string `env:"TRACE_EXPORTER" envDefault:"none"`
+
+	WebhookInterval     time.Duration `env:"WEBHOOK_INTERVAL" envDefault:"5s"`
+	WebhookTimeout      time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"10s"`
+	WebhookAttempts     int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"10"`
+	WebhookAllowPrivate bool          `env:"WEBHOOK_ALLOW_PRIVATE"`
 }
 
 func NewConfig() (*Config, error) {
 	cfg := &Config{
-		JWTSecret:       constants.DefaultJWTSecret,
 		PollIntervalSec: constants.DefaultPollInterval,
+		AccrualWorkers:  constants.DefaultAccrualWorkers,
+		AccrualBatch:    constants.DefaultAccrualBatchSize,
+		AccrualAttempts: constants.DefaultAccrualAttempts,
+		AccrualNotFound: constants.DefaultAccrualNotFound,
+		ShutdownSec:     constants.DefaultShutdownTimeout,
+		DrainSec:        constants.DefaultDrainDelay,
+		AccessTokenTTL:  constants.DefaultAccessTokenTTL,
+		RefreshTokenTTL: constants.DefaultRefreshTokenTTL,
+		TokenPrune:      constants.DefaultTokenPruneInterval,
+		JWTPrivateKeyID: constants.DefaultJWTPrivateKeyID,
+		JWTKeysReload:   constants.DefaultJWTKeysReload,
+
+		LoginMaxFailures:   constants.DefaultLoginMaxFailures,
+		LoginIPMaxFailures: constants.DefaultLoginIPMaxFailures,
+		LoginDelayAfter:    constants.DefaultLoginDelayAfter,
+		LoginBaseDelay:     constants.DefaultLoginBaseDelay,
+		LoginLockout:       constants.DefaultLoginLockout,
+		LoginWindow:        constants.DefaultLoginWindow,
+
+		PasswordMinLength:  constants.DefaultPasswordMinLength,
+		PasswordMaxLength:  constants.DefaultPasswordMaxLength,
+		PasswordMinClasses: constants.DefaultPasswordMinClasses,
+		PasswordResetTTL:   constants.DefaultPasswordResetTTL,
+
+		LogLevel:  constants.DefaultLogLevel,
+		LogFormat: constants.DefaultLogFormat,
+
+		TraceExporter: constants.DefaultTraceExporter,
+
+		WebhookInterval: constants.DefaultWebhookInterval,
+		WebhookTimeout:  constants.DefaultWebhookTimeout,
+		WebhookAttempts: constants.DefaultWebhookAttempts,
 	}
 
 	if err := env.Parse(cfg); err != nil {
-		log.Printf("Failed to parse environment variables: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("failed to parse environment variables: %w", err)
 	}
 
-	log.Printf("Config loaded: RunAddr=%s, DatabaseURI=%s, AccrualAddr=%s, PollInterval=%ds",
-		cfg.RunAddr, cfg.DatabaseURI, cfg.AccrualAddr, cfg.PollIntervalSec)
-
 	if cfg.DatabaseURI == "" {
-		log.Printf("Error: DATABASE_URI is empty")
 		return nil, errors.New("DATABASE_URI is required")
 	}
 
+	if err := cfg.checkSigningKeys(); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
+
+// checkSigningKeys refuses the well-known default secret, and falls back to
+// it only in dev mode when no other key is configured. The caller warns about
+// the insecure default once logging is set up, see InsecureSecret.
+func (c *Config) checkSigningKeys() error {
+	if c.JWTSecret == constants.DefaultJWTSecret && !c.DevMode {
+		return errors.New("JWT_SECRET is set to the insecure default, set DEV_MODE to allow it")
+	}
+	if c.JWTSecret != "" || c.JWTPrivateKey != "" || c.JWTKeysDir != "" {
+		return nil
+	}
+	if !c.DevMode {
+		return errors.New("one of JWT_SECRET, JWT_PRIVATE_KEY or JWT_KEYS_DIR is required")
+	}
+	c.JWTSecret = constants.DefaultJWTSecret
+	return nil
+}
+
+// InsecureSecret reports whether tokens are signed with the well-known
+// default secret, which is only allowed in dev mode.
+func (c *Config) InsecureSecret() bool {
+	return c.JWTSecret == constants.DefaultJWTSecret
+}
+
+// LogValue lists the settings worth logging at startup. The database password
+// and signing keys are left out.
+func (c *Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("run_address", c.RunAddr),
+		slog.String("database", logging.RedactDSN(c.DatabaseURI)),
+		slog.String("accrual_address", c.AccrualAddr),
+		slog.Int("poll_interval_sec", c.PollIntervalSec),
+		slog.Int("accrual_workers", c.AccrualWorkers),
+		slog.Int("accrual_batch", c.AccrualBatch),
+		slog.String("log_level", c.LogLevel),
+		slog.String("log_format", c.LogFormat),
+		slog.String("trace_exporter", c.TraceExporter),
+		slog.Duration("webhook_interval", c.WebhookInterval),
+		slog.Bool("webhook_allow_private", c.WebhookAllowPrivate),
+	)
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConfigSigningKeys(t *testing.T) {
+	tests := []struct {
+		name           string
+		env            map[string]string
+		expectedErr    bool
+		expectedSecret string
+	}{
+		{
+			name:        "ключ не задан",
+			env:         map[string]string{},
+			expectedErr: true,
+		},
+		{
+			name:        "секрет по умолчанию без DEV_MODE",
+			env:         map[string]string{"JWT_SECRET": constants.DefaultJWTSecret},
+			expectedErr: true,
+		},
+		{
+			name:           "секрет по умолчанию в DEV_MODE",
+			env:            map[string]string{"JWT_SECRET": constants.DefaultJWTSecret, "DEV_MODE": "true"},
+			expectedSecret: constants.DefaultJWTSecret,
+		},
+		{
+			name:           "DEV_MODE без ключей",
+			env:            map[string]string{"DEV_MODE": "true"},
+			expectedSecret: constants.DefaultJWTSecret,
+		},
+		{
+			name:           "собственный секрет",
+			env:            map[string]string{"JWT_SECRET": "production-secret"},
+			expectedSecret: "production-secret",
+		},
+		{
+			name: "каталог ключей",
+			env:  map[string]string{"JWT_KEYS_DIR": "/etc/gophermart/keys"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DATABASE_URI", "postgres://localhost/test")
+			for _, name := range []string{"JWT_SECRET", "JWT_PRIVATE_KEY", "JWT_KEYS_DIR", "DEV_MODE"} {
+				t.Setenv(name, "")
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := NewConfig()
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedSecret, cfg.JWTSecret)
+		})
+	}
+}
+
+func TestConfigLogValue(t *testing.T) {
+	cfg := &Config{
+		RunAddr:     ":8080",
+		DatabaseURI: "postgres://gophermart:s3cret@db/gophermart",
+		JWTSecret:   "production-secret",
+	}
+
+	value := cfg.LogValue().String()
+
+	assert.Contains(t, value, "db/gophermart")
+	assert.NotContains(t, value, "s3cret")
+	assert.NotContains(t, value, "production-secret")
+}
@@ -1,5 +1,7 @@
 package constants
 
+import "time"
+
 const (
 	StatusNew        = "NEW"
 	StatusRegistered = "REGISTERED"
@@ -9,6 +11,148 @@ const (
 )
 
 const (
-	DefaultPollInterval = 5 
-	DefaultJWTSecret    = "supersecretkey"
-)
\ No newline at end of file
+	LedgerKindOpening    = "opening"
+	LedgerKindAccrual    = "accrual"
+	LedgerKindWithdrawal = "withdrawal"
+	LedgerKindAdjustment = "adjustment"
+)
+
+const (
+	JobStatePending = "pending"
+	JobStateDone    = "done"
+	JobStateDead    = "dead"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Audit actions. Admin actions are prefixed with "admin.".
+const (
+	AuditUserRegister       = "user.register"
+	AuditUserLogin          = "user.login"
+	AuditUserLoginFailed    = "user.login_failed"
+	AuditUserPasswordChange = "user.password_change"
+	AuditUserPasswordReset  = "user.password_reset"
+	AuditOrderUpload        = "order.upload"
+	AuditOrderStatus        = "order.status"
+	AuditBalanceAccrual     = "balance.accrual"
+	AuditBalanceWithdrawal  = "balance.withdrawal"
+	AuditWebhookCreate      = "webhook.create"
+	AuditWebhookDelete      = "webhook.delete"
+
+	AuditAdminUserLookup      = "admin.user.lookup"
+	AuditAdminUserOrders      = "admin.user.orders"
+	AuditAdminUserWithdrawals = "admin.user.withdrawals"
+	AuditAdminOrderAccrual    = "admin.order.accrual"
+	AuditAdminBalanceAdjust   = "admin.balance.adjust"
+	AuditAdminAuditList       = "admin.audit.list"
+	AuditAdminWebhookCreate   = "admin.webhook.create"
+	AuditAdminWebhookDelete   = "admin.webhook.delete"
+)
+
+const (
+	DefaultPollInterval     = 5
+	DefaultAccrualWorkers   = 4
+	DefaultAccrualBatchSize = 100
+	DefaultAccrualAttempts  = 20
+	DefaultAccrualNotFound  = 10
+	DefaultShutdownTimeout  = 10
+	DefaultDrainDelay       = 5
+	DefaultJWTSecret        = "supersecretkey"
+)
+
+const (
+	DefaultAuditPageSize = 50
+	MaxAuditPageSize     = 500
+)
+
+// Outcomes of uploading one number of an order batch. They match the
+// responses to a single upload: 202, 200, 409 and 422.
+const (
+	UploadAccepted        = "accepted"
+	UploadAlreadyUploaded = "already_uploaded"
+	UploadOwnedByOther    = "owned_by_other_user"
+	UploadInvalid         = "invalid"
+)
+
+// Kinds of entries in the status history of an order.
+const (
+	HistoryStatusChange = "status_change"
+	HistoryAccrualCheck = "accrual_check"
+)
+
+// Outcomes of one check of an order by the accrual poller. A check that got
+// the order's status back is CheckAccrual; the others are named after the
+// response code, or CheckError when there was no usable response.
+const (
+	CheckAccrual     = "accrual"
+	CheckNoContent   = "204"
+	CheckNotFound    = "404"
+	CheckRateLimited = "429"
+	CheckError       = "error"
+)
+
+// Kinds of the events pushed to a user's event stream.
+const (
+	EventOrder   = "order"
+	EventBalance = "balance"
+)
+
+// Events webhooks can subscribe to.
+const (
+	WebhookOrderProcessed    = "order.processed"
+	WebhookWithdrawalCreated = "withdrawal.created"
+)
+
+const (
+	DefaultWebhookInterval = 5 * time.Second
+	DefaultWebhookTimeout  = 10 * time.Second
+	DefaultWebhookWorkers  = 4
+	DefaultWebhookAttempts = 10
+	DefaultWebhookLogSize  = 50
+	MaxWebhookLogSize      = 500
+	// MaxWebhooksPerUser caps the live webhooks of a user. Global webhooks,
+	// which only admins create, are not capped.
+	MaxWebhooksPerUser = 10
+)
+
+// MaxOrderBatchSize caps the number of orders in one batch upload.
+const MaxOrderBatchSize = 1000
+
+// MaxListPageSize caps the limit of the orders and withdrawals listings.
+const MaxListPageSize = 1000
+
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+	DefaultJWTKeysReload   = time.Minute
+	// DefaultTokenPruneInterval is how often expired tokens are deleted.
+	DefaultTokenPruneInterval = time.Hour
+)
+
+const DefaultJWTPrivateKeyID = "primary"
+
+const (
+	DefaultLoginMaxFailures   = 10
+	DefaultLoginIPMaxFailures = 50
+	DefaultLoginDelayAfter    = 3
+	DefaultLoginBaseDelay     = time.Second
+	DefaultLoginLockout       = 15 * time.Minute
+	DefaultLoginWindow        = 15 * time.Minute
+)
+
+const (
+	DefaultPasswordMinLength  = 8
+	DefaultPasswordMaxLength  = 72
+	DefaultPasswordMinClasses = 1
+	DefaultPasswordResetTTL   = time.Hour
+)
+
+const (
+	DefaultLogLevel  = "info"
+	DefaultLogFormat = "text"
+)
+
+const DefaultTraceExporter = "none"
@@ -0,0 +1,146 @@
+// Package events fans the user events of every replica out to the event
+// streams open on this one.
+package events
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/models"
+)
+
+const (
+	// streamBuffer is how many events a stream may fall behind before it is
+	// closed.
+	streamBuffer = 16
+	// minRetryDelay and maxRetryDelay bound the wait before listening again
+	// after the listener failed.
+	minRetryDelay = time.Second
+	maxRetryDelay = 30 * time.Second
+)
+
+// Source delivers the user events of every replica, as storage.Storage does
+// with Postgres notifications.
+type Source interface {
+	ListenUserEvents(ctx context.Context, fn func(models.UserEvent)) error
+}
+
+type Hub struct {
+	mu      sync.Mutex
+	streams map[int64]map[chan models.UserEvent]struct{}
+	closed  bool
+	logger  *slog.Logger
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		streams: map[int64]map[chan models.UserEvent]struct{}{},
+		logger:  slog.Default(),
+	}
+}
+
+func (h *Hub) SetLogger(logger *slog.Logger) {
+	h.logger = logger
+}
+
+// Subscribe opens a stream of userID's events. The hub closes the channel
+// when the stream falls too far behind, when events may have been lost while
+// the listener reconnected, and on Close; the subscriber should then reload
+// what it shows. cancel ends the subscription and may be called at any time.
+func (h *Hub) Subscribe(userID int64) (events <-chan models.UserEvent, cancel func()) {
+	ch := make(chan models.UserEvent, streamBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if h.streams[userID] == nil {
+		h.streams[userID] = map[chan models.UserEvent]struct{}{}
+	}
+	h.streams[userID][ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.drop(userID, ch)
+	}
+}
+
+// Publish hands event to the streams of its user without waiting for them.
+func (h *Hub) Publish(event models.UserEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.streams[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			h.logger.Warn("Closing lagging event stream", slog.Int64("user_id", event.UserID))
+			h.drop(event.UserID, ch)
+		}
+	}
+}
+
+// Run publishes the events from source until ctx is done. When the listener
+// fails it listens again after a growing delay, and closes every open stream,
+// since events sent in between are lost.
+func (h *Hub) Run(ctx context.Context, source Source) {
+	delay := minRetryDelay
+	for {
+		started := time.Now()
+		err := source.ListenUserEvents(ctx, h.Publish)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > maxRetryDelay {
+			delay = minRetryDelay
+		}
+		h.logger.ErrorContext(ctx, "User events listener failed",
+			slog.Any("error", err), slog.Duration("retry_in", delay))
+		h.dropAll()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		delay = min(2*delay, maxRetryDelay)
+	}
+}
+
+// Close ends every open stream, and the ones opened later right away. It lets
+// a shutting-down server finish the requests that serve them.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+	h.dropAll()
+}
+
+func (h *Hub) dropAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for userID, streams := range h.streams {
+		for ch := range streams {
+			h.drop(userID, ch)
+		}
+	}
+}
+
+// drop closes the stream unless it is already gone. h.mu must be held.
+func (h *Hub) drop(userID int64, ch chan models.UserEvent) {
+	streams := h.streams[userID]
+	if _, ok := streams[ch]; !ok {
+		return
+	}
+	delete(streams, ch)
+	close(ch)
+	if len(streams) == 0 {
+		delete(h.streams, userID)
+	}
+}
@@ -0,0 +1,132 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHub() *Hub {
+	hub := NewHub()
+	hub.SetLogger(logging.Discard())
+	return hub
+}
+
+func TestHubDeliversToUserStreams(t *testing.T) {
+	hub := newTestHub()
+	first, cancelFirst := hub.Subscribe(1)
+	defer cancelFirst()
+	second, cancelSecond := hub.Subscribe(1)
+	defer cancelSecond()
+	other, cancelOther := hub.Subscribe(2)
+	defer cancelOther()
+
+	event := models.UserEvent{UserID: 1, Kind: constants.EventBalance}
+	hub.Publish(event)
+
+	assert.Equal(t, event, <-first)
+	assert.Equal(t, event, <-second)
+	assert.Empty(t, other, "события другого пользователя не доставляются")
+}
+
+func TestHubCancel(t *testing.T) {
+	hub := newTestHub()
+	events, cancel := hub.Subscribe(1)
+	cancel()
+	cancel()
+
+	_, ok := <-events
+	assert.False(t, ok)
+	hub.Publish(models.UserEvent{UserID: 1})
+}
+
+func TestHubClosesLaggingStream(t *testing.T) {
+	hub := newTestHub()
+	events, cancel := hub.Subscribe(1)
+	defer cancel()
+
+	for i := 0; i <= streamBuffer; i++ {
+		hub.Publish(models.UserEvent{UserID: 1})
+	}
+
+	received := 0
+	for range events {
+		received++
+	}
+	assert.Equal(t, streamBuffer, received)
+}
+
+func TestHubClose(t *testing.T) {
+	hub := newTestHub()
+	open, cancel := hub.Subscribe(1)
+	defer cancel()
+
+	hub.Close()
+	_, ok := <-open
+	assert.False(t, ok)
+
+	late, cancelLate := hub.Subscribe(1)
+	defer cancelLate()
+	_, ok = <-late
+	assert.False(t, ok, "после Close потоки закрываются сразу")
+}
+
+type fakeSource struct {
+	listens atomic.Int32
+	failed  chan struct{}
+}
+
+// ListenUserEvents fails the first time and then delivers one event and
+// waits for ctx.
+func (s *fakeSource) ListenUserEvents(ctx context.Context, fn func(models.UserEvent)) error {
+	if s.listens.Add(1) == 1 {
+		<-s.failed
+		return errors.New("connection reset")
+	}
+	fn(models.UserEvent{UserID: 1, Kind: constants.EventOrder})
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestHubRunReconnects(t *testing.T) {
+	hub := newTestHub()
+	source := &fakeSource{failed: make(chan struct{})}
+	before, cancelBefore := hub.Subscribe(1)
+	defer cancelBefore()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		hub.Run(ctx, source)
+		close(done)
+	}()
+
+	close(source.failed)
+	_, ok := <-before
+	assert.False(t, ok, "потоки закрываются, когда события могли потеряться")
+
+	after, cancelAfter := hub.Subscribe(1)
+	defer cancelAfter()
+	select {
+	case event := <-after:
+		assert.Equal(t, constants.EventOrder, event.Kind)
+	case <-time.After(3 * minRetryDelay):
+		t.Fatal("Expected the hub to listen again")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Run to return once the context is cancelled")
+	}
+	require.Equal(t, int32(2), source.listens.Load())
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/AlenaMolokova/diploma/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// URL parameters of the admin and order routes.
+const (
+	UserIDParam      = "userID"
+	OrderNumberParam = "number"
+)
+
+type AdminService interface {
+	GetUser(ctx context.Context, actorID, userID int64) (models.UserAccount, error)
+	FindUser(ctx context.Context, actorID int64, login string) (models.UserAccount, error)
+	GetUserOrders(ctx context.Context, actorID, userID int64) ([]models.Order, error)
+	GetUserWithdrawals(ctx context.Context, actorID, userID int64) ([]models.Withdrawal, error)
+	GetOrderAccrual(ctx context.Context, actorID int64, number string) (models.AccrualJobState, error)
+	AdjustBalance(ctx context.Context, adjustment models.BalanceAdjustment) (money.Amount, error)
+	ListAudit(ctx context.Context, actorID int64, filter models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+type UserAccountResponse struct {
+	ID        int64        `json:"id"`
+	Login     string       `json:"login"`
+	Role      string       `json:"role"`
+	Current   money.Amount `json:"current"`
+	Withdrawn money.Amount `json:"withdrawn"`
+}
+
+type AccrualJobResponse struct {
+	State         string `json:"state"`
+	Attempts      int    `json:"attempts"`
+	NotFound      int    `json:"not_found"`
+	NextAttemptAt string `json:"next_attempt_at"`
+	LockedBy      string `json:"locked_by,omitempty"`
+	LockedUntil   string `json:"locked_until,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+	UpdatedAt     string `json:"updated_at"`
+	TraceParent   string `json:"trace_parent,omitempty"`
+}
+
+type OrderAccrualResponse struct {
+	Number     string              `json:"number"`
+	UserID     int64               `json:"user_id"`
+	Status     string              `json:"status"`
+	Accrual    money.Amount        `json:"accrual,omitempty"`
+	UploadedAt string              `json:"uploaded_at"`
+	Job        *AccrualJobResponse `json:"job"`
+}
+
+// adminRequest returns the admin making the request and, when the route has
+// one, the user it is about. It answers the request itself when either is
+// missing or malformed.
+func adminRequest(w http.ResponseWriter, r *http.Request, logger *slog.Logger, withUser bool) (actorID, userID int64, ok bool) {
+	actorID, ok = middleware.GetUserID(r)
+	if !ok {
+		logger.WarnContext(r.Context(), "Unauthorized: missing user_id in context")
+		utils.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
+		return 0, 0, false
+	}
+	if !withUser {
+		return actorID, 0, true
+	}
+	userID, err := strconv.ParseInt(chi.URLParam(r, UserIDParam), 10, 64)
+	if err != nil || userID <= 0 {
+		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid user id")
+		return 0, 0, false
+	}
+	return actorID, userID, true
+}
+
+func writeAdminError(w http.ResponseWriter, r *http.Request, logger *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, models.ErrUserNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, "User not found")
+	case errors.Is(err, models.ErrOrderNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, "Order not found")
+	default:
+		logger.ErrorContext(r.Context(), "Admin request failed", slog.Any("error", err))
+		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, logger *slog.Logger, status int, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.ErrorContext(r.Context(), "Failed to encode response", slog.Any("error", err))
+	}
+}
+
+type AdminUserHandler struct {
+	admin  AdminService
+	logger *slog.Logger
+}
+
+func NewAdminUserHandler(admin AdminService, logger *slog.Logger) *AdminUserHandler {
+	return &AdminUserHandler{admin: admin, logger: logger}
+}
+
+// ServeHTTP looks the user up by the id in the path or, on the collection
+// route, by the login query parameter.
+func (h *AdminUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	withUser := chi.URLParam(r, UserIDParam) != ""
+	actorID, userID, ok := adminRequest(w, r, h.logger, withUser)
+	if !ok {
+		return
+	}
+
+	var account models.UserAccount
+	var err error
+	if withUser {
+		account, err = h.admin.GetUser(r.Context(), actorID, userID)
+	} else {
+		login := r.URL.Query().Get("login")
+		if login == "" {
+			utils.WriteJSONError(w, http.StatusBadRequest, "Login is required")
+			return
+		}
+		account, err = h.admin.FindUser(r.Context(), actorID, login)
+	}
+	if err != nil {
+		writeAdminError(w, r, h.logger, err)
+		return
+	}
+
+	writeJSON(w, r, h.logger, http.StatusOK, UserAccountResponse{
+		ID:        account.ID,
+		Login:     account.Login,
+		Role:      account.Role,
+		Current:   account.Current,
+		Withdrawn: account.Withdrawn,
+	})
+	h.logger.InfoContext(r.Context(), "Admin looked up user", slog.Int64("target_user_id", account.ID))
+}
+
+type AdminUserOrdersHandler struct {
+	admin  AdminService
+	logger *slog.Logger
+}
+
+func NewAdminUserOrdersHandler(admin AdminService, logger *slog.Logger) *AdminUserOrdersHandler {
+	return &AdminUserOrdersHandler{admin: admin, logger: logger}
+}
+
+func (h *AdminUserOrdersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	actorID, userID, ok := adminRequest(w, r, h.logger, true)
+	if !ok {
+		return
+	}
+
+	orders, err := h.admin.GetUserOrders(r.Context(), actorID, userID)
+	if err != nil {
+		writeAdminError(w, r, h.logger, err)
+		return
+	}
+
+	response := make([]OrderResponse, len(orders))
+	for i, order := range orders {
+		response[i] = OrderResponse{
+			Number:     order.Number,
+			Status:     order.Status,
+			Accrual:    order.Accrual,
+			UploadedAt: order.UploadedAt.Time.Format(time.RFC3339),
+		}
+	}
+	writeJSON(w, r, h.logger, http.StatusOK, response)
+	h.logger.InfoContext(r.Context(), "Admin listed orders",
+		slog.Int64("target_user_id", userID), slog.Int("count", len(orders)))
+}
+
+type AdminUserWithdrawalsHandler struct {
+	admin  AdminService
+	logger *slog.Logger
+}
+
+func NewAdminUserWithdrawalsHandler(admin AdminService, logger *slog.Logger) *AdminUserWithdrawalsHandler {
+	return &AdminUserWithdrawalsHandler{admin: admin, logger: logger}
+}
+
+func (h *AdminUserWithdrawalsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	actorID, userID, ok := adminRequest(w, r, h.logger, true)
+	if !ok {
+		return
+	}
+
+	withdrawals, err := h.admin.GetUserWithdrawals(r.Context(), actorID, userID)
+	if err != nil {
+		writeAdminError(w, r, h.logger, err)
+		return
+	}
+
+	response := make([]WithdrawalResponse, len(withdrawals))
+	for i, withdrawal := range withdrawals {
+		response[i] = WithdrawalResponse{
+			Order:       withdrawal.OrderNumber,
+			Sum:         withdrawal.Sum,
+			ProcessedAt: withdrawal.ProcessedAt.Time.Format(time.RFC3339),
+		}
+	}
+	writeJSON(w, r, h.logger, http.StatusOK, response)
+	h.logger.InfoContext(r.Context(), "Admin listed withdrawals",
+		slog.Int64("target_user_id", userID), slog.Int("count", len(withdrawals)))
+}
+
+type AdminOrderAccrualHandler struct {
+	admin  AdminService
+	logger *slog.Logger
+}
+
+func NewAdminOrderAccrualHandler(admin AdminService, logger *slog.Logger) *AdminOrderAccrualHandler {
+	return &AdminOrderAccrualHandler{admin: admin, logger: logger}
+}
+
+// ServeHTTP shows where the order is in the accrual poller: its status and
+// the state, attempts and last error of its job.
+func (h *AdminOrderAccrualHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	actorID, _, ok := adminRequest(w, r, h.logger, false)
+	if !ok {
+		return
+	}
+
+	number := chi.URLParam(r, OrderNumberParam)
+	state, err := h.admin.GetOrderAccrual(r.Context(), actorID, number)
+	if err != nil {
+		writeAdminError(w, r, h.logger, err)
+		return
+	}
+
+	response := OrderAccrualResponse{
+		Number:     state.Order.Number,
+		UserID:     state.Order.UserID,
+		Status:     state.Order.Status,
+		Accrual:    state.Order.Accrual,
+		UploadedAt: state.Order.UploadedAt.Time.Format(time.RFC3339),
+	}
+	if job := state.Job; job != nil {
+		response.Job = &AccrualJobResponse{
+			State:         job.State,
+			Attempts:      job.Attempts,
+			NotFound:      job.NotFound,
+			NextAttemptAt: job.NextAttemptAt.Format(time.RFC3339),
+			LockedBy:      job.LockedBy,
+			LastError:     job.LastError,
+			UpdatedAt:     job.UpdatedAt.Format(time.RFC3339),
+			TraceParent:   job.TraceParent,
+		}
+		if !job.LockedUntil.IsZero() {
+			response.Job.LockedUntil = job.LockedUntil.Format(time.RFC3339)
+		}
+	}
+	writeJSON(w, r, h.logger, http.StatusOK, response)
+	h.logger.InfoContext(r.Context(), "Admin checked order accrual", slog.String(logging.OrderKey, number))
+}
+
+type AdminBalanceAdjustHandler struct {
+	admin  AdminService
+	logger *slog.Logger
+}
+
+func NewAdminBalanceAdjustHandler(admin AdminService, logger *slog.Logger) *AdminBalanceAdjustHandler {
+	return &AdminBalanceAdjustHandler{admin: admin, logger: logger}
+}
+
+// ServeHTTP credits a positive amount or debits a negative one. The reason is
+// mandatory and kept in the audit log.
+func (h *AdminBalanceAdjustHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	actorID, userID, ok := adminRequest(w, r, h.logger, true)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Amount money.Amount `json:"amount"`
+		Reason string       `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.InfoContext(r.Context(), "Failed to decode balance adjustment", slog.Any("error", err))
+		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+	if req.Amount == 0 || req.Reason == "" {
+		utils.WriteJSONError(w, http.StatusBadRequest, "Non-zero amount and reason are required")
+		return
+	}
+
+	current, err := h.admin.AdjustBalance(r.Context(), models.BalanceAdjustment{
+		UserID:  userID,
+		ActorID: actorID,
+		Amount:  req.Amount,
+		Reason:  req.Reason,
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrInsufficientBalance) {
+			utils.WriteJSONError(w, http.StatusConflict, "Adjustment would make the balance negative")
+			return
+		}
+		writeAdminError(w, r, h.logger, err)
+		return
+	}
+
+	writeJSON(w, r, h.logger, http.StatusOK, map[string]money.Amount{"current": current})
+	h.logger.InfoContext(r.Context(), "Admin adjusted balance",
+		slog.Int64("target_user_id", userID), slog.String("amount", req.Amount.String()))
+}
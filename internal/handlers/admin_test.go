@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAdminService struct {
+	mock.Mock
+}
+
+func (m *MockAdminService) GetUser(ctx context.Context, actorID, userID int64) (models.UserAccount, error) {
+	args := m.Called(ctx, actorID, userID)
+	return args.Get(0).(models.UserAccount), args.Error(1)
+}
+
+func (m *MockAdminService) FindUser(ctx context.Context, actorID int64, login string) (models.UserAccount, error) {
+	args := m.Called(ctx, actorID, login)
+	return args.Get(0).(models.UserAccount), args.Error(1)
+}
+
+func (m *MockAdminService) GetUserOrders(ctx context.Context, actorID, userID int64) ([]models.Order, error) {
+	args := m.Called(ctx, actorID, userID)
+	return args.Get(0).([]models.Order), args.Error(1)
+}
+
+func (m *MockAdminService) GetUserWithdrawals(ctx context.Context, actorID, userID int64) ([]models.Withdrawal, error) {
+	args := m.Called(ctx, actorID, userID)
+	return args.Get(0).([]models.Withdrawal), args.Error(1)
+}
+
+func (m *MockAdminService) GetOrderAccrual(ctx context.Context, actorID int64, number string) (models.AccrualJobState, error) {
+	args := m.Called(ctx, actorID, number)
+	return args.Get(0).(models.AccrualJobState), args.Error(1)
+}
+
+func (m *MockAdminService) AdjustBalance(ctx context.Context, adjustment models.BalanceAdjustment) (money.Amount, error) {
+	args := m.Called(ctx, adjustment)
+	return args.Get(0).(money.Amount), args.Error(1)
+}
+
+func (m *MockAdminService) ListAudit(ctx context.Context, actorID int64, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	args := m.Called(ctx, actorID, filter)
+	return args.Get(0).([]models.AuditEntry), args.Error(1)
+}
+
+// adminRequestWith builds a request from admin 1 with the given chi URL
+// parameters.
+func adminRequestWith(method, target, body string, params map[string]string) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	rctx := chi.NewRouteContext()
+	for key, value := range params {
+		rctx.URLParams.Add(key, value)
+	}
+	userData := map[middleware.UserID]interface{}{
+		middleware.UserID("id"): int64(1),
+	}
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	ctx = context.WithValue(ctx, middleware.UserKey{}, userData)
+	return req.WithContext(ctx)
+}
+
+func TestAdminUserHandler_ServeHTTP(t *testing.T) {
+	account := models.UserAccount{ID: 7, Login: "alice", Role: "user", Current: money.MustParse("100"), Withdrawn: money.MustParse("20")}
+	accountBody := `{"id":7,"login":"alice","role":"user","current":100,"withdrawn":20}`
+
+	tests := []struct {
+		name           string
+		target         string
+		params         map[string]string
+		setupMocks     func(*MockAdminService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "поиск по id",
+			target: "/api/admin/users/7",
+			params: map[string]string{UserIDParam: "7"},
+			setupMocks: func(s *MockAdminService) {
+				s.On("GetUser", mock.Anything, int64(1), int64(7)).Return(account, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   accountBody,
+		},
+		{
+			name:   "поиск по логину",
+			target: "/api/admin/users?login=alice",
+			setupMocks: func(s *MockAdminService) {
+				s.On("FindUser", mock.Anything, int64(1), "alice").Return(account, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   accountBody,
+		},
+		{
+			name:           "без логина",
+			target:         "/api/admin/users",
+			setupMocks:     func(s *MockAdminService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Login is required"}`,
+		},
+		{
+			name:           "неверный id",
+			target:         "/api/admin/users/abc",
+			params:         map[string]string{UserIDParam: "abc"},
+			setupMocks:     func(s *MockAdminService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Invalid user id"}`,
+		},
+		{
+			name:   "пользователь не найден",
+			target: "/api/admin/users/7",
+			params: map[string]string{UserIDParam: "7"},
+			setupMocks: func(s *MockAdminService) {
+				s.On("GetUser", mock.Anything, int64(1), int64(7)).Return(models.UserAccount{}, models.ErrUserNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"User not found"}`,
+		},
+		{
+			name:   "ошибка сервера",
+			target: "/api/admin/users/7",
+			params: map[string]string{UserIDParam: "7"},
+			setupMocks: func(s *MockAdminService) {
+				s.On("GetUser", mock.Anything, int64(1), int64(7)).Return(models.UserAccount{}, errors.New("db error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"Internal server error"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &MockAdminService{}
+			tt.setupMocks(service)
+			handler := NewAdminUserHandler(service, logging.Discard())
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, adminRequestWith(http.MethodGet, tt.target, "", tt.params))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			service.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAdminUserOrdersHandler_ServeHTTP(t *testing.T) {
+	uploadedAt := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	service := &MockAdminService{}
+	service.On("GetUserOrders", mock.Anything, int64(1), int64(7)).Return([]models.Order{
+		{Number: "12345678903", Status: "PROCESSED", Accrual: money.MustParse("500"), UploadedAt: pgtype.Timestamptz{Time: uploadedAt, Valid: true}},
+	}, nil)
+	service.On("GetUserOrders", mock.Anything, int64(1), int64(8)).Return([]models.Order{}, nil)
+	handler := NewAdminUserOrdersHandler(service, logging.Discard())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, adminRequestWith(http.MethodGet, "/api/admin/users/7/orders", "", map[string]string{UserIDParam: "7"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"number":"12345678903","status":"PROCESSED","accrual":500,"uploaded_at":"2024-05-01T10:30:00Z"}]`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, adminRequestWith(http.MethodGet, "/api/admin/users/8/orders", "", map[string]string{UserIDParam: "8"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String(), "an empty list is still a 200 for support")
+}
+
+func TestAdminUserWithdrawalsHandler_ServeHTTP(t *testing.T) {
+	processedAt := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	service := &MockAdminService{}
+	service.On("GetUserWithdrawals", mock.Anything, int64(1), int64(7)).Return([]models.Withdrawal{
+		{OrderNumber: "2377225624", Sum: money.MustParse("200"), ProcessedAt: pgtype.Timestamptz{Time: processedAt, Valid: true}},
+	}, nil)
+	handler := NewAdminUserWithdrawalsHandler(service, logging.Discard())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, adminRequestWith(http.MethodGet, "/api/admin/users/7/withdrawals", "", map[string]string{UserIDParam: "7"}))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"order":"2377225624","sum":200,"processed_at":"2024-05-01T10:30:00Z"}]`, w.Body.String())
+}
+
+func TestAdminOrderAccrualHandler_ServeHTTP(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	order := models.Order{UserID: 7, Number: "12345678903", Status: "PROCESSING", UploadedAt: pgtype.Timestamptz{Time: at, Valid: true}}
+
+	tests := []struct {
+		name           string
+		setupMocks     func(*MockAdminService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "заказ в очереди",
+			setupMocks: func(s *MockAdminService) {
+				s.On("GetOrderAccrual", mock.Anything, int64(1), "12345678903").Return(models.AccrualJobState{
+					Order: order,
+					Job: &models.AccrualJobStatus{
+						State:         "pending",
+						Attempts:      2,
+						NextAttemptAt: at.Add(time.Minute),
+						LastError:     "accrual service unavailable",
+						UpdatedAt:     at,
+					},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"number":"12345678903","user_id":7,"status":"PROCESSING","uploaded_at":"2024-05-01T10:30:00Z",
+				"job":{"state":"pending","attempts":2,"not_found":0,"next_attempt_at":"2024-05-01T10:31:00Z",
+				"last_error":"accrual service unavailable","updated_at":"2024-05-01T10:30:00Z"}}`,
+		},
+		{
+			name: "заказ без задания",
+			setupMocks: func(s *MockAdminService) {
+				s.On("GetOrderAccrual", mock.Anything, int64(1), "12345678903").Return(models.AccrualJobState{Order: order}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"number":"12345678903","user_id":7,"status":"PROCESSING","uploaded_at":"2024-05-01T10:30:00Z","job":null}`,
+		},
+		{
+			name: "заказ не найден",
+			setupMocks: func(s *MockAdminService) {
+				s.On("GetOrderAccrual", mock.Anything, int64(1), "12345678903").Return(models.AccrualJobState{}, models.ErrOrderNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"Order not found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &MockAdminService{}
+			tt.setupMocks(service)
+			handler := NewAdminOrderAccrualHandler(service, logging.Discard())
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, adminRequestWith(http.MethodGet, "/api/admin/orders/12345678903/accrual", "",
+				map[string]string{OrderNumberParam: "12345678903"}))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestAdminBalanceAdjustHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		setupMocks     func(*MockAdminService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "успешная корректировка",
+			body: `{"amount":-12.5,"reason":"duplicate accrual"}`,
+			setupMocks: func(s *MockAdminService) {
+				s.On("AdjustBalance", mock.Anything, models.BalanceAdjustment{
+					UserID:  7,
+					ActorID: 1,
+					Amount:  money.MustParse("-12.5"),
+					Reason:  "duplicate accrual",
+				}).Return(money.MustParse("87.5"), nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"current":87.5}`,
+		},
+		{
+			name:           "без причины",
+			body:           `{"amount":10}`,
+			setupMocks:     func(s *MockAdminService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Non-zero amount and reason are required"}`,
+		},
+		{
+			name:           "невалидный JSON",
+			body:           `{invalid}`,
+			setupMocks:     func(s *MockAdminService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Invalid request format"}`,
+		},
+		{
+			name: "баланс ушёл бы в минус",
+			body: `{"amount":-1000,"reason":"correction"}`,
+			setupMocks: func(s *MockAdminService) {
+				s.On("AdjustBalance", mock.Anything, mock.Anything).Return(money.Amount(0), models.ErrInsufficientBalance)
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"error":"Adjustment would make the balance negative"}`,
+		},
+		{
+			name: "пользователь не найден",
+			body: `{"amount":10,"reason":"goodwill"}`,
+			setupMocks: func(s *MockAdminService) {
+				s.On("AdjustBalance", mock.Anything, mock.Anything).Return(money.Amount(0), models.ErrUserNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"User not found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &MockAdminService{}
+			tt.setupMocks(service)
+			handler := NewAdminBalanceAdjustHandler(service, logging.Discard())
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, adminRequestWith(http.MethodPost, "/api/admin/users/7/balance/adjustments", tt.body,
+				map[string]string{UserIDParam: "7"}))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			service.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/AlenaMolokova/diploma/internal/utils"
+)
+
+type AuditReader interface {
+	ListUserAudit(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+type AuditEntryResponse struct {
+	ID            int64          `json:"id"`
+	ActorID       int64          `json:"actor_id,omitempty"`
+	Action        string         `json:"action"`
+	TargetUserID  int64          `json:"target_user_id,omitempty"`
+	Order         string         `json:"order,omitempty"`
+	SourceIP      string         `json:"source_ip,omitempty"`
+	BalanceBefore *money.Amount  `json:"balance_before,omitempty"`
+	BalanceAfter  *money.Amount  `json:"balance_after,omitempty"`
+	Details       map[string]any `json:"details,omitempty"`
+	CreatedAt     string         `json:"created_at"`
+}
+
+type AuditPageResponse struct {
+	Entries    []AuditEntryResponse `json:"entries"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+var errInvalidAuditQuery = errors.New("invalid audit query")
+
+// parseAuditFilter reads the action, order, from, to, limit and cursor query
+// parameters. The limit is one more than the page size, so the caller can
+// tell whether another page follows.
+func parseAuditFilter(r *http.Request) (models.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		Action:      query.Get("action"),
+		OrderNumber: query.Get("order"),
+		Limit:       constants.DefaultAuditPageSize,
+	}
+
+	for name, dst := range map[string]*time.Time{"from": &filter.Since, "to": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return models.AuditFilter{}, errInvalidAuditQuery
+			}
+			*dst = t
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > constants.MaxAuditPageSize {
+			return models.AuditFilter{}, errInvalidAuditQuery
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("cursor"); value != "" {
+		id, err := decodeAuditCursor(value)
+		if err != nil {
+			return models.AuditFilter{}, errInvalidAuditQuery
+		}
+		filter.BeforeID = id
+	}
+	filter.Limit++
+	return filter, nil
+}
+
+func encodeAuditCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeAuditCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errInvalidAuditQuery
+	}
+	return id, nil
+}
+
+// writeAuditPage answers with at most limit-1 entries and a cursor for the
+// next page if the listing found more.
+func writeAuditPage(w http.ResponseWriter, r *http.Request, logger *slog.Logger, entries []models.AuditEntry, limit int) {
+	page := AuditPageResponse{Entries: make([]AuditEntryResponse, 0, len(entries))}
+	if len(entries) >= limit {
+		entries = entries[:limit-1]
+		page.NextCursor = encodeAuditCursor(entries[len(entries)-1].ID)
+	}
+	for _, entry := range entries {
+		page.Entries = append(page.Entries, AuditEntryResponse{
+			ID:            entry.ID,
+			ActorID:       entry.ActorID,
+			Action:        entry.Action,
+			TargetUserID:  entry.TargetUserID,
+			Order:         entry.OrderNumber,
+			SourceIP:      entry.SourceIP,
+			BalanceBefore: entry.BalanceBefore,
+			BalanceAfter:  entry.BalanceAfter,
+			Details:       entry.Details,
+			CreatedAt:     entry.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	writeJSON(w, r, logger, http.StatusOK, page)
+}
+
+type AuditHandler struct {
+	audit  AuditReader
+	logger *slog.Logger
+}
+
+func NewAuditHandler(audit AuditReader, logger *slog.Logger) *AuditHandler {
+	return &AuditHandler{audit: audit, logger: logger}
+}
+
+// ServeHTTP lists the caller's own actions, the system's changes to the
+// account and admin adjustments of its balance. Other admin actions on the
+// account are left out.
+func (h *AuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		h.logger.WarnContext(r.Context(), "Unauthorized: missing user_id in context")
+		utils.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid audit query")
+		return
+	}
+	filter.UserID = userID
+
+	entries, err := h.audit.ListUserAudit(r.Context(), filter)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Failed to list audit entries", slog.Any("error", err))
+		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	writeAuditPage(w, r, h.logger, entries, filter.Limit)
+}
+
+type AdminAuditHandler struct {
+	admin  AdminService
+	logger *slog.Logger
+}
+
+func NewAdminAuditHandler(admin AdminService, logger *slog.Logger) *AdminAuditHandler {
+	return &AdminAuditHandler{admin: admin, logger: logger}
+}
+
+// ServeHTTP lists the audit entries of every user, or of the one given by the
+// user_id query parameter.
+func (h *AdminAuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	actorID, _, ok := adminRequest(w, r, h.logger, false)
+	if !ok {
+		return
+	}
+
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid audit query")
+		return
+	}
+	if value := r.URL.Query().Get("user_id"); value != "" {
+		userID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || userID <= 0 {
+			utils.WriteJSONError(w, http.StatusBadRequest, "Invalid user id")
+			return
+		}
+		filter.UserID = userID
+	}
+
+	entries, err := h.admin.ListAudit(r.Context(), actorID, filter)
+	if err != nil {
+		writeAdminError(w, r, h.logger, err)
+		return
+	}
+	writeAuditPage(w, r, h.logger, entries, filter.Limit)
+}
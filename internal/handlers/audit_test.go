@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAuditReader struct {
+	mock.Mock
+}
+
+func (m *MockAuditReader) ListUserAudit(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]models.AuditEntry), args.Error(1)
+}
+
+func TestAuditHandler_ServeHTTP(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	before, after := money.MustParse("100"), money.MustParse("60")
+	withdrawal := models.AuditEntry{
+		ID:            12,
+		ActorID:       1,
+		Action:        constants.AuditBalanceWithdrawal,
+		TargetUserID:  1,
+		OrderNumber:   "2377225624",
+		SourceIP:      "203.0.113.5",
+		BalanceBefore: &before,
+		BalanceAfter:  &after,
+		Details:       map[string]any{"sum": "40"},
+		CreatedAt:     createdAt,
+	}
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		target         string
+		setupMocks     func(*MockAuditReader)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "первая страница",
+			target: "/api/user/audit",
+			setupMocks: func(m *MockAuditReader) {
+				m.On("ListUserAudit", mock.Anything, models.AuditFilter{UserID: 1, Limit: constants.DefaultAuditPageSize + 1}).
+					Return([]models.AuditEntry{withdrawal}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"entries":[{"id":12,"actor_id":1,"action":"balance.withdrawal","target_user_id":1,"order":"2377225624",
+				"source_ip":"203.0.113.5","balance_before":100,"balance_after":60,"details":{"sum":"40"},"created_at":"2024-03-01T12:00:00Z"}]}`,
+		},
+		{
+			name:   "фильтры и курсор",
+			target: "/api/user/audit?action=balance.withdrawal&order=2377225624&from=2024-03-01T00:00:00Z&limit=1&cursor=" + encodeAuditCursor(20),
+			setupMocks: func(m *MockAuditReader) {
+				m.On("ListUserAudit", mock.Anything, models.AuditFilter{
+					UserID:      1,
+					Action:      constants.AuditBalanceWithdrawal,
+					OrderNumber: "2377225624",
+					Since:       since,
+					BeforeID:    20,
+					Limit:       2,
+				}).Return([]models.AuditEntry{withdrawal, {ID: 9, Action: constants.AuditBalanceWithdrawal}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"entries":[{"id":12,"actor_id":1,"action":"balance.withdrawal","target_user_id":1,"order":"2377225624",
+				"source_ip":"203.0.113.5","balance_before":100,"balance_after":60,"details":{"sum":"40"},"created_at":"2024-03-01T12:00:00Z"}],
+				"next_cursor":"` + encodeAuditCursor(12) + `"}`,
+		},
+		{
+			name:   "пустой журнал",
+			target: "/api/user/audit",
+			setupMocks: func(m *MockAuditReader) {
+				m.On("ListUserAudit", mock.Anything, mock.Anything).Return([]models.AuditEntry{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"entries":[]}`,
+		},
+		{
+			name:           "лимит больше допустимого",
+			target:         "/api/user/audit?limit=501",
+			setupMocks:     func(m *MockAuditReader) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Invalid audit query"}`,
+		},
+		{
+			name:           "неверная дата",
+			target:         "/api/user/audit?to=yesterday",
+			setupMocks:     func(m *MockAuditReader) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Invalid audit query"}`,
+		},
+		{
+			name:           "неверный курсор",
+			target:         "/api/user/audit?cursor=@@",
+			setupMocks:     func(m *MockAuditReader) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Invalid audit query"}`,
+		},
+		{
+			name:   "ошибка хранилища",
+			target: "/api/user/audit",
+			setupMocks: func(m *MockAuditReader) {
+				m.On("ListUserAudit", mock.Anything, mock.Anything).Return([]models.AuditEntry(nil), errors.New("db error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"Internal server error"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := &MockAuditReader{}
+			tt.setupMocks(reader)
+			handler := NewAuditHandler(reader, logging.Discard())
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			userData := map[middleware.UserID]interface{}{
+				middleware.UserID("id"): int64(1),
+			}
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserKey{}, userData))
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			reader.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAdminAuditHandler_ServeHTTP(t *testing.T) {
+	t.Run("журнал выбранного пользователя", func(t *testing.T) {
+		admin := &MockAdminService{}
+		admin.On("ListAudit", mock.Anything, int64(1), models.AuditFilter{UserID: 7, Limit: constants.DefaultAuditPageSize + 1}).
+			Return([]models.AuditEntry{{ID: 5, Action: constants.AuditUserLogin, ActorID: 7, TargetUserID: 7}}, nil)
+
+		w := httptest.NewRecorder()
+		NewAdminAuditHandler(admin, logging.Discard()).ServeHTTP(w, adminRequestWith(http.MethodGet, "/api/admin/audit?user_id=7", "", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var page AuditPageResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		if assert.Len(t, page.Entries, 1) {
+			assert.Equal(t, constants.AuditUserLogin, page.Entries[0].Action)
+		}
+		assert.Empty(t, page.NextCursor)
+		admin.AssertExpectations(t)
+	})
+
+	t.Run("неверный user_id", func(t *testing.T) {
+		admin := &MockAdminService{}
+
+		w := httptest.NewRecorder()
+		NewAdminAuditHandler(admin, logging.Discard()).ServeHTTP(w, adminRequestWith(http.MethodGet, "/api/admin/audit?user_id=abc", "", nil))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		admin.AssertNotCalled(t, "ListAudit", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
@@ -2,38 +2,41 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/money"
 	"github.com/AlenaMolokova/diploma/internal/usecase"
 	"github.com/AlenaMolokova/diploma/internal/utils"
 )
 
 type BalanceHandler struct {
 	balanceUC usecase.BalanceUseCase
+	logger    *slog.Logger
 }
 
-func NewBalanceHandler(balanceUC usecase.BalanceUseCase) *BalanceHandler {
-	return &BalanceHandler{balanceUC: balanceUC}
+func NewBalanceHandler(balanceUC usecase.BalanceUseCase, logger *slog.Logger) *BalanceHandler {
+	return &BalanceHandler{balanceUC: balanceUC, logger: logger}
 }
 
 func (h *BalanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		log.Printf("Unauthorized: missing user_id in context")
+		h.logger.WarnContext(ctx, "Unauthorized: missing user_id in context")
 		utils.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	current, withdrawn, err := h.balanceUC.GetUserBalance(r.Context(), userID)
+	current, withdrawn, err := h.balanceUC.GetUserBalance(ctx, userID)
 	if err != nil {
-		log.Printf("Failed to get balance for user %d: %v", userID, err)
+		h.logger.ErrorContext(ctx, "Failed to get balance", slog.Any("error", err))
 		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	response := map[string]float64{
+	response := map[string]money.Amount{
 		"current":   current,
 		"withdrawn": withdrawn,
 	}
@@ -41,7 +44,9 @@ func (h *BalanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Failed to encode balance response: %v", err)
+		h.logger.ErrorContext(ctx, "Failed to encode balance response", slog.Any("error", err))
 	}
-	log.Printf("Returned balance current=%.2f, withdrawn=%.2f for user %d", current, withdrawn, userID)
+	h.logger.DebugContext(ctx, "Returned balance",
+		slog.String("current", current.String()),
+		slog.String("withdrawn", withdrawn.String()))
 }
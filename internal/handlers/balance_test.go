@@ -8,10 +8,11 @@ import (
 	"testing"
 
 	"github.com/AlenaMolokova/diploma/internal/handlers"
+	"github.com/AlenaMolokova/diploma/internal/logging"
 	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/money"
 	"github.com/AlenaMolokova/diploma/internal/testutils"
 	"github.com/AlenaMolokova/diploma/internal/usecase"
-	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -19,12 +20,12 @@ import (
 func TestBalanceHandler(t *testing.T) {
 	mockStorage := new(testutils.MockBalanceStorage)
 	uc := usecase.NewBalanceUseCase(mockStorage)
-	handler := handlers.NewBalanceHandler(uc)
+	handler := handlers.NewBalanceHandler(uc, logging.Discard())
 
 	t.Run("success", func(t *testing.T) {
 		mockStorage.On("GetBalance", mock.Anything, int64(1)).Return(
-			pgtype.Float8{Float64: 100, Valid: true},
-			pgtype.Float8{Float64: 20, Valid: true},
+			money.MustParse("100"),
+			money.MustParse("20"),
 			nil,
 		)
 
@@ -52,8 +53,8 @@ func TestBalanceHandler(t *testing.T) {
 
 	t.Run("internal_error", func(t *testing.T) {
 		mockStorage.On("GetBalance", mock.Anything, int64(2)).Return(
-			pgtype.Float8{},
-			pgtype.Float8{},
+			money.Amount(0),
+			money.Amount(0),
 			errors.New("DB down"),
 		)
 
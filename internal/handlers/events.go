@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/AlenaMolokova/diploma/internal/utils"
+)
+
+// eventsKeepAlive is how often an idle event stream sends a comment, so that
+// proxies do not time it out.
+const eventsKeepAlive = 15 * time.Second
+
+type EventSubscriber interface {
+	Subscribe(userID int64) (<-chan models.UserEvent, func())
+}
+
+// EventsHandler streams the changes of the user's orders and balance as
+// Server-Sent Events: an "order" event carries the order as the orders
+// listing shows it, a "balance" event the balance as GET /balance does. The
+// server ends the stream when events may have been missed; clients should
+// reconnect and reload then.
+type EventsHandler struct {
+	hub    EventSubscriber
+	logger *slog.Logger
+}
+
+func NewEventsHandler(hub EventSubscriber, logger *slog.Logger) *EventsHandler {
+	return &EventsHandler{hub: hub, logger: logger}
+}
+
+func (h *EventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		h.logger.WarnContext(ctx, "Unauthorized: missing user_id in context")
+		utils.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	events, cancel := h.hub.Subscribe(userID)
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		h.logger.ErrorContext(ctx, "Event stream cannot be flushed", slog.Any("error", err))
+		return
+	}
+	h.logger.DebugContext(ctx, "Opened event stream")
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				h.logger.DebugContext(ctx, "Event stream closed by the server")
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				h.logger.DebugContext(ctx, "Failed to write event", slog.Any("error", err))
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event models.UserEvent) error {
+	var data any
+	switch event.Kind {
+	case constants.EventOrder:
+		data = OrderResponse{
+			Number:     event.Order.Number,
+			Status:     event.Order.Status,
+			Accrual:    event.Order.Accrual,
+			UploadedAt: event.Order.UploadedAt.Time.Format(time.RFC3339),
+		}
+	case constants.EventBalance:
+		data = map[string]money.Amount{
+			"current":   event.Current,
+			"withdrawn": event.Withdrawn,
+		}
+	default:
+		return nil
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, payload)
+	return err
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubSubscriber hands out a stream that replays events and then closes.
+type stubSubscriber struct {
+	userID    int64
+	events    []models.UserEvent
+	cancelled bool
+}
+
+func (s *stubSubscriber) Subscribe(userID int64) (<-chan models.UserEvent, func()) {
+	s.userID = userID
+	ch := make(chan models.UserEvent, len(s.events))
+	for _, event := range s.events {
+		ch <- event
+	}
+	close(ch)
+	return ch, func() { s.cancelled = true }
+}
+
+func TestEventsHandler_ServeHTTP(t *testing.T) {
+	uploadedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	hub := &stubSubscriber{events: []models.UserEvent{
+		{
+			UserID: 1,
+			Kind:   constants.EventOrder,
+			Order: models.Order{
+				Number:     "79927398713",
+				Status:     constants.StatusProcessed,
+				Accrual:    money.MustParse("500"),
+				UploadedAt: pgtype.Timestamptz{Time: uploadedAt, Valid: true},
+			},
+		},
+		{UserID: 1, Kind: constants.EventBalance, Current: money.MustParse("500"), Withdrawn: money.MustParse("42.5")},
+	}}
+	handler := NewEventsHandler(hub, logging.Discard())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/orders/events", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserKey{}, map[middleware.UserID]interface{}{
+		middleware.UserID("id"): int64(1),
+	}))
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "event: order\n"+
+		`data: {"number":"79927398713","status":"PROCESSED","accrual":500,"uploaded_at":"2024-05-01T12:00:00Z"}`+"\n\n"+
+		"event: balance\n"+
+		`data: {"current":500,"withdrawn":42.5}`+"\n\n", w.Body.String())
+	assert.True(t, w.Flushed)
+	assert.Equal(t, int64(1), hub.userID)
+	assert.True(t, hub.cancelled, "подписка снимается, когда поток закрыт")
+}
+
+func TestEventsHandlerStopsWhenClientLeaves(t *testing.T) {
+	events := make(chan models.UserEvent)
+	handler := NewEventsHandler(subscriberFunc(func(int64) (<-chan models.UserEvent, func()) {
+		return events, func() {}
+	}), logging.Discard())
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), middleware.UserKey{}, map[middleware.UserID]interface{}{
+		middleware.UserID("id"): int64(1),
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/user/orders/events", nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the stream to end once the client leaves")
+	}
+}
+
+func TestEventsHandlerUnauthorized(t *testing.T) {
+	handler := NewEventsHandler(&stubSubscriber{}, logging.Discard())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/user/orders/events", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+type subscriberFunc func(userID int64) (<-chan models.UserEvent, func())
+
+func (f subscriberFunc) Subscribe(userID int64) (<-chan models.UserEvent, func()) {
+	return f(userID)
+}
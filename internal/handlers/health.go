@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Statuses reported by the health endpoints, for the service as a whole and
+// for each component.
+const (
+	HealthOK       = "ok"
+	HealthFailing  = "failing"
+	HealthDraining = "draining"
+	HealthPending  = "pending"
+	HealthStale    = "stale"
+)
+
+const (
+	// readyTimeout bounds all the readiness checks together.
+	readyTimeout = 2 * time.Second
+	// stalePollCycles is how many poll intervals may pass without a completed
+	// polling round before the poller is reported as stale.
+	stalePollCycles = 3
+)
+
+type DatabaseProbe interface {
+	Ping(ctx context.Context) error
+	SchemaVersion(ctx context.Context) (version uint, dirty bool, err error)
+}
+
+type AccrualProbe interface {
+	Ping(ctx context.Context) error
+	LastCycle() time.Time
+	PollInterval() time.Duration
+}
+
+// ComponentHealth is the state of one dependency. Only critical components
+// make the service unready; the others are reported for diagnosis.
+type ComponentHealth struct {
+	Status      string     `json:"status"`
+	Critical    bool       `json:"critical"`
+	Detail      string     `json:"detail,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+}
+
+type HealthResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components,omitempty"`
+}
+
+// HealthHandler answers the liveness probe: it succeeds for as long as the
+// process serves HTTP and checks no dependency.
+type HealthHandler struct {
+	logger *slog.Logger
+}
+
+func NewHealthHandler(logger *slog.Logger) *HealthHandler {
+	return &HealthHandler{logger: logger}
+}
+
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, r, h.logger, http.StatusOK, HealthResponse{Status: HealthOK})
+}
+
+// ReadyHandler answers the readiness probe. The service is ready when the
+// database answers and its schema is at the version this build expects, and
+// it is not draining for shutdown. The accrual service and the poller are
+// reported but do not affect readiness, since orders are still accepted and
+// polled later while they are down.
+type ReadyHandler struct {
+	db            DatabaseProbe
+	accrual       AccrualProbe
+	schemaVersion uint
+	draining      atomic.Bool
+	clock         func() time.Time
+	logger        *slog.Logger
+}
+
+// NewReadyHandler creates the readiness handler. schemaVersion is the
+// migration version the database is expected at; zero skips the check.
+func NewReadyHandler(db DatabaseProbe, accrual AccrualProbe, schemaVersion uint, logger *slog.Logger) *ReadyHandler {
+	return &ReadyHandler{
+		db:            db,
+		accrual:       accrual,
+		schemaVersion: schemaVersion,
+		clock:         time.Now,
+		logger:        logger,
+	}
+}
+
+func (h *ReadyHandler) SetClock(clock func() time.Time) {
+	h.clock = clock
+}
+
+// Drain makes every later readiness check fail. It is meant for the server's
+// OnDrain hook.
+func (h *ReadyHandler) Drain() {
+	h.draining.Store(true)
+}
+
+func (h *ReadyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	var (
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+		components = map[string]ComponentHealth{}
+	)
+	run := func(name string, check func(ctx context.Context) ComponentHealth) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := check(ctx)
+			mu.Lock()
+			components[name] = result
+			mu.Unlock()
+		}()
+	}
+	run("database", h.checkDatabase)
+	if h.schemaVersion > 0 {
+		run("migrations", h.checkMigrations)
+	}
+	run("accrual", h.checkAccrual)
+	wg.Wait()
+	components["poller"] = h.checkPoller()
+
+	resp := HealthResponse{Status: HealthOK, Components: components}
+	for _, c := range components {
+		if c.Critical && c.Status != HealthOK {
+			resp.Status = HealthFailing
+		}
+	}
+	if h.draining.Load() {
+		resp.Status = HealthDraining
+	}
+
+	status := http.StatusOK
+	if resp.Status != HealthOK {
+		status = http.StatusServiceUnavailable
+		h.logger.WarnContext(r.Context(), "Service is not ready", slog.String("status", resp.Status))
+	}
+	writeHealth(w, r, h.logger, status, resp)
+}
+
+func (h *ReadyHandler) checkDatabase(ctx context.Context) ComponentHealth {
+	if err := h.db.Ping(ctx); err != nil {
+		h.logger.ErrorContext(ctx, "Database ping failed", slog.Any("error", err))
+		return ComponentHealth{Status: HealthFailing, Critical: true, Detail: "ping failed"}
+	}
+	return ComponentHealth{Status: HealthOK, Critical: true}
+}
+
+// checkMigrations accepts a schema newer than expected, so a replica still
+// running the previous build stays ready while a newer one rolls out. That
+// holds only for additive migrations; one that drops or changes what the
+// previous build uses needs a coordinated deploy.
+func (h *ReadyHandler) checkMigrations(ctx context.Context) ComponentHealth {
+	version, dirty, err := h.db.SchemaVersion(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to read schema version", slog.Any("error", err))
+		return ComponentHealth{Status: HealthFailing, Critical: true, Detail: "schema version unavailable"}
+	}
+
+	detail := fmt.Sprintf("version %d, expected %d", version, h.schemaVersion)
+	switch {
+	case dirty:
+		return ComponentHealth{Status: HealthFailing, Critical: true, Detail: detail + ", last migration failed"}
+	case version < h.schemaVersion:
+		return ComponentHealth{Status: HealthFailing, Critical: true, Detail: detail}
+	default:
+		return ComponentHealth{Status: HealthOK, Critical: true, Detail: detail}
+	}
+}
+
+func (h *ReadyHandler) checkAccrual(ctx context.Context) ComponentHealth {
+	if err := h.accrual.Ping(ctx); err != nil {
+		h.logger.WarnContext(ctx, "Accrual service is unreachable", slog.Any("error", err))
+		return ComponentHealth{Status: HealthFailing, Detail: "unreachable"}
+	}
+	return ComponentHealth{Status: HealthOK}
+}
+
+func (h *ReadyHandler) checkPoller() ComponentHealth {
+	last := h.accrual.LastCycle()
+	if last.IsZero() {
+		return ComponentHealth{Status: HealthPending, Detail: "no polling round completed yet"}
+	}
+	result := ComponentHealth{Status: HealthOK, LastSuccess: &last}
+	if h.clock().Sub(last) > stalePollCycles*h.accrual.PollInterval() {
+		result.Status = HealthStale
+	}
+	return result
+}
+
+func writeHealth(w http.ResponseWriter, r *http.Request, logger *slog.Logger, status int, resp HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.ErrorContext(r.Context(), "Failed to encode health response", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubDatabase struct {
+	pingErr    error
+	version    uint
+	dirty      bool
+	versionErr error
+}
+
+func (s stubDatabase) Ping(context.Context) error {
+	return s.pingErr
+}
+
+func (s stubDatabase) SchemaVersion(context.Context) (uint, bool, error) {
+	return s.version, s.dirty, s.versionErr
+}
+
+type stubAccrual struct {
+	pingErr   error
+	lastCycle time.Time
+}
+
+func (s stubAccrual) Ping(context.Context) error {
+	return s.pingErr
+}
+
+func (s stubAccrual) LastCycle() time.Time {
+	return s.lastCycle
+}
+
+func (s stubAccrual) PollInterval() time.Duration {
+	return 5 * time.Second
+}
+
+func TestHealthHandler_ServeHTTP(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewHealthHandler(logging.Discard()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestReadyHandler_ServeHTTP(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		db             stubDatabase
+		accrual        stubAccrual
+		drain          bool
+		wantCode       int
+		wantStatus     string
+		wantComponents map[string]string
+	}{
+		{
+			name:       "все зависимости в порядке",
+			db:         stubDatabase{version: 14},
+			accrual:    stubAccrual{lastCycle: now.Add(-3 * time.Second)},
+			wantCode:   http.StatusOK,
+			wantStatus: HealthOK,
+			wantComponents: map[string]string{
+				"database": HealthOK, "migrations": HealthOK, "accrual": HealthOK, "poller": HealthOK,
+			},
+		},
+		{
+			name:       "база недоступна",
+			db:         stubDatabase{pingErr: errors.New("connection refused"), versionErr: errors.New("connection refused")},
+			accrual:    stubAccrual{lastCycle: now},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: HealthFailing,
+			wantComponents: map[string]string{
+				"database": HealthFailing, "migrations": HealthFailing,
+			},
+		},
+		{
+			name:           "миграции не применены",
+			db:             stubDatabase{version: 13},
+			accrual:        stubAccrual{lastCycle: now},
+			wantCode:       http.StatusServiceUnavailable,
+			wantStatus:     HealthFailing,
+			wantComponents: map[string]string{"database": HealthOK, "migrations": HealthFailing},
+		},
+		{
+			name:           "миграция упала на полпути",
+			db:             stubDatabase{version: 14, dirty: true},
+			accrual:        stubAccrual{lastCycle: now},
+			wantCode:       http.StatusServiceUnavailable,
+			wantStatus:     HealthFailing,
+			wantComponents: map[string]string{"migrations": HealthFailing},
+		},
+		{
+			name:           "схема новее ожидаемой во время выкатки",
+			db:             stubDatabase{version: 15},
+			accrual:        stubAccrual{lastCycle: now},
+			wantCode:       http.StatusOK,
+			wantStatus:     HealthOK,
+			wantComponents: map[string]string{"migrations": HealthOK},
+		},
+		{
+			name:           "accrual недоступен и поллер отстал, но сервис готов",
+			db:             stubDatabase{version: 14},
+			accrual:        stubAccrual{pingErr: errors.New("timeout"), lastCycle: now.Add(-time.Minute)},
+			wantCode:       http.StatusOK,
+			wantStatus:     HealthOK,
+			wantComponents: map[string]string{"accrual": HealthFailing, "poller": HealthStale},
+		},
+		{
+			name:           "поллер ещё не отработал",
+			db:             stubDatabase{version: 14},
+			accrual:        stubAccrual{},
+			wantCode:       http.StatusOK,
+			wantStatus:     HealthOK,
+			wantComponents: map[string]string{"poller": HealthPending},
+		},
+		{
+			name:           "сервис останавливается",
+			db:             stubDatabase{version: 14},
+			accrual:        stubAccrual{lastCycle: now},
+			drain:          true,
+			wantCode:       http.StatusServiceUnavailable,
+			wantStatus:     HealthDraining,
+			wantComponents: map[string]string{"database": HealthOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewReadyHandler(tt.db, tt.accrual, 14, logging.Discard())
+			handler.SetClock(func() time.Time { return now })
+			if tt.drain {
+				handler.Drain()
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			var resp HealthResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantStatus, resp.Status)
+			for name, want := range tt.wantComponents {
+				assert.Equal(t, want, resp.Components[name].Status, name)
+			}
+		})
+	}
+}
+
+func TestReadyHandlerWithoutSchemaVersion(t *testing.T) {
+	handler := NewReadyHandler(stubDatabase{versionErr: errors.New("no schema_migrations")}, stubAccrual{}, 0, logging.Discard())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "migrations")
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/AlenaMolokova/diploma/internal/auth"
+)
+
+type KeySet interface {
+	JWKS() auth.JWKS
+}
+
+// JWKSHandler publishes the public keys access tokens can be verified with.
+type JWKSHandler struct {
+	keys   KeySet
+	logger *slog.Logger
+}
+
+func NewJWKSHandler(keys KeySet, logger *slog.Logger) *JWKSHandler {
+	return &JWKSHandler{keys: keys, logger: logger}
+}
+
+func (h *JWKSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(h.keys.JWKS()); err != nil {
+		h.logger.ErrorContext(r.Context(), "Failed to encode JWKS response", slog.Any("error", err))
+	}
+}
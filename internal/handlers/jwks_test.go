@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AlenaMolokova/diploma/internal/auth"
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticKeySet auth.JWKS
+
+func (s staticKeySet) JWKS() auth.JWKS {
+	return auth.JWKS(s)
+}
+
+func TestJWKSHandler_ServeHTTP(t *testing.T) {
+	keys := staticKeySet{Keys: []auth.JWK{{Kty: "OKP", Kid: "2024-01", Use: "sig", Alg: "EdDSA", Crv: "Ed25519", X: "abc"}}}
+
+	handler := NewJWKSHandler(keys, logging.Discard())
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"keys":[{"kty":"OKP","kid":"2024-01","use":"sig","alg":"EdDSA","crv":"Ed25519","x":"abc"}]}`, w.Body.String())
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+)
+
+// NextCursorHeader carries the cursor of the next page of the orders and
+// withdrawals listings. The listings answer with a bare JSON array, as they
+// did before pagination, so the cursor cannot go in the body.
+const NextCursorHeader = "X-Next-Cursor"
+
+var errInvalidListQuery = errors.New("invalid listing query")
+
+// listQuery holds the query parameters the orders and withdrawals listings
+// share. A zero limit returns every matching row, as an unpaginated request
+// always did.
+type listQuery struct {
+	since time.Time
+	until time.Time
+	after models.ListCursor
+	limit int
+}
+
+// parseListQuery reads the from, to, limit and cursor query parameters.
+func parseListQuery(query url.Values) (listQuery, error) {
+	var q listQuery
+	for name, dst := range map[string]*time.Time{"from": &q.since, "to": &q.until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return listQuery{}, errInvalidListQuery
+			}
+			*dst = t
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > constants.MaxListPageSize {
+			return listQuery{}, errInvalidListQuery
+		}
+		q.limit = limit
+	}
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decodeListCursor(value)
+		if err != nil {
+			return listQuery{}, errInvalidListQuery
+		}
+		q.after = cursor
+	}
+	return q, nil
+}
+
+// fetchLimit is the limit to query with: one more than the page size, so the
+// caller can tell whether another page follows.
+func (q listQuery) fetchLimit() int {
+	if q.limit == 0 {
+		return 0
+	}
+	return q.limit + 1
+}
+
+// parseAmountRange reads an inclusive amount range from the named query
+// parameters. Either end may be missing.
+func parseAmountRange(query url.Values, minName, maxName string) (lo, hi *money.Amount, err error) {
+	parse := func(name string) (*money.Amount, error) {
+		value := query.Get(name)
+		if value == "" {
+			return nil, nil
+		}
+		a, err := money.Parse(value)
+		if err != nil {
+			return nil, errInvalidListQuery
+		}
+		return &a, nil
+	}
+	if lo, err = parse(minName); err != nil {
+		return nil, nil, err
+	}
+	if hi, err = parse(maxName); err != nil {
+		return nil, nil, err
+	}
+	return lo, hi, nil
+}
+
+// parseStatuses reads the order statuses to list, given as repeated or
+// comma-separated status parameters.
+func parseStatuses(query url.Values) ([]string, error) {
+	var statuses []string
+	for _, value := range query["status"] {
+		for _, status := range strings.Split(value, ",") {
+			switch status {
+			case constants.StatusNew, constants.StatusRegistered, constants.StatusProcessing,
+				constants.StatusProcessed, constants.StatusInvalid:
+				statuses = append(statuses, status)
+			default:
+				return nil, errInvalidListQuery
+			}
+		}
+	}
+	return statuses, nil
+}
+
+// encodeListCursor makes an opaque cursor from the time and ID of the last
+// row of a page.
+func encodeListCursor(c models.ListCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d", c.At.UnixMicro(), c.ID)))
+}
+
+func decodeListCursor(cursor string) (models.ListCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return models.ListCursor{}, err
+	}
+	at, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return models.ListCursor{}, errInvalidListQuery
+	}
+	micros, err := strconv.ParseInt(at, 10, 64)
+	if err != nil {
+		return models.ListCursor{}, errInvalidListQuery
+	}
+	rowID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || rowID <= 0 {
+		return models.ListCursor{}, errInvalidListQuery
+	}
+	return models.ListCursor{At: time.UnixMicro(micros), ID: rowID}, nil
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListCursorRoundTrip(t *testing.T) {
+	cursor := models.ListCursor{At: time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC), ID: 42}
+
+	decoded, err := decodeListCursor(encodeListCursor(cursor))
+	require.NoError(t, err)
+	assert.True(t, cursor.At.Equal(decoded.At))
+	assert.Equal(t, cursor.ID, decoded.ID)
+
+	for _, bad := range []string{"!!!", "MTIz", "YWJjLjE", "MTIzLjA"} {
+		_, err := decodeListCursor(bad)
+		assert.Error(t, err, bad)
+	}
+}
@@ -2,15 +2,19 @@ package handlers
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/logging"
 	"github.com/AlenaMolokova/diploma/internal/models"
 	"github.com/AlenaMolokova/diploma/internal/utils"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -18,13 +22,26 @@ type UserGetter interface {
 	GetUserByLogin(ctx context.Context, login string) (models.User, error)
 }
 
+type LoginThrottler interface {
+	Check(ctx context.Context, login, ip string) (time.Duration, error)
+	Fail(ctx context.Context, login, ip string) error
+	Succeed(ctx context.Context, login string) error
+}
+
+type AuditRecorder interface {
+	RecordAudit(ctx context.Context, entry models.AuditEntry) error
+}
+
 type LoginHandler struct {
-	store     UserGetter
-	jwtSecret string
+	store    UserGetter
+	tokens   TokenIssuer
+	throttle LoginThrottler
+	audit    AuditRecorder
+	logger   *slog.Logger
 }
 
-func NewLoginHandler(store UserGetter, jwtSecret string) *LoginHandler {
-	return &LoginHandler{store: store, jwtSecret: jwtSecret}
+func NewLoginHandler(store UserGetter, tokens TokenIssuer, throttle LoginThrottler, audit AuditRecorder, logger *slog.Logger) *LoginHandler {
+	return &LoginHandler{store: store, tokens: tokens, throttle: throttle, audit: audit, logger: logger}
 }
 
 func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -32,48 +49,105 @@ func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Login    string `json:"login"`
 		Password string `json:"password"`
 	}
+	ctx := r.Context()
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Failed to decode login request: %v", err)
+		h.logger.InfoContext(ctx, "Failed to decode login request", slog.Any("error", err))
 		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid request format")
 		return
 	}
 
 	if req.Login == "" || req.Password == "" {
-		log.Printf("Empty login or password")
+		h.logger.InfoContext(ctx, "Empty login or password")
 		utils.WriteJSONError(w, http.StatusBadRequest, "Login and password are required")
 		return
 	}
 
-	user, err := h.store.GetUserByLogin(r.Context(), req.Login)
+	ip := clientIP(r)
+	ctx = logging.With(ctx, "login", req.Login, "ip", ip)
+	wait, err := h.throttle.Check(ctx, req.Login, ip)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to check login throttle", slog.Any("error", err))
+		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if wait > 0 {
+		h.logger.WarnContext(ctx, "Login is locked", slog.Duration("wait", wait))
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		utils.WriteJSONError(w, http.StatusTooManyRequests, "Too many login attempts")
+		return
+	}
+
+	user, err := h.store.GetUserByLogin(ctx, req.Login)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Printf("User not found: %s", req.Login)
+		if errors.Is(err, models.ErrUserNotFound) {
+			h.logger.InfoContext(ctx, "User not found")
+			h.fail(ctx, req.Login, ip, 0)
 			utils.WriteJSONError(w, http.StatusUnauthorized, "Invalid login or password")
 		} else {
-			log.Printf("Failed to get user %s: %v", req.Login, err)
+			h.logger.ErrorContext(ctx, "Failed to get user", slog.Any("error", err))
 			utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
 		}
 		return
 	}
 
+	ctx = logging.With(ctx, logging.UserIDKey, user.ID)
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		log.Printf("Invalid password for user %s", req.Login)
+		h.logger.InfoContext(ctx, "Invalid password")
+		h.fail(ctx, req.Login, ip, user.ID)
 		utils.WriteJSONError(w, http.StatusUnauthorized, "Invalid login or password")
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
-	})
-	tokenString, err := token.SignedString([]byte(h.jwtSecret))
+	if err := h.throttle.Succeed(ctx, req.Login); err != nil {
+		h.logger.ErrorContext(ctx, "Failed to reset login failures", slog.Any("error", err))
+	}
+
+	tokens, err := h.tokens.IssueTokens(ctx, user.ID)
 	if err != nil {
-		log.Printf("Failed to sign token: %v", err)
+		h.logger.ErrorContext(ctx, "Failed to issue tokens", slog.Any("error", err))
 		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	w.Header().Set("Authorization", "Bearer "+tokenString)
-	w.WriteHeader(http.StatusOK)
-	log.Printf("User %s authenticated", req.Login)
-}
\ No newline at end of file
+	h.record(ctx, models.AuditEntry{
+		ActorID:      user.ID,
+		Action:       constants.AuditUserLogin,
+		TargetUserID: user.ID,
+		SourceIP:     ip,
+	})
+	writeTokens(w, r, h.logger, tokens)
+	h.logger.InfoContext(ctx, "User authenticated")
+}
+
+// fail counts a failed attempt against login and ip. userID is the account
+// the login belongs to, or zero for an unknown login.
+func (h *LoginHandler) fail(ctx context.Context, login, ip string, userID int64) {
+	if err := h.throttle.Fail(ctx, login, ip); err != nil {
+		h.logger.ErrorContext(ctx, "Failed to record login failure", slog.Any("error", err))
+	}
+	h.record(ctx, models.AuditEntry{
+		Action:       constants.AuditUserLoginFailed,
+		TargetUserID: userID,
+		SourceIP:     ip,
+		Details:      map[string]any{"login": login},
+	})
+}
+
+// record writes a login audit entry. A failure is logged rather than
+// turning the login away.
+func (h *LoginHandler) record(ctx context.Context, entry models.AuditEntry) {
+	if err := h.audit.RecordAudit(ctx, entry); err != nil {
+		h.logger.ErrorContext(ctx, "Failed to record audit entry",
+			slog.String("action", entry.Action), slog.Any("error", err))
+	}
+}
+
+// clientIP is the address the request came from. Behind a proxy RemoteAddr is
+// rewritten from the forwarding headers when TRUST_PROXY_HEADERS is set.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -3,14 +3,20 @@ package handlers
 import (
 	"bytes"
 	"context"
-	"database/sql"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/AlenaMolokova/diploma/internal/auth"
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/middleware"
 	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/testutils"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -31,6 +37,41 @@ func (m *MockUserStorage) GetUserByLogin(ctx context.Context, login string) (mod
 	return args.Get(0).(models.User), args.Error(1)
 }
 
+type MockLoginThrottler struct {
+	mock.Mock
+}
+
+func (m *MockLoginThrottler) Check(ctx context.Context, login, ip string) (time.Duration, error) {
+	args := m.Called(ctx, login, ip)
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *MockLoginThrottler) Fail(ctx context.Context, login, ip string) error {
+	args := m.Called(ctx, login, ip)
+	return args.Error(0)
+}
+
+func (m *MockLoginThrottler) Succeed(ctx context.Context, login string) error {
+	args := m.Called(ctx, login)
+	return args.Error(0)
+}
+
+type MockAuditRecorder struct {
+	mock.Mock
+}
+
+func (m *MockAuditRecorder) RecordAudit(ctx context.Context, entry models.AuditEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+// auditAction matches an audit entry by its action and source address.
+func auditAction(action string) interface{} {
+	return mock.MatchedBy(func(entry models.AuditEntry) bool {
+		return entry.Action == action && entry.SourceIP == "192.0.2.1"
+	})
+}
+
 func TestLoginHandler_ServeHTTP(t *testing.T) {
 	userID := int64(1)
 	ctx := context.Background()
@@ -63,7 +104,7 @@ func TestLoginHandler_ServeHTTP(t *testing.T) {
 			name: "неверный логин",
 			body: `{"login":"testuser","password":"testpass"}`,
 			setupMocks: func(us *MockUserStorage) {
-				us.On("GetUserByLogin", mock.Anything, "testuser").Return(models.User{}, sql.ErrNoRows)
+				us.On("GetUserByLogin", mock.Anything, "testuser").Return(models.User{}, models.ErrUserNotFound)
 			},
 			expectedStatus: http.StatusUnauthorized,
 			expectedBody:   `{"error":"Invalid login or password"}`,
@@ -123,9 +164,24 @@ func TestLoginHandler_ServeHTTP(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			us := &MockUserStorage{}
 			tt.setupMocks(us)
+			lt := &MockLoginThrottler{}
+			lt.On("Check", mock.Anything, "testuser", "192.0.2.1").Return(time.Duration(0), nil).Maybe()
+			ar := &MockAuditRecorder{}
+			if tt.expectedStatus == http.StatusUnauthorized {
+				lt.On("Fail", mock.Anything, "testuser", "192.0.2.1").Return(nil).Once()
+				ar.On("RecordAudit", mock.Anything, auditAction(constants.AuditUserLoginFailed)).Return(nil).Once()
+			}
+			if tt.expectedToken {
+				lt.On("Succeed", mock.Anything, "testuser").Return(nil).Once()
+				ar.On("RecordAudit", mock.Anything, auditAction(constants.AuditUserLogin)).Return(nil).Once()
+			}
+			ts := &testutils.MockTokenStore{}
+			ts.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("models.RefreshToken")).Return(nil).Maybe()
+			ts.On("GetUserRole", mock.Anything, mock.Anything).Return("user", nil).Maybe()
 
-			handler := NewLoginHandler(us, jwtSecret)
+			handler := NewLoginHandler(us, auth.NewService(ts, testutils.HMACKeyring(jwtSecret), time.Minute, time.Hour), lt, ar, logging.Discard())
 			req := httptest.NewRequest(http.MethodPost, "/api/user/login", bytes.NewBufferString(tt.body))
+			req.RemoteAddr = "192.0.2.1:54321"
 			req = req.WithContext(ctx)
 			w := httptest.NewRecorder()
 
@@ -134,11 +190,37 @@ func TestLoginHandler_ServeHTTP(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, w.Code)
 			if tt.expectedBody != "" {
 				assert.JSONEq(t, tt.expectedBody, w.Body.String())
-			} else {
-				assert.Empty(t, w.Body.String())
 			}
 
 			if tt.expectedToken {
+				var tokens auth.Tokens
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+				assert.NotEmpty(t, tokens.RefreshToken)
+				assert.Equal(t, "Bearer "+tokens.AccessToken, w.Header().Get("Authorization"))
+
+				cookies := map[string]*http.Cookie{}
+				for _, cookie := range w.Result().Cookies() {
+					cookies[cookie.Name] = cookie
+				}
+				session := cookies[middleware.SessionCookie]
+				if assert.NotNil(t, session) {
+					assert.Equal(t, tokens.AccessToken, session.Value)
+					assert.True(t, session.HttpOnly)
+					assert.True(t, session.Secure)
+					assert.Equal(t, http.SameSiteLaxMode, session.SameSite)
+				}
+				refresh := cookies[middleware.RefreshCookie]
+				if assert.NotNil(t, refresh) {
+					assert.Equal(t, tokens.RefreshToken, refresh.Value)
+					assert.True(t, refresh.HttpOnly)
+					assert.Equal(t, http.SameSiteStrictMode, refresh.SameSite)
+				}
+				csrf := cookies[middleware.CSRFCookie]
+				if assert.NotNil(t, csrf) {
+					assert.NotEmpty(t, csrf.Value)
+					assert.False(t, csrf.HttpOnly, "the frontend has to read the CSRF token")
+				}
+
 				tokenHeader := w.Header().Get("Authorization")
 				assert.NotEmpty(t, tokenHeader)
 				assert.True(t, strings.HasPrefix(tokenHeader, "Bearer "))
@@ -156,6 +238,68 @@ func TestLoginHandler_ServeHTTP(t *testing.T) {
 			}
 
 			us.AssertExpectations(t)
+			lt.AssertExpectations(t)
+			ar.AssertExpectations(t)
 		})
 	}
 }
+
+func TestLoginHandler_Throttle(t *testing.T) {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("testpass"), bcrypt.DefaultCost)
+	body := `{"login":"testuser","password":"testpass"}`
+
+	t.Run("вход заблокирован", func(t *testing.T) {
+		us := &MockUserStorage{}
+		lt := &MockLoginThrottler{}
+		ar := &MockAuditRecorder{}
+		lt.On("Check", mock.Anything, "testuser", "192.0.2.1").Return(2500*time.Millisecond, nil)
+
+		handler := NewLoginHandler(us, auth.NewService(&testutils.MockTokenStore{}, testutils.HMACKeyring("secret"), time.Minute, time.Hour), lt, ar, logging.Discard())
+		req := httptest.NewRequest(http.MethodPost, "/api/user/login", bytes.NewBufferString(body))
+		req.RemoteAddr = "192.0.2.1:54321"
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "3", w.Header().Get("Retry-After"))
+		assert.JSONEq(t, `{"error":"Too many login attempts"}`, w.Body.String())
+		us.AssertNotCalled(t, "GetUserByLogin", mock.Anything, mock.Anything)
+	})
+
+	t.Run("ошибка проверки блокировки", func(t *testing.T) {
+		us := &MockUserStorage{}
+		lt := &MockLoginThrottler{}
+		ar := &MockAuditRecorder{}
+		lt.On("Check", mock.Anything, "testuser", "192.0.2.1").Return(time.Duration(0), errors.New("db error"))
+
+		handler := NewLoginHandler(us, auth.NewService(&testutils.MockTokenStore{}, testutils.HMACKeyring("secret"), time.Minute, time.Hour), lt, ar, logging.Discard())
+		req := httptest.NewRequest(http.MethodPost, "/api/user/login", bytes.NewBufferString(body))
+		req.RemoteAddr = "192.0.2.1:54321"
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+
+	t.Run("ошибка учёта неудачной попытки не меняет ответ", func(t *testing.T) {
+		us := &MockUserStorage{}
+		us.On("GetUserByLogin", mock.Anything, "testuser").Return(models.User{ID: 1, Login: "testuser", Password: string(hashedPassword)}, nil)
+		ar := &MockAuditRecorder{}
+		ar.On("RecordAudit", mock.Anything, auditAction(constants.AuditUserLoginFailed)).Return(errors.New("db error"))
+		lt := &MockLoginThrottler{}
+		lt.On("Check", mock.Anything, "testuser", "192.0.2.1").Return(time.Duration(0), nil)
+		lt.On("Fail", mock.Anything, "testuser", "192.0.2.1").Return(errors.New("db error"))
+
+		handler := NewLoginHandler(us, auth.NewService(&testutils.MockTokenStore{}, testutils.HMACKeyring("secret"), time.Minute, time.Hour), lt, ar, logging.Discard())
+		req := httptest.NewRequest(http.MethodPost, "/api/user/login", bytes.NewBufferString(`{"login":"testuser","password":"wrongpass"}`))
+		req.RemoteAddr = "192.0.2.1:54321"
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		lt.AssertExpectations(t)
+	})
+}
@@ -3,10 +3,11 @@ package handlers
 import (
 	"errors"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 
+	"github.com/AlenaMolokova/diploma/internal/logging"
 	"github.com/AlenaMolokova/diploma/internal/middleware"
 	"github.com/AlenaMolokova/diploma/internal/usecase"
 	"github.com/AlenaMolokova/diploma/internal/utils"
@@ -16,26 +17,29 @@ import (
 type OrderHandler struct {
 	orderUC   *usecase.OrderUseCase
 	validator validation.OrderValidator
+	logger    *slog.Logger
 }
 
-func NewOrderHandler(orderUC *usecase.OrderUseCase) *OrderHandler {
+func NewOrderHandler(orderUC *usecase.OrderUseCase, logger *slog.Logger) *OrderHandler {
 	return &OrderHandler{
 		orderUC:   orderUC,
 		validator: validation.NewLuhnValidator(),
+		logger:    logger,
 	}
 }
 
 func (h *OrderHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		log.Printf("Unauthorized: missing user_id in context")
+		h.logger.WarnContext(ctx, "Unauthorized: missing user_id in context")
 		utils.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Failed to read request body: %v", err)
+		h.logger.InfoContext(ctx, "Failed to read request body", slog.Any("error", err))
 		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
@@ -43,34 +47,35 @@ func (h *OrderHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	orderNumber := strings.TrimSpace(string(body))
 	if orderNumber == "" {
-		log.Printf("Empty order number")
+		h.logger.InfoContext(ctx, "Empty order number")
 		utils.WriteJSONError(w, http.StatusBadRequest, "Order number is required")
 		return
 	}
 
+	ctx = logging.With(ctx, logging.OrderKey, orderNumber)
 	if !h.validator.ValidateOrderNumber(orderNumber) {
-		log.Printf("Order number '%s' failed validation", orderNumber)
+		h.logger.InfoContext(ctx, "Order number failed validation")
 		utils.WriteJSONError(w, http.StatusUnprocessableEntity, "Invalid order number")
 		return
 	}
 
-	err = h.orderUC.ProcessNewOrder(r.Context(), userID, orderNumber)
+	err = h.orderUC.ProcessNewOrder(ctx, userID, orderNumber)
 	if err != nil {
 		if errors.Is(err, usecase.ErrOrderAlreadyExists) {
-			log.Printf("Order %s already exists for user %d", orderNumber, userID)
+			h.logger.InfoContext(ctx, "Order already uploaded by the user")
 			w.WriteHeader(http.StatusOK)
 			return
 		}
 		if errors.Is(err, usecase.ErrOrderBelongsToOtherUser) {
-			log.Printf("Order %s belongs to another user", orderNumber)
+			h.logger.InfoContext(ctx, "Order belongs to another user")
 			utils.WriteJSONError(w, http.StatusConflict, "Order already taken by another user")
 			return
 		}
-		log.Printf("Failed to process order %s: %v", orderNumber, err)
+		h.logger.ErrorContext(ctx, "Failed to process order", slog.Any("error", err))
 		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	log.Printf("Order %s created for user %d", orderNumber, userID)
+	h.logger.InfoContext(ctx, "Order created")
 	w.WriteHeader(http.StatusAccepted)
 }
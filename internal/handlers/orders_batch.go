@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/usecase"
+	"github.com/AlenaMolokova/diploma/internal/utils"
+)
+
+// maxOrderBatchBody bounds the body of a batch upload, generously for
+// MaxOrderBatchSize numbers in either format.
+const maxOrderBatchBody = 1 << 20
+
+var (
+	errEmptyOrderBatch    = errors.New("no order numbers in batch")
+	errOrderBatchTooLarge = errors.New("too many order numbers in batch")
+)
+
+type OrderBatchUploader interface {
+	ProcessNewOrders(ctx context.Context, userID int64, numbers []string) ([]usecase.OrderUploadResult, error)
+}
+
+type OrderUploadResponse struct {
+	Number string `json:"number"`
+	Result string `json:"result"`
+}
+
+// OrderBatchHandler uploads many orders at once. The body is either a JSON
+// array of numbers, with Content-Type application/json, or one number per
+// line. Every number gets a result; the request itself only fails when the
+// body cannot be read at all.
+type OrderBatchHandler struct {
+	orderUC OrderBatchUploader
+	logger  *slog.Logger
+}
+
+func NewOrderBatchHandler(orderUC OrderBatchUploader, logger *slog.Logger) *OrderBatchHandler {
+	return &OrderBatchHandler{orderUC: orderUC, logger: logger}
+}
+
+func (h *OrderBatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		h.logger.WarnContext(ctx, "Unauthorized: missing user_id in context")
+		utils.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxOrderBatchBody))
+	if err != nil {
+		h.logger.InfoContext(ctx, "Failed to read request body", slog.Any("error", err))
+		utils.WriteJSONError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+		return
+	}
+	defer r.Body.Close()
+
+	numbers, err := parseOrderBatch(r.Header.Get("Content-Type"), body)
+	switch {
+	case errors.Is(err, errEmptyOrderBatch):
+		utils.WriteJSONError(w, http.StatusBadRequest, "Order numbers are required")
+		return
+	case errors.Is(err, errOrderBatchTooLarge):
+		utils.WriteJSONError(w, http.StatusRequestEntityTooLarge, "Too many order numbers in batch")
+		return
+	case err != nil:
+		h.logger.InfoContext(ctx, "Invalid order batch", slog.Any("error", err))
+		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	results, err := h.orderUC.ProcessNewOrders(ctx, userID, numbers)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to process order batch", slog.Any("error", err))
+		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	response := make([]OrderUploadResponse, len(results))
+	for i, result := range results {
+		response[i] = OrderUploadResponse{Number: result.Number, Result: result.Outcome}
+	}
+	writeJSON(w, r, h.logger, http.StatusOK, response)
+}
+
+// parseOrderBatch reads the numbers of a batch upload. JSON arrays may hold
+// the numbers as strings or as JSON numbers; in the line format blank lines
+// are skipped.
+func parseOrderBatch(contentType string, body []byte) ([]string, error) {
+	var numbers []string
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/json" {
+		var items []json.RawMessage
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			var number string
+			if err := json.Unmarshal(item, &number); err != nil {
+				var n json.Number
+				if err := json.Unmarshal(item, &n); err != nil {
+					return nil, err
+				}
+				number = n.String()
+			}
+			numbers = append(numbers, strings.TrimSpace(number))
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				numbers = append(numbers, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case len(numbers) == 0:
+		return nil, errEmptyOrderBatch
+	case len(numbers) > constants.MaxOrderBatchSize:
+		return nil, errOrderBatchTooLarge
+	}
+	return numbers, nil
+}
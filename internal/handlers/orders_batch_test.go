@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockOrderBatchUploader struct {
+	mock.Mock
+}
+
+func (m *mockOrderBatchUploader) ProcessNewOrders(ctx context.Context, userID int64, numbers []string) ([]usecase.OrderUploadResult, error) {
+	args := m.Called(ctx, userID, numbers)
+	return args.Get(0).([]usecase.OrderUploadResult), args.Error(1)
+}
+
+func TestOrderBatchHandler_ServeHTTP(t *testing.T) {
+	userID := int64(1)
+	uploaded := []usecase.OrderUploadResult{
+		{Number: "79927398713", Outcome: constants.UploadAccepted},
+		{Number: "12345678900", Outcome: constants.UploadInvalid},
+	}
+	uploadedBody := `[{"number":"79927398713","result":"accepted"},{"number":"12345678900","result":"invalid"}]`
+
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		setupMocks     func(*mockOrderBatchUploader)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:        "JSON-массив строк и чисел",
+			contentType: "application/json; charset=utf-8",
+			body:        `["79927398713", 12345678900]`,
+			setupMocks: func(m *mockOrderBatchUploader) {
+				m.On("ProcessNewOrders", mock.Anything, userID, []string{"79927398713", "12345678900"}).Return(uploaded, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   uploadedBody,
+		},
+		{
+			name:        "номера по одному на строку",
+			contentType: "text/plain",
+			body:        "79927398713\r\n\n  12345678900  \n",
+			setupMocks: func(m *mockOrderBatchUploader) {
+				m.On("ProcessNewOrders", mock.Anything, userID, []string{"79927398713", "12345678900"}).Return(uploaded, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   uploadedBody,
+		},
+		{
+			name:           "пустая пачка",
+			contentType:    "text/plain",
+			body:           "\n\n",
+			setupMocks:     func(m *mockOrderBatchUploader) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Order numbers are required"}`,
+		},
+		{
+			name:           "некорректный JSON",
+			contentType:    "application/json",
+			body:           `{"orders":["79927398713"]}`,
+			setupMocks:     func(m *mockOrderBatchUploader) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Invalid request body"}`,
+		},
+		{
+			name:           "слишком большая пачка",
+			contentType:    "text/plain",
+			body:           strings.Repeat("79927398713\n", constants.MaxOrderBatchSize+1),
+			setupMocks:     func(m *mockOrderBatchUploader) {},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedBody:   `{"error":"Too many order numbers in batch"}`,
+		},
+		{
+			name:        "внутренняя ошибка",
+			contentType: "text/plain",
+			body:        "79927398713",
+			setupMocks: func(m *mockOrderBatchUploader) {
+				m.On("ProcessNewOrders", mock.Anything, userID, []string{"79927398713"}).Return([]usecase.OrderUploadResult(nil), errors.New("db error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"Internal server error"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploader := new(mockOrderBatchUploader)
+			tt.setupMocks(uploader)
+			handler := NewOrderBatchHandler(uploader, logging.Discard())
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/orders/batch", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserKey{}, map[middleware.UserID]interface{}{
+				middleware.UserID("id"): userID,
+			}))
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			uploader.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOrderBatchHandlerUnauthorized(t *testing.T) {
+	handler := NewOrderBatchHandler(new(mockOrderBatchUploader), logging.Discard())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/user/orders/batch", strings.NewReader("79927398713")))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
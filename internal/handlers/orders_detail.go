@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/AlenaMolokova/diploma/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+type OrderDetailGetter interface {
+	GetUserOrder(ctx context.Context, userID int64, number string) (models.OrderDetails, error)
+}
+
+// OrderDetailResponse is an order as the orders listing shows it, with the
+// history of its status changes and accrual checks, oldest first.
+type OrderDetailResponse struct {
+	OrderResponse
+	History []OrderHistoryResponse `json:"history"`
+}
+
+type OrderHistoryResponse struct {
+	Kind       string        `json:"kind"`
+	FromStatus string        `json:"from_status,omitempty"`
+	Status     string        `json:"status,omitempty"`
+	Outcome    string        `json:"outcome,omitempty"`
+	Accrual    *money.Amount `json:"accrual,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	At         string        `json:"at"`
+}
+
+// OrderDetailHandler shows one order of the user with its history. Orders of
+// other users are answered with 404, as missing ones are.
+type OrderDetailHandler struct {
+	store  OrderDetailGetter
+	logger *slog.Logger
+}
+
+func NewOrderDetailHandler(store OrderDetailGetter, logger *slog.Logger) *OrderDetailHandler {
+	return &OrderDetailHandler{store: store, logger: logger}
+}
+
+func (h *OrderDetailHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		h.logger.WarnContext(ctx, "Unauthorized: missing user_id in context")
+		utils.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	details, err := h.store.GetUserOrder(ctx, userID, chi.URLParam(r, OrderNumberParam))
+	if errors.Is(err, models.ErrOrderNotFound) {
+		utils.WriteJSONError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to get order", slog.Any("error", err))
+		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	order := details.Order
+	response := OrderDetailResponse{
+		OrderResponse: OrderResponse{
+			Number:     order.Number,
+			Status:     order.Status,
+			Accrual:    order.Accrual,
+			UploadedAt: order.UploadedAt.Time.Format(time.RFC3339),
+		},
+		History: make([]OrderHistoryResponse, len(details.History)),
+	}
+	for i, entry := range details.History {
+		response.History[i] = OrderHistoryResponse{
+			Kind:       entry.Kind,
+			FromStatus: entry.FromStatus,
+			Status:     entry.Status,
+			Outcome:    entry.Outcome,
+			Accrual:    entry.Accrual,
+			Error:      entry.Error,
+			At:         entry.CreatedAt.Format(time.RFC3339),
+		}
+	}
+	writeJSON(w, r, h.logger, http.StatusOK, response)
+}
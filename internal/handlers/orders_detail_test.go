@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockOrderDetailGetter struct {
+	mock.Mock
+}
+
+func (m *mockOrderDetailGetter) GetUserOrder(ctx context.Context, userID int64, number string) (models.OrderDetails, error) {
+	args := m.Called(ctx, userID, number)
+	return args.Get(0).(models.OrderDetails), args.Error(1)
+}
+
+func TestOrderDetailHandler_ServeHTTP(t *testing.T) {
+	uploadedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	accrual := money.MustParse("500")
+	details := models.OrderDetails{
+		Order: models.Order{
+			UserID:     1,
+			Number:     "79927398713",
+			Status:     constants.StatusProcessed,
+			Accrual:    accrual,
+			UploadedAt: pgtype.Timestamptz{Time: uploadedAt, Valid: true},
+		},
+		History: []models.OrderHistoryEntry{
+			{Kind: constants.HistoryStatusChange, Status: constants.StatusNew, CreatedAt: uploadedAt},
+			{Kind: constants.HistoryAccrualCheck, Outcome: constants.CheckNoContent, Error: "order is still processing", CreatedAt: uploadedAt.Add(time.Second)},
+			{Kind: constants.HistoryAccrualCheck, Outcome: constants.CheckAccrual, Status: constants.StatusProcessed, Accrual: &accrual, CreatedAt: uploadedAt.Add(2 * time.Second)},
+			{Kind: constants.HistoryStatusChange, FromStatus: constants.StatusNew, Status: constants.StatusProcessed, Accrual: &accrual, CreatedAt: uploadedAt.Add(2 * time.Second)},
+		},
+	}
+	detailsBody := `{
+		"number":"79927398713","status":"PROCESSED","accrual":500,"uploaded_at":"2024-05-01T12:00:00Z",
+		"history":[
+			{"kind":"status_change","status":"NEW","at":"2024-05-01T12:00:00Z"},
+			{"kind":"accrual_check","outcome":"204","error":"order is still processing","at":"2024-05-01T12:00:01Z"},
+			{"kind":"accrual_check","outcome":"accrual","status":"PROCESSED","accrual":500,"at":"2024-05-01T12:00:02Z"},
+			{"kind":"status_change","from_status":"NEW","status":"PROCESSED","accrual":500,"at":"2024-05-01T12:00:02Z"}
+		]
+	}`
+
+	tests := []struct {
+		name           string
+		setupMocks     func(*mockOrderDetailGetter)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "заказ с историей",
+			setupMocks: func(m *mockOrderDetailGetter) {
+				m.On("GetUserOrder", mock.Anything, int64(1), "79927398713").Return(details, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   detailsBody,
+		},
+		{
+			name: "заказ не найден или чужой",
+			setupMocks: func(m *mockOrderDetailGetter) {
+				m.On("GetUserOrder", mock.Anything, int64(1), "79927398713").Return(models.OrderDetails{}, models.ErrOrderNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"Order not found"}`,
+		},
+		{
+			name: "внутренняя ошибка",
+			setupMocks: func(m *mockOrderDetailGetter) {
+				m.On("GetUserOrder", mock.Anything, int64(1), "79927398713").Return(models.OrderDetails{}, errors.New("db error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"Internal server error"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := new(mockOrderDetailGetter)
+			tt.setupMocks(store)
+			handler := NewOrderDetailHandler(store, logging.Discard())
+
+			req := adminRequestWith(http.MethodGet, "/api/user/orders/79927398713", "", map[string]string{OrderNumberParam: "79927398713"})
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			store.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOrderDetailHandlerUnauthorized(t *testing.T) {
+	handler := NewOrderDetailHandler(new(mockOrderDetailGetter), logging.Discard())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/user/orders/79927398713", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
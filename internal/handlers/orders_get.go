@@ -3,75 +3,115 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/AlenaMolokova/diploma/internal/middleware"
 	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
 	"github.com/AlenaMolokova/diploma/internal/utils"
 )
 
 type OrderGetter interface {
-	GetOrdersByUserID(ctx context.Context, userID int64) ([]models.Order, error)
+	ListOrders(ctx context.Context, filter models.OrderFilter) ([]models.Order, error)
 }
 
 type OrderGetHandler struct {
-	store OrderGetter
+	store  OrderGetter
+	logger *slog.Logger
 }
 
-func NewOrderGetHandler(store OrderGetter) *OrderGetHandler {
-	return &OrderGetHandler{store: store}
+func NewOrderGetHandler(store OrderGetter, logger *slog.Logger) *OrderGetHandler {
+	return &OrderGetHandler{store: store, logger: logger}
 }
 
 type OrderResponse struct {
-	Number     string  `json:"number"`
-	Status     string  `json:"status"`
-	Accrual    float64 `json:"accrual,omitempty"`
-	UploadedAt string  `json:"uploaded_at"`
+	Number     string       `json:"number"`
+	Status     string       `json:"status"`
+	Accrual    money.Amount `json:"accrual,omitempty"`
+	UploadedAt string       `json:"uploaded_at"`
 }
 
 func (h *OrderGetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		log.Printf("Unauthorized: missing user_id in context")
+		h.logger.WarnContext(ctx, "Unauthorized: missing user_id in context")
 		utils.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	orders, err := h.store.GetOrdersByUserID(r.Context(), userID)
+	filter, err := parseOrderFilter(r)
 	if err != nil {
-		log.Printf("Failed to get orders for user %d: %v", userID, err)
+		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid orders query")
+		return
+	}
+	filter.UserID = userID
+
+	orders, err := h.store.ListOrders(ctx, filter)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to get orders", slog.Any("error", err))
 		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
 	if len(orders) == 0 {
-		log.Printf("No orders found for user %d", userID)
+		h.logger.DebugContext(ctx, "No orders found")
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
+	if filter.Limit > 0 && len(orders) == filter.Limit {
+		orders = orders[:filter.Limit-1]
+		last := orders[len(orders)-1]
+		w.Header().Set(NextCursorHeader, encodeListCursor(models.ListCursor{At: last.UploadedAt.Time, ID: last.ID}))
+	}
+
 	response := make([]OrderResponse, len(orders))
 	for i, order := range orders {
-		resp := OrderResponse{
+		response[i] = OrderResponse{
 			Number:     order.Number,
 			Status:     order.Status,
+			Accrual:    order.Accrual,
 			UploadedAt: order.UploadedAt.Time.Format(time.RFC3339),
 		}
-		if order.Accrual.Valid {
-			resp.Accrual = order.Accrual.Float64
-		}
-		response[i] = resp
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Failed to encode orders response: %v", err)
+		h.logger.ErrorContext(ctx, "Failed to encode orders response", slog.Any("error", err))
 		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
-	log.Printf("Returned %d orders for user %d", len(orders), userID)
-}
\ No newline at end of file
+	h.logger.DebugContext(ctx, "Returned orders", slog.Int("count", len(orders)))
+}
+
+// parseOrderFilter reads the listing parameters together with the status,
+// min_accrual and max_accrual filters.
+func parseOrderFilter(r *http.Request) (models.OrderFilter, error) {
+	query := r.URL.Query()
+	list, err := parseListQuery(query)
+	if err != nil {
+		return models.OrderFilter{}, err
+	}
+	statuses, err := parseStatuses(query)
+	if err != nil {
+		return models.OrderFilter{}, err
+	}
+	minAccrual, maxAccrual, err := parseAmountRange(query, "min_accrual", "max_accrual")
+	if err != nil {
+		return models.OrderFilter{}, err
+	}
+	return models.OrderFilter{
+		Statuses:   statuses,
+		Since:      list.since,
+		Until:      list.until,
+		MinAccrual: minAccrual,
+		MaxAccrual: maxAccrual,
+		After:      list.after,
+		Limit:      list.fetchLimit(),
+	}, nil
+}
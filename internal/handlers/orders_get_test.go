@@ -9,8 +9,10 @@ import (
 	"time"
 
 	"github.com/AlenaMolokova/diploma/internal/handlers"
+	"github.com/AlenaMolokova/diploma/internal/logging"
 	"github.com/AlenaMolokova/diploma/internal/middleware"
 	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -20,25 +22,25 @@ type mockOrderGetter struct {
 	mock.Mock
 }
 
-func (m *mockOrderGetter) GetOrdersByUserID(ctx context.Context, userID int64) ([]models.Order, error) {
-	args := m.Called(ctx, userID)
+func (m *mockOrderGetter) ListOrders(ctx context.Context, filter models.OrderFilter) ([]models.Order, error) {
+	args := m.Called(ctx, filter)
 	return args.Get(0).([]models.Order), args.Error(1)
 }
 
 func TestOrderGetHandler(t *testing.T) {
 	mockGetter := new(mockOrderGetter)
-	handler := handlers.NewOrderGetHandler(mockGetter)
+	handler := handlers.NewOrderGetHandler(mockGetter, logging.Discard())
 
 	now := time.Now()
 	mockOrder := models.Order{
 		Number:     "1234567890",
 		Status:     "PROCESSED",
-		Accrual:    pgtype.Float8{Float64: 120.5, Valid: true},
+		Accrual:    money.MustParse("120.5"),
 		UploadedAt: pgtype.Timestamptz{Time: now, Valid: true},
 	}
 
 	t.Run("orders found", func(t *testing.T) {
-		mockGetter.On("GetOrdersByUserID", mock.Anything, int64(1)).Return([]models.Order{mockOrder}, nil)
+		mockGetter.On("ListOrders", mock.Anything, models.OrderFilter{UserID: 1}).Return([]models.Order{mockOrder}, nil)
 
 		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
 		userData := map[middleware.UserID]interface{}{
@@ -55,5 +57,52 @@ func TestOrderGetHandler(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Len(t, resp, 1, "expected one order in response")
 		assert.Equal(t, "1234567890", resp[0].Number)
+		assert.Empty(t, w.Header().Get(handlers.NextCursorHeader), "an unpaginated listing has no next page")
+	})
+
+	t.Run("page with filters", func(t *testing.T) {
+		uploadedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		minAccrual := money.MustParse("100")
+		mockGetter.On("ListOrders", mock.Anything, models.OrderFilter{
+			UserID:     2,
+			Statuses:   []string{"PROCESSED", "INVALID"},
+			Since:      since,
+			MinAccrual: &minAccrual,
+			Limit:      3,
+		}).Return([]models.Order{
+			{ID: 30, Number: "3", Status: "PROCESSED", Accrual: money.MustParse("300"), UploadedAt: pgtype.Timestamptz{Time: uploadedAt, Valid: true}},
+			{ID: 20, Number: "2", Status: "INVALID", Accrual: money.MustParse("200"), UploadedAt: pgtype.Timestamptz{Time: uploadedAt, Valid: true}},
+			{ID: 10, Number: "1", Status: "PROCESSED", Accrual: money.MustParse("100"), UploadedAt: pgtype.Timestamptz{Time: uploadedAt, Valid: true}},
+		}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/orders?limit=2&status=PROCESSED,INVALID&from=2024-05-01T00:00:00Z&min_accrual=100", nil)
+		userData := map[middleware.UserID]interface{}{
+			middleware.UserID("id"): int64(2),
+		}
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserKey{}, userData))
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp []handlers.OrderResponse
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Len(t, resp, 2, "the extra order only signals a next page")
+		assert.NotEmpty(t, w.Header().Get(handlers.NextCursorHeader))
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		for _, query := range []string{"limit=0", "limit=100000", "status=LOST", "from=yesterday", "max_accrual=lots", "min_accrual=1/3", "max_accrual=1e2", "min_accrual=0.001", "cursor=bm9wZQ"} {
+			req := httptest.NewRequest(http.MethodGet, "/orders?"+query, nil)
+			userData := map[middleware.UserID]interface{}{
+				middleware.UserID("id"): int64(1),
+			}
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserKey{}, userData))
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
 	})
 }
@@ -9,11 +9,12 @@ import (
 	"testing"
 
 	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/logging"
 	"github.com/AlenaMolokova/diploma/internal/middleware"
 	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
 	"github.com/AlenaMolokova/diploma/internal/testutils"
 	"github.com/AlenaMolokova/diploma/internal/usecase"
-	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -35,7 +36,7 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 		name           string
 		body           string
 		userID         interface{}
-		setupMocks     func(*testutils.MockOrderStorage, *testutils.MockLoyaltyClient, *testutils.MockBalanceStorage)
+		setupMocks     func(*testutils.MockOrderStorage, *testutils.MockLoyaltyClient)
 		expectedStatus int
 		expectedBody   string
 	}{
@@ -43,7 +44,7 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 			name:   "успешное создание заказа - StatusNew",
 			body:   validOrderNumber,
 			userID: userID,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return((*models.LoyaltyResponse)(nil), errors.New("not found"))
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
@@ -55,13 +56,14 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 			name:   "успешное создание заказа - StatusRegistered",
 			body:   validOrderNumber,
 			userID: userID,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return(&models.LoyaltyResponse{
 					Order:  validOrderNumber,
 					Status: constants.StatusRegistered,
 				}, nil)
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
+				os.On("ApplyAccrual", mock.Anything, validOrderNumber, constants.StatusRegistered, money.Amount(0)).Return(false, nil)
 			},
 			expectedStatus: http.StatusAccepted,
 			expectedBody:   "",
@@ -70,13 +72,14 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 			name:   "успешное создание заказа - StatusProcessing",
 			body:   validOrderNumber,
 			userID: userID,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return(&models.LoyaltyResponse{
 					Order:  validOrderNumber,
 					Status: constants.StatusProcessing,
 				}, nil)
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
+				os.On("ApplyAccrual", mock.Anything, validOrderNumber, constants.StatusProcessing, money.Amount(0)).Return(false, nil)
 			},
 			expectedStatus: http.StatusAccepted,
 			expectedBody:   "",
@@ -85,16 +88,15 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 			name:   "успешное создание заказа - StatusProcessed",
 			body:   validOrderNumber,
 			userID: userID,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return(&models.LoyaltyResponse{
 					Order:   validOrderNumber,
 					Status:  constants.StatusProcessed,
-					Accrual: 100.0,
+					Accrual: money.MustParse("100"),
 				}, nil)
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
-				bs.On("GetBalance", mock.Anything, userID).Return(pgtype.Float8{Float64: 0, Valid: true}, pgtype.Float8{}, nil)
-				bs.On("UpdateBalance", mock.Anything, userID, 100.0).Return(nil)
+				os.On("ApplyAccrual", mock.Anything, validOrderNumber, constants.StatusProcessed, money.MustParse("100")).Return(true, nil)
 			},
 			expectedStatus: http.StatusAccepted,
 			expectedBody:   "",
@@ -103,13 +105,14 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 			name:   "успешное создание заказа - StatusInvalid",
 			body:   validOrderNumber,
 			userID: userID,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return(&models.LoyaltyResponse{
 					Order:  validOrderNumber,
 					Status: constants.StatusInvalid,
 				}, nil)
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
+				os.On("ApplyAccrual", mock.Anything, validOrderNumber, constants.StatusInvalid, money.Amount(0)).Return(false, nil)
 			},
 			expectedStatus: http.StatusAccepted,
 			expectedBody:   "",
@@ -118,7 +121,7 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 			name:   "ошибка проверки заказа",
 			body:   validOrderNumber,
 			userID: userID,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return((*models.LoyaltyResponse)(nil), errors.New("rate limit"))
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
@@ -130,7 +133,7 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 			name:   "неавторизованный запрос",
 			body:   validOrderNumber,
 			userID: nil,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 			},
 			expectedStatus: http.StatusUnauthorized,
 			expectedBody:   `{"error":"Unauthorized"}`,
@@ -139,7 +142,7 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 			name:   "пустой номер заказа",
 			body:   "",
 			userID: userID,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 			},
 			expectedStatus: http.StatusBadRequest,
 			expectedBody:   `{"error":"Order number is required"}`,
@@ -148,7 +151,7 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 			name:   "неверный Luhn номер",
 			body:   "4532015112830367",
 			userID: userID,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 			},
 			expectedStatus: http.StatusUnprocessableEntity,
 			expectedBody:   `{"error":"Invalid order number"}`,
@@ -157,7 +160,7 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 			name:   "нечисловой номер заказа",
 			body:   "123abc",
 			userID: userID,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 			},
 			expectedStatus: http.StatusUnprocessableEntity,
 			expectedBody:   `{"error":"Invalid order number"}`,
@@ -166,7 +169,7 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 			name:   "заказ уже существует",
 			body:   validOrderNumber,
 			userID: userID,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{UserID: userID}, nil)
 			},
 			expectedStatus: http.StatusOK,
@@ -176,7 +179,7 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 			name:   "заказ принадлежит другому пользователю",
 			body:   validOrderNumber,
 			userID: userID,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{UserID: 2}, nil)
 			},
 			expectedStatus: http.StatusConflict,
@@ -186,7 +189,7 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 			name:   "внутренняя ошибка создания заказа",
 			body:   validOrderNumber,
 			userID: userID,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return((*models.LoyaltyResponse)(nil), errors.New("not found"))
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(errors.New("db error"))
@@ -195,22 +198,20 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 			expectedBody:   `{"error":"Internal server error"}`,
 		},
 		{
-			name:   "ошибка обновления баланса",
+			name:   "ошибка обновления баланса не отменяет загрузку",
 			body:   validOrderNumber,
 			userID: userID,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return(&models.LoyaltyResponse{
 					Order:   validOrderNumber,
 					Status:  constants.StatusProcessed,
-					Accrual: 100.0,
+					Accrual: money.MustParse("100"),
 				}, nil)
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
-				bs.On("GetBalance", mock.Anything, userID).Return(pgtype.Float8{Float64: 0, Valid: true}, pgtype.Float8{}, nil)
-				bs.On("UpdateBalance", mock.Anything, userID, 100.0).Return(errors.New("db error"))
+				os.On("ApplyAccrual", mock.Anything, validOrderNumber, constants.StatusProcessed, money.MustParse("100")).Return(false, errors.New("db error"))
 			},
-			expectedStatus: http.StatusInternalServerError,
-			expectedBody:   `{"error":"Internal server error"}`,
+			expectedStatus: http.StatusAccepted,
 		},
 	}
 
@@ -218,13 +219,11 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			os := &testutils.MockOrderStorage{}
 			lc := &testutils.MockLoyaltyClient{}
-			bs := &testutils.MockBalanceStorage{}
-			tt.setupMocks(os, lc, bs)
+			tt.setupMocks(os, lc)
 
 			loyaltyChecker := &MockLoyaltyChecker{mock: lc}
-			balanceUC := usecase.NewBalanceUseCase(bs)
-			uc := usecase.NewOrderUseCase(os, loyaltyChecker, balanceUC)
-			handler := NewOrderHandler(uc)
+			uc := usecase.NewOrderUseCase(os, loyaltyChecker)
+			handler := NewOrderHandler(uc, logging.Discard())
 
 			req := httptest.NewRequest(http.MethodPost, "/api/user/orders", bytes.NewBufferString(tt.body))
 			if tt.userID != nil {
@@ -247,7 +246,35 @@ func TestOrderHandlerServeHTTP(t *testing.T) {
 
 			os.AssertExpectations(t)
 			lc.AssertExpectations(t)
-			bs.AssertExpectations(t)
 		})
 	}
 }
+
+func TestOrderHandlerLogsOrderNumber(t *testing.T) {
+	validOrderNumber := "4532015112830366"
+
+	os := &testutils.MockOrderStorage{}
+	lc := &testutils.MockLoyaltyClient{}
+	os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
+	lc.On("CheckOrder", mock.Anything, validOrderNumber).Return((*models.LoyaltyResponse)(nil), errors.New("rate limit"))
+	os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
+
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "debug", "json")
+	assert.NoError(t, err)
+
+	uc := usecase.NewOrderUseCase(os, &MockLoyaltyChecker{mock: lc})
+	uc.SetLogger(logger)
+	handler := NewOrderHandler(uc, logger)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/user/orders", bytes.NewBufferString(validOrderNumber))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserKey{}, map[middleware.UserID]interface{}{
+		middleware.UserID("id"): int64(1),
+	}))
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Contains(t, buf.String(), `"order":"`+validOrderNumber+`"`)
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/utils"
+	"github.com/AlenaMolokova/diploma/internal/validation"
+)
+
+type PasswordChanger interface {
+	ChangePassword(ctx context.Context, userID int64, oldPassword, newPassword string) error
+}
+
+type PasswordResetter interface {
+	RequestPasswordReset(ctx context.Context, login string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+}
+
+// writePasswordError answers a password rejected by the policy with the codes
+// of the broken rules, so clients can show their own messages.
+func writePasswordError(w http.ResponseWriter, r *http.Request, logger *slog.Logger, err error) {
+	var policyErr *validation.PolicyError
+	if !errors.As(err, &policyErr) {
+		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid password")
+		return
+	}
+
+	writeJSON(w, r, logger, http.StatusBadRequest, struct {
+		Error      string                 `json:"error"`
+		Violations []validation.Violation `json:"violations"`
+	}{
+		Error:      "Password does not meet the policy",
+		Violations: policyErr.Violations,
+	})
+}
+
+type ChangePasswordHandler struct {
+	passwords PasswordChanger
+	tokens    TokenIssuer
+	logger    *slog.Logger
+}
+
+func NewChangePasswordHandler(passwords PasswordChanger, tokens TokenIssuer, logger *slog.Logger) *ChangePasswordHandler {
+	return &ChangePasswordHandler{passwords: passwords, tokens: tokens, logger: logger}
+}
+
+// ServeHTTP changes the password, which revokes every session of the user,
+// and starts a new session for the caller.
+func (h *ChangePasswordHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		h.logger.WarnContext(ctx, "Unauthorized: missing user_id in context")
+		utils.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.InfoContext(ctx, "Failed to decode change password request", slog.Any("error", err))
+		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+	if req.OldPassword == "" || req.NewPassword == "" {
+		utils.WriteJSONError(w, http.StatusBadRequest, "Old and new passwords are required")
+		return
+	}
+
+	if err := h.passwords.ChangePassword(ctx, userID, req.OldPassword, req.NewPassword); err != nil {
+		var policyErr *validation.PolicyError
+		switch {
+		case errors.Is(err, models.ErrWrongPassword):
+			h.logger.WarnContext(ctx, "Wrong old password")
+			utils.WriteJSONError(w, http.StatusForbidden, "Old password is incorrect")
+		case errors.As(err, &policyErr):
+			h.logger.InfoContext(ctx, "New password rejected", slog.Any("error", err))
+			writePasswordError(w, r, h.logger, err)
+		default:
+			h.logger.ErrorContext(ctx, "Failed to change password", slog.Any("error", err))
+			utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	tokens, err := h.tokens.IssueTokens(ctx, userID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to issue tokens", slog.Any("error", err))
+		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	writeTokens(w, r, h.logger, tokens)
+	h.logger.InfoContext(ctx, "User changed password")
+}
+
+type PasswordResetRequestHandler struct {
+	passwords PasswordResetter
+	throttle  LoginThrottler
+	logger    *slog.Logger
+}
+
+func NewPasswordResetRequestHandler(passwords PasswordResetter, throttle LoginThrottler, logger *slog.Logger) *PasswordResetRequestHandler {
+	return &PasswordResetRequestHandler{passwords: passwords, throttle: throttle, logger: logger}
+}
+
+// ServeHTTP answers 202 whether or not the login exists. Every request counts
+// against the login and the client address like a failed login does, so
+// tokens cannot be issued for an account over and over.
+func (h *PasswordResetRequestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Login string `json:"login"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Login == "" {
+		utils.WriteJSONError(w, http.StatusBadRequest, "Login is required")
+		return
+	}
+
+	ip := clientIP(r)
+	ctx := logging.With(r.Context(), "login", req.Login, "ip", ip)
+	wait, err := h.throttle.Check(ctx, req.Login, ip)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to check password reset throttle", slog.Any("error", err))
+		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if wait > 0 {
+		h.logger.WarnContext(ctx, "Password reset is locked", slog.Duration("wait", wait))
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		utils.WriteJSONError(w, http.StatusTooManyRequests, "Too many password reset requests")
+		return
+	}
+	if err := h.throttle.Fail(ctx, req.Login, ip); err != nil {
+		h.logger.ErrorContext(ctx, "Failed to record password reset request", slog.Any("error", err))
+	}
+
+	if err := h.passwords.RequestPasswordReset(ctx, req.Login); err != nil {
+		h.logger.ErrorContext(ctx, "Failed to request password reset", slog.Any("error", err))
+		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type PasswordResetHandler struct {
+	passwords PasswordResetter
+	logger    *slog.Logger
+}
+
+func NewPasswordResetHandler(passwords PasswordResetter, logger *slog.Logger) *PasswordResetHandler {
+	return &PasswordResetHandler{passwords: passwords, logger: logger}
+}
+
+func (h *PasswordResetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+	if req.Token == "" || req.NewPassword == "" {
+		utils.WriteJSONError(w, http.StatusBadRequest, "Token and new password are required")
+		return
+	}
+
+	if err := h.passwords.ResetPassword(r.Context(), req.Token, req.NewPassword); err != nil {
+		var policyErr *validation.PolicyError
+		switch {
+		case errors.Is(err, models.ErrResetTokenInvalid):
+			utils.WriteJSONError(w, http.StatusBadRequest, "Invalid or expired reset token")
+		case errors.As(err, &policyErr):
+			writePasswordError(w, r, h.logger, err)
+		default:
+			h.logger.ErrorContext(r.Context(), "Failed to reset password", slog.Any("error", err))
+			utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	h.logger.InfoContext(r.Context(), "Password reset completed")
+}
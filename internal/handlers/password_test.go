@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/auth"
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/testutils"
+	"github.com/AlenaMolokova/diploma/internal/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockPasswordService struct {
+	mock.Mock
+}
+
+func (m *MockPasswordService) ChangePassword(ctx context.Context, userID int64, oldPassword, newPassword string) error {
+	args := m.Called(ctx, userID, oldPassword, newPassword)
+	return args.Error(0)
+}
+
+func (m *MockPasswordService) RequestPasswordReset(ctx context.Context, login string) error {
+	args := m.Called(ctx, login)
+	return args.Error(0)
+}
+
+func (m *MockPasswordService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	args := m.Called(ctx, token, newPassword)
+	return args.Error(0)
+}
+
+var weakPasswordErr = &validation.PolicyError{Violations: []validation.Violation{
+	{Code: validation.CodePasswordTooShort, Message: "Password must be at least 8 characters long"},
+}}
+
+const weakPasswordBody = `{"error":"Password does not meet the policy","violations":[{"code":"password_too_short","message":"Password must be at least 8 characters long"}]}`
+
+func TestChangePasswordHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		authenticated  bool
+		setupMocks     func(*MockPasswordService)
+		expectedStatus int
+		expectedBody   string
+		expectedTokens bool
+	}{
+		{
+			name:          "успешная смена пароля",
+			body:          `{"old_password":"old-password","new_password":"new-password"}`,
+			authenticated: true,
+			setupMocks: func(ps *MockPasswordService) {
+				ps.On("ChangePassword", mock.Anything, int64(1), "old-password", "new-password").Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedTokens: true,
+		},
+		{
+			name:           "без авторизации",
+			body:           `{"old_password":"old-password","new_password":"new-password"}`,
+			setupMocks:     func(ps *MockPasswordService) {},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"error":"Unauthorized"}`,
+		},
+		{
+			name:           "пустой новый пароль",
+			body:           `{"old_password":"old-password"}`,
+			authenticated:  true,
+			setupMocks:     func(ps *MockPasswordService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Old and new passwords are required"}`,
+		},
+		{
+			name:           "невалидный JSON",
+			body:           `{invalid}`,
+			authenticated:  true,
+			setupMocks:     func(ps *MockPasswordService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Invalid request format"}`,
+		},
+		{
+			name:          "неверный старый пароль",
+			body:          `{"old_password":"wrong","new_password":"new-password"}`,
+			authenticated: true,
+			setupMocks: func(ps *MockPasswordService) {
+				ps.On("ChangePassword", mock.Anything, int64(1), "wrong", "new-password").Return(models.ErrWrongPassword)
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"error":"Old password is incorrect"}`,
+		},
+		{
+			name:          "слабый новый пароль",
+			body:          `{"old_password":"old-password","new_password":"short"}`,
+			authenticated: true,
+			setupMocks: func(ps *MockPasswordService) {
+				ps.On("ChangePassword", mock.Anything, int64(1), "old-password", "short").Return(weakPasswordErr)
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   weakPasswordBody,
+		},
+		{
+			name:          "ошибка сервера",
+			body:          `{"old_password":"old-password","new_password":"new-password"}`,
+			authenticated: true,
+			setupMocks: func(ps *MockPasswordService) {
+				ps.On("ChangePassword", mock.Anything, int64(1), "old-password", "new-password").Return(errors.New("db error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"Internal server error"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := &MockPasswordService{}
+			tt.setupMocks(ps)
+			ts := &testutils.MockTokenStore{}
+			ts.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("models.RefreshToken")).Return(nil).Maybe()
+			ts.On("GetUserRole", mock.Anything, mock.Anything).Return("user", nil).Maybe()
+
+			handler := NewChangePasswordHandler(ps, auth.NewService(ts, testutils.HMACKeyring("secret"), time.Minute, time.Hour), logging.Discard())
+			req := httptest.NewRequest(http.MethodPut, "/api/user/password", bytes.NewBufferString(tt.body))
+			if tt.authenticated {
+				userData := map[middleware.UserID]interface{}{
+					middleware.UserID("id"): int64(1),
+				}
+				req = req.WithContext(context.WithValue(req.Context(), middleware.UserKey{}, userData))
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			}
+			if tt.expectedTokens {
+				var tokens auth.Tokens
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+				assert.NotEmpty(t, tokens.AccessToken)
+				assert.NotEmpty(t, tokens.RefreshToken)
+			}
+			ps.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPasswordResetRequestHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		setupMocks     func(*MockPasswordService, *MockLoginThrottler)
+		expectedStatus int
+		expectedBody   string
+		retryAfter     string
+	}{
+		{
+			name: "запрос принят",
+			body: `{"login":"alice"}`,
+			setupMocks: func(ps *MockPasswordService, lt *MockLoginThrottler) {
+				lt.On("Check", mock.Anything, "alice", "192.0.2.1").Return(time.Duration(0), nil)
+				lt.On("Fail", mock.Anything, "alice", "192.0.2.1").Return(nil)
+				ps.On("RequestPasswordReset", mock.Anything, "alice").Return(nil)
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "пустой логин",
+			body:           `{"login":""}`,
+			setupMocks:     func(ps *MockPasswordService, lt *MockLoginThrottler) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Login is required"}`,
+		},
+		{
+			name: "слишком много запросов",
+			body: `{"login":"alice"}`,
+			setupMocks: func(ps *MockPasswordService, lt *MockLoginThrottler) {
+				lt.On("Check", mock.Anything, "alice", "192.0.2.1").Return(1500*time.Millisecond, nil)
+			},
+			expectedStatus: http.StatusTooManyRequests,
+			expectedBody:   `{"error":"Too many password reset requests"}`,
+			retryAfter:     "2",
+		},
+		{
+			name: "ошибка проверки блокировки",
+			body: `{"login":"alice"}`,
+			setupMocks: func(ps *MockPasswordService, lt *MockLoginThrottler) {
+				lt.On("Check", mock.Anything, "alice", "192.0.2.1").Return(time.Duration(0), errors.New("db error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"Internal server error"}`,
+		},
+		{
+			name: "ошибка сервера",
+			body: `{"login":"alice"}`,
+			setupMocks: func(ps *MockPasswordService, lt *MockLoginThrottler) {
+				lt.On("Check", mock.Anything, "alice", "192.0.2.1").Return(time.Duration(0), nil)
+				lt.On("Fail", mock.Anything, "alice", "192.0.2.1").Return(errors.New("db error"))
+				ps.On("RequestPasswordReset", mock.Anything, "alice").Return(errors.New("db error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"Internal server error"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := &MockPasswordService{}
+			lt := &MockLoginThrottler{}
+			tt.setupMocks(ps, lt)
+
+			handler := NewPasswordResetRequestHandler(ps, lt, logging.Discard())
+			req := httptest.NewRequest(http.MethodPost, "/api/user/password/reset/request", bytes.NewBufferString(tt.body))
+			req.RemoteAddr = "192.0.2.1:54321"
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			}
+			assert.Equal(t, tt.retryAfter, w.Header().Get("Retry-After"))
+			ps.AssertExpectations(t)
+			lt.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPasswordResetHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		setupMocks     func(*MockPasswordService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "успешный сброс",
+			body: `{"token":"reset-token","new_password":"new-password"}`,
+			setupMocks: func(ps *MockPasswordService) {
+				ps.On("ResetPassword", mock.Anything, "reset-token", "new-password").Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name: "недействительный токен",
+			body: `{"token":"reset-token","new_password":"new-password"}`,
+			setupMocks: func(ps *MockPasswordService) {
+				ps.On("ResetPassword", mock.Anything, "reset-token", "new-password").Return(models.ErrResetTokenInvalid)
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Invalid or expired reset token"}`,
+		},
+		{
+			name: "слабый пароль",
+			body: `{"token":"reset-token","new_password":"short"}`,
+			setupMocks: func(ps *MockPasswordService) {
+				ps.On("ResetPassword", mock.Anything, "reset-token", "short").Return(weakPasswordErr)
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   weakPasswordBody,
+		},
+		{
+			name:           "без токена",
+			body:           `{"new_password":"new-password"}`,
+			setupMocks:     func(ps *MockPasswordService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Token and new password are required"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := &MockPasswordService{}
+			tt.setupMocks(ps)
+
+			handler := NewPasswordResetHandler(ps, logging.Discard())
+			req := httptest.NewRequest(http.MethodPost, "/api/user/password/reset", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			}
+			ps.AssertExpectations(t)
+		})
+	}
+}
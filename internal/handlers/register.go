@@ -3,13 +3,12 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
-	"time"
 
+	"github.com/AlenaMolokova/diploma/internal/logging"
 	"github.com/AlenaMolokova/diploma/internal/utils"
 	"github.com/AlenaMolokova/diploma/internal/validation"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -19,15 +18,17 @@ type UserCreator interface {
 
 type RegisterHandler struct {
 	store     UserCreator
-	secret    string
+	tokens    TokenIssuer
 	validator validation.PasswordValidator
+	logger    *slog.Logger
 }
 
-func NewRegisterHandler(store UserCreator, secret string) *RegisterHandler {
+func NewRegisterHandler(store UserCreator, tokens TokenIssuer, validator validation.PasswordValidator, logger *slog.Logger) *RegisterHandler {
 	return &RegisterHandler{
 		store:     store,
-		secret:    secret,
-		validator: validation.NewDefaultPasswordValidator(),
+		tokens:    tokens,
+		validator: validator,
+		logger:    logger,
 	}
 }
 
@@ -36,57 +37,53 @@ func (h *RegisterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Login    string `json:"login"`
 		Password string `json:"password"`
 	}
+	ctx := r.Context()
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Failed to decode register request: %v", err)
+		h.logger.InfoContext(ctx, "Failed to decode register request", slog.Any("error", err))
 		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid request format")
 		return
 	}
 
-	log.Printf("Register request: login=%s", req.Login)
-
 	if req.Login == "" || req.Password == "" {
-		log.Printf("Empty login or password")
+		h.logger.InfoContext(ctx, "Empty login or password")
 		utils.WriteJSONError(w, http.StatusBadRequest, "Login and password are required")
 		return
 	}
 
-	if !h.validator.ValidatePassword(req.Password) {
-		log.Printf("Invalid password for login %s: must be >=8 chars", req.Login)
-		utils.WriteJSONError(w, http.StatusBadRequest, "Password must be at least 8 characters long")
+	login := slog.String("login", req.Login)
+	if err := h.validator.ValidatePassword(req.Login, req.Password); err != nil {
+		h.logger.InfoContext(ctx, "Password rejected by the policy", login, slog.Any("error", err))
+		writePasswordError(w, r, h.logger, err)
 		return
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Printf("Failed to hash password for login %s: %v", req.Login, err)
+		h.logger.ErrorContext(ctx, "Failed to hash password", login, slog.Any("error", err))
 		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	userID, err := h.store.CreateUser(r.Context(), req.Login, string(hashedPassword))
+	userID, err := h.store.CreateUser(ctx, req.Login, string(hashedPassword))
 	if err != nil {
 		if err.Error() == "login already exists" {
-			log.Printf("Login %s already exists", req.Login)
+			h.logger.InfoContext(ctx, "Login already exists", login)
 			utils.WriteJSONError(w, http.StatusConflict, "Login already exists")
 			return
 		}
-		log.Printf("Failed to create user %s: %v", req.Login, err)
+		h.logger.ErrorContext(ctx, "Failed to create user", login, slog.Any("error", err))
 		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
-	})
-	tokenString, err := token.SignedString([]byte(h.secret))
+	ctx = logging.With(ctx, logging.UserIDKey, userID)
+	tokens, err := h.tokens.IssueTokens(ctx, userID)
 	if err != nil {
-		log.Printf("Failed to sign token for user %s: %v", req.Login, err)
+		h.logger.ErrorContext(ctx, "Failed to issue tokens", slog.Any("error", err))
 		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	w.Header().Set("Authorization", "Bearer "+tokenString)
-	w.WriteHeader(http.StatusOK)
-	log.Printf("User %s registered successfully, user_id: %d", req.Login, userID)
+	writeTokens(w, r, h.logger, tokens)
+	h.logger.InfoContext(ctx, "User registered", login)
 }
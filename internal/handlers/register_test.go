@@ -7,8 +7,13 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/AlenaMolokova/diploma/internal/auth"
 	"github.com/AlenaMolokova/diploma/internal/handlers"
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/testutils"
+	"github.com/AlenaMolokova/diploma/internal/validation"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -25,7 +30,10 @@ func (m *mockUserCreator) CreateUser(ctx context.Context, login, password string
 func TestRegisterHandler(t *testing.T) {
 	mockStore := new(mockUserCreator)
 	secret := "testsecret"
-	handler := handlers.NewRegisterHandler(mockStore, secret)
+	tokenStore := &testutils.MockTokenStore{}
+	tokenStore.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("models.RefreshToken")).Return(nil)
+	tokenStore.On("GetUserRole", mock.Anything, mock.Anything).Return("user", nil)
+	handler := handlers.NewRegisterHandler(mockStore, auth.NewService(tokenStore, testutils.HMACKeyring(secret), time.Minute, time.Hour), validation.NewDefaultPasswordValidator(), logging.Discard())
 
 	t.Run("successful registration", func(t *testing.T) {
 		mockStore.On("CreateUser", mock.Anything, "newuser", mock.Anything).Return(int64(1), nil)
@@ -36,7 +44,9 @@ func TestRegisterHandler(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 		assert.Contains(t, w.Header().Get("Authorization"), "Bearer ")
+		assert.Contains(t, w.Body.String(), `"refresh_token"`)
 		mockStore.AssertExpectations(t)
+		tokenStore.AssertExpectations(t)
 	})
 
 	t.Run("weak password", func(t *testing.T) {
@@ -44,6 +54,15 @@ func TestRegisterHandler(t *testing.T) {
 		w := httptest.NewRecorder()
 		handler.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"password_too_short"`)
+	})
+
+	t.Run("password contains login", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"login":"newuser", "password":"NewUser-2024"}`))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error":"Password does not meet the policy","violations":[{"code":"password_contains_login","message":"Password must not contain the login"}]}`, w.Body.String())
 	})
 
 	t.Run("duplicate user", func(t *testing.T) {
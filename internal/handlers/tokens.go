@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/AlenaMolokova/diploma/internal/auth"
+	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/utils"
+)
+
+type TokenIssuer interface {
+	IssueTokens(ctx context.Context, userID int64) (auth.Tokens, error)
+}
+
+type TokenRefresher interface {
+	Refresh(ctx context.Context, refreshToken string) (auth.Tokens, error)
+}
+
+type TokenRevoker interface {
+	Logout(ctx context.Context, claims auth.Claims) error
+}
+
+// refreshCookiePath limits the refresh cookie to the refresh endpoint.
+const refreshCookiePath = "/api/user/token"
+
+// writeTokens sends the access token in the Authorization header, as clients
+// of the original API expect, and the full pair in the body. Browsers get the
+// same pair as a cookie session.
+func writeTokens(w http.ResponseWriter, r *http.Request, logger *slog.Logger, tokens auth.Tokens) {
+	setSessionCookies(w, tokens)
+	w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+	writeJSON(w, r, logger, http.StatusOK, tokens)
+}
+
+func setSessionCookies(w http.ResponseWriter, tokens auth.Tokens) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.SessionCookie,
+		Value:    tokens.AccessToken,
+		Path:     "/",
+		MaxAge:   int(tokens.ExpiresIn),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.RefreshCookie,
+		Value:    tokens.RefreshToken,
+		Path:     refreshCookiePath,
+		MaxAge:   int(tokens.RefreshExpiresIn),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.CSRFCookie,
+		Value:    tokens.CSRFToken,
+		Path:     "/",
+		MaxAge:   int(tokens.RefreshExpiresIn),
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: middleware.SessionCookie, Path: "/", MaxAge: -1, HttpOnly: true, Secure: true})
+	http.SetCookie(w, &http.Cookie{Name: middleware.RefreshCookie, Path: refreshCookiePath, MaxAge: -1, HttpOnly: true, Secure: true})
+	http.SetCookie(w, &http.Cookie{Name: middleware.CSRFCookie, Path: "/", MaxAge: -1, Secure: true})
+}
+
+// refreshTokenFromCookie returns the refresh token of a cookie session. Since
+// the browser sends the cookie on its own, the CSRF header has to match the
+// CSRF cookie as well.
+func refreshTokenFromCookie(r *http.Request) (string, bool) {
+	refresh, err := r.Cookie(middleware.RefreshCookie)
+	if err != nil || refresh.Value == "" {
+		return "", false
+	}
+	csrf, err := r.Cookie(middleware.CSRFCookie)
+	if err != nil || csrf.Value == "" {
+		return "", false
+	}
+	header := r.Header.Get(middleware.CSRFHeader)
+	if subtle.ConstantTimeCompare([]byte(header), []byte(csrf.Value)) != 1 {
+		return "", false
+	}
+	return refresh.Value, true
+}
+
+type RefreshHandler struct {
+	tokens TokenRefresher
+	logger *slog.Logger
+}
+
+func NewRefreshHandler(tokens TokenRefresher, logger *slog.Logger) *RefreshHandler {
+	return &RefreshHandler{tokens: tokens, logger: logger}
+}
+
+func (h *RefreshHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.WriteJSONError(w, http.StatusBadRequest, "Refresh token is required")
+		return
+	}
+	if req.RefreshToken == "" {
+		refresh, ok := refreshTokenFromCookie(r)
+		if !ok {
+			utils.WriteJSONError(w, http.StatusBadRequest, "Refresh token is required")
+			return
+		}
+		req.RefreshToken = refresh
+	}
+
+	tokens, err := h.tokens.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRefreshTokenReused):
+			h.logger.WarnContext(r.Context(), "Refresh token reuse detected, session revoked")
+			utils.WriteJSONError(w, http.StatusUnauthorized, "Invalid refresh token")
+		case errors.Is(err, models.ErrRefreshTokenInvalid):
+			utils.WriteJSONError(w, http.StatusUnauthorized, "Invalid refresh token")
+		default:
+			h.logger.ErrorContext(r.Context(), "Failed to refresh tokens", slog.Any("error", err))
+			utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	writeTokens(w, r, h.logger, tokens)
+}
+
+type LogoutHandler struct {
+	tokens TokenRevoker
+	logger *slog.Logger
+}
+
+func NewLogoutHandler(tokens TokenRevoker, logger *slog.Logger) *LogoutHandler {
+	return &LogoutHandler{tokens: tokens, logger: logger}
+}
+
+func (h *LogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.tokens.Logout(r.Context(), claims); err != nil {
+		h.logger.ErrorContext(r.Context(), "Failed to log out", slog.Any("error", err))
+		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+	h.logger.InfoContext(r.Context(), "User logged out")
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AlenaMolokova/diploma/internal/auth"
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockTokenService struct {
+	mock.Mock
+}
+
+func (m *MockTokenService) Refresh(ctx context.Context, refreshToken string) (auth.Tokens, error) {
+	args := m.Called(ctx, refreshToken)
+	return args.Get(0).(auth.Tokens), args.Error(1)
+}
+
+func (m *MockTokenService) Logout(ctx context.Context, claims auth.Claims) error {
+	args := m.Called(ctx, claims)
+	return args.Error(0)
+}
+
+func TestRefreshHandler_ServeHTTP(t *testing.T) {
+	tokens := auth.Tokens{AccessToken: "access", RefreshToken: "next", TokenType: "Bearer", ExpiresIn: 900}
+
+	tests := []struct {
+		name           string
+		body           string
+		cookies        map[string]string
+		csrfHeader     string
+		setupMocks     func(*MockTokenService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:       "обновление по cookie",
+			body:       "",
+			cookies:    map[string]string{middleware.RefreshCookie: "old", middleware.CSRFCookie: "csrf"},
+			csrfHeader: "csrf",
+			setupMocks: func(ts *MockTokenService) {
+				ts.On("Refresh", mock.Anything, "old").Return(tokens, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"access_token":"access","refresh_token":"next","token_type":"Bearer","expires_in":900}`,
+		},
+		{
+			name:           "обновление по cookie без CSRF",
+			body:           "",
+			cookies:        map[string]string{middleware.RefreshCookie: "old", middleware.CSRFCookie: "csrf"},
+			setupMocks:     func(ts *MockTokenService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Refresh token is required"}`,
+		},
+		{
+			name: "успешное обновление",
+			body: `{"refresh_token":"old"}`,
+			setupMocks: func(ts *MockTokenService) {
+				ts.On("Refresh", mock.Anything, "old").Return(tokens, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"access_token":"access","refresh_token":"next","token_type":"Bearer","expires_in":900}`,
+		},
+		{
+			name:           "пустой токен",
+			body:           `{"refresh_token":""}`,
+			setupMocks:     func(ts *MockTokenService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Refresh token is required"}`,
+		},
+		{
+			name:           "невалидный JSON",
+			body:           `{"refresh_token":`,
+			setupMocks:     func(ts *MockTokenService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Refresh token is required"}`,
+		},
+		{
+			name: "неизвестный или истёкший токен",
+			body: `{"refresh_token":"old"}`,
+			setupMocks: func(ts *MockTokenService) {
+				ts.On("Refresh", mock.Anything, "old").Return(auth.Tokens{}, models.ErrRefreshTokenInvalid)
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"error":"Invalid refresh token"}`,
+		},
+		{
+			name: "повторное использование токена",
+			body: `{"refresh_token":"old"}`,
+			setupMocks: func(ts *MockTokenService) {
+				ts.On("Refresh", mock.Anything, "old").Return(auth.Tokens{}, models.ErrRefreshTokenReused)
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"error":"Invalid refresh token"}`,
+		},
+		{
+			name: "внутренняя ошибка",
+			body: `{"refresh_token":"old"}`,
+			setupMocks: func(ts *MockTokenService) {
+				ts.On("Refresh", mock.Anything, "old").Return(auth.Tokens{}, errors.New("db error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"Internal server error"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := &MockTokenService{}
+			tt.setupMocks(ts)
+
+			handler := NewRefreshHandler(ts, logging.Discard())
+			req := httptest.NewRequest(http.MethodPost, "/api/user/token/refresh", bytes.NewBufferString(tt.body))
+			for name, value := range tt.cookies {
+				req.AddCookie(&http.Cookie{Name: name, Value: value})
+			}
+			if tt.csrfHeader != "" {
+				req.Header.Set(middleware.CSRFHeader, tt.csrfHeader)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, "Bearer access", w.Header().Get("Authorization"))
+			}
+			ts.AssertExpectations(t)
+		})
+	}
+}
+
+func TestLogoutHandler_ServeHTTP(t *testing.T) {
+	claims := auth.Claims{UserID: 1, SessionID: "family"}
+
+	tests := []struct {
+		name           string
+		authenticated  bool
+		setupMocks     func(*MockTokenService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:          "успешный выход",
+			authenticated: true,
+			setupMocks: func(ts *MockTokenService) {
+				ts.On("Logout", mock.Anything, claims).Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "без авторизации",
+			authenticated:  false,
+			setupMocks:     func(ts *MockTokenService) {},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"error":"Unauthorized"}`,
+		},
+		{
+			name:          "ошибка отзыва",
+			authenticated: true,
+			setupMocks: func(ts *MockTokenService) {
+				ts.On("Logout", mock.Anything, claims).Return(errors.New("db error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"Internal server error"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := &MockTokenService{}
+			tt.setupMocks(ts)
+
+			handler := NewLogoutHandler(ts, logging.Discard())
+			req := httptest.NewRequest(http.MethodPost, "/api/user/logout", nil)
+			if tt.authenticated {
+				req = req.WithContext(context.WithValue(req.Context(), middleware.ClaimsKey{}, claims))
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			}
+			if tt.expectedStatus == http.StatusNoContent {
+				cookies := w.Result().Cookies()
+				assert.Len(t, cookies, 3)
+				for _, cookie := range cookies {
+					assert.Equal(t, -1, cookie.MaxAge, "cookie %s must be cleared", cookie.Name)
+				}
+			}
+			ts.AssertExpectations(t)
+		})
+	}
+}
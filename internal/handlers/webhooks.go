@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/usecase"
+	"github.com/AlenaMolokova/diploma/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// WebhookIDParam is the URL parameter of the webhook routes.
+const WebhookIDParam = "webhookID"
+
+type WebhookService interface {
+	CreateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error)
+	ListWebhooks(ctx context.Context, userID int64) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, actorID, userID, id int64) error
+	GetWebhookLog(ctx context.Context, userID, id int64, limit int) ([]models.WebhookLogEntry, error)
+}
+
+// WebhookResponse is a webhook as listed. The secret is only part of the
+// response to its creation.
+type WebhookResponse struct {
+	ID        int64    `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Secret    string   `json:"secret,omitempty"`
+	CreatedAt string   `json:"created_at"`
+}
+
+type WebhookLogResponse struct {
+	ID         int64  `json:"id"`
+	DeliveryID int64  `json:"delivery_id"`
+	EventID    int64  `json:"event_id"`
+	Event      string `json:"event"`
+	State      string `json:"state"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	At         string `json:"at"`
+}
+
+// webhookRequest returns the user making the request and the owner of the
+// webhooks it is about: the user itself, or nobody for the global webhooks
+// of the admin routes. With withID it also returns the webhook id from the
+// path. It answers the request itself when any of them is missing or
+// malformed.
+func webhookRequest(w http.ResponseWriter, r *http.Request, logger *slog.Logger, global, withID bool) (actorID, ownerID, id int64, ok bool) {
+	actorID, ok = middleware.GetUserID(r)
+	if !ok {
+		logger.WarnContext(r.Context(), "Unauthorized: missing user_id in context")
+		utils.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
+		return 0, 0, 0, false
+	}
+	if !global {
+		ownerID = actorID
+	}
+	if !withID {
+		return actorID, ownerID, 0, true
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, WebhookIDParam), 10, 64)
+	if err != nil || id <= 0 {
+		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid webhook id")
+		return 0, 0, 0, false
+	}
+	return actorID, ownerID, id, true
+}
+
+func writeWebhookError(w http.ResponseWriter, r *http.Request, logger *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, models.ErrWebhookNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, "Webhook not found")
+	case errors.Is(err, models.ErrWebhookLimit):
+		utils.WriteJSONError(w, http.StatusConflict, "Too many webhooks")
+	case errors.Is(err, usecase.ErrInvalidWebhookURL), errors.Is(err, usecase.ErrInvalidWebhookEvents):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	default:
+		logger.ErrorContext(r.Context(), "Webhook request failed", slog.Any("error", err))
+		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+func webhookResponse(webhook models.Webhook) WebhookResponse {
+	return WebhookResponse{
+		ID:        webhook.ID,
+		URL:       webhook.URL,
+		Events:    webhook.Events,
+		CreatedAt: webhook.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// WebhookCreateHandler registers a webhook of the user or, when global, one
+// that receives the events of every user.
+type WebhookCreateHandler struct {
+	service WebhookService
+	global  bool
+	logger  *slog.Logger
+}
+
+func NewWebhookCreateHandler(service WebhookService, global bool, logger *slog.Logger) *WebhookCreateHandler {
+	return &WebhookCreateHandler{service: service, global: global, logger: logger}
+}
+
+// ServeHTTP answers with the webhook and its signing secret, which is not
+// shown again.
+func (h *WebhookCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	actorID, ownerID, _, ok := webhookRequest(w, r, h.logger, h.global, false)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.InfoContext(r.Context(), "Failed to decode webhook", slog.Any("error", err))
+		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid request format")
+		return
+	}
+
+	webhook, err := h.service.CreateWebhook(r.Context(), models.Webhook{
+		UserID:    ownerID,
+		URL:       req.URL,
+		Events:    req.Events,
+		CreatedBy: actorID,
+	})
+	if err != nil {
+		writeWebhookError(w, r, h.logger, err)
+		return
+	}
+
+	response := webhookResponse(webhook)
+	response.Secret = webhook.Secret
+	writeJSON(w, r, h.logger, http.StatusCreated, response)
+	h.logger.InfoContext(r.Context(), "Created webhook",
+		slog.Int64("webhook_id", webhook.ID), slog.Bool("global", h.global))
+}
+
+type WebhookListHandler struct {
+	service WebhookService
+	global  bool
+	logger  *slog.Logger
+}
+
+func NewWebhookListHandler(service WebhookService, global bool, logger *slog.Logger) *WebhookListHandler {
+	return &WebhookListHandler{service: service, global: global, logger: logger}
+}
+
+func (h *WebhookListHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, ownerID, _, ok := webhookRequest(w, r, h.logger, h.global, false)
+	if !ok {
+		return
+	}
+
+	webhooks, err := h.service.ListWebhooks(r.Context(), ownerID)
+	if err != nil {
+		writeWebhookError(w, r, h.logger, err)
+		return
+	}
+
+	response := make([]WebhookResponse, len(webhooks))
+	for i, webhook := range webhooks {
+		response[i] = webhookResponse(webhook)
+	}
+	writeJSON(w, r, h.logger, http.StatusOK, response)
+}
+
+type WebhookDeleteHandler struct {
+	service WebhookService
+	global  bool
+	logger  *slog.Logger
+}
+
+func NewWebhookDeleteHandler(service WebhookService, global bool, logger *slog.Logger) *WebhookDeleteHandler {
+	return &WebhookDeleteHandler{service: service, global: global, logger: logger}
+}
+
+// ServeHTTP deletes the webhook. Its events that are not delivered yet are
+// given up.
+func (h *WebhookDeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	actorID, ownerID, id, ok := webhookRequest(w, r, h.logger, h.global, true)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteWebhook(r.Context(), actorID, ownerID, id); err != nil {
+		writeWebhookError(w, r, h.logger, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	h.logger.InfoContext(r.Context(), "Deleted webhook",
+		slog.Int64("webhook_id", id), slog.Bool("global", h.global))
+}
+
+// WebhookLogHandler shows the latest delivery attempts of a webhook, newest
+// first. The limit query parameter sets how many.
+type WebhookLogHandler struct {
+	service WebhookService
+	global  bool
+	logger  *slog.Logger
+}
+
+func NewWebhookLogHandler(service WebhookService, global bool, logger *slog.Logger) *WebhookLogHandler {
+	return &WebhookLogHandler{service: service, global: global, logger: logger}
+}
+
+func (h *WebhookLogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, ownerID, id, ok := webhookRequest(w, r, h.logger, h.global, true)
+	if !ok {
+		return
+	}
+
+	limit := constants.DefaultWebhookLogSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > constants.MaxWebhookLogSize {
+			utils.WriteJSONError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	entries, err := h.service.GetWebhookLog(r.Context(), ownerID, id, limit)
+	if err != nil {
+		writeWebhookError(w, r, h.logger, err)
+		return
+	}
+
+	response := make([]WebhookLogResponse, len(entries))
+	for i, entry := range entries {
+		response[i] = WebhookLogResponse{
+			ID:         entry.ID,
+			DeliveryID: entry.DeliveryID,
+			EventID:    entry.EventID,
+			Event:      entry.Event,
+			State:      entry.State,
+			StatusCode: entry.StatusCode,
+			Error:      entry.Error,
+			DurationMs: entry.Duration.Milliseconds(),
+			At:         entry.CreatedAt.Format(time.RFC3339),
+		}
+	}
+	writeJSON(w, r, h.logger, http.StatusOK, response)
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockWebhookService struct {
+	mock.Mock
+}
+
+func (m *mockWebhookService) CreateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	args := m.Called(ctx, webhook)
+	return args.Get(0).(models.Webhook), args.Error(1)
+}
+
+func (m *mockWebhookService) ListWebhooks(ctx context.Context, userID int64) ([]models.Webhook, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]models.Webhook), args.Error(1)
+}
+
+func (m *mockWebhookService) DeleteWebhook(ctx context.Context, actorID, userID, id int64) error {
+	args := m.Called(ctx, actorID, userID, id)
+	return args.Error(0)
+}
+
+func (m *mockWebhookService) GetWebhookLog(ctx context.Context, userID, id int64, limit int) ([]models.WebhookLogEntry, error) {
+	args := m.Called(ctx, userID, id, limit)
+	return args.Get(0).([]models.WebhookLogEntry), args.Error(1)
+}
+
+func TestWebhookCreateHandler_ServeHTTP(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	events := []string{constants.WebhookOrderProcessed}
+	body := `{"url":"https://example.com/hook","events":["order.processed"]}`
+
+	tests := []struct {
+		name           string
+		global         bool
+		body           string
+		setupMocks     func(*mockWebhookService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "вебхук пользователя",
+			body: body,
+			setupMocks: func(m *mockWebhookService) {
+				m.On("CreateWebhook", mock.Anything, models.Webhook{UserID: 1, URL: "https://example.com/hook", Events: events, CreatedBy: 1}).
+					Return(models.Webhook{ID: 5, UserID: 1, URL: "https://example.com/hook", Events: events, Secret: "s3cret", CreatedBy: 1, CreatedAt: createdAt}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"id":5,"url":"https://example.com/hook","events":["order.processed"],"secret":"s3cret","created_at":"2024-05-01T12:00:00Z"}`,
+		},
+		{
+			name:   "глобальный вебхук администратора",
+			global: true,
+			body:   body,
+			setupMocks: func(m *mockWebhookService) {
+				m.On("CreateWebhook", mock.Anything, models.Webhook{URL: "https://example.com/hook", Events: events, CreatedBy: 1}).
+					Return(models.Webhook{ID: 6, URL: "https://example.com/hook", Events: events, Secret: "s3cret", CreatedBy: 1, CreatedAt: createdAt}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"id":6,"url":"https://example.com/hook","events":["order.processed"],"secret":"s3cret","created_at":"2024-05-01T12:00:00Z"}`,
+		},
+		{
+			name: "неверный адрес",
+			body: `{"url":"ftp://example.com","events":["order.processed"]}`,
+			setupMocks: func(m *mockWebhookService) {
+				m.On("CreateWebhook", mock.Anything, mock.Anything).
+					Return(models.Webhook{}, usecase.ErrInvalidWebhookURL)
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   fmt.Sprintf(`{"error":%q}`, usecase.ErrInvalidWebhookURL.Error()),
+		},
+		{
+			name: "неизвестное событие",
+			body: `{"url":"https://example.com/hook","events":["order.deleted"]}`,
+			setupMocks: func(m *mockWebhookService) {
+				m.On("CreateWebhook", mock.Anything, mock.Anything).
+					Return(models.Webhook{}, usecase.ErrInvalidWebhookEvents)
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   fmt.Sprintf(`{"error":%q}`, usecase.ErrInvalidWebhookEvents.Error()),
+		},
+		{
+			name: "слишком много вебхуков",
+			body: `{"url":"https://example.com/hook","events":["order.processed"]}`,
+			setupMocks: func(m *mockWebhookService) {
+				m.On("CreateWebhook", mock.Anything, mock.Anything).
+					Return(models.Webhook{}, fmt.Errorf("failed to create webhook: %w", models.ErrWebhookLimit))
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"error":"Too many webhooks"}`,
+		},
+		{
+			name:           "неверный формат запроса",
+			body:           `{"url":`,
+			setupMocks:     func(m *mockWebhookService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Invalid request format"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := new(mockWebhookService)
+			tt.setupMocks(service)
+			handler := NewWebhookCreateHandler(service, tt.global, logging.Discard())
+
+			req := adminRequestWith(http.MethodPost, "/api/user/webhooks", tt.body, nil)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			service.AssertExpectations(t)
+		})
+	}
+}
+
+func TestWebhookListHandler_ServeHTTP(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		global bool
+		owner  int64
+	}{
+		{name: "вебхуки пользователя", owner: 1},
+		{name: "глобальные вебхуки", global: true, owner: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := new(mockWebhookService)
+			service.On("ListWebhooks", mock.Anything, tt.owner).Return([]models.Webhook{
+				{ID: 5, UserID: tt.owner, URL: "https://example.com/hook", Events: []string{constants.WebhookWithdrawalCreated}, Secret: "s3cret", CreatedAt: createdAt},
+			}, nil)
+			handler := NewWebhookListHandler(service, tt.global, logging.Discard())
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, adminRequestWith(http.MethodGet, "/api/user/webhooks", "", nil))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, `[{"id":5,"url":"https://example.com/hook","events":["withdrawal.created"],"created_at":"2024-05-01T12:00:00Z"}]`,
+				w.Body.String(), "секрет в списке не показывается")
+			service.AssertExpectations(t)
+		})
+	}
+}
+
+func TestWebhookDeleteHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name           string
+		id             string
+		setupMocks     func(*mockWebhookService)
+		expectedStatus int
+	}{
+		{
+			name: "успешное удаление",
+			id:   "5",
+			setupMocks: func(m *mockWebhookService) {
+				m.On("DeleteWebhook", mock.Anything, int64(1), int64(1), int64(5)).Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name: "вебхук не найден или чужой",
+			id:   "5",
+			setupMocks: func(m *mockWebhookService) {
+				m.On("DeleteWebhook", mock.Anything, int64(1), int64(1), int64(5)).Return(fmt.Errorf("failed to delete webhook: %w", models.ErrWebhookNotFound))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "неверный идентификатор",
+			id:             "abc",
+			setupMocks:     func(m *mockWebhookService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := new(mockWebhookService)
+			tt.setupMocks(service)
+			handler := NewWebhookDeleteHandler(service, false, logging.Discard())
+
+			req := adminRequestWith(http.MethodDelete, "/api/user/webhooks/"+tt.id, "", map[string]string{WebhookIDParam: tt.id})
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			service.AssertExpectations(t)
+		})
+	}
+}
+
+func TestWebhookLogHandler_ServeHTTP(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entries := []models.WebhookLogEntry{
+		{ID: 2, DeliveryID: 3, EventID: 4, Event: constants.WebhookOrderProcessed, State: constants.JobStateDone, StatusCode: 200, Duration: 120 * time.Millisecond, CreatedAt: at.Add(time.Minute)},
+		{ID: 1, DeliveryID: 3, EventID: 4, Event: constants.WebhookOrderProcessed, State: constants.JobStateDone, Error: "connection refused", Duration: 5 * time.Millisecond, CreatedAt: at},
+	}
+
+	tests := []struct {
+		name           string
+		global         bool
+		target         string
+		setupMocks     func(*mockWebhookService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "журнал доставок",
+			target: "/api/user/webhooks/5/deliveries",
+			setupMocks: func(m *mockWebhookService) {
+				m.On("GetWebhookLog", mock.Anything, int64(1), int64(5), constants.DefaultWebhookLogSize).Return(entries, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: `[
+				{"id":2,"delivery_id":3,"event_id":4,"event":"order.processed","state":"done","status_code":200,"duration_ms":120,"at":"2024-05-01T12:01:00Z"},
+				{"id":1,"delivery_id":3,"event_id":4,"event":"order.processed","state":"done","error":"connection refused","duration_ms":5,"at":"2024-05-01T12:00:00Z"}
+			]`,
+		},
+		{
+			name:   "глобальный вебхук с лимитом",
+			global: true,
+			target: "/api/admin/webhooks/5/deliveries?limit=10",
+			setupMocks: func(m *mockWebhookService) {
+				m.On("GetWebhookLog", mock.Anything, int64(0), int64(5), 10).Return([]models.WebhookLogEntry{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[]`,
+		},
+		{
+			name:           "неверный лимит",
+			target:         "/api/user/webhooks/5/deliveries?limit=0",
+			setupMocks:     func(m *mockWebhookService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Invalid limit"}`,
+		},
+		{
+			name:   "вебхук не найден",
+			target: "/api/user/webhooks/5/deliveries",
+			setupMocks: func(m *mockWebhookService) {
+				m.On("GetWebhookLog", mock.Anything, int64(1), int64(5), constants.DefaultWebhookLogSize).Return([]models.WebhookLogEntry(nil), models.ErrWebhookNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"Webhook not found"}`,
+		},
+		{
+			name:   "внутренняя ошибка",
+			target: "/api/user/webhooks/5/deliveries",
+			setupMocks: func(m *mockWebhookService) {
+				m.On("GetWebhookLog", mock.Anything, int64(1), int64(5), constants.DefaultWebhookLogSize).Return([]models.WebhookLogEntry(nil), errors.New("db error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"Internal server error"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := new(mockWebhookService)
+			tt.setupMocks(service)
+			handler := NewWebhookLogHandler(service, tt.global, logging.Discard())
+
+			req := adminRequestWith(http.MethodGet, tt.target, "", map[string]string{WebhookIDParam: "5"})
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			service.AssertExpectations(t)
+		})
+	}
+}
+
+func TestWebhookHandlersUnauthorized(t *testing.T) {
+	service := new(mockWebhookService)
+	for name, handler := range map[string]http.Handler{
+		"create": NewWebhookCreateHandler(service, false, logging.Discard()),
+		"list":   NewWebhookListHandler(service, false, logging.Discard()),
+		"delete": NewWebhookDeleteHandler(service, false, logging.Discard()),
+		"log":    NewWebhookLogHandler(service, false, logging.Discard()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/user/webhooks", nil))
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+		})
+	}
+}
@@ -2,66 +2,74 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 
+	"github.com/AlenaMolokova/diploma/internal/logging"
 	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
 	"github.com/AlenaMolokova/diploma/internal/usecase"
 	"github.com/AlenaMolokova/diploma/internal/utils"
 )
 
 type WithdrawHandler struct {
 	withdrawalUC *usecase.WithdrawalUseCase
+	logger       *slog.Logger
 }
 
-func NewWithdrawHandler(withdrawalUC *usecase.WithdrawalUseCase) *WithdrawHandler {
+func NewWithdrawHandler(withdrawalUC *usecase.WithdrawalUseCase, logger *slog.Logger) *WithdrawHandler {
 	return &WithdrawHandler{
 		withdrawalUC: withdrawalUC,
+		logger:       logger,
 	}
 }
 
 func (h *WithdrawHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		log.Printf("Unauthorized: missing user_id in context")
+		h.logger.WarnContext(ctx, "Unauthorized: missing user_id in context")
 		utils.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	var req struct {
-		Order string  `json:"order"`
-		Sum   float64 `json:"sum"`
+		Order string       `json:"order"`
+		Sum   money.Amount `json:"sum"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Failed to decode withdraw request: %v", err)
+		h.logger.InfoContext(ctx, "Failed to decode withdraw request", slog.Any("error", err))
 		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid request format")
 		return
 	}
 
+	ctx = logging.With(ctx, logging.OrderKey, req.Order)
 	if req.Order == "" || req.Sum <= 0 {
-		log.Printf("Invalid withdraw request: order=%s, sum=%.2f", req.Order, req.Sum)
+		h.logger.InfoContext(ctx, "Invalid withdraw request", slog.String("sum", req.Sum.String()))
 		utils.WriteJSONError(w, http.StatusBadRequest, "Order and positive sum are required")
 		return
 	}
 
-	err := h.withdrawalUC.ProcessWithdrawal(r.Context(), userID, req.Order, req.Sum)
+	err := h.withdrawalUC.ProcessWithdrawal(ctx, userID, req.Order, req.Sum)
 	if err != nil {
-		if err.Error() == "insufficient balance" {
-			log.Printf("Insufficient balance for user %d: requested=%.2f", userID, req.Sum)
+		if errors.Is(err, models.ErrInsufficientBalance) {
+			h.logger.InfoContext(ctx, "Insufficient balance", slog.String("sum", req.Sum.String()))
 			utils.WriteJSONError(w, http.StatusPaymentRequired, "Insufficient balance")
 			return
 		}
 		if err.Error() == "invalid order number" {
-			log.Printf("Invalid order number: '%s'", req.Order)
+			h.logger.InfoContext(ctx, "Invalid order number")
 			utils.WriteJSONError(w, http.StatusUnprocessableEntity, "Invalid order number")
 			return
 		}
-		log.Printf("Failed to process withdrawal for user %d: %v", userID, err)
+		h.logger.ErrorContext(ctx, "Failed to process withdrawal", slog.Any("error", err))
 		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	log.Printf("Withdrawal of %.2f for order %s by user %d successful", req.Sum, req.Order, userID)
+	h.logger.InfoContext(ctx, "Withdrawal successful", slog.String("sum", req.Sum.String()))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 }
@@ -8,10 +8,11 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/AlenaMolokova/diploma/internal/logging"
 	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/models"
 	"github.com/AlenaMolokova/diploma/internal/testutils"
 	"github.com/AlenaMolokova/diploma/internal/usecase"
-	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -25,7 +26,7 @@ func TestWithdrawHandlerServeHTTP(t *testing.T) {
 		name           string
 		body           string
 		userID         interface{}
-		setupMocks     func(*testutils.MockWithdrawalStorage, *testutils.MockBalanceStorage)
+		setupMocks     func(*testutils.MockWithdrawalStorage)
 		expectedStatus int
 		expectedBody   string
 	}{
@@ -33,11 +34,8 @@ func TestWithdrawHandlerServeHTTP(t *testing.T) {
 			name:   "успешное снятие средств",
 			body:   `{"order":"` + validOrderNumber + `","sum":100.0}`,
 			userID: userID,
-			setupMocks: func(ws *testutils.MockWithdrawalStorage, bs *testutils.MockBalanceStorage) {
-				bs.On("GetBalance", mock.Anything, userID).Return(pgtype.Float8{Float64: 200.0, Valid: true}, pgtype.Float8{}, nil)
-				bs.On("UpdateBalance", mock.Anything, userID, 100.0).Return(nil)
-				bs.On("UpdateWithdrawn", mock.Anything, userID, 100.0).Return(nil)
-				ws.On("CreateWithdrawal", mock.Anything, mock.AnythingOfType("models.Withdrawal")).Return(nil)
+			setupMocks: func(ws *testutils.MockWithdrawalStorage) {
+				ws.On("Withdraw", mock.Anything, mock.AnythingOfType("models.Withdrawal")).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedBody:   "",
@@ -46,7 +44,7 @@ func TestWithdrawHandlerServeHTTP(t *testing.T) {
 			name:           "неавторизованный запрос",
 			body:           `{"order":"` + validOrderNumber + `","sum":100.0}`,
 			userID:         nil,
-			setupMocks:     func(ws *testutils.MockWithdrawalStorage, bs *testutils.MockBalanceStorage) {},
+			setupMocks:     func(ws *testutils.MockWithdrawalStorage) {},
 			expectedStatus: http.StatusUnauthorized,
 			expectedBody:   `{"error":"Unauthorized"}`,
 		},
@@ -54,7 +52,7 @@ func TestWithdrawHandlerServeHTTP(t *testing.T) {
 			name:           "неверный формат запроса",
 			body:           `invalid json`,
 			userID:         userID,
-			setupMocks:     func(ws *testutils.MockWithdrawalStorage, bs *testutils.MockBalanceStorage) {},
+			setupMocks:     func(ws *testutils.MockWithdrawalStorage) {},
 			expectedStatus: http.StatusBadRequest,
 			expectedBody:   `{"error":"Invalid request format"}`,
 		},
@@ -62,7 +60,7 @@ func TestWithdrawHandlerServeHTTP(t *testing.T) {
 			name:           "пустой order или положительная сумма",
 			body:           `{"order":"","sum":0}`,
 			userID:         userID,
-			setupMocks:     func(ws *testutils.MockWithdrawalStorage, bs *testutils.MockBalanceStorage) {},
+			setupMocks:     func(ws *testutils.MockWithdrawalStorage) {},
 			expectedStatus: http.StatusBadRequest,
 			expectedBody:   `{"error":"Order and positive sum are required"}`,
 		},
@@ -70,7 +68,7 @@ func TestWithdrawHandlerServeHTTP(t *testing.T) {
 			name:           "неверный номер заказа",
 			body:           `{"order":"4532015112830367","sum":100.0}`,
 			userID:         userID,
-			setupMocks:     func(ws *testutils.MockWithdrawalStorage, bs *testutils.MockBalanceStorage) {},
+			setupMocks:     func(ws *testutils.MockWithdrawalStorage) {},
 			expectedStatus: http.StatusUnprocessableEntity,
 			expectedBody:   `{"error":"Invalid order number"}`,
 		},
@@ -78,7 +76,7 @@ func TestWithdrawHandlerServeHTTP(t *testing.T) {
 			name:           "нечисловой номер заказа",
 			body:           `{"order":"123abc","sum":100.0}`,
 			userID:         userID,
-			setupMocks:     func(ws *testutils.MockWithdrawalStorage, bs *testutils.MockBalanceStorage) {},
+			setupMocks:     func(ws *testutils.MockWithdrawalStorage) {},
 			expectedStatus: http.StatusUnprocessableEntity,
 			expectedBody:   `{"error":"Invalid order number"}`,
 		},
@@ -86,8 +84,8 @@ func TestWithdrawHandlerServeHTTP(t *testing.T) {
 			name:   "недостаточный баланс",
 			body:   `{"order":"` + validOrderNumber + `","sum":100.0}`,
 			userID: userID,
-			setupMocks: func(ws *testutils.MockWithdrawalStorage, bs *testutils.MockBalanceStorage) {
-				bs.On("GetBalance", mock.Anything, userID).Return(pgtype.Float8{Float64: 50.0, Valid: true}, pgtype.Float8{}, nil)
+			setupMocks: func(ws *testutils.MockWithdrawalStorage) {
+				ws.On("Withdraw", mock.Anything, mock.AnythingOfType("models.Withdrawal")).Return(models.ErrInsufficientBalance)
 			},
 			expectedStatus: http.StatusPaymentRequired,
 			expectedBody:   `{"error":"Insufficient balance"}`,
@@ -96,11 +94,8 @@ func TestWithdrawHandlerServeHTTP(t *testing.T) {
 			name:   "внутренняя ошибка",
 			body:   `{"order":"` + validOrderNumber + `","sum":100.0}`,
 			userID: userID,
-			setupMocks: func(ws *testutils.MockWithdrawalStorage, bs *testutils.MockBalanceStorage) {
-				bs.On("GetBalance", mock.Anything, userID).Return(pgtype.Float8{Float64: 200.0, Valid: true}, pgtype.Float8{}, nil)
-				bs.On("UpdateBalance", mock.Anything, userID, 100.0).Return(nil)
-				bs.On("UpdateWithdrawn", mock.Anything, userID, 100.0).Return(nil)
-				ws.On("CreateWithdrawal", mock.Anything, mock.AnythingOfType("models.Withdrawal")).Return(errors.New("db error"))
+			setupMocks: func(ws *testutils.MockWithdrawalStorage) {
+				ws.On("Withdraw", mock.Anything, mock.AnythingOfType("models.Withdrawal")).Return(errors.New("db error"))
 			},
 			expectedStatus: http.StatusInternalServerError,
 			expectedBody:   `{"error":"Internal server error"}`,
@@ -110,12 +105,10 @@ func TestWithdrawHandlerServeHTTP(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ws := &testutils.MockWithdrawalStorage{}
-			bs := &testutils.MockBalanceStorage{}
-			tt.setupMocks(ws, bs)
+			tt.setupMocks(ws)
 
-			balanceUC := usecase.NewBalanceUseCase(bs)
-			uc := usecase.NewWithdrawalUseCase(ws, balanceUC)
-			handler := NewWithdrawHandler(uc)
+			uc := usecase.NewWithdrawalUseCase(ws)
+			handler := NewWithdrawHandler(uc, logging.Discard())
 
 			req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", bytes.NewBufferString(tt.body))
 			if tt.userID != nil {
@@ -137,7 +130,6 @@ func TestWithdrawHandlerServeHTTP(t *testing.T) {
 			}
 
 			ws.AssertExpectations(t)
-			bs.AssertExpectations(t)
 		})
 	}
 }
@@ -3,60 +3,76 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/AlenaMolokova/diploma/internal/middleware"
 	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
 	"github.com/AlenaMolokova/diploma/internal/utils"
 )
 
 type WithdrawalUseCase interface {
-	GetUserWithdrawals(ctx context.Context, userID int64) ([]models.Withdrawal, error)
+	GetUserWithdrawals(ctx context.Context, filter models.WithdrawalFilter) ([]models.Withdrawal, error)
 }
 
 type WithdrawalsHandler struct {
 	withdrawalUC WithdrawalUseCase
+	logger       *slog.Logger
 }
 
-func NewWithdrawalsHandler(withdrawalUC WithdrawalUseCase) *WithdrawalsHandler {
-	return &WithdrawalsHandler{withdrawalUC: withdrawalUC}
+func NewWithdrawalsHandler(withdrawalUC WithdrawalUseCase, logger *slog.Logger) *WithdrawalsHandler {
+	return &WithdrawalsHandler{withdrawalUC: withdrawalUC, logger: logger}
 }
 
 type WithdrawalResponse struct {
-	Order       string `json:"order"`
-	Sum         float64 `json:"sum"`
-	ProcessedAt string `json:"processed_at"`
+	Order       string       `json:"order"`
+	Sum         money.Amount `json:"sum"`
+	ProcessedAt string       `json:"processed_at"`
 }
 
 func (h *WithdrawalsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
-		log.Printf("Unauthorized: missing user_id in context")
+		h.logger.WarnContext(ctx, "Unauthorized: missing user_id in context")
 		utils.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	withdrawals, err := h.withdrawalUC.GetUserWithdrawals(r.Context(), userID)
+	filter, err := parseWithdrawalFilter(r)
 	if err != nil {
-		log.Printf("Failed to get withdrawals for user %d: %v", userID, err)
+		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid withdrawals query")
+		return
+	}
+	filter.UserID = userID
+
+	withdrawals, err := h.withdrawalUC.GetUserWithdrawals(ctx, filter)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to get withdrawals", slog.Any("error", err))
 		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
 	if len(withdrawals) == 0 {
-		log.Printf("No withdrawals found for user %d", userID)
+		h.logger.DebugContext(ctx, "No withdrawals found")
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
+	if filter.Limit > 0 && len(withdrawals) == filter.Limit {
+		withdrawals = withdrawals[:filter.Limit-1]
+		last := withdrawals[len(withdrawals)-1]
+		w.Header().Set(NextCursorHeader, encodeListCursor(models.ListCursor{At: last.ProcessedAt.Time, ID: last.ID}))
+	}
+
 	response := make([]WithdrawalResponse, len(withdrawals))
 	for i, withdrawal := range withdrawals {
 		response[i] = WithdrawalResponse{
 			Order:       withdrawal.OrderNumber,
-			Sum:         withdrawal.Sum.Float64,
+			Sum:         withdrawal.Sum,
 			ProcessedAt: withdrawal.ProcessedAt.Time.Format(time.RFC3339),
 		}
 	}
@@ -64,9 +80,31 @@ func (h *WithdrawalsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Failed to encode withdrawals response: %v", err)
+		h.logger.ErrorContext(ctx, "Failed to encode withdrawals response", slog.Any("error", err))
 		utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
-	log.Printf("Returned %d withdrawals for user %d", len(withdrawals), userID)
-}
\ No newline at end of file
+	h.logger.DebugContext(ctx, "Returned withdrawals", slog.Int("count", len(withdrawals)))
+}
+
+// parseWithdrawalFilter reads the listing parameters together with the
+// min_sum and max_sum filters.
+func parseWithdrawalFilter(r *http.Request) (models.WithdrawalFilter, error) {
+	query := r.URL.Query()
+	list, err := parseListQuery(query)
+	if err != nil {
+		return models.WithdrawalFilter{}, err
+	}
+	minSum, maxSum, err := parseAmountRange(query, "min_sum", "max_sum")
+	if err != nil {
+		return models.WithdrawalFilter{}, err
+	}
+	return models.WithdrawalFilter{
+		Since:  list.since,
+		Until:  list.until,
+		MinSum: minSum,
+		MaxSum: maxSum,
+		After:  list.after,
+		Limit:  list.fetchLimit(),
+	}, nil
+}
@@ -8,8 +8,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/AlenaMolokova/diploma/internal/logging"
 	"github.com/AlenaMolokova/diploma/internal/middleware"
 	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
 	"github.com/AlenaMolokova/diploma/internal/testutils"
 	"github.com/AlenaMolokova/diploma/internal/usecase"
 	"github.com/jackc/pgx/v5/pgtype"
@@ -21,22 +23,26 @@ func TestWithdrawalsHandlerServeHTTP(t *testing.T) {
 	userID := int64(1)
 	ctx := context.Background()
 
+	processedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
 	tests := []struct {
 		name           string
 		userID         interface{}
+		query          string
 		setupMocks     func(*testutils.MockWithdrawalStorage)
 		expectedStatus int
 		expectedBody   string
+		expectedCursor string
 	}{
 		{
 			name:   "успешное получение списка списаний",
 			userID: userID,
 			setupMocks: func(ws *testutils.MockWithdrawalStorage) {
-				ws.On("GetWithdrawalsByUserID", mock.Anything, userID).Return([]models.Withdrawal{
+				ws.On("ListWithdrawals", mock.Anything, models.WithdrawalFilter{UserID: userID}).Return([]models.Withdrawal{
 					{
 						UserID:      userID,
 						OrderNumber: "79927398713",
-						Sum:         pgtype.Float8{Float64: 100.0, Valid: true},
+						Sum:         money.MustParse("100"),
 						ProcessedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
 					},
 				}, nil)
@@ -48,11 +54,37 @@ func TestWithdrawalsHandlerServeHTTP(t *testing.T) {
 			name:   "нет списаний",
 			userID: userID,
 			setupMocks: func(ws *testutils.MockWithdrawalStorage) {
-				ws.On("GetWithdrawalsByUserID", mock.Anything, userID).Return([]models.Withdrawal{}, nil)
+				ws.On("ListWithdrawals", mock.Anything, models.WithdrawalFilter{UserID: userID}).Return([]models.Withdrawal{}, nil)
 			},
 			expectedStatus: http.StatusNoContent,
 			expectedBody:   "",
 		},
+		{
+			name:   "страница с фильтром по сумме",
+			userID: userID,
+			query:  "?limit=1&min_sum=50",
+			setupMocks: func(ws *testutils.MockWithdrawalStorage) {
+				ws.On("ListWithdrawals", mock.Anything, models.WithdrawalFilter{
+					UserID: userID,
+					MinSum: amountPtr(money.MustParse("50")),
+					Limit:  2,
+				}).Return([]models.Withdrawal{
+					{ID: 9, OrderNumber: "79927398713", Sum: money.MustParse("100"), ProcessedAt: pgtype.Timestamptz{Time: processedAt, Valid: true}},
+					{ID: 4, OrderNumber: "12345678903", Sum: money.MustParse("60"), ProcessedAt: pgtype.Timestamptz{Time: processedAt, Valid: true}},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"order":"79927398713","sum":100,"processed_at":"2024-05-01T12:00:00Z"}]`,
+			expectedCursor: encodeListCursor(models.ListCursor{At: processedAt, ID: 9}),
+		},
+		{
+			name:           "некорректный курсор",
+			userID:         userID,
+			query:          "?cursor=!!!",
+			setupMocks:     func(ws *testutils.MockWithdrawalStorage) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Invalid withdrawals query"}`,
+		},
 		{
 			name:           "неавторизованный запрос",
 			userID:         nil,
@@ -64,7 +96,7 @@ func TestWithdrawalsHandlerServeHTTP(t *testing.T) {
 			name:   "внутренняя ошибка",
 			userID: userID,
 			setupMocks: func(ws *testutils.MockWithdrawalStorage) {
-				ws.On("GetWithdrawalsByUserID", mock.Anything, userID).Return([]models.Withdrawal{}, errors.New("db error"))
+				ws.On("ListWithdrawals", mock.Anything, models.WithdrawalFilter{UserID: userID}).Return([]models.Withdrawal{}, errors.New("db error"))
 			},
 			expectedStatus: http.StatusInternalServerError,
 			expectedBody:   `{"error":"Internal server error"}`,
@@ -76,10 +108,10 @@ func TestWithdrawalsHandlerServeHTTP(t *testing.T) {
 			ws := &testutils.MockWithdrawalStorage{}
 			tt.setupMocks(ws)
 
-			uc := usecase.NewWithdrawalUseCase(ws, nil)
-			handler := NewWithdrawalsHandler(uc)
+			uc := usecase.NewWithdrawalUseCase(ws)
+			handler := NewWithdrawalsHandler(uc, logging.Discard())
 
-			req := httptest.NewRequest(http.MethodGet, "/api/user/balance/withdrawals", nil)
+			req := httptest.NewRequest(http.MethodGet, "/api/user/balance/withdrawals"+tt.query, nil)
 			if tt.userID != nil {
 				req = req.WithContext(context.WithValue(ctx, middleware.UserKey{}, map[middleware.UserID]interface{}{
 					middleware.UserID("id"): tt.userID,
@@ -92,6 +124,7 @@ func TestWithdrawalsHandlerServeHTTP(t *testing.T) {
 			handler.ServeHTTP(w, req)
 
 			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedCursor, w.Header().Get(NextCursorHeader))
 			if tt.expectedBody != "" {
 				assert.JSONEq(t, tt.expectedBody, w.Body.String())
 			} else {
@@ -102,3 +135,7 @@ func TestWithdrawalsHandlerServeHTTP(t *testing.T) {
 		})
 	}
 }
+
+func amountPtr(a money.Amount) *money.Amount {
+	return &a
+}
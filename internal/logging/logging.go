@@ -0,0 +1,120 @@
+// Package logging builds the application's structured logger. Fields of the
+// request being served, such as its ID, the user and the order, are carried
+// in the context and added to every line logged with it.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Field names shared by every package that logs about a request.
+const (
+	RequestIDKey = "request_id"
+	TraceIDKey   = "trace_id"
+	UserIDKey    = "user_id"
+	OrderKey     = "order"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute names whose values never reach the output.
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"password":      true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"reset_token":   true,
+	"secret":        true,
+	"jwt_secret":    true,
+	"database_uri":  true,
+}
+
+// New returns a logger writing to w. level is one of debug, info, warn or
+// error, format is text or json.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redact}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
+
+// Discard returns a logger that drops everything, for tests.
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func redact(_ []string, attr slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(attr.Key)] {
+		return slog.String(attr.Key, redacted)
+	}
+	return attr
+}
+
+var dsnPassword = regexp.MustCompile(`password=\S+`)
+
+// RedactDSN hides the password of a database URL or key/value connection
+// string, keeping the rest of it useful for debugging.
+func RedactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		return dsnPassword.ReplaceAllString(u.Redacted(), "password="+redacted)
+	}
+	return dsnPassword.ReplaceAllString(dsn, "password="+redacted)
+}
+
+type attrsKey struct{}
+
+// With returns a context whose log lines carry the given key/value pairs in
+// addition to those already in ctx.
+func With(ctx context.Context, args ...any) context.Context {
+	parent, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	record := slog.NewRecord(time.Time{}, 0, "", 0)
+	record.Add(args...)
+	attrs := make([]slog.Attr, len(parent), len(parent)+record.NumAttrs())
+	copy(attrs, parent)
+	record.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, attr)
+		return true
+	})
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// contextHandler adds the fields stored by With to every record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   string
+		format  string
+		wantErr bool
+	}{
+		{name: "json", level: "info", format: "json"},
+		{name: "текст в любом регистре", level: "DEBUG", format: "Text"},
+		{name: "неизвестный уровень", level: "verbose", format: "json", wantErr: true},
+		{name: "неизвестный формат", level: "info", format: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, err := New(&bytes.Buffer{}, tt.level, tt.format)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, logger)
+		})
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	assert.NoError(t, err)
+
+	ctx := With(context.Background(), RequestIDKey, "req-1")
+	ctx = With(ctx, UserIDKey, int64(7), OrderKey, "12345678903")
+	logger.DebugContext(ctx, "dropped below the level")
+	logger.InfoContext(ctx, "order uploaded",
+		slog.String("authorization", "Bearer abc"),
+		slog.String("Password", "hunter2"),
+		slog.String("reset_token", "abc123"),
+		slog.String("status", "NEW"))
+
+	var line map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line), "exactly one line is written")
+	assert.Equal(t, "order uploaded", line["msg"])
+	assert.Equal(t, "req-1", line[RequestIDKey])
+	assert.Equal(t, float64(7), line[UserIDKey])
+	assert.Equal(t, "12345678903", line[OrderKey])
+	assert.Equal(t, "NEW", line["status"])
+	assert.Equal(t, redacted, line["authorization"])
+	assert.Equal(t, redacted, line["Password"])
+	assert.Equal(t, redacted, line["reset_token"])
+}
+
+func TestWithDoesNotLeakIntoParent(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	assert.NoError(t, err)
+
+	parent := With(context.Background(), RequestIDKey, "req-1")
+	_ = With(parent, OrderKey, "12345678903")
+	logger.InfoContext(parent, "done")
+
+	var line map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.NotContains(t, line, OrderKey)
+}
+
+func TestRedactDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		dsn  string
+		want string
+	}{
+		{
+			name: "URL с паролем",
+			dsn:  "postgres://gophermart:s3cret@db:5432/gophermart?sslmode=disable",
+			want: "postgres://gophermart:xxxxx@db:5432/gophermart?sslmode=disable",
+		},
+		{
+			name: "URL без пароля",
+			dsn:  "postgres://db:5432/gophermart",
+			want: "postgres://db:5432/gophermart",
+		},
+		{
+			name: "строка ключ=значение",
+			dsn:  "host=db user=gophermart password=s3cret dbname=gophermart",
+			want: "host=db user=gophermart password=[REDACTED] dbname=gophermart",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, RedactDSN(tt.dsn))
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package loyalty
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultRetryAfter is used when a 429 response carries no usable Retry-After header.
+const defaultRetryAfter = 60 * time.Second
+
+var rateLimitPattern = regexp.MustCompile(`(\d+)\s+requests?\s+per\s+minute`)
+
+// limiter gates every outgoing request to the accrual service. A 429 pauses
+// all callers until the Retry-After window ends, and once the service has told
+// us its requests-per-minute quota, requests are spaced to stay under it.
+type limiter struct {
+	mu          sync.Mutex
+	pausedUntil time.Time
+	next        time.Time
+	interval    time.Duration
+}
+
+func newLimiter() *limiter {
+	return &limiter{}
+}
+
+// wait blocks until the caller may send a request and reserves that slot.
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	at := time.Now()
+	if l.pausedUntil.After(at) {
+		at = l.pausedUntil
+	}
+	if l.next.After(at) {
+		at = l.next
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// tryAcquire reserves a slot only if one is available right now.
+func (l *limiter) tryAcquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.pausedUntil.After(now) || l.next.After(now) {
+		return false
+	}
+	l.next = now.Add(l.interval)
+	return true
+}
+
+func (l *limiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// state reports how long requests stay paused after a 429 and the spacing
+// between requests imposed by the service's quota.
+func (l *limiter) state(now time.Time) (pause, interval time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.pausedUntil.After(now) {
+		pause = l.pausedUntil.Sub(now)
+	}
+	return pause, l.interval
+}
+
+func (l *limiter) setRate(perMinute int) {
+	if perMinute <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.interval = time.Minute / time.Duration(perMinute)
+}
+
+// parseRetryAfter accepts both forms allowed by RFC 9110: delay-seconds and an HTTP-date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return defaultRetryAfter
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
+
+// parseRateLimit extracts N from bodies like "No more than N requests per minute allowed".
+func parseRateLimit(body string) int {
+	m := rateLimitPattern.FindStringSubmatch(body)
+	if m == nil {
+		return 0
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0
+	}
+	return n
+}
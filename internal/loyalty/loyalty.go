@@ -5,13 +5,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/logging"
 	"github.com/AlenaMolokova/diploma/internal/models"
-	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/AlenaMolokova/diploma/internal/tracing"
 )
 
 var (
@@ -20,20 +26,39 @@ var (
 	ErrOrderProcessing = fmt.Errorf("order is still processing")
 )
 
-type OrderStorage interface {
-	GetAllOrders(ctx context.Context) ([]models.Order, error)
-	UpdateOrder(ctx context.Context, order models.Order) error
-}
+const (
+	// jobLease bounds how long a claimed job stays invisible to other replicas.
+	jobLease = 2 * time.Minute
+	// maxRetryBackoff caps the exponential delay between failed checks.
+	maxRetryBackoff = 10 * time.Minute
+	// pingTimeout bounds the reachability probe behind Ping.
+	pingTimeout = 2 * time.Second
+)
 
-type BalanceUpdater interface {
-	GetBalance(ctx context.Context, userID int64) (pgtype.Float8, pgtype.Float8, error)
-	UpdateBalance(ctx context.Context, userID int64, amount float64) error
+type OrderStorage interface {
+	ClaimAccrualJobs(ctx context.Context, owner string, limit int, lease time.Duration) ([]models.AccrualJob, error)
+	RescheduleAccrualJob(ctx context.Context, number, owner string, at time.Time) error
+	FailAccrualJob(ctx context.Context, failure models.AccrualJobFailure) (bool, error)
+	ApplyAccrual(ctx context.Context, number, status string, accrual money.Amount) (bool, error)
+	RecordAccrualCheck(ctx context.Context, check models.AccrualCheck) error
 }
 
 type Client struct {
 	baseURL      string
 	client       *http.Client
+	probe        *http.Client
 	pollInterval time.Duration
+	workers      int
+	batchSize    int
+	maxAttempts  int
+	maxNotFound  int
+	owner        string
+	limiter      *limiter
+	logger       *slog.Logger
+
+	// lastCycle is the Unix time in nanoseconds at which a polling round
+	// last went through the whole due queue without a storage error.
+	lastCycle atomic.Int64
 }
 
 func NewClient(baseURL string) *Client {
@@ -42,18 +67,135 @@ func NewClient(baseURL string) *Client {
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		probe: &http.Client{
+			Timeout: pingTimeout,
+		},
 		pollInterval: time.Duration(constants.DefaultPollInterval) * time.Second,
+		workers:      constants.DefaultAccrualWorkers,
+		batchSize:    constants.DefaultAccrualBatchSize,
+		maxAttempts:  constants.DefaultAccrualAttempts,
+		maxNotFound:  constants.DefaultAccrualNotFound,
+		owner:        workerID(),
+		limiter:      newLimiter(),
+		logger:       slog.Default(),
 	}
 }
 
+// workerID identifies this replica as the owner of the jobs it claims.
+func workerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "gophermart"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+func (c *Client) SetLogger(logger *slog.Logger) {
+	c.logger = logger
+}
+
 func (c *Client) SetPollInterval(seconds int) {
 	c.pollInterval = time.Duration(seconds) * time.Second
 }
 
+func (c *Client) SetWorkers(n int) {
+	if n > 0 {
+		c.workers = n
+	}
+}
+
+func (c *Client) SetBatchSize(n int) {
+	if n > 0 {
+		c.batchSize = n
+	}
+}
+
+// SetRetryLimits sets after how many failed checks, or consecutive 404s from
+// the accrual service, an order's job is dead-lettered.
+func (c *Client) SetRetryLimits(maxAttempts, maxNotFound int) {
+	if maxAttempts > 0 {
+		c.maxAttempts = maxAttempts
+	}
+	if maxNotFound > 0 {
+		c.maxNotFound = maxNotFound
+	}
+}
+
+// WrapTransport wraps the transport used for requests to the accrual service,
+// for instance to instrument them.
+func (c *Client) WrapTransport(wrap func(http.RoundTripper) http.RoundTripper) {
+	transport := c.client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	c.client.Transport = wrap(transport)
+}
+
+// Backoff reports how long requests to the accrual service stay paused after
+// a 429, and the spacing between requests imposed by its quota.
+func (c *Client) Backoff() (pause, interval time.Duration) {
+	return c.limiter.state(time.Now())
+}
+
+// Ping reports whether the accrual service answers HTTP requests at all. It
+// requests the service's root, so it neither counts against the quota of
+// the order endpoint nor waits for the limiter: any response is a success.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create accrual ping request: %w", err)
+	}
+	resp, err := c.probe.Do(req)
+	if err != nil {
+		return fmt.Errorf("accrual service is unreachable: %w", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
+
+// LastCycle returns when a polling round last completed, or the zero time if
+// none has since the client started.
+func (c *Client) LastCycle() time.Time {
+	nanos := c.lastCycle.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// PollInterval returns the interval between polling rounds.
+func (c *Client) PollInterval() time.Duration {
+	return c.pollInterval
+}
+
 type AccrualResponse struct {
-	Order   string  `json:"order"`
-	Status  string  `json:"status"`
-	Accrual float64 `json:"accrual,omitempty"`
+	Order   string       `json:"order"`
+	Status  string       `json:"status"`
+	Accrual money.Amount `json:"accrual,omitempty"`
+}
+
+// UnmarshalJSON rounds the accrual to hundredths instead of rejecting it: the
+// accrual service is not bound to the two decimal places users may enter.
+func (r *AccrualResponse) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Order   string      `json:"order"`
+		Status  string      `json:"status"`
+		Accrual json.Number `json:"accrual"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*r = AccrualResponse{Order: raw.Order, Status: raw.Status}
+	if raw.Accrual != "" {
+		accrual, err := money.ParseLenient(raw.Accrual.String())
+		if err != nil {
+			return err
+		}
+		r.Accrual = accrual
+	}
+	return nil
 }
 
 func (c *Client) checkOrderInternal(ctx context.Context, orderNumber string) (*AccrualResponse, error) {
@@ -78,7 +220,12 @@ func (c *Client) checkOrderInternal(ctx context.Context, orderNumber string) (*A
 	case http.StatusNotFound:
 		return nil, ErrOrderNotFound
 	case http.StatusTooManyRequests:
-		return nil, ErrRateLimit
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		c.limiter.pause(retryAfter)
+		if body, err := io.ReadAll(io.LimitReader(resp.Body, 1024)); err == nil {
+			c.limiter.setRate(parseRateLimit(string(body)))
+		}
+		return nil, fmt.Errorf("%w: retry after %v", ErrRateLimit, retryAfter)
 	case http.StatusNoContent:
 		return nil, ErrOrderProcessing
 	default:
@@ -86,7 +233,16 @@ func (c *Client) checkOrderInternal(ctx context.Context, orderNumber string) (*A
 	}
 }
 
-func (c *Client) CheckOrder(ctx context.Context, orderNumber string) (*models.LoyaltyResponse, error) {
+// CheckOrder is called while serving a user request, so it does not wait for
+// the rate limit window: it fails with ErrRateLimit and leaves the order to the poller.
+func (c *Client) CheckOrder(ctx context.Context, orderNumber string) (_ *models.LoyaltyResponse, err error) {
+	ctx, span := tracing.Start(ctx, "loyalty.CheckOrder", tracing.Order(orderNumber))
+	defer func() { tracing.End(span, err) }()
+
+	if !c.limiter.tryAcquire() {
+		return nil, ErrRateLimit
+	}
+
 	resp, err := c.checkOrderInternal(ctx, orderNumber)
 	if err != nil {
 		return nil, err
@@ -99,14 +255,19 @@ func (c *Client) CheckOrder(ctx context.Context, orderNumber string) (*models.Lo
 	}, nil
 }
 
+// StartOrderProcessing claims due accrual jobs every pollInterval until ctx is
+// cancelled. It returns only after the workers of the current round exit.
 func (c *Client) StartOrderProcessing(ctx context.Context, store OrderStorage) {
-	log.Printf("Starting order processing with interval: %v", c.pollInterval)
+	c.logger.InfoContext(ctx, "Starting order processing",
+		slog.Duration("interval", c.pollInterval), slog.Int("workers", c.workers), slog.String("owner", c.owner))
 
-	for ticker := time.NewTicker(c.pollInterval); ; {
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+
+	for {
 		select {
 		case <-ctx.Done():
-			ticker.Stop()
-			log.Println("Order processing stopped")
+			c.logger.InfoContext(ctx, "Order processing stopped")
 			return
 		case <-ticker.C:
 			c.processOrders(ctx, store)
@@ -114,71 +275,175 @@ func (c *Client) StartOrderProcessing(ctx context.Context, store OrderStorage) {
 	}
 }
 
+// processOrders claims due jobs in batches and hands them to a bounded pool
+// of workers. All workers share the client's rate limiter.
 func (c *Client) processOrders(ctx context.Context, store OrderStorage) {
-	orders, err := store.GetAllOrders(ctx)
-	if err != nil {
-		log.Printf("Failed to get orders: %v", err)
-		return
+	jobs := make(chan models.AccrualJob)
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				c.processJob(ctx, store, job)
+			}
+		}()
+	}
+
+	drained := c.feedJobs(ctx, store, jobs)
+	close(jobs)
+	wg.Wait()
+	if drained {
+		c.lastCycle.Store(time.Now().UnixNano())
 	}
+}
+
+// feedJobs reports whether it went through every due job, as opposed to
+// stopping on a storage error or cancellation.
+func (c *Client) feedJobs(ctx context.Context, store OrderStorage, jobs chan<- models.AccrualJob) bool {
+	for {
+		claimed, err := store.ClaimAccrualJobs(ctx, c.owner, c.batchSize, jobLease)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.logger.ErrorContext(ctx, "Failed to claim accrual jobs", slog.Any("error", err))
+			}
+			return false
+		}
+
+		for _, job := range claimed {
+			select {
+			case <-ctx.Done():
+				return false
+			case jobs <- job:
+			}
+		}
 
-	for _, order := range orders {
-		c.processOrder(ctx, store, order)
+		if len(claimed) < c.batchSize {
+			return true
+		}
 	}
 }
 
-func (c *Client) processOrder(ctx context.Context, store OrderStorage, order models.Order) {
-	if order.Status == constants.StatusProcessed || order.Status == constants.StatusInvalid {
+// processJob checks one claimed order. If the worker is interrupted, the job
+// is left leased and becomes claimable again once the lease expires. Each
+// check is traced on its own, linked to the trace of the order's upload.
+func (c *Client) processJob(ctx context.Context, store OrderStorage, job models.AccrualJob) {
+	ctx, span := tracing.StartLinked(ctx, "loyalty.processJob", job.TraceParent,
+		tracing.Order(job.OrderNumber), tracing.UserID(job.UserID), tracing.AttemptsKey.Int(job.Attempts))
+	defer span.End()
+
+	ctx = logging.With(ctx, logging.OrderKey, job.OrderNumber, logging.UserIDKey, job.UserID)
+	if err := c.limiter.wait(ctx); err != nil {
 		return
 	}
 
-	resp, err := c.checkOrderInternal(ctx, order.Number)
+	resp, err := c.checkOrderInternal(ctx, job.OrderNumber)
+	if ctx.Err() != nil {
+		return
+	}
 	if err != nil {
-		if errors.Is(err, ErrOrderProcessing) {
-			return
-		}
-		log.Printf("Failed to check order %s: %v", order.Number, err)
+		span.RecordError(err)
+	} else {
+		span.SetAttributes(tracing.OrderStatusKey.String(resp.Status))
+	}
+	c.recordCheck(ctx, store, job.OrderNumber, resp, err)
+	switch {
+	case errors.Is(err, ErrOrderProcessing):
+		c.rescheduleJob(ctx, store, job, c.pollInterval)
+		return
+	case errors.Is(err, ErrRateLimit):
+		c.rescheduleJob(ctx, store, job, 0)
+		return
+	case err != nil:
+		c.failJob(ctx, store, job, err)
 		return
 	}
 
-	prevStatus := order.Status
-	updatedOrder := models.Order{
-		ID:         order.ID,
-		UserID:     order.UserID,
-		Number:     order.Number,
-		Status:     resp.Status,
-		Accrual:    pgtype.Float8{Float64: resp.Accrual, Valid: resp.Accrual > 0},
-		UploadedAt: order.UploadedAt,
+	credited, err := store.ApplyAccrual(ctx, job.OrderNumber, resp.Status, resp.Accrual)
+	if err != nil {
+		c.failJob(ctx, store, job, err)
+		return
 	}
 
-	if err := store.UpdateOrder(ctx, updatedOrder); err != nil {
-		log.Printf("Failed to update order %s: %v", order.Number, err)
-		return
+	c.logger.DebugContext(ctx, "Updated order",
+		slog.String("status", resp.Status), slog.String("accrual", resp.Accrual.String()))
+	if credited {
+		c.logger.InfoContext(ctx, "Credited accrual", slog.String("accrual", resp.Accrual.String()))
 	}
 
-	log.Printf("Updated order %s: status=%s, accrual=%.2f", order.Number, resp.Status, resp.Accrual)
+	if resp.Status != constants.StatusProcessed && resp.Status != constants.StatusInvalid {
+		c.rescheduleJob(ctx, store, job, c.pollInterval)
+	}
+}
 
-	balanceStore, ok := store.(BalanceUpdater)
-	if ok && resp.Status == constants.StatusProcessed && prevStatus != constants.StatusProcessed && resp.Accrual > 0 {
-		c.updateUserBalance(ctx, balanceStore, order.UserID, resp.Accrual)
+// recordCheck adds the outcome of a check to the order's history. The history
+// is informational, so failing to write it does not stop the job.
+func (c *Client) recordCheck(ctx context.Context, store OrderStorage, number string, resp *AccrualResponse, checkErr error) {
+	check := models.AccrualCheck{OrderNumber: number, Outcome: checkOutcome(checkErr)}
+	if checkErr != nil {
+		check.Error = checkErr.Error()
+	} else {
+		check.Status = resp.Status
+		if resp.Status == constants.StatusProcessed {
+			check.Accrual = &resp.Accrual
+		}
+	}
+	if err := store.RecordAccrualCheck(ctx, check); err != nil {
+		c.logger.WarnContext(ctx, "Failed to record order check", slog.Any("error", err))
 	}
 }
 
-func (c *Client) updateUserBalance(ctx context.Context, store BalanceUpdater, userID int64, accrual float64) {
-	current, _, err := store.GetBalance(ctx, userID)
-	if err != nil {
-		log.Printf("Failed to get current balance: %v", err)
-		return
+func checkOutcome(err error) string {
+	switch {
+	case err == nil:
+		return constants.CheckAccrual
+	case errors.Is(err, ErrOrderProcessing):
+		return constants.CheckNoContent
+	case errors.Is(err, ErrOrderNotFound):
+		return constants.CheckNotFound
+	case errors.Is(err, ErrRateLimit):
+		return constants.CheckRateLimited
+	default:
+		return constants.CheckError
 	}
+}
 
-	newBalance := accrual
-	if current.Valid {
-		newBalance += current.Float64
+func (c *Client) rescheduleJob(ctx context.Context, store OrderStorage, job models.AccrualJob, delay time.Duration) {
+	if err := store.RescheduleAccrualJob(ctx, job.OrderNumber, c.owner, time.Now().Add(delay)); err != nil {
+		c.logger.ErrorContext(ctx, "Failed to reschedule order", slog.Any("error", err))
 	}
+}
+
+func (c *Client) failJob(ctx context.Context, store OrderStorage, job models.AccrualJob, cause error) {
+	c.logger.WarnContext(ctx, "Failed to check order", slog.Any("error", cause))
 
-	if err := store.UpdateBalance(ctx, userID, newBalance); err != nil {
-		log.Printf("Failed to update balance: %v", err)
+	dead, err := store.FailAccrualJob(ctx, models.AccrualJobFailure{
+		OrderNumber: job.OrderNumber,
+		Owner:       c.owner,
+		NotFound:    errors.Is(cause, ErrOrderNotFound),
+		Error:       cause.Error(),
+		RetryAt:     time.Now().Add(c.retryBackoff(job.Attempts)),
+		MaxAttempts: c.maxAttempts,
+		MaxNotFound: c.maxNotFound,
+	})
+	if err != nil {
+		c.logger.ErrorContext(ctx, "Failed to record order failure", slog.Any("error", err))
 		return
 	}
+	if dead {
+		c.logger.ErrorContext(ctx, "Order moved to dead letter", slog.Int("attempts", job.Attempts+1))
+	}
+}
 
-	log.Printf("Updated balance for user %d: added %.2f, new balance: %.2f", userID, accrual, newBalance)
+// retryBackoff doubles the poll interval for every earlier failure, up to maxRetryBackoff.
+func (c *Client) retryBackoff(attempts int) time.Duration {
+	backoff := c.pollInterval
+	for i := 0; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff
 }
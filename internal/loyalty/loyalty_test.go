@@ -5,47 +5,183 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/logging"
 	"github.com/AlenaMolokova/diploma/internal/models"
-	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/AlenaMolokova/diploma/internal/testutils"
+	"github.com/AlenaMolokova/diploma/internal/tracing"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
+type mockJob struct {
+	state       string
+	attempts    int
+	notFound    int
+	nextAt      time.Time
+	owner       string
+	leasedUntil time.Time
+}
+
 type mockOrderStorage struct {
-	orders []models.Order
+	mu      sync.Mutex
+	orders  []models.Order
+	jobs    map[string]*mockJob
+	entries []models.LedgerEntry
+	claims  int
+	// claimErr, if set, is returned by ClaimAccrualJobs.
+	claimErr error
+	checks   []models.AccrualCheck
 }
 
-func (m *mockOrderStorage) GetAllOrders(ctx context.Context) ([]models.Order, error) {
-	return m.orders, nil
+func newMockOrderStorage(orders ...models.Order) *mockOrderStorage {
+	m := &mockOrderStorage{orders: orders, jobs: map[string]*mockJob{}}
+	for _, o := range orders {
+		if o.Status != constants.StatusProcessed && o.Status != constants.StatusInvalid {
+			m.jobs[o.Number] = &mockJob{state: constants.JobStatePending}
+		}
+	}
+	return m
 }
 
-func (m *mockOrderStorage) UpdateOrder(ctx context.Context, order models.Order) error {
-	for i, o := range m.orders {
-		if o.ID == order.ID {
-			m.orders[i] = order
-			return nil
+func (m *mockOrderStorage) ClaimAccrualJobs(ctx context.Context, owner string, limit int, lease time.Duration) ([]models.AccrualJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.claims++
+	if m.claimErr != nil {
+		return nil, m.claimErr
+	}
+	now := time.Now()
+	var claimed []models.AccrualJob
+	for _, o := range m.orders {
+		job, ok := m.jobs[o.Number]
+		if !ok || job.state != constants.JobStatePending || job.nextAt.After(now) || job.leasedUntil.After(now) {
+			continue
+		}
+		job.owner = owner
+		job.leasedUntil = now.Add(lease)
+		claimed = append(claimed, models.AccrualJob{
+			OrderNumber: o.Number,
+			UserID:      o.UserID,
+			Attempts:    job.attempts,
+			NotFound:    job.notFound,
+		})
+		if len(claimed) == limit {
+			break
 		}
 	}
-	return errors.New("order not found")
+	return claimed, nil
+}
+
+func (m *mockOrderStorage) RescheduleAccrualJob(ctx context.Context, number, owner string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if job, ok := m.jobs[number]; ok && job.owner == owner && job.state == constants.JobStatePending {
+		job.nextAt = at
+		job.notFound = 0
+		job.owner = ""
+		job.leasedUntil = time.Time{}
+	}
+	return nil
 }
 
-type mockBalanceUpdater struct {
-	balances map[int64]pgtype.Float8
+func (m *mockOrderStorage) FailAccrualJob(ctx context.Context, failure models.AccrualJobFailure) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[failure.OrderNumber]
+	if !ok || job.owner != failure.Owner || job.state != constants.JobStatePending {
+		return false, nil
+	}
+	job.attempts++
+	if failure.NotFound {
+		job.notFound++
+	} else {
+		job.notFound = 0
+	}
+	if job.attempts >= failure.MaxAttempts || (failure.NotFound && job.notFound >= failure.MaxNotFound) {
+		job.state = constants.JobStateDead
+	}
+	job.nextAt = failure.RetryAt
+	job.owner = ""
+	job.leasedUntil = time.Time{}
+	return job.state == constants.JobStateDead, nil
 }
 
-func (m *mockBalanceUpdater) GetBalance(ctx context.Context, userID int64) (pgtype.Float8, pgtype.Float8, error) {
-	if balance, ok := m.balances[userID]; ok {
-		return balance, pgtype.Float8{}, nil
+func (m *mockOrderStorage) ApplyAccrual(ctx context.Context, number, status string, accrual money.Amount) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, o := range m.orders {
+		if o.Number != number {
+			continue
+		}
+		if o.Status == constants.StatusProcessed || o.Status == constants.StatusInvalid {
+			m.finishJob(number)
+			return false, nil
+		}
+		m.orders[i].Status = status
+		m.orders[i].Accrual = accrual
+		if status == constants.StatusProcessed || status == constants.StatusInvalid {
+			m.finishJob(number)
+		}
+		if status != constants.StatusProcessed || accrual <= 0 {
+			return false, nil
+		}
+		m.entries = append(m.entries, models.LedgerEntry{
+			UserID:      o.UserID,
+			Kind:        constants.LedgerKindAccrual,
+			Amount:      accrual,
+			OrderNumber: number,
+		})
+		return true, nil
 	}
-	return pgtype.Float8{}, pgtype.Float8{}, nil
+	return false, errors.New("order not found")
 }
 
-func (m *mockBalanceUpdater) UpdateBalance(ctx context.Context, userID int64, amount float64) error {
-	m.balances[userID] = pgtype.Float8{Float64: amount, Valid: true}
+func (m *mockOrderStorage) RecordAccrualCheck(ctx context.Context, check models.AccrualCheck) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.checks = append(m.checks, check)
 	return nil
 }
 
+func (m *mockOrderStorage) finishJob(number string) {
+	if job, ok := m.jobs[number]; ok {
+		job.state = constants.JobStateDone
+		job.owner = ""
+	}
+}
+
+func (m *mockOrderStorage) jobState(number string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if job, ok := m.jobs[number]; ok {
+		return job.state
+	}
+	return ""
+}
+
+func (m *mockOrderStorage) balance(userID int64) money.Amount {
+	var total money.Amount
+	for _, e := range m.entries {
+		if e.UserID == userID {
+			total += e.Amount
+		}
+	}
+	return total
+}
+
 func TestCheckOrder(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -119,13 +255,7 @@ func TestProcessOrder(t *testing.T) {
 		Status: constants.StatusNew,
 	}
 
-	orderStorage := &mockOrderStorage{
-		orders: []models.Order{order},
-	}
-
-	balanceUpdater := &mockBalanceUpdater{
-		balances: make(map[int64]pgtype.Float8),
-	}
+	orderStorage := newMockOrderStorage(order)
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -134,18 +264,452 @@ func TestProcessOrder(t *testing.T) {
 	defer server.Close()
 
 	client := NewClient(server.URL)
-	client.processOrder(context.Background(), struct {
-		OrderStorage
-		BalanceUpdater
-	}{orderStorage, balanceUpdater}, order)
+	job := models.AccrualJob{OrderNumber: order.Number, UserID: order.UserID}
+	client.processJob(context.Background(), orderStorage, job)
+	client.processJob(context.Background(), orderStorage, job)
 
 	updatedOrder := orderStorage.orders[0]
 	if updatedOrder.Status != constants.StatusProcessed {
 		t.Errorf("Expected status %s, got %s", constants.StatusProcessed, updatedOrder.Status)
 	}
 
-	balance, _, _ := balanceUpdater.GetBalance(context.Background(), order.UserID)
-	if !balance.Valid || balance.Float64 != 100.0 {
-		t.Errorf("Expected balance 100.0, got %v", balance.Float64)
+	if balance := orderStorage.balance(order.UserID); balance != money.MustParse("100") {
+		t.Errorf("Expected balance 100, got %s", balance)
+	}
+	if len(orderStorage.entries) != 1 || orderStorage.entries[0].OrderNumber != order.Number {
+		t.Errorf("Expected one ledger entry for order %s, got %+v", order.Number, orderStorage.entries)
+	}
+	if state := orderStorage.jobState(order.Number); state != constants.JobStateDone {
+		t.Errorf("Expected job state %s, got %s", constants.JobStateDone, state)
+	}
+}
+
+func TestProcessJobRecordsChecks(t *testing.T) {
+	tests := []struct {
+		name        string
+		code        int
+		body        string
+		wantOutcome string
+		wantStatus  string
+		wantAccrual string
+		wantError   bool
+	}{
+		{"начисление получено", http.StatusOK, `{"order":"123","status":"PROCESSED","accrual":100.5}`, constants.CheckAccrual, constants.StatusProcessed, "100.5", false},
+		{"начисление с лишними знаками округляется", http.StatusOK, `{"order":"123","status":"PROCESSED","accrual":86.4192}`, constants.CheckAccrual, constants.StatusProcessed, "86.42", false},
+		{"начисление в экспоненциальной записи", http.StatusOK, `{"order":"123","status":"PROCESSED","accrual":1e-7}`, constants.CheckAccrual, constants.StatusProcessed, "0", false},
+		{"заказ ещё в обработке у сервиса", http.StatusOK, `{"order":"123","status":"PROCESSING"}`, constants.CheckAccrual, constants.StatusProcessing, "", false},
+		{"ответ 204", http.StatusNoContent, "", constants.CheckNoContent, "", "", true},
+		{"ответ 404", http.StatusNotFound, "", constants.CheckNotFound, "", "", true},
+		{"ответ 429", http.StatusTooManyRequests, "", constants.CheckRateLimited, "", "", true},
+		{"ошибка сервиса", http.StatusInternalServerError, "", constants.CheckError, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderStorage := newMockOrderStorage(models.Order{ID: 1, UserID: 1, Number: "123", Status: constants.StatusNew})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.code == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "0")
+				}
+				w.WriteHeader(tt.code)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL)
+			client.SetLogger(logging.Discard())
+			client.processJob(context.Background(), orderStorage, models.AccrualJob{OrderNumber: "123", UserID: 1})
+
+			if len(orderStorage.checks) != 1 {
+				t.Fatalf("Expected one recorded check, got %+v", orderStorage.checks)
+			}
+			check := orderStorage.checks[0]
+			if check.OrderNumber != "123" || check.Outcome != tt.wantOutcome || check.Status != tt.wantStatus {
+				t.Errorf("Expected check %s with status %q, got %+v", tt.wantOutcome, tt.wantStatus, check)
+			}
+			if (check.Error != "") != tt.wantError {
+				t.Errorf("Expected error recorded: %v, got %q", tt.wantError, check.Error)
+			}
+			switch {
+			case tt.wantAccrual == "" && check.Accrual != nil:
+				t.Errorf("Expected no accrual, got %s", check.Accrual)
+			case tt.wantAccrual != "" && (check.Accrual == nil || *check.Accrual != money.MustParse(tt.wantAccrual)):
+				t.Errorf("Expected accrual %s, got %v", tt.wantAccrual, check.Accrual)
+			}
+		})
+	}
+}
+
+func TestProcessJobTraced(t *testing.T) {
+	spans := testutils.RecordSpans(t)
+	order := models.Order{ID: 1, UserID: 1, Number: "123", Status: constants.StatusNew}
+	orderStorage := newMockOrderStorage(order)
+
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("traceparent")
+		w.Write([]byte(`{"order":"123","status":"PROCESSING"}`))
+	}))
+	defer server.Close()
+
+	uploadCtx, upload := tracing.Start(context.Background(), "upload")
+	upload.End()
+
+	client := NewClient(server.URL)
+	client.WrapTransport(tracing.Transport)
+	client.processJob(context.Background(), orderStorage, models.AccrualJob{
+		OrderNumber: order.Number,
+		UserID:      order.UserID,
+		TraceParent: tracing.Inject(uploadCtx),
+	})
+
+	var check *tracetest.SpanStub
+	for _, span := range spans.GetSpans() {
+		if span.Name == "loyalty.processJob" {
+			check = &span
+		}
+	}
+	if check == nil {
+		t.Fatal("Expected a span for the check")
+	}
+	if len(check.Links) != 1 || check.Links[0].SpanContext.SpanID() != upload.SpanContext().SpanID() {
+		t.Errorf("Expected the check to link to the upload span, got %+v", check.Links)
+	}
+	if !strings.Contains(header, check.SpanContext.TraceID().String()) {
+		t.Errorf("Expected the accrual request to carry the check's trace, got traceparent %q", header)
+	}
+	found := false
+	for _, attr := range check.Attributes {
+		found = found || attr == tracing.Order(order.Number)
+	}
+	if !found {
+		t.Errorf("Expected the check span to carry the order number, got %v", check.Attributes)
+	}
+}
+
+func TestRetryAfterPausesPolling(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []time.Time
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, time.Now())
+		first := len(calls) == 1
+		mu.Unlock()
+
+		if first {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte("No more than 600 requests per minute allowed"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"order":"` + r.URL.Path[len("/api/orders/"):] + `","status":"PROCESSING"}`))
+	}))
+	defer server.Close()
+
+	orderStorage := newMockOrderStorage(
+		models.Order{ID: 1, UserID: 1, Number: "1", Status: constants.StatusNew},
+		models.Order{ID: 2, UserID: 1, Number: "2", Status: constants.StatusNew},
+		models.Order{ID: 3, UserID: 1, Number: "3", Status: constants.StatusNew},
+	)
+
+	client := NewClient(server.URL)
+	client.SetWorkers(1)
+	client.processOrders(context.Background(), orderStorage)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(calls))
+	}
+	if gap := calls[1].Sub(calls[0]); gap < 900*time.Millisecond {
+		t.Errorf("Expected requests to pause for Retry-After, got gap %v", gap)
+	}
+	if gap := calls[2].Sub(calls[1]); gap < 90*time.Millisecond {
+		t.Errorf("Expected requests to be throttled to 600 rpm, got gap %v", gap)
+	}
+}
+
+func TestCheckOrderFailsFastWhileRateLimited(t *testing.T) {
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	for i := 0; i < 3; i++ {
+		if _, err := client.CheckOrder(context.Background(), "123"); !errors.Is(err, ErrRateLimit) {
+			t.Errorf("Expected ErrRateLimit, got %v", err)
+		}
+	}
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected a single request during the Retry-After window, got %d", n)
+	}
+	if pause, _ := client.Backoff(); pause < 50*time.Second {
+		t.Errorf("Expected the client to report the Retry-After pause, got %v", pause)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+	}{
+		{name: "seconds", value: "30", expected: 30 * time.Second},
+		{name: "http date", value: now.Add(90 * time.Second).Format(http.TimeFormat), expected: 90 * time.Second},
+		{name: "date in the past", value: now.Add(-time.Minute).Format(http.TimeFormat), expected: 0},
+		{name: "missing", value: "", expected: defaultRetryAfter},
+		{name: "garbage", value: "soon", expected: defaultRetryAfter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected int
+	}{
+		{body: "No more than 60 requests per minute allowed", expected: 60},
+		{body: "No more than 1 request per minute allowed", expected: 1},
+		{body: "slow down", expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			if got := parseRateLimit(tt.body); got != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestProcessOrdersWorkerPool(t *testing.T) {
+	var (
+		inFlight    atomic.Int64
+		maxInFlight atomic.Int64
+		requests    atomic.Int64
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		number := r.URL.Path[len("/api/orders/"):]
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"order":"` + number + `","status":"PROCESSED","accrual":10}`))
+	}))
+	defer server.Close()
+
+	var orders []models.Order
+	for i := 1; i <= 7; i++ {
+		status := constants.StatusNew
+		if i%3 == 0 {
+			status = constants.StatusProcessed
+		}
+		orders = append(orders, models.Order{
+			ID:     int64(i),
+			UserID: 1,
+			Number: string(rune('0' + i)),
+			Status: status,
+		})
+	}
+	orderStorage := newMockOrderStorage(orders...)
+
+	client := NewClient(server.URL)
+	client.SetWorkers(3)
+	client.SetBatchSize(2)
+	client.processOrders(context.Background(), orderStorage)
+
+	if n := requests.Load(); n != 5 {
+		t.Errorf("Expected 5 requests for pending orders, got %d", n)
+	}
+	if m := maxInFlight.Load(); m < 2 || m > 3 {
+		t.Errorf("Expected between 2 and 3 concurrent requests, got %d", m)
+	}
+	if orderStorage.claims != 3 {
+		t.Errorf("Expected 3 claimed batches, got %d", orderStorage.claims)
+	}
+	if balance := orderStorage.balance(1); balance != money.MustParse("50") {
+		t.Errorf("Expected balance 50, got %s", balance)
+	}
+}
+
+func TestLastCycle(t *testing.T) {
+	client := NewClient("http://127.0.0.1:0")
+	client.SetLogger(logging.Discard())
+	if !client.LastCycle().IsZero() {
+		t.Fatalf("Expected no completed cycle before polling, got %v", client.LastCycle())
+	}
+
+	failing := newMockOrderStorage()
+	failing.claimErr = errors.New("db error")
+	client.processOrders(context.Background(), failing)
+	if !client.LastCycle().IsZero() {
+		t.Errorf("A round that failed to claim jobs must not count as completed")
+	}
+
+	before := time.Now()
+	client.processOrders(context.Background(), newMockOrderStorage())
+	if last := client.LastCycle(); last.Before(before) {
+		t.Errorf("Expected the cycle to complete after %v, got %v", before, last)
+	}
+}
+
+func TestPing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	client := NewClient(server.URL)
+	if err := client.Ping(context.Background()); err != nil {
+		t.Errorf("Any HTTP response means the service is reachable, got %v", err)
+	}
+
+	server.Close()
+	if err := client.Ping(context.Background()); err == nil {
+		t.Error("Expected an error once the service is down")
+	}
+}
+
+func TestStartOrderProcessingStopsOnCancel(t *testing.T) {
+	released := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-released:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	defer close(released)
+
+	orderStorage := newMockOrderStorage(models.Order{ID: 1, UserID: 1, Number: "1", Status: constants.StatusNew})
+
+	client := NewClient(server.URL)
+	client.pollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		client.StartOrderProcessing(ctx, orderStorage)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Order processing did not stop after cancellation")
+	}
+}
+
+func TestFailedJobsAreDeadLettered(t *testing.T) {
+	tests := []struct {
+		name          string
+		responses     []int
+		expectedState string
+	}{
+		{
+			name:          "consecutive 404s reach the limit",
+			responses:     []int{http.StatusNotFound, http.StatusNotFound, http.StatusNotFound},
+			expectedState: constants.JobStateDead,
+		},
+		{
+			name:          "404s interrupted by another error",
+			responses:     []int{http.StatusNotFound, http.StatusNotFound, http.StatusInternalServerError, http.StatusNotFound, http.StatusNotFound},
+			expectedState: constants.JobStatePending,
+		},
+		{
+			name:          "attempt limit exhausted",
+			responses:     []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusInternalServerError, http.StatusNotFound, http.StatusInternalServerError, http.StatusInternalServerError},
+			expectedState: constants.JobStateDead,
+		},
+		{
+			name:          "order processed after failures",
+			responses:     []int{http.StatusInternalServerError, http.StatusNotFound, http.StatusOK},
+			expectedState: constants.JobStateDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(requests.Add(1)) - 1
+				if n >= len(tt.responses) {
+					t.Errorf("Unexpected request #%d", n+1)
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(tt.responses[n])
+				if tt.responses[n] == http.StatusOK {
+					w.Write([]byte(`{"order":"1","status":"PROCESSED","accrual":5}`))
+				}
+			}))
+			defer server.Close()
+
+			orderStorage := newMockOrderStorage(models.Order{ID: 1, UserID: 1, Number: "1", Status: constants.StatusNew})
+
+			client := NewClient(server.URL)
+			client.pollInterval = time.Millisecond
+			client.SetRetryLimits(6, 3)
+
+			for i := 0; i < len(tt.responses); i++ {
+				time.Sleep(40 * time.Millisecond)
+				client.processOrders(context.Background(), orderStorage)
+			}
+
+			if n := requests.Load(); n != int64(len(tt.responses)) {
+				t.Errorf("Expected %d requests, got %d", len(tt.responses), n)
+			}
+			if state := orderStorage.jobState("1"); state != tt.expectedState {
+				t.Errorf("Expected job state %s, got %s", tt.expectedState, state)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	client := NewClient("http://localhost")
+	client.pollInterval = time.Second
+
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 0, expected: time.Second},
+		{attempts: 1, expected: 2 * time.Second},
+		{attempts: 3, expected: 8 * time.Second},
+		{attempts: 30, expected: maxRetryBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := client.retryBackoff(tt.attempts); got != tt.expected {
+			t.Errorf("attempts=%d: expected %v, got %v", tt.attempts, tt.expected, got)
+		}
 	}
 }
@@ -0,0 +1,318 @@
+// Package metrics collects the service's Prometheus metrics: HTTP traffic per
+// route, requests to the accrual service, the accrual polling queue, points
+// movements and database pool statistics.
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gophermart"
+
+// unmatchedRoute labels requests that matched no route, so probing random
+// paths does not create new series.
+const unmatchedRoute = "unmatched"
+
+// queueTimeout bounds the queue depth query run on every scrape.
+const queueTimeout = 5 * time.Second
+
+// Outcomes of a request to the accrual service. Transport failures and
+// unexpected status codes are both counted as errors.
+const (
+	OutcomeOK              = "200"
+	OutcomeNoContent       = "204"
+	OutcomeNotFound        = "404"
+	OutcomeTooManyRequests = "429"
+	OutcomeError           = "error"
+)
+
+// BackoffSource reports the accrual client's rate limiting state.
+type BackoffSource interface {
+	Backoff() (pause, interval time.Duration)
+}
+
+// QueueSource counts the accrual jobs still to be polled by order status.
+type QueueSource interface {
+	CountPendingAccrualJobs(ctx context.Context) (map[string]int64, error)
+}
+
+// PoolSource reports database connection pool statistics.
+type PoolSource interface {
+	Stat() *pgxpool.Stat
+}
+
+type Metrics struct {
+	registry *prometheus.Registry
+	logger   *slog.Logger
+
+	httpRequests    *prometheus.CounterVec
+	httpDuration    *prometheus.HistogramVec
+	accrualRequests *prometheus.CounterVec
+	orderProcessing prometheus.Histogram
+	pointsAccrued   prometheus.Counter
+	pointsWithdrawn prometheus.Counter
+}
+
+// New creates the metrics on a registry of their own, together with the Go
+// runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		logger:   slog.Default(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by route, method and status code.",
+		}, []string{"route", "method", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time spent serving HTTP requests, by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		accrualRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "accrual_requests_total",
+			Help:      "Requests to the accrual service, by outcome.",
+		}, []string{"outcome"}),
+		orderProcessing: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "order_processing_seconds",
+			Help:      "Time from order upload until the order is PROCESSED.",
+			Buckets:   []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 4 * 3600, 12 * 3600, 24 * 3600},
+		}),
+		pointsAccrued: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "points_accrued_total",
+			Help:      "Points credited to users for processed orders.",
+		}),
+		pointsWithdrawn: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "points_withdrawn_total",
+			Help:      "Points withdrawn by users.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.accrualRequests,
+		m.orderProcessing,
+		m.pointsAccrued,
+		m.pointsWithdrawn,
+	)
+	return m
+}
+
+func (m *Metrics) SetLogger(logger *slog.Logger) {
+	m.logger = logger
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts and times requests by their chi route pattern rather
+// than the raw path, which would carry order numbers and user IDs. It has to
+// be mounted on the chi router.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		m.httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// InstrumentAccrual counts the outcomes of the requests sent through next. It
+// is meant for loyalty.Client's WrapTransport.
+func (m *Metrics) InstrumentAccrual(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		resp, err := next.RoundTrip(r)
+		m.accrualRequests.WithLabelValues(accrualOutcome(resp, err)).Inc()
+		return resp, err
+	})
+}
+
+func accrualOutcome(resp *http.Response, err error) string {
+	if err != nil {
+		return OutcomeError
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return OutcomeOK
+	case http.StatusNoContent:
+		return OutcomeNoContent
+	case http.StatusNotFound:
+		return OutcomeNotFound
+	case http.StatusTooManyRequests:
+		return OutcomeTooManyRequests
+	default:
+		return OutcomeError
+	}
+}
+
+// OrderProcessed, PointsAccrued and PointsWithdrawn make Metrics a
+// storage.Observer.
+func (m *Metrics) OrderProcessed(uploadedAt time.Time) {
+	m.orderProcessing.Observe(time.Since(uploadedAt).Seconds())
+}
+
+func (m *Metrics) PointsAccrued(amount money.Amount) {
+	m.pointsAccrued.Add(amount.Float64())
+}
+
+func (m *Metrics) PointsWithdrawn(amount money.Amount) {
+	m.pointsWithdrawn.Add(amount.Float64())
+}
+
+// WatchAccrualBackoff exports the accrual client's current backoff: the time
+// left in a Retry-After pause and the spacing between requests.
+func (m *Metrics) WatchAccrualBackoff(src BackoffSource) {
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "accrual_backoff_seconds",
+			Help:      "Time left before requests to the accrual service resume after a 429.",
+		}, func() float64 {
+			pause, _ := src.Backoff()
+			return pause.Seconds()
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "accrual_request_interval_seconds",
+			Help:      "Spacing between requests to the accrual service imposed by its quota.",
+		}, func() float64 {
+			_, interval := src.Backoff()
+			return interval.Seconds()
+		}),
+	)
+}
+
+// WatchAccrualQueue exports the polling queue depth, queried on every scrape.
+func (m *Metrics) WatchAccrualQueue(src QueueSource) {
+	m.registry.MustRegister(&queueCollector{
+		src:    src,
+		logger: m.logger,
+		depth: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "accrual", "queue_depth"),
+			"Accrual jobs waiting to be polled, by order status.",
+			[]string{"status"}, nil,
+		),
+	})
+}
+
+// WatchPool exports the database connection pool statistics.
+func (m *Metrics) WatchPool(src PoolSource) {
+	m.registry.MustRegister(newPoolCollector(src))
+}
+
+type queueCollector struct {
+	src    QueueSource
+	logger *slog.Logger
+	depth  *prometheus.Desc
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.depth
+}
+
+// Collect always reports the statuses an order can be polled in, so their
+// series do not disappear while the queue is empty. A failed query is logged
+// and leaves the metric out of the scrape.
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), queueTimeout)
+	defer cancel()
+
+	counts, err := c.src.CountPendingAccrualJobs(ctx)
+	if err != nil {
+		c.logger.Error("Failed to count pending accrual jobs", slog.Any("error", err))
+		return
+	}
+	for _, status := range []string{constants.StatusNew, constants.StatusRegistered, constants.StatusProcessing} {
+		if _, ok := counts[status]; !ok {
+			counts[status] = 0
+		}
+	}
+	for status, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.depth, prometheus.GaugeValue, float64(n), status)
+	}
+}
+
+type poolCollector struct {
+	src PoolSource
+
+	acquired        *prometheus.Desc
+	idle            *prometheus.Desc
+	total           *prometheus.Desc
+	max             *prometheus.Desc
+	acquires        *prometheus.Desc
+	acquireDuration *prometheus.Desc
+	emptyAcquires   *prometheus.Desc
+	canceled        *prometheus.Desc
+}
+
+func newPoolCollector(src PoolSource) *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+	return &poolCollector{
+		src:             src,
+		acquired:        desc("acquired_conns", "Connections currently in use."),
+		idle:            desc("idle_conns", "Connections currently idle."),
+		total:           desc("total_conns", "Connections currently open."),
+		max:             desc("max_conns", "Maximum size of the pool."),
+		acquires:        desc("acquires_total", "Successful connection acquisitions."),
+		acquireDuration: desc("acquire_duration_seconds_total", "Time spent acquiring connections."),
+		emptyAcquires:   desc("empty_acquires_total", "Acquisitions that had to wait for a connection."),
+		canceled:        desc("canceled_acquires_total", "Acquisitions cancelled by their context."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.src.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceled, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
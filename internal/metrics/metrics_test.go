@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubQueue struct {
+	counts map[string]int64
+	err    error
+}
+
+func (s stubQueue) CountPendingAccrualJobs(context.Context) (map[string]int64, error) {
+	return s.counts, s.err
+}
+
+type stubBackoff struct {
+	pause, interval time.Duration
+}
+
+func (s stubBackoff) Backoff() (time.Duration, time.Duration) {
+	return s.pause, s.interval
+}
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/api/admin/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.Post("/api/user/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/admin/users/1", nil),
+		httptest.NewRequest(http.MethodGet, "/api/admin/users/2", nil),
+		httptest.NewRequest(http.MethodPost, "/api/user/orders", nil),
+		httptest.NewRequest(http.MethodGet, "/no/such/path", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("/api/admin/users/{id}", http.MethodGet, "404")),
+		"requests are labelled by route pattern, not by path")
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("/api/user/orders", http.MethodPost, "202")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues(unmatchedRoute, http.MethodGet, "404")))
+	assert.Equal(t, 3, testutil.CollectAndCount(m.httpDuration))
+}
+
+func TestInstrumentAccrual(t *testing.T) {
+	statuses := []int{http.StatusOK, http.StatusOK, http.StatusNoContent, http.StatusNotFound, http.StatusTooManyRequests, http.StatusInternalServerError}
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statuses[calls])
+		calls++
+	}))
+	defer server.Close()
+
+	m := New()
+	client := &http.Client{Transport: m.InstrumentAccrual(http.DefaultTransport)}
+	for range statuses {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	server.Close()
+	_, err := client.Get(server.URL)
+	require.Error(t, err)
+
+	tests := []struct {
+		outcome string
+		want    float64
+	}{
+		{OutcomeOK, 2},
+		{OutcomeNoContent, 1},
+		{OutcomeNotFound, 1},
+		{OutcomeTooManyRequests, 1},
+		{OutcomeError, 2},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, testutil.ToFloat64(m.accrualRequests.WithLabelValues(tt.outcome)), tt.outcome)
+	}
+}
+
+func TestObserver(t *testing.T) {
+	m := New()
+	m.OrderProcessed(time.Now().Add(-time.Minute))
+	m.PointsAccrued(money.MustParse("500.5"))
+	m.PointsAccrued(money.MustParse("20"))
+	m.PointsWithdrawn(money.MustParse("100.25"))
+
+	assert.Equal(t, 520.5, testutil.ToFloat64(m.pointsAccrued))
+	assert.Equal(t, 100.25, testutil.ToFloat64(m.pointsWithdrawn))
+	assert.Contains(t, scrape(t, m), "gophermart_order_processing_seconds_count 1")
+}
+
+func TestWatchAccrualBackoff(t *testing.T) {
+	m := New()
+	m.WatchAccrualBackoff(stubBackoff{pause: 30 * time.Second, interval: 100 * time.Millisecond})
+
+	body := scrape(t, m)
+	assert.Contains(t, body, "gophermart_accrual_backoff_seconds 30")
+	assert.Contains(t, body, "gophermart_accrual_request_interval_seconds 0.1")
+}
+
+func TestWatchAccrualQueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		queue   stubQueue
+		want    []string
+		notWant string
+	}{
+		{
+			name:  "статусы без заданий отдаются нулями",
+			queue: stubQueue{counts: map[string]int64{"REGISTERED": 3}},
+			want: []string{
+				`gophermart_accrual_queue_depth{status="NEW"} 0`,
+				`gophermart_accrual_queue_depth{status="PROCESSING"} 0`,
+				`gophermart_accrual_queue_depth{status="REGISTERED"} 3`,
+			},
+		},
+		{
+			name:    "ошибка запроса не ломает остальные метрики",
+			queue:   stubQueue{err: errors.New("db error")},
+			want:    []string{"go_goroutines"},
+			notWant: "gophermart_accrual_queue_depth",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New()
+			m.SetLogger(logging.Discard())
+			m.WatchAccrualQueue(tt.queue)
+
+			body := scrape(t, m)
+			for _, want := range tt.want {
+				assert.Contains(t, body, want)
+			}
+			if tt.notWant != "" {
+				assert.False(t, strings.Contains(body, tt.notWant+"{"))
+			}
+		})
+	}
+}
@@ -2,76 +2,206 @@ package middleware
 
 import (
 	"context"
-	"log"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/AlenaMolokova/diploma/internal/audit"
+	"github.com/AlenaMolokova/diploma/internal/auth"
+	"github.com/AlenaMolokova/diploma/internal/logging"
 	"github.com/AlenaMolokova/diploma/internal/utils"
-	"github.com/golang-jwt/jwt/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
 )
 
+// Cookie sessions carry the access token in SessionCookie and the refresh
+// token in RefreshCookie, both HttpOnly. CSRFCookie is readable by scripts and
+// its value has to be echoed in CSRFHeader on state-changing requests.
+const (
+	SessionCookie = "gophermart_session"
+	RefreshCookie = "gophermart_refresh"
+	CSRFCookie    = "gophermart_csrf"
+	CSRFHeader    = "X-CSRF-Token"
+)
+
+// RequestIDHeader carries the request ID. A usable one sent by the caller is
+// kept, so a request can be followed across services.
+const RequestIDHeader = "X-Request-ID"
+
 type UserID string
 
 type UserKey struct{}
 
-func AuthMiddleware(secret string) func(http.Handler) http.Handler {
+type ClaimsKey struct{}
+
+type TokenVerifier interface {
+	ParseAccessToken(ctx context.Context, token string) (auth.Claims, error)
+}
+
+// AuthMiddleware authenticates the request and adds the user ID to the
+// request's log fields. Credentials themselves are never logged.
+func AuthMiddleware(verifier TokenVerifier, logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			log.Printf("Middleware: received Authorization header: %s", authHeader)
-
-			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-				log.Printf("Middleware: missing or invalid Authorization header")
+			ctx := r.Context()
+			tokenString, fromCookie, ok := credentials(r)
+			if !ok {
+				logger.InfoContext(ctx, "Missing or invalid Authorization header")
 				utils.WriteJSONError(w, http.StatusUnauthorized, "Missing or invalid Authorization header")
 				return
 			}
 
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, jwt.ErrSignatureInvalid
+			claims, err := verifier.ParseAccessToken(ctx, tokenString)
+			if err != nil {
+				switch {
+				case errors.Is(err, auth.ErrTokenRevoked):
+					logger.InfoContext(ctx, "Token revoked")
+					utils.WriteJSONError(w, http.StatusUnauthorized, "Token revoked")
+				case errors.Is(err, auth.ErrInvalidToken):
+					logger.InfoContext(ctx, "Invalid token", slog.Any("error", err))
+					utils.WriteJSONError(w, http.StatusUnauthorized, "Invalid token")
+				default:
+					logger.ErrorContext(ctx, "Failed to verify token", slog.Any("error", err))
+					utils.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
 				}
-				return []byte(secret), nil
-			})
-
-			if err != nil || !token.Valid {
-				log.Printf("Middleware: invalid token: %v", err)
-				utils.WriteJSONError(w, http.StatusUnauthorized, "Invalid token")
 				return
 			}
 
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok {
-				log.Printf("Middleware: invalid claims")
-				utils.WriteJSONError(w, http.StatusUnauthorized, "Invalid token claims")
+			ctx = logging.With(ctx, logging.UserIDKey, claims.UserID)
+			if fromCookie && !isSafeMethod(r.Method) && !validCSRF(r, claims) {
+				logger.WarnContext(ctx, "Missing or invalid CSRF token")
+				utils.WriteJSONError(w, http.StatusForbidden, "Invalid CSRF token")
 				return
 			}
 
-			exp, ok := claims["exp"].(float64)
-			if !ok || time.Unix(int64(exp), 0).Before(time.Now()) {
-				log.Printf("Middleware: token expired or invalid exp claim")
-				utils.WriteJSONError(w, http.StatusUnauthorized, "Token expired or invalid")
-				return
+			userData := map[UserID]interface{}{
+				UserID("id"): claims.UserID,
+			}
+			ctx = context.WithValue(ctx, UserKey{}, userData)
+			ctx = context.WithValue(ctx, ClaimsKey{}, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestLogger tags the request with an ID, echoed in RequestIDHeader and
+// added to the request's log fields, and logs the request once it is served.
+func RequestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
 			}
+			w.Header().Set(RequestIDHeader, id)
+			ctx := logging.With(r.Context(), logging.RequestIDKey, id)
+
+			ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			logger.InfoContext(ctx, "Request served",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Duration("duration", time.Since(start)))
+		})
+	}
+}
 
-			userIDFloat, ok := claims["user_id"].(float64)
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts short IDs made of characters that are safe to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// SourceIP stamps the request context with the client address, so audit
+// entries written while serving the request record where it came from. Behind
+// a proxy it has to run after chi's RealIP.
+func SourceIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			ip = host
+		}
+		next.ServeHTTP(w, r.WithContext(audit.WithSourceIP(r.Context(), ip)))
+	})
+}
+
+// RequireRole only lets through requests whose access token carries role. It
+// has to run after AuthMiddleware.
+func RequireRole(role string, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := GetClaims(r)
 			if !ok {
-				log.Printf("Middleware: user_id not found in claims")
-				utils.WriteJSONError(w, http.StatusUnauthorized, "Invalid token claims")
+				logger.WarnContext(r.Context(), "Missing claims for role check")
+				utils.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
 				return
 			}
-			userID := int64(userIDFloat)
-
-			userData := map[UserID]interface{}{
-				UserID("id"): userID,
+			if claims.Role != role {
+				logger.WarnContext(r.Context(), "User lacks role", slog.String("role", role))
+				utils.WriteJSONError(w, http.StatusForbidden, "Forbidden")
+				return
 			}
-			ctx := context.WithValue(r.Context(), UserKey{}, userData)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// credentials returns the access token of the request. A bearer token takes
+// precedence over the session cookie; a malformed Authorization header is
+// rejected rather than falling back to the cookie.
+func credentials(r *http.Request) (token string, fromCookie, ok bool) {
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			return "", false, false
+		}
+		return strings.TrimPrefix(authHeader, "Bearer "), false, true
+	}
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil || cookie.Value == "" {
+		return "", false, false
+	}
+	return cookie.Value, true, true
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// validCSRF checks the header against the token signed into the session, so
+// a value planted in the CSRF cookie by another site is of no use.
+func validCSRF(r *http.Request, claims auth.Claims) bool {
+	header := r.Header.Get(CSRFHeader)
+	return claims.CSRF != "" && subtle.ConstantTimeCompare([]byte(header), []byte(claims.CSRF)) == 1
+}
+
 func GetUserID(r *http.Request) (int64, bool) {
 	userData, ok := r.Context().Value(UserKey{}).(map[UserID]interface{})
 	if !ok {
@@ -80,3 +210,9 @@ func GetUserID(r *http.Request) (int64, bool) {
 	userID, ok := userData[UserID("id")].(int64)
 	return userID, ok
 }
+
+// GetClaims returns the access token claims of an authenticated request.
+func GetClaims(r *http.Request) (auth.Claims, bool) {
+	claims, ok := r.Context().Value(ClaimsKey{}).(auth.Claims)
+	return claims, ok
+}
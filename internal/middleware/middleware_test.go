@@ -1,21 +1,29 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/AlenaMolokova/diploma/internal/audit"
+	"github.com/AlenaMolokova/diploma/internal/auth"
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/testutils"
 	"github.com/AlenaMolokova/diploma/internal/utils"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestAuthMiddleware(t *testing.T) {
 	secret := "test-secret"
 	userID := int64(1)
+	ctx := context.Background()
 
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID, ok := GetUserID(r)
@@ -27,8 +35,24 @@ func TestAuthMiddleware(t *testing.T) {
 		w.Write([]byte(fmt.Sprintf(`{"user_id":%d}`, userID)))
 	})
 
-	validToken := generateTestToken(t, userID, secret, time.Now().Add(time.Hour))
+	store := &testutils.MockTokenStore{}
+	store.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+	store.On("GetUserRole", mock.Anything, mock.Anything).Return("user", nil)
+	service := auth.NewService(store, testutils.HMACKeyring(secret), time.Hour, 24*time.Hour)
+
+	validTokens, err := service.IssueTokens(ctx, userID)
+	assert.NoError(t, err)
+	revokedTokens, err := service.IssueTokens(ctx, userID)
+	assert.NoError(t, err)
+	validClaims, err := parseUnverified(validTokens.AccessToken)
+	assert.NoError(t, err)
+	revokedClaims, err := parseUnverified(revokedTokens.AccessToken)
+	assert.NoError(t, err)
+	store.On("IsTokenRevoked", mock.Anything, validClaims.ID, validClaims.SessionID).Return(false, nil)
+	store.On("IsTokenRevoked", mock.Anything, revokedClaims.ID, revokedClaims.SessionID).Return(true, nil)
+
 	expiredToken := generateTestToken(t, userID, secret, time.Now().Add(-time.Hour))
+	legacyToken := generateLegacyToken(t, userID, secret, time.Now().Add(time.Hour))
 
 	tests := []struct {
 		name           string
@@ -38,7 +62,7 @@ func TestAuthMiddleware(t *testing.T) {
 	}{
 		{
 			name:           "валидный токен",
-			authHeader:     "Bearer " + validToken,
+			authHeader:     "Bearer " + validTokens.AccessToken,
 			expectedStatus: http.StatusOK,
 			expectedBody:   `{"user_id":1}`,
 		},
@@ -66,6 +90,18 @@ func TestAuthMiddleware(t *testing.T) {
 			expectedStatus: http.StatusUnauthorized,
 			expectedBody:   `{"error":"Invalid token"}`,
 		},
+		{
+			name:           "токен без jti и sid",
+			authHeader:     "Bearer " + legacyToken,
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"error":"Invalid token"}`,
+		},
+		{
+			name:           "отозванный токен",
+			authHeader:     "Bearer " + revokedTokens.AccessToken,
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"error":"Token revoked"}`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -76,7 +112,7 @@ func TestAuthMiddleware(t *testing.T) {
 			}
 			w := httptest.NewRecorder()
 
-			middleware := AuthMiddleware(secret)(nextHandler)
+			middleware := AuthMiddleware(service, logging.Discard())(nextHandler)
 			middleware.ServeHTTP(w, req)
 
 			assert.Equal(t, tt.expectedStatus, w.Code)
@@ -130,7 +166,30 @@ func TestGetUserID(t *testing.T) {
 	}
 }
 
+func parseUnverified(token string) (auth.Claims, error) {
+	var claims auth.Claims
+	_, _, err := jwt.NewParser().ParseUnverified(token, &claims)
+	return claims, err
+}
+
 func generateTestToken(t *testing.T, userID int64, secret string, exp time.Time) string {
+	claims := auth.Claims{
+		UserID:    userID,
+		SessionID: "session",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti",
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	return tokenString
+}
+
+func generateLegacyToken(t *testing.T, userID int64, secret string, exp time.Time) string {
 	claims := jwt.MapClaims{
 		"user_id": float64(userID),
 		"exp":     float64(exp.Unix()),
@@ -142,3 +201,208 @@ func generateTestToken(t *testing.T, userID int64, secret string, exp time.Time)
 	}
 	return tokenString
 }
+
+func TestAuthMiddlewareCookieSession(t *testing.T) {
+	ctx := context.Background()
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	store := &testutils.MockTokenStore{}
+	store.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+	store.On("GetUserRole", mock.Anything, mock.Anything).Return("user", nil)
+	store.On("IsTokenRevoked", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	service := auth.NewService(store, testutils.HMACKeyring("test-secret"), time.Hour, 24*time.Hour)
+
+	tokens, err := service.IssueTokens(ctx, 1)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		method         string
+		cookie         bool
+		authHeader     string
+		csrfHeader     string
+		expectedStatus int
+	}{
+		{
+			name:           "GET по cookie без CSRF",
+			method:         http.MethodGet,
+			cookie:         true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "POST по cookie без CSRF",
+			method:         http.MethodPost,
+			cookie:         true,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "POST по cookie с неверным CSRF",
+			method:         http.MethodPost,
+			cookie:         true,
+			csrfHeader:     "forged",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "POST по cookie с верным CSRF",
+			method:         http.MethodPost,
+			cookie:         true,
+			csrfHeader:     tokens.CSRFToken,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "POST с Bearer без CSRF",
+			method:         http.MethodPost,
+			authHeader:     "Bearer " + tokens.AccessToken,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "неверный заголовок при валидной cookie",
+			method:         http.MethodGet,
+			cookie:         true,
+			authHeader:     "Basic token",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/test", nil)
+			if tt.cookie {
+				req.AddCookie(&http.Cookie{Name: SessionCookie, Value: tokens.AccessToken})
+			}
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			if tt.csrfHeader != "" {
+				req.Header.Set(CSRFHeader, tt.csrfHeader)
+			}
+			w := httptest.NewRecorder()
+
+			AuthMiddleware(service, logging.Discard())(nextHandler).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "info", "json")
+	assert.NoError(t, err)
+
+	handler := RequestLogger(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.InfoContext(r.Context(), "inner")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	tests := []struct {
+		name       string
+		requestID  string
+		expectedID func(t *testing.T, id string)
+	}{
+		{
+			name:      "ID запроса от клиента",
+			requestID: "client-req-1",
+			expectedID: func(t *testing.T, id string) {
+				assert.Equal(t, "client-req-1", id)
+			},
+		},
+		{
+			name:      "непригодный ID заменяется",
+			requestID: "bad id\n",
+			expectedID: func(t *testing.T, id string) {
+				assert.Len(t, id, 16)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest(http.MethodPost, "/api/user/orders", nil)
+			req.Header.Set(RequestIDHeader, tt.requestID)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusAccepted, w.Code)
+			id := w.Header().Get(RequestIDHeader)
+			tt.expectedID(t, id)
+
+			decoder := json.NewDecoder(&buf)
+			var inner, served map[string]any
+			assert.NoError(t, decoder.Decode(&inner))
+			assert.NoError(t, decoder.Decode(&served))
+			assert.Equal(t, id, inner[logging.RequestIDKey], "lines logged by the handler carry the ID")
+			assert.Equal(t, "Request served", served["msg"])
+			assert.Equal(t, id, served[logging.RequestIDKey])
+			assert.Equal(t, float64(http.StatusAccepted), served["status"])
+		})
+	}
+}
+
+func TestAuthMiddlewareDoesNotLogTokens(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "debug", "text")
+	assert.NoError(t, err)
+	service := auth.NewService(&testutils.MockTokenStore{}, testutils.HMACKeyring("secret"), time.Minute, time.Hour)
+	handler := AuthMiddleware(service, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/balance", nil)
+	req.Header.Set("Authorization", "Bearer not.a.valid-token")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotEmpty(t, buf.String())
+	assert.NotContains(t, buf.String(), "not.a.valid-token")
+}
+
+func TestSourceIP(t *testing.T) {
+	var got string
+	handler := SourceIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = audit.SourceIP(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/balance", nil)
+	req.RemoteAddr = "203.0.113.5:40000"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "203.0.113.5", got)
+}
+
+func TestRequireRole(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := RequireRole("admin", logging.Discard())(nextHandler)
+
+	tests := []struct {
+		name           string
+		claims         *auth.Claims
+		expectedStatus int
+	}{
+		{name: "администратор", claims: &auth.Claims{UserID: 1, Role: "admin"}, expectedStatus: http.StatusOK},
+		{name: "обычный пользователь", claims: &auth.Claims{UserID: 1, Role: "user"}, expectedStatus: http.StatusForbidden},
+		{name: "токен без роли", claims: &auth.Claims{UserID: 1}, expectedStatus: http.StatusForbidden},
+		{name: "без авторизации", claims: nil, expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/users/1", nil)
+			if tt.claims != nil {
+				req = req.WithContext(context.WithValue(req.Context(), ClaimsKey{}, *tt.claims))
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
@@ -2,15 +2,23 @@ package migrations
 
 import (
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
 func Apply(databaseURI string) error {
+	return ApplyDir(databaseURI, "migrations")
+}
+
+func ApplyDir(databaseURI, dir string) error {
 	db, err := sql.Open("pgx", databaseURI)
 	if err != nil {
 		return err
@@ -23,7 +31,7 @@ func Apply(databaseURI string) error {
 	}
 
 	m, err := migrate.NewWithDatabaseInstance(
-		"file://migrations",
+		"file://"+dir,
 		"postgres",
 		driver,
 	)
@@ -36,6 +44,35 @@ func Apply(databaseURI string) error {
 		return err
 	}
 
-	log.Println("Database migrations applied successfully")
+	slog.Info("Database migrations applied successfully")
 	return nil
-}
\ No newline at end of file
+}
+
+// Latest returns the version of the newest migration in "migrations", the
+// version the schema is at once Apply succeeds.
+func Latest() (uint, error) {
+	return LatestDir("migrations")
+}
+
+func LatestDir(dir string) (uint, error) {
+	src, err := source.Open("file://" + dir)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if err != nil {
+		return 0, fmt.Errorf("no migrations in %s: %w", dir, err)
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
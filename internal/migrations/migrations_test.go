@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"000001_init.up.sql",
+		"000001_init.down.sql",
+		"000003_orders_index.up.sql",
+		"000003_orders_index.down.sql",
+		"README.md",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o600))
+	}
+
+	version, err := LatestDir(dir)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, version)
+
+	_, err = LatestDir(t.TempDir())
+	assert.Error(t, err, "an empty directory has no version to expect")
+}
@@ -0,0 +1,23 @@
+package models
+
+import "errors"
+
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+var ErrOrderNotFound = errors.New("order not found")
+
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+	ErrWebhookLimit    = errors.New("webhook limit reached")
+)
+
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrWrongPassword     = errors.New("password is incorrect")
+	ErrResetTokenInvalid = errors.New("password reset token is invalid or expired")
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
@@ -1,7 +1,9 @@
 package models
 
+import "github.com/AlenaMolokova/diploma/internal/money"
+
 type LoyaltyResponse struct {
-	Order   string  `json:"order"`
-	Status  string  `json:"status"`
-	Accrual float64 `json:"accrual,omitempty"`
+	Order   string       `json:"order"`
+	Status  string       `json:"status"`
+	Accrual money.Amount `json:"accrual,omitempty"`
 }
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/money"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
@@ -9,21 +12,263 @@ type Order struct {
 	UserID     int64
 	Number     string
 	Status     string
-	Accrual    pgtype.Float8
+	Accrual    money.Amount
 	UploadedAt pgtype.Timestamptz
 }
 
 type User struct {
+	ID       int64
+	Login    string
+	Password string
+	Role     string
+}
+
+// UserAccount is a user as support sees it: no password, with the balance.
+type UserAccount struct {
 	ID        int64
 	Login     string
-	Password  string
-	Balance   pgtype.Float8
-	Withdrawn pgtype.Float8
+	Role      string
+	Current   money.Amount
+	Withdrawn money.Amount
 }
 
 type Withdrawal struct {
+	ID          int64
 	UserID      int64
 	OrderNumber string
-	Sum         pgtype.Float8
+	Sum         money.Amount
 	ProcessedAt pgtype.Timestamptz
 }
+
+type LedgerEntry struct {
+	ID          int64
+	UserID      int64
+	Kind        string
+	Amount      money.Amount
+	OrderNumber string
+	CreatedAt   pgtype.Timestamptz
+}
+
+type RefreshToken struct {
+	UserID    int64
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+type PasswordReset struct {
+	UserID    int64
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+// AccrualJobState is what the poller knows about an order: Job is nil for
+// orders that never needed polling.
+type AccrualJobState struct {
+	Order Order
+	Job   *AccrualJobStatus
+}
+
+type AccrualJobStatus struct {
+	State         string
+	Attempts      int
+	NotFound      int
+	NextAttemptAt time.Time
+	LockedBy      string
+	LockedUntil   time.Time
+	LastError     string
+	UpdatedAt     time.Time
+	TraceParent   string
+}
+
+// OrderDetails is an order together with its status history, oldest first.
+type OrderDetails struct {
+	Order   Order
+	History []OrderHistoryEntry
+}
+
+// OrderHistoryEntry is one event in the life of an order. A status change
+// has the status the order moved to and, unless it is the upload, the one it
+// left. An accrual check has the Outcome of the request to the accrual
+// service, and the Status and Accrual the service reported when it answered
+// with the order.
+type OrderHistoryEntry struct {
+	Kind       string
+	FromStatus string
+	Status     string
+	Outcome    string
+	Accrual    *money.Amount
+	Error      string
+	CreatedAt  time.Time
+}
+
+// AccrualCheck is the result of one check of an order by the accrual poller.
+type AccrualCheck struct {
+	OrderNumber string
+	Outcome     string
+	Status      string
+	Accrual     *money.Amount
+	Error       string
+}
+
+// UserEvent is a change pushed to the user's event stream as it happens. An
+// order event carries the order as it now is; a balance event carries the new
+// balance.
+type UserEvent struct {
+	UserID    int64
+	Kind      string
+	Order     Order
+	Current   money.Amount
+	Withdrawn money.Amount
+}
+
+// Webhook is an endpoint that is sent the Events of UserID, or of every user
+// when UserID is zero. Secret signs the deliveries; it is only shown to the
+// caller that creates the webhook.
+type Webhook struct {
+	ID        int64
+	UserID    int64
+	URL       string
+	Secret    string
+	Events    []string
+	CreatedBy int64
+	CreatedAt time.Time
+}
+
+// WebhookDelivery is one event on its way to one webhook, as the dispatcher
+// claims it. Payload is the JSON the event carries.
+type WebhookDelivery struct {
+	ID         int64
+	EventID    int64
+	Event      string
+	UserID     int64
+	Payload    []byte
+	OccurredAt time.Time
+	URL        string
+	Secret     string
+	Attempts   int
+}
+
+// WebhookAttempt is the outcome of one attempt to deliver, made by Owner.
+// A failed delivery is retried at RetryAt until it has failed MaxAttempts
+// times.
+type WebhookAttempt struct {
+	DeliveryID  int64
+	Owner       string
+	StatusCode  int
+	Error       string
+	Duration    time.Duration
+	Delivered   bool
+	RetryAt     time.Time
+	MaxAttempts int
+}
+
+// WebhookLogEntry is an attempt as the delivery log of a webhook shows it.
+// StatusCode is zero when no response came back.
+type WebhookLogEntry struct {
+	ID         int64
+	DeliveryID int64
+	EventID    int64
+	Event      string
+	State      string
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+	CreatedAt  time.Time
+}
+
+// BalanceAdjustment is a manual ledger correction made by ActorID.
+type BalanceAdjustment struct {
+	UserID  int64
+	ActorID int64
+	Amount  money.Amount
+	Reason  string
+}
+
+// AuditEntry records an action of ActorID, optionally about another user or
+// an order. ActorID is zero for actions of the system itself, such as the
+// accrual poller. BalanceBefore and BalanceAfter are set for entries that
+// move the balance. Details are stored as JSON.
+type AuditEntry struct {
+	ID            int64
+	ActorID       int64
+	Action        string
+	TargetUserID  int64
+	OrderNumber   string
+	SourceIP      string
+	BalanceBefore *money.Amount
+	BalanceAfter  *money.Amount
+	Details       map[string]any
+	CreatedAt     time.Time
+}
+
+// AuditFilter selects audit entries. Zero fields do not filter; UserID
+// matches both the actor and the target. Entries come newest first, and
+// BeforeID continues a listing after the last entry of the previous page.
+type AuditFilter struct {
+	UserID      int64
+	Action      string
+	OrderNumber string
+	Since       time.Time
+	Until       time.Time
+	BeforeID    int64
+	Limit       int
+}
+
+// ListCursor marks where a listing of orders or withdrawals stopped: the
+// time and ID of the last row returned. The zero cursor starts at the newest
+// row.
+type ListCursor struct {
+	At time.Time
+	ID int64
+}
+
+func (c ListCursor) IsZero() bool {
+	return c.ID == 0
+}
+
+// OrderFilter selects a user's orders, newest upload first. Zero fields do
+// not filter: Since and Until bound the upload time, MinAccrual and
+// MaxAccrual the accrual, both inclusive except Until. A zero Limit returns
+// every matching order.
+type OrderFilter struct {
+	UserID     int64
+	Statuses   []string
+	Since      time.Time
+	Until      time.Time
+	MinAccrual *money.Amount
+	MaxAccrual *money.Amount
+	After      ListCursor
+	Limit      int
+}
+
+// WithdrawalFilter selects a user's withdrawals, newest first, the same way
+// OrderFilter selects orders.
+type WithdrawalFilter struct {
+	UserID int64
+	Since  time.Time
+	Until  time.Time
+	MinSum *money.Amount
+	MaxSum *money.Amount
+	After  ListCursor
+	Limit  int
+}
+
+type AccrualJob struct {
+	OrderNumber string
+	UserID      int64
+	Attempts    int
+	NotFound    int
+	// TraceParent links the checks of the order to the trace of its upload.
+	TraceParent string
+}
+
+type AccrualJobFailure struct {
+	OrderNumber string
+	Owner       string
+	NotFound    bool
+	Error       string
+	RetryAt     time.Time
+	MaxAttempts int
+	MaxNotFound int
+}
@@ -0,0 +1,179 @@
+// Package money provides an exact representation of loyalty point amounts.
+//
+// Amounts are stored as an integer number of hundredths, so sums of many
+// accruals never drift the way float64 does. On the wire they are encoded as
+// plain JSON numbers ("729.98", "500.5", "42"), and in Postgres they map to
+// NUMERIC columns.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Amount is a number of points in hundredths.
+type Amount int64
+
+const (
+	scale = 2
+	unit  = 100
+)
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// decimal is the only notation Parse accepts: no exponents, fractions or
+// digits beyond the hundredths, which could only be taken by rounding.
+var decimal = regexp.MustCompile(`^-?[0-9]+(\.[0-9]{1,2})?$`)
+
+// number is the JSON number notation ParseLenient accepts. The exponent is
+// bounded so a hostile value cannot make the conversion allocate without limit.
+var number = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][+-]?[0-9]{1,3})?$`)
+
+// Parse converts a plain decimal string with at most two decimal places, such
+// as "729.98", "500.5" or "42", into an Amount.
+func Parse(s string) (Amount, error) {
+	if !decimal.MatchString(s) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	a, err := fromRat(r)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is out of range", ErrInvalidAmount, s)
+	}
+	return a, nil
+}
+
+// ParseLenient converts any JSON number, such as "86.4192" or "1e-7", into an
+// Amount, rounding digits beyond the hundredths. It is meant for amounts
+// reported by other services; user input goes through Parse.
+func ParseLenient(s string) (Amount, error) {
+	if !number.MatchString(s) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	a, err := fromRat(r)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is out of range", ErrInvalidAmount, s)
+	}
+	return a, nil
+}
+
+// fromRat converts r into an Amount. Digits beyond the second decimal place
+// are rounded half away from zero.
+func fromRat(r *big.Rat) (Amount, error) {
+	r = new(big.Rat).Mul(r, big.NewRat(unit, 1))
+
+	num, den := r.Num(), r.Denom()
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Abs(rem).Lsh(rem, 1).Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	if !q.IsInt64() {
+		return 0, ErrInvalidAmount
+	}
+	return Amount(q.Int64()), nil
+}
+
+// MustParse is like Parse but panics on error. It is meant for constants and tests.
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Float64 converts the amount for reporting, such as metrics. It must not be
+// used for arithmetic.
+func (a Amount) Float64() float64 {
+	return float64(a) / unit
+}
+
+// String formats the amount with the shortest exact decimal representation.
+func (a Amount) String() string {
+	sign := ""
+	v := int64(a)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+
+	units, frac := v/unit, v%unit
+	switch {
+	case frac == 0:
+		return sign + strconv.FormatInt(units, 10)
+	case frac%10 == 0:
+		return fmt.Sprintf("%s%d.%d", sign, units, frac/10)
+	default:
+		return fmt.Sprintf("%s%d.%02d", sign, units, frac)
+	}
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	v, err := Parse(string(data))
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// ScanNumeric implements pgtype.NumericScanner. NULL scans as zero.
+func (a *Amount) ScanNumeric(n pgtype.Numeric) error {
+	if !n.Valid {
+		*a = 0
+		return nil
+	}
+	if n.NaN || n.InfinityModifier != pgtype.Finite {
+		return fmt.Errorf("%w: cannot scan non-finite numeric", ErrInvalidAmount)
+	}
+
+	r := new(big.Rat).SetInt(n.Int)
+	exp := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(n.Exp))), nil)
+	if n.Exp >= 0 {
+		r.Mul(r, new(big.Rat).SetInt(exp))
+	} else {
+		r.Quo(r, new(big.Rat).SetInt(exp))
+	}
+
+	v, err := fromRat(r)
+	if err != nil {
+		return fmt.Errorf("%w: numeric is out of range", ErrInvalidAmount)
+	}
+	*a = v
+	return nil
+}
+
+// NumericValue implements pgtype.NumericValuer.
+func (a Amount) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(int64(a)), Exp: -scale, Valid: true}, nil
+}
+
+func abs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,130 @@
+package money
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Amount
+		wantErr  bool
+	}{
+		{name: "целое число", input: "42", expected: 4200},
+		{name: "два знака после запятой", input: "729.98", expected: 72998},
+		{name: "один знак после запятой", input: "500.5", expected: 50050},
+		{name: "отрицательное число", input: "-0.01", expected: -1},
+		{name: "незначащий ноль", input: "0.10", expected: 10},
+		{name: "экспоненциальная запись", input: "1e2", wantErr: true},
+		{name: "дробь", input: "1/3", wantErr: true},
+		{name: "третий знак после запятой", input: "0.005", wantErr: true},
+		{name: "без целой части", input: ".5", wantErr: true},
+		{name: "точка без дробной части", input: "1.", wantErr: true},
+		{name: "знак плюс", input: "+1", wantErr: true},
+		{name: "пробелы", input: " 1", wantErr: true},
+		{name: "вне диапазона", input: "99999999999999999999", wantErr: true},
+		{name: "не число", input: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestParseLenient(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Amount
+		wantErr  bool
+	}{
+		{name: "два знака после запятой", input: "729.98", expected: 72998},
+		{name: "округление вверх", input: "86.4192", expected: 8642},
+		{name: "округление половины от нуля", input: "-0.005", expected: -1},
+		{name: "экспоненциальная запись", input: "1e2", expected: 10000},
+		{name: "малая экспонента", input: "1e-7", expected: 0},
+		{name: "дробь", input: "1/3", wantErr: true},
+		{name: "слишком длинная экспонента", input: "1e1000000", wantErr: true},
+		{name: "вне диапазона", input: "1e300", wantErr: true},
+		{name: "не число", input: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLenient(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	assert.Equal(t, "42", Amount(4200).String())
+	assert.Equal(t, "729.98", Amount(72998).String())
+	assert.Equal(t, "500.5", Amount(50050).String())
+	assert.Equal(t, "0.05", Amount(5).String())
+	assert.Equal(t, "-1.5", Amount(-150).String())
+}
+
+func TestSumDoesNotDrift(t *testing.T) {
+	var total Amount
+	for i := 0; i < 1000; i++ {
+		total += MustParse("729.98")
+	}
+	assert.Equal(t, "729980", total.String())
+}
+
+func TestJSON(t *testing.T) {
+	var resp struct {
+		Current   Amount `json:"current"`
+		Withdrawn Amount `json:"withdrawn"`
+		Accrual   Amount `json:"accrual,omitempty"`
+	}
+	err := json.Unmarshal([]byte(`{"current":500.5,"withdrawn":42}`), &resp)
+	assert.NoError(t, err)
+	assert.Equal(t, Amount(50050), resp.Current)
+	assert.Equal(t, Amount(4200), resp.Withdrawn)
+
+	data, err := json.Marshal(resp)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"current":500.5,"withdrawn":42}`, string(data))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"current":"x"}`), &resp))
+	assert.Error(t, json.Unmarshal([]byte(`{"current":1e2}`), &resp))
+	assert.Error(t, json.Unmarshal([]byte(`{"current":0.001}`), &resp))
+}
+
+func TestNumeric(t *testing.T) {
+	var a Amount
+	assert.NoError(t, a.ScanNumeric(pgtype.Numeric{Int: big.NewInt(72998), Exp: -2, Valid: true}))
+	assert.Equal(t, Amount(72998), a)
+
+	assert.NoError(t, a.ScanNumeric(pgtype.Numeric{Int: big.NewInt(5), Exp: 1, Valid: true}))
+	assert.Equal(t, Amount(5000), a)
+
+	assert.NoError(t, a.ScanNumeric(pgtype.Numeric{}))
+	assert.Equal(t, Amount(0), a)
+
+	n, err := Amount(72998).NumericValue()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(72998), n.Int.Int64())
+	assert.Equal(t, int32(-2), n.Exp)
+}
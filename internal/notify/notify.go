@@ -0,0 +1,33 @@
+// Package notify delivers messages to users outside of the API.
+package notify
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+)
+
+type Notifier interface {
+	SendPasswordReset(ctx context.Context, login, token string, expiresAt time.Time) error
+}
+
+// LogNotifier writes notifications to w instead of delivering them. It is
+// meant for local development only, and is the fallback in dev mode when no
+// other notifier is configured. It does not go through the application's
+// logger, which redacts reset tokens, so the token can be read from w.
+type LogNotifier struct {
+	logger *slog.Logger
+}
+
+func NewLogNotifier(w io.Writer) *LogNotifier {
+	return &LogNotifier{logger: slog.New(slog.NewTextHandler(w, nil))}
+}
+
+func (n *LogNotifier) SendPasswordReset(ctx context.Context, login, token string, expiresAt time.Time) error {
+	n.logger.InfoContext(ctx, "Password reset",
+		slog.String("login", login),
+		slog.String("reset_token", token),
+		slog.Time("expires_at", expiresAt))
+	return nil
+}
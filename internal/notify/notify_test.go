@@ -0,0 +1,20 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogNotifierWritesToken(t *testing.T) {
+	var out bytes.Buffer
+	notifier := NewLogNotifier(&out)
+
+	err := notifier.SendPasswordReset(context.Background(), "alice", "reset-token-value", time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "login=alice")
+	assert.Contains(t, out.String(), "reset_token=reset-token-value")
+}
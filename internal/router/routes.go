@@ -1,43 +1,290 @@
 package router
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/auth"
+	"github.com/AlenaMolokova/diploma/internal/config"
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/events"
 	"github.com/AlenaMolokova/diploma/internal/handlers"
 	"github.com/AlenaMolokova/diploma/internal/loyalty"
+	"github.com/AlenaMolokova/diploma/internal/metrics"
 	"github.com/AlenaMolokova/diploma/internal/middleware"
+	"github.com/AlenaMolokova/diploma/internal/notify"
 	"github.com/AlenaMolokova/diploma/internal/storage"
+	"github.com/AlenaMolokova/diploma/internal/tracing"
 	"github.com/AlenaMolokova/diploma/internal/usecase"
+	"github.com/AlenaMolokova/diploma/internal/validation"
+	"github.com/AlenaMolokova/diploma/internal/webhook"
 	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
 )
 
 const (
 	UserPrefix      = "/api/user"
 	OrdersPath      = "/orders"
+	OrdersBatchPath = "/orders/batch"
+	OrderPath       = "/orders/{" + handlers.OrderNumberParam + "}"
+	OrderEventsPath = "/orders/events"
 	RegisterPath    = "/register"
 	LoginPath       = "/login"
 	BalancePath     = "/balance"
 	WithdrawPath    = "/balance/withdraw"
 	WithdrawalsPath = "/withdrawals"
+	RefreshPath     = "/token/refresh"
+	LogoutPath      = "/logout"
+	AuditPath       = "/audit"
+	WebhooksPath    = "/webhooks"
+	WebhookPath     = "/webhooks/{" + handlers.WebhookIDParam + "}"
+	WebhookLogPath  = WebhookPath + "/deliveries"
+	JWKSPath        = "/.well-known/jwks.json"
+	MetricsPath     = "/metrics"
+	HealthPath      = "/healthz"
+	ReadyPath       = "/readyz"
+
+	PasswordPath             = "/password"
+	PasswordResetPath        = "/password/reset"
+	PasswordResetRequestPath = "/password/reset/request"
 )
 
-func SetupRoutes(store *storage.Storage, jwtSecret, loyaltyURL string) *chi.Mux {
-	r := chi.NewRouter()
-	loyaltyClient := loyalty.NewClient(loyaltyURL)
+const (
+	AdminPrefix              = "/api/admin"
+	AdminUsersPath           = "/users"
+	AdminUserPath            = "/users/{" + handlers.UserIDParam + "}"
+	AdminUserOrdersPath      = AdminUserPath + "/orders"
+	AdminUserWithdrawalsPath = AdminUserPath + "/withdrawals"
+	AdminUserBalancePath     = AdminUserPath + "/balance/adjustments"
+	AdminOrderAccrualPath    = "/orders/{" + handlers.OrderNumberParam + "}/accrual"
+	AdminAuditPath           = "/audit"
+	AdminWebhooksPath        = "/webhooks"
+	AdminWebhookPath         = "/webhooks/{" + handlers.WebhookIDParam + "}"
+	AdminWebhookLogPath      = AdminWebhookPath + "/deliveries"
+)
+
+// Deps are the external collaborators of the application. Accrual, Clock and
+// Logger are optional: a client for cfg.AccrualAddr, time.Now and slog's
+// default logger are used when unset. Without a Notifier the password reset
+// routes are not served, except in dev mode, where reset requests are logged.
+// SchemaVersion is the migration version readiness expects the database at;
+// the check is skipped when it is zero.
+type Deps struct {
+	Store         *storage.Storage
+	Accrual       *loyalty.Client
+	Clock         func() time.Time
+	Notifier      notify.Notifier
+	Logger        *slog.Logger
+	SchemaVersion uint
+}
+
+// App is the wired application: the HTTP handler to serve, the background
+// workers to run next to it until shutdown, Drain, which fails the readiness
+// check once shutdown begins, and Stop, which ends the event streams once the
+// server stops accepting connections.
+type App struct {
+	Handler http.Handler
+	Workers []func(ctx context.Context)
+	Drain   func()
+	Stop    func()
+}
+
+// SetupRoutes is the single composition root shared by main and the
+// end-to-end tests.
+func SetupRoutes(cfg *config.Config, deps Deps) (*App, error) {
+	store := deps.Store
+	clock := deps.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+	logger := deps.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	loyaltyClient := deps.Accrual
+	if loyaltyClient == nil {
+		loyaltyClient = loyalty.NewClient(cfg.AccrualAddr)
+	}
+	loyaltyClient.SetLogger(logger)
+	loyaltyClient.SetPollInterval(cfg.PollIntervalSec)
+	loyaltyClient.SetWorkers(cfg.AccrualWorkers)
+	loyaltyClient.SetBatchSize(cfg.AccrualBatch)
+	loyaltyClient.SetRetryLimits(cfg.AccrualAttempts, cfg.AccrualNotFound)
+
+	appMetrics := metrics.New()
+	appMetrics.SetLogger(logger)
+	loyaltyClient.WrapTransport(appMetrics.InstrumentAccrual)
+	loyaltyClient.WrapTransport(tracing.Transport)
+	appMetrics.WatchAccrualBackoff(loyaltyClient)
+	appMetrics.WatchAccrualQueue(store)
+	appMetrics.WatchPool(store)
+	store.SetObserver(appMetrics)
+
+	keySource := auth.KeySource{
+		Secret:       cfg.JWTSecret,
+		PrivateKey:   cfg.JWTPrivateKey,
+		PrivateKeyID: cfg.JWTPrivateKeyID,
+		Dir:          cfg.JWTKeysDir,
+		SigningKeyID: cfg.JWTSigningKeyID,
+	}
+	keys, err := auth.LoadKeyring(keySource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	tokens := auth.NewService(store, keys, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
+	tokens.SetClock(clock)
 
 	balanceUC := usecase.NewBalanceUseCase(store)
-	withdrawalUC := usecase.NewWithdrawalUseCase(store, balanceUC)
-	orderUC := usecase.NewOrderUseCase(store, loyaltyClient, balanceUC)
+	withdrawalUC := usecase.NewWithdrawalUseCase(store)
+	withdrawalUC.SetClock(clock)
+	orderUC := usecase.NewOrderUseCase(store, loyaltyClient)
+	orderUC.SetClock(clock)
+	orderUC.SetLogger(logger)
 
-	r.Post(UserPrefix+RegisterPath, handlers.NewRegisterHandler(store, jwtSecret).ServeHTTP)
-	r.Post(UserPrefix+LoginPath, handlers.NewLoginHandler(store, jwtSecret).ServeHTTP)
+	notifier := deps.Notifier
+	if notifier == nil && cfg.DevMode {
+		notifier = notify.NewLogNotifier(os.Stderr)
+	}
+
+	policy := validation.PasswordPolicy{
+		MinLength:     cfg.PasswordMinLength,
+		MaxLength:     cfg.PasswordMaxLength,
+		MinClasses:    cfg.PasswordMinClasses,
+		DisallowLogin: !cfg.PasswordAllowLogin,
+	}
+	if cfg.PasswordBannedFile != "" {
+		banned, err := validation.LoadBannedPasswords(cfg.PasswordBannedFile)
+		if err != nil {
+			return nil, err
+		}
+		policy.Banned = banned
+	}
+	passwordValidator := validation.NewPolicyValidator(policy)
+	passwordUC := usecase.NewPasswordUseCase(store, passwordValidator, notifier, cfg.PasswordResetTTL)
+	passwordUC.SetClock(clock)
+	passwordUC.SetLogger(logger)
+
+	adminUC := usecase.NewAdminUseCase(store)
+
+	// Password reset requests are throttled like logins, but counted apart
+	// from them.
+	loginPolicy := usecase.LoginPolicy{
+		MaxFailures:   cfg.LoginMaxFailures,
+		IPMaxFailures: cfg.LoginIPMaxFailures,
+		DelayAfter:    cfg.LoginDelayAfter,
+		BaseDelay:     cfg.LoginBaseDelay,
+		Lockout:       cfg.LoginLockout,
+		Window:        cfg.LoginWindow,
+	}
+	loginThrottle := usecase.NewLoginThrottle(store, loginPolicy)
+	loginThrottle.SetClock(clock)
+	loginThrottle.SetLogger(logger)
+	resetThrottle := usecase.NewLoginThrottle(store, loginPolicy)
+	resetThrottle.SetScope("reset")
+	resetThrottle.SetClock(clock)
+	resetThrottle.SetLogger(logger)
+
+	hub := events.NewHub()
+	hub.SetLogger(logger)
+
+	webhookUC := usecase.NewWebhookUseCase(store)
+	dispatcher := webhook.NewDispatcher()
+	dispatcher.SetLogger(logger)
+	dispatcher.SetClock(clock)
+	dispatcher.SetInterval(cfg.WebhookInterval)
+	dispatcher.SetTimeout(cfg.WebhookTimeout)
+	dispatcher.SetMaxAttempts(cfg.WebhookAttempts)
+	dispatcher.SetAllowPrivate(cfg.WebhookAllowPrivate)
+
+	readyHandler := handlers.NewReadyHandler(store, loyaltyClient, deps.SchemaVersion, logger)
+	readyHandler.SetClock(clock)
+
+	r := chi.NewRouter()
+	if cfg.TrustProxyHeaders {
+		r.Use(chimiddleware.RealIP)
+	}
+	r.Use(tracing.Middleware)
+	r.Use(middleware.RequestLogger(logger))
+	r.Use(appMetrics.Middleware)
+	r.Use(middleware.SourceIP)
+
+	r.Get(HealthPath, handlers.NewHealthHandler(logger).ServeHTTP)
+	r.Get(ReadyPath, readyHandler.ServeHTTP)
+	r.Get(MetricsPath, appMetrics.Handler().ServeHTTP)
+	r.Get(JWKSPath, handlers.NewJWKSHandler(keys, logger).ServeHTTP)
+
+	r.Post(UserPrefix+RegisterPath, handlers.NewRegisterHandler(store, tokens, passwordValidator, logger).ServeHTTP)
+	r.Post(UserPrefix+LoginPath, handlers.NewLoginHandler(store, tokens, loginThrottle, store, logger).ServeHTTP)
+	r.Post(UserPrefix+RefreshPath, handlers.NewRefreshHandler(tokens, logger).ServeHTTP)
+	if notifier != nil {
+		r.Post(UserPrefix+PasswordResetRequestPath, handlers.NewPasswordResetRequestHandler(passwordUC, resetThrottle, logger).ServeHTTP)
+		r.Post(UserPrefix+PasswordResetPath, handlers.NewPasswordResetHandler(passwordUC, logger).ServeHTTP)
+	} else {
+		logger.Warn("No notifier is configured, password reset is disabled")
+	}
 
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.AuthMiddleware(jwtSecret))
-		r.Post(UserPrefix+OrdersPath, handlers.NewOrderHandler(orderUC).ServeHTTP)
-		r.Get(UserPrefix+OrdersPath, handlers.NewOrderGetHandler(store).ServeHTTP)
-		r.Get(UserPrefix+BalancePath, handlers.NewBalanceHandler(balanceUC).ServeHTTP)
-		r.Post(UserPrefix+WithdrawPath, handlers.NewWithdrawHandler(withdrawalUC).ServeHTTP)
-		r.Get(UserPrefix+WithdrawalsPath, handlers.NewWithdrawalsHandler(withdrawalUC).ServeHTTP)
+		r.Use(middleware.AuthMiddleware(tokens, logger))
+		r.Post(UserPrefix+LogoutPath, handlers.NewLogoutHandler(tokens, logger).ServeHTTP)
+		r.Put(UserPrefix+PasswordPath, handlers.NewChangePasswordHandler(passwordUC, tokens, logger).ServeHTTP)
+		r.Post(UserPrefix+OrdersPath, handlers.NewOrderHandler(orderUC, logger).ServeHTTP)
+		r.Post(UserPrefix+OrdersBatchPath, handlers.NewOrderBatchHandler(orderUC, logger).ServeHTTP)
+		r.Get(UserPrefix+OrdersPath, handlers.NewOrderGetHandler(store, logger).ServeHTTP)
+		r.Get(UserPrefix+OrderEventsPath, handlers.NewEventsHandler(hub, logger).ServeHTTP)
+		r.Get(UserPrefix+OrderPath, handlers.NewOrderDetailHandler(store, logger).ServeHTTP)
+		r.Get(UserPrefix+BalancePath, handlers.NewBalanceHandler(balanceUC, logger).ServeHTTP)
+		r.Post(UserPrefix+WithdrawPath, handlers.NewWithdrawHandler(withdrawalUC, logger).ServeHTTP)
+		r.Get(UserPrefix+WithdrawalsPath, handlers.NewWithdrawalsHandler(withdrawalUC, logger).ServeHTTP)
+		r.Get(UserPrefix+AuditPath, handlers.NewAuditHandler(store, logger).ServeHTTP)
+		r.Post(UserPrefix+WebhooksPath, handlers.NewWebhookCreateHandler(webhookUC, false, logger).ServeHTTP)
+		r.Get(UserPrefix+WebhooksPath, handlers.NewWebhookListHandler(webhookUC, false, logger).ServeHTTP)
+		r.Delete(UserPrefix+WebhookPath, handlers.NewWebhookDeleteHandler(webhookUC, false, logger).ServeHTTP)
+		r.Get(UserPrefix+WebhookLogPath, handlers.NewWebhookLogHandler(webhookUC, false, logger).ServeHTTP)
 	})
 
-	return r
+	r.Route(AdminPrefix, func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(tokens, logger))
+		r.Use(middleware.RequireRole(constants.RoleAdmin, logger))
+		r.Get(AdminUsersPath, handlers.NewAdminUserHandler(adminUC, logger).ServeHTTP)
+		r.Get(AdminUserPath, handlers.NewAdminUserHandler(adminUC, logger).ServeHTTP)
+		r.Get(AdminUserOrdersPath, handlers.NewAdminUserOrdersHandler(adminUC, logger).ServeHTTP)
+		r.Get(AdminUserWithdrawalsPath, handlers.NewAdminUserWithdrawalsHandler(adminUC, logger).ServeHTTP)
+		r.Post(AdminUserBalancePath, handlers.NewAdminBalanceAdjustHandler(adminUC, logger).ServeHTTP)
+		r.Get(AdminOrderAccrualPath, handlers.NewAdminOrderAccrualHandler(adminUC, logger).ServeHTTP)
+		r.Get(AdminAuditPath, handlers.NewAdminAuditHandler(adminUC, logger).ServeHTTP)
+		r.Post(AdminWebhooksPath, handlers.NewWebhookCreateHandler(webhookUC, true, logger).ServeHTTP)
+		r.Get(AdminWebhooksPath, handlers.NewWebhookListHandler(webhookUC, true, logger).ServeHTTP)
+		r.Delete(AdminWebhookPath, handlers.NewWebhookDeleteHandler(webhookUC, true, logger).ServeHTTP)
+		r.Get(AdminWebhookLogPath, handlers.NewWebhookLogHandler(webhookUC, true, logger).ServeHTTP)
+	})
+
+	workers := []func(ctx context.Context){
+		func(ctx context.Context) {
+			loyaltyClient.StartOrderProcessing(ctx, store)
+		},
+		func(ctx context.Context) {
+			hub.Run(ctx, store)
+		},
+		func(ctx context.Context) {
+			dispatcher.Run(ctx, store)
+		},
+	}
+	if cfg.TokenPrune > 0 {
+		workers = append(workers, func(ctx context.Context) {
+			tokens.PruneExpired(ctx, cfg.TokenPrune)
+		})
+	}
+	if cfg.JWTKeysDir != "" && cfg.JWTKeysReload > 0 {
+		workers = append(workers, func(ctx context.Context) {
+			keys.Watch(ctx, keySource, cfg.JWTKeysReload)
+		})
+	}
+
+	return &App{Handler: r, Workers: workers, Drain: readyHandler.Drain, Stop: hub.Close}, nil
 }
@@ -0,0 +1,450 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/config"
+	"github.com/AlenaMolokova/diploma/internal/handlers"
+	"github.com/AlenaMolokova/diploma/internal/loyalty"
+	"github.com/AlenaMolokova/diploma/internal/migrations"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/AlenaMolokova/diploma/internal/storage"
+	"github.com/AlenaMolokova/diploma/internal/webhook"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestApp wires the application exactly as main does, against the
+// database from TEST_DATABASE_URI and the given fake accrual service.
+func newTestApp(t *testing.T, accrualURL string, clock func() time.Time) *App {
+	t.Helper()
+
+	databaseURI := os.Getenv("TEST_DATABASE_URI")
+	if databaseURI == "" {
+		t.Skip("TEST_DATABASE_URI is not set, skipping integration test")
+	}
+
+	if err := migrations.ApplyDir(databaseURI, "../../migrations"); err != nil {
+		t.Fatalf("Failed to apply migrations: %v", err)
+	}
+	schemaVersion, err := migrations.LatestDir("../../migrations")
+	if err != nil {
+		t.Fatalf("Failed to read migrations: %v", err)
+	}
+
+	pool, err := pgxpool.New(context.Background(), databaseURI)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	store, err := storage.NewStorage(pool)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	cfg := &config.Config{
+		AccrualAddr:     accrualURL,
+		JWTSecret:       "test-secret",
+		PollIntervalSec: 1,
+		AccrualWorkers:  2,
+		AccrualBatch:    10,
+		AccrualAttempts: 5,
+		AccrualNotFound: 5,
+		// The webhook receivers of the tests listen on loopback.
+		WebhookInterval:     200 * time.Millisecond,
+		WebhookAllowPrivate: true,
+	}
+	app, err := SetupRoutes(cfg, Deps{
+		Store:         store,
+		Accrual:       loyalty.NewClient(accrualURL),
+		Clock:         clock,
+		SchemaVersion: schemaVersion,
+	})
+	if err != nil {
+		t.Fatalf("Failed to set up application: %v", err)
+	}
+	return app
+}
+
+// luhnNumber appends a Luhn check digit to digits.
+func luhnNumber(digits string) string {
+	sum := 0
+	double := true
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return digits + fmt.Sprint((10-sum%10)%10)
+}
+
+func TestEndToEndAccrualAndWithdrawal(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls = map[string]int{}
+	)
+	accrual := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		number := strings.TrimPrefix(r.URL.Path, "/api/orders/")
+		mu.Lock()
+		calls[number]++
+		first := calls[number] == 1
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if first {
+			fmt.Fprintf(w, `{"order":"%s","status":"REGISTERED"}`, number)
+			return
+		}
+		fmt.Fprintf(w, `{"order":"%s","status":"PROCESSED","accrual":500}`, number)
+	}))
+	defer accrual.Close()
+
+	now := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	app := newTestApp(t, accrual.URL, func() time.Time { return now })
+	api := httptest.NewServer(app.Handler)
+	defer api.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	for _, worker := range app.Workers {
+		workers.Add(1)
+		go func(run func(ctx context.Context)) {
+			defer workers.Done()
+			run(ctx)
+		}(worker)
+	}
+	defer func() {
+		cancel()
+		workers.Wait()
+	}()
+
+	login := fmt.Sprintf("e2e-%d", time.Now().UnixNano())
+	resp, err := http.Post(api.URL+"/api/user/register", "application/json",
+		strings.NewReader(fmt.Sprintf(`{"login":%q,"password":"e2e-Secret-42"}`, login)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	token := resp.Header.Get("Authorization")
+	require.NotEmpty(t, token)
+
+	do := func(method, path, contentType, body string) *http.Response {
+		req, err := http.NewRequest(method, api.URL+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", token)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	orderNumber := luhnNumber(fmt.Sprint(time.Now().UnixNano()))
+	resp = do(http.MethodPost, "/api/user/orders", "text/plain", orderNumber)
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	var balance struct {
+		Current   money.Amount `json:"current"`
+		Withdrawn money.Amount `json:"withdrawn"`
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		resp = do(http.MethodGet, "/api/user/balance", "", "")
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&balance))
+		resp.Body.Close()
+		if balance.Current == money.MustParse("500") || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	require.Equal(t, money.MustParse("500"), balance.Current, "the poller must credit the accrual")
+
+	resp = do(http.MethodGet, "/api/user/orders", "", "")
+	var orders []struct {
+		Number     string       `json:"number"`
+		Status     string       `json:"status"`
+		Accrual    money.Amount `json:"accrual"`
+		UploadedAt time.Time    `json:"uploaded_at"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&orders))
+	resp.Body.Close()
+	require.Len(t, orders, 1)
+	assert.Equal(t, orderNumber, orders[0].Number)
+	assert.Equal(t, "PROCESSED", orders[0].Status)
+	assert.True(t, orders[0].UploadedAt.Equal(now), "uploaded_at must come from the injected clock")
+
+	resp = do(http.MethodPost, "/api/user/balance/withdraw", "application/json",
+		fmt.Sprintf(`{"order":%q,"sum":200}`, luhnNumber("2377225624")))
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = do(http.MethodGet, "/api/user/balance", "", "")
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&balance))
+	resp.Body.Close()
+	assert.Equal(t, money.MustParse("300"), balance.Current)
+	assert.Equal(t, money.MustParse("200"), balance.Withdrawn)
+
+	resp, err = http.Get(api.URL + "/metrics")
+	require.NoError(t, err)
+	scrape, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Contains(t, string(scrape), `gophermart_http_requests_total{method="POST",route="/api/user/orders",status="202"} 1`)
+	assert.Contains(t, string(scrape), `gophermart_accrual_requests_total{outcome="200"}`)
+	assert.Contains(t, string(scrape), "gophermart_points_accrued_total 500")
+	assert.Contains(t, string(scrape), "gophermart_points_withdrawn_total 200")
+	assert.Contains(t, string(scrape), "gophermart_order_processing_seconds_count 1")
+	assert.Contains(t, string(scrape), "gophermart_db_pool_total_conns")
+}
+
+func TestEndToEndAdmin(t *testing.T) {
+	app := newTestApp(t, "http://127.0.0.1:0", time.Now)
+	api := httptest.NewServer(app.Handler)
+	defer api.Close()
+
+	pool, err := pgxpool.New(context.Background(), os.Getenv("TEST_DATABASE_URI"))
+	require.NoError(t, err)
+	defer pool.Close()
+
+	register := func(login string) string {
+		resp, err := http.Post(api.URL+"/api/user/register", "application/json",
+			strings.NewReader(fmt.Sprintf(`{"login":%q,"password":"e2e-Secret-42"}`, login)))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp.Header.Get("Authorization")
+	}
+	do := func(token, method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, api.URL+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	suffix := time.Now().UnixNano()
+	customer := fmt.Sprintf("e2e-customer-%d", suffix)
+	customerToken := register(customer)
+	adminLogin := fmt.Sprintf("e2e-admin-%d", suffix)
+	register(adminLogin)
+
+	resp := do(customerToken, http.MethodGet, "/api/admin/users?login="+customer, "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "users without the admin role are turned away")
+
+	_, err = pool.Exec(context.Background(), "UPDATE users SET role = 'admin' WHERE login = $1", adminLogin)
+	require.NoError(t, err)
+	resp, err = http.Post(api.URL+"/api/user/login", "application/json",
+		strings.NewReader(fmt.Sprintf(`{"login":%q,"password":"e2e-Secret-42"}`, adminLogin)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	adminToken := resp.Header.Get("Authorization")
+
+	resp = do(adminToken, http.MethodGet, "/api/admin/users?login="+customer, "")
+	var account struct {
+		ID      int64        `json:"id"`
+		Login   string       `json:"login"`
+		Current money.Amount `json:"current"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&account))
+	resp.Body.Close()
+	require.Equal(t, customer, account.Login)
+
+	path := fmt.Sprintf("/api/admin/users/%d/balance/adjustments", account.ID)
+	resp = do(adminToken, http.MethodPost, path, `{"amount":25.5,"reason":"goodwill credit"}`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = do(adminToken, http.MethodPost, path, `{"amount":-100,"reason":"correction"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp = do(customerToken, http.MethodGet, "/api/user/balance", "")
+	var balance struct {
+		Current money.Amount `json:"current"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&balance))
+	resp.Body.Close()
+	assert.Equal(t, money.MustParse("25.5"), balance.Current)
+
+	var audited int
+	require.NoError(t, pool.QueryRow(context.Background(),
+		"SELECT count(*) FROM audit_log WHERE target_user_id = $1 AND action LIKE 'admin.%'", account.ID).Scan(&audited))
+	assert.Equal(t, 2, audited, "the lookup and the adjustment are audited")
+}
+
+func TestEndToEndHealth(t *testing.T) {
+	app := newTestApp(t, "http://127.0.0.1:0", time.Now)
+
+	get := func(path string) (int, handlers.HealthResponse) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var resp handlers.HealthResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w.Code, resp
+	}
+
+	code, _ := get(HealthPath)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, resp := get(ReadyPath)
+	assert.Equal(t, http.StatusOK, code, "an unreachable accrual service does not make the service unready")
+	assert.Equal(t, handlers.HealthOK, resp.Components["database"].Status)
+	assert.Equal(t, handlers.HealthOK, resp.Components["migrations"].Status)
+	assert.Equal(t, handlers.HealthFailing, resp.Components["accrual"].Status)
+
+	app.Drain()
+	code, resp = get(ReadyPath)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, handlers.HealthDraining, resp.Status)
+
+	code, _ = get(HealthPath)
+	assert.Equal(t, http.StatusOK, code, "liveness is unaffected by draining")
+}
+
+func TestEndToEndWebhook(t *testing.T) {
+	accrual := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		number := strings.TrimPrefix(r.URL.Path, "/api/orders/")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"order":"%s","status":"PROCESSED","accrual":120}`, number)
+	}))
+	defer accrual.Close()
+
+	type delivery struct {
+		header http.Header
+		body   []byte
+	}
+	received := make(chan delivery, 16)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{header: r.Header.Clone(), body: body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	app := newTestApp(t, accrual.URL, time.Now)
+	api := httptest.NewServer(app.Handler)
+	defer api.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	for _, worker := range app.Workers {
+		workers.Add(1)
+		go func(run func(ctx context.Context)) {
+			defer workers.Done()
+			run(ctx)
+		}(worker)
+	}
+	defer func() {
+		cancel()
+		workers.Wait()
+	}()
+
+	resp, err := http.Post(api.URL+"/api/user/register", "application/json",
+		strings.NewReader(fmt.Sprintf(`{"login":"e2e-webhook-%d","password":"e2e-Secret-42"}`, time.Now().UnixNano())))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	token := resp.Header.Get("Authorization")
+
+	do := func(method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, api.URL+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp = do(http.MethodPost, "/api/user/webhooks",
+		fmt.Sprintf(`{"url":%q,"events":["order.processed"]}`, receiver.URL))
+	var created handlers.WebhookResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.NotEmpty(t, created.Secret)
+
+	orderNumber := luhnNumber(fmt.Sprint(time.Now().UnixNano()))
+	resp = do(http.MethodPost, "/api/user/orders", orderNumber)
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	var event delivery
+	select {
+	case event = <-received:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected the order.processed event to be delivered")
+	}
+	assert.Equal(t, "order.processed", event.header.Get(webhook.EventHeader))
+	timestamp, err := strconv.ParseInt(event.header.Get(webhook.TimestampHeader), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, webhook.Sign(created.Secret, timestamp, event.body), event.header.Get(webhook.SignatureHeader))
+
+	var envelope struct {
+		Event string `json:"event"`
+		Data  struct {
+			Number  string       `json:"number"`
+			Status  string       `json:"status"`
+			Accrual money.Amount `json:"accrual"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(event.body, &envelope))
+	assert.Equal(t, "order.processed", envelope.Event)
+	assert.Equal(t, orderNumber, envelope.Data.Number)
+	assert.Equal(t, "PROCESSED", envelope.Data.Status)
+	assert.Equal(t, money.MustParse("120"), envelope.Data.Accrual)
+
+	var log []handlers.WebhookLogResponse
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp = do(http.MethodGet, fmt.Sprintf("/api/user/webhooks/%d/deliveries", created.ID), "")
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&log))
+		resp.Body.Close()
+		if len(log) > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.Len(t, log, 1, "the attempt is recorded once the receiver answers")
+	assert.Equal(t, "done", log[0].State)
+	assert.Equal(t, http.StatusNoContent, log[0].StatusCode)
+
+	resp = do(http.MethodDelete, fmt.Sprintf("/api/user/webhooks/%d", created.ID), "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = do(http.MethodGet, fmt.Sprintf("/api/user/webhooks/%d/deliveries", created.ID), "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestEndToEndPasswordResetNeedsNotifier(t *testing.T) {
+	app := newTestApp(t, "http://127.0.0.1:0", time.Now)
+
+	w := httptest.NewRecorder()
+	app.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/user/password/reset/request",
+		strings.NewReader(`{"login":"someone"}`)))
+	assert.Equal(t, http.StatusNotFound, w.Code, "reset tokens are not issued without a way to deliver them")
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Server owns the HTTP listener, the background workers and the resources
+// they share, and tears them down in order when its context is cancelled.
+type Server struct {
+	httpServer      *http.Server
+	shutdownTimeout time.Duration
+	drainDelay      time.Duration
+	drainers        []func()
+	workers         []func(ctx context.Context)
+	closers         []func()
+}
+
+func New(addr string, handler http.Handler, shutdownTimeout time.Duration) *Server {
+	return &Server{
+		httpServer: &http.Server{
+			Addr:    addr,
+			Handler: handler,
+		},
+		shutdownTimeout: shutdownTimeout,
+	}
+}
+
+// SetDrainDelay sets how long the server keeps serving after its context is
+// cancelled and the OnDrain hooks have run, so that load balancers notice the
+// failing readiness check before the listener closes.
+func (s *Server) SetDrainDelay(d time.Duration) {
+	s.drainDelay = d
+}
+
+// OnDrain registers a hook that runs as soon as shutdown begins, while
+// requests are still being served.
+func (s *Server) OnDrain(fn func()) {
+	s.drainers = append(s.drainers, fn)
+}
+
+// OnStop registers a hook that runs once the server stops accepting
+// connections, while in-flight requests drain. Shutdown does not interrupt
+// long-lived responses such as event streams; they end themselves from here.
+func (s *Server) OnStop(fn func()) {
+	s.httpServer.RegisterOnShutdown(fn)
+}
+
+// AddWorker registers a background task. It runs until the server's HTTP side
+// has drained and must return once its context is cancelled.
+func (s *Server) AddWorker(fn func(ctx context.Context)) {
+	s.workers = append(s.workers, fn)
+}
+
+// OnShutdown registers a cleanup that runs after every worker has returned,
+// in reverse order of registration.
+func (s *Server) OnShutdown(fn func()) {
+	s.closers = append(s.closers, fn)
+}
+
+// Run listens on the configured address and serves until ctx is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		s.close()
+		return fmt.Errorf("failed to listen on %s: %w", s.httpServer.Addr, err)
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve accepts connections on ln until ctx is cancelled or the listener
+// fails. Shutdown first runs the OnDrain hooks and keeps serving for the
+// drain delay, then stops accepting new connections, waits up to the shutdown
+// timeout for in-flight requests, cancels the workers, waits for them and
+// finally runs the OnShutdown hooks.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := s.httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+		close(serveErr)
+	}()
+
+	workerCtx, cancelWorkers := context.WithCancel(context.Background())
+	defer cancelWorkers()
+
+	var wg sync.WaitGroup
+	for _, worker := range s.workers {
+		wg.Add(1)
+		go func(run func(ctx context.Context)) {
+			defer wg.Done()
+			run(workerCtx)
+		}(worker)
+	}
+
+	var errs []error
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down server", slog.Duration("drain_delay", s.drainDelay))
+		if err := s.drain(serveErr); err != nil {
+			errs = append(errs, fmt.Errorf("server failed: %w", err))
+		}
+	case err := <-serveErr:
+		if err != nil {
+			errs = append(errs, fmt.Errorf("server failed: %w", err))
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to drain requests: %w", err))
+		s.httpServer.Close()
+	}
+
+	cancelWorkers()
+	wg.Wait()
+	s.close()
+
+	slog.Info("Server stopped")
+	return errors.Join(errs...)
+}
+
+// drain runs the OnDrain hooks and waits out the drain delay, unless the
+// listener fails in the meantime.
+func (s *Server) drain(serveErr <-chan error) error {
+	for _, fn := range s.drainers {
+		fn()
+	}
+	if s.drainDelay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(s.drainDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case err := <-serveErr:
+		return err
+	}
+}
+
+func (s *Server) close() {
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i]()
+	}
+}
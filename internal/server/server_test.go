@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerGracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	srv := New("", mux, time.Second)
+	srv.AddWorker(func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		record("worker")
+	})
+	srv.OnShutdown(func() { record("pool") })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := "http://" + ln.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, ln) }()
+
+	respCh := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(addr + "/slow")
+		if err != nil {
+			respCh <- 0
+			return
+		}
+		resp.Body.Close()
+		record("request")
+		respCh <- resp.StatusCode
+	}()
+
+	<-started
+	cancel()
+
+	assert.Equal(t, http.StatusOK, <-respCh, "in-flight request must be drained")
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Server did not stop")
+	}
+
+	_, err = http.Get(addr + "/slow")
+	assert.Error(t, err, "server must not accept requests after shutdown")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"request", "worker", "pool"}, events)
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stuck", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	defer close(release)
+
+	closed := false
+	srv := New("", mux, 50*time.Millisecond)
+	srv.OnShutdown(func() { closed = true })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, ln) }()
+
+	go http.Get("http://" + ln.Addr().String() + "/stuck")
+	<-started
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.True(t, closed)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Server did not give up draining after the timeout")
+	}
+}
+
+func TestServerRunListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	closed := false
+	srv := New(ln.Addr().String(), http.NewServeMux(), time.Second)
+	srv.OnShutdown(func() { closed = true })
+
+	err = srv.Run(context.Background())
+	assert.Error(t, err)
+	assert.True(t, closed)
+}
+
+func TestServerDrainsBeforeShutdown(t *testing.T) {
+	var draining atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if draining.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	srv := New("", mux, time.Second)
+	srv.SetDrainDelay(300 * time.Millisecond)
+	srv.OnDrain(func() { draining.Store(true) })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := "http://" + ln.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, ln) }()
+
+	resp, err := http.Get(addr + "/readyz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	cancel()
+	require.Eventually(t, draining.Load, time.Second, 10*time.Millisecond)
+
+	resp, err = http.Get(addr + "/readyz")
+	require.NoError(t, err, "requests are still served during the drain delay")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Server did not stop after the drain delay")
+	}
+}
+
+func TestServerStopEndsStreams(t *testing.T) {
+	stop := make(chan struct{})
+	streaming := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		close(streaming)
+		<-stop
+	})
+
+	srv := New("", mux, 5*time.Second)
+	srv.OnStop(func() { close(stop) })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, ln) }()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	<-streaming
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Server waited for the stream instead of ending it")
+	}
+}
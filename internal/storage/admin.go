@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetAccrualJobState returns an order together with its accrual job, if any.
+func (s *Storage) GetAccrualJobState(ctx context.Context, number string) (models.AccrualJobState, error) {
+	order, err := s.queries.GetOrderByNumber(ctx, number)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.AccrualJobState{}, models.ErrOrderNotFound
+	}
+	if err != nil {
+		return models.AccrualJobState{}, err
+	}
+	state := models.AccrualJobState{
+		Order: models.Order{
+			ID:         order.ID,
+			UserID:     order.UserID.Int64,
+			Number:     order.Number,
+			Status:     order.Status,
+			Accrual:    order.Accrual,
+			UploadedAt: order.UploadedAt,
+		},
+	}
+
+	job, err := s.queries.GetAccrualJob(ctx, number)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return state, nil
+	}
+	if err != nil {
+		return models.AccrualJobState{}, err
+	}
+	state.Job = &models.AccrualJobStatus{
+		State:         job.State,
+		Attempts:      int(job.Attempts),
+		NotFound:      int(job.NotFound),
+		NextAttemptAt: job.NextAttemptAt.Time,
+		LockedBy:      job.LockedBy.String,
+		LockedUntil:   job.LockedUntil.Time,
+		LastError:     job.LastError.String,
+		UpdatedAt:     job.UpdatedAt.Time,
+		TraceParent:   job.TraceParent.String,
+	}
+	return state, nil
+}
+
+// AdjustBalance adds an adjustment entry to the user's ledger and audits it in
+// the same transaction. A debit may not take the balance below zero. Listeners
+// of user events are told about the new balance. It returns the new current
+// balance.
+func (s *Storage) AdjustBalance(ctx context.Context, adjustment models.BalanceAdjustment) (money.Amount, error) {
+	var current money.Amount
+	err := s.inTx(ctx, func(q *Queries) error {
+		if _, err := q.LockUser(ctx, adjustment.UserID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return models.ErrUserNotFound
+			}
+			return err
+		}
+
+		bal, err := q.GetUserBalance(ctx, adjustment.UserID)
+		if err != nil {
+			return err
+		}
+		current = bal.Current + adjustment.Amount
+		if current < 0 {
+			return models.ErrInsufficientBalance
+		}
+
+		if err := q.CreateLedgerEntry(ctx, CreateLedgerEntryParams{
+			UserID: adjustment.UserID,
+			Kind:   constants.LedgerKindAdjustment,
+			Amount: adjustment.Amount,
+		}); err != nil {
+			return err
+		}
+
+		if err := writeAudit(ctx, q, models.AuditEntry{
+			ActorID:       adjustment.ActorID,
+			Action:        constants.AuditAdminBalanceAdjust,
+			TargetUserID:  adjustment.UserID,
+			BalanceBefore: amountRef(bal.Current),
+			BalanceAfter:  amountRef(current),
+			Details: map[string]any{
+				"amount": adjustment.Amount,
+				"reason": adjustment.Reason,
+			},
+		}); err != nil {
+			return err
+		}
+		return notifyBalance(ctx, q, adjustment.UserID, current, bal.Withdrawn)
+	})
+	return current, err
+}
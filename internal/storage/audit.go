@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/AlenaMolokova/diploma/internal/audit"
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func (s *Storage) RecordAudit(ctx context.Context, entry models.AuditEntry) error {
+	return writeAudit(ctx, s.queries, entry)
+}
+
+// writeAudit lets callers write the audit entry in the same transaction
+// as the change it describes. The source address is taken from ctx unless
+// the entry has one.
+func writeAudit(ctx context.Context, q *Queries, entry models.AuditEntry) error {
+	details := []byte("{}")
+	if len(entry.Details) > 0 {
+		var err error
+		if details, err = json.Marshal(entry.Details); err != nil {
+			return fmt.Errorf("failed to encode audit details: %w", err)
+		}
+	}
+	if entry.SourceIP == "" {
+		entry.SourceIP = audit.SourceIP(ctx)
+	}
+	before, err := nullableNumeric(entry.BalanceBefore)
+	if err != nil {
+		return err
+	}
+	after, err := nullableNumeric(entry.BalanceAfter)
+	if err != nil {
+		return err
+	}
+	return q.CreateAuditEntry(ctx, CreateAuditEntryParams{
+		ActorID:       pgtype.Int8{Int64: entry.ActorID, Valid: entry.ActorID != 0},
+		Action:        entry.Action,
+		TargetUserID:  pgtype.Int8{Int64: entry.TargetUserID, Valid: entry.TargetUserID != 0},
+		OrderNumber:   pgtype.Text{String: entry.OrderNumber, Valid: entry.OrderNumber != ""},
+		Details:       details,
+		SourceIp:      pgtype.Text{String: entry.SourceIP, Valid: entry.SourceIP != ""},
+		BalanceBefore: before,
+		BalanceAfter:  after,
+	})
+}
+
+// ListAudit returns the entries matching filter, newest first.
+func (s *Storage) ListAudit(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	rows, err := s.queries.ListAuditEntries(ctx, ListAuditEntriesParams{
+		UserID:      pgtype.Int8{Int64: filter.UserID, Valid: filter.UserID != 0},
+		Action:      pgtype.Text{String: filter.Action, Valid: filter.Action != ""},
+		OrderNumber: pgtype.Text{String: filter.OrderNumber, Valid: filter.OrderNumber != ""},
+		Since:       pgtype.Timestamptz{Time: filter.Since, Valid: !filter.Since.IsZero()},
+		Until:       pgtype.Timestamptz{Time: filter.Until, Valid: !filter.Until.IsZero()},
+		BeforeID:    pgtype.Int8{Int64: filter.BeforeID, Valid: filter.BeforeID != 0},
+		Limit:       int32(filter.Limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return auditEntries(rows)
+}
+
+// userVisibleAdminActions are the admin actions on an account that its owner
+// sees in their audit trail: the ones that change the balance it explains.
+var userVisibleAdminActions = []string{constants.AuditAdminBalanceAdjust}
+
+// ListUserAudit returns the entries matching filter that the user may see:
+// the user's own actions, the system's changes to the account and admin
+// actions that changed its balance, but not admins looking at it.
+func (s *Storage) ListUserAudit(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	rows, err := s.queries.ListUserAuditEntries(ctx, ListUserAuditEntriesParams{
+		UserID:       pgtype.Int8{Int64: filter.UserID, Valid: true},
+		AdminActions: userVisibleAdminActions,
+		Action:       pgtype.Text{String: filter.Action, Valid: filter.Action != ""},
+		OrderNumber:  pgtype.Text{String: filter.OrderNumber, Valid: filter.OrderNumber != ""},
+		Since:        pgtype.Timestamptz{Time: filter.Since, Valid: !filter.Since.IsZero()},
+		Until:        pgtype.Timestamptz{Time: filter.Until, Valid: !filter.Until.IsZero()},
+		BeforeID:     pgtype.Int8{Int64: filter.BeforeID, Valid: filter.BeforeID != 0},
+		Limit:        int32(filter.Limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return auditEntries(rows)
+}
+
+func auditEntries(rows []AuditLog) ([]models.AuditEntry, error) {
+	entries := make([]models.AuditEntry, len(rows))
+	for i, row := range rows {
+		entry := models.AuditEntry{
+			ID:           row.ID,
+			ActorID:      row.ActorID.Int64,
+			Action:       row.Action,
+			TargetUserID: row.TargetUserID.Int64,
+			OrderNumber:  row.OrderNumber.String,
+			SourceIP:     row.SourceIp.String,
+			CreatedAt:    row.CreatedAt.Time,
+		}
+		var err error
+		if entry.BalanceBefore, err = scanNullableNumeric(row.BalanceBefore); err != nil {
+			return nil, err
+		}
+		if entry.BalanceAfter, err = scanNullableNumeric(row.BalanceAfter); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(row.Details, &entry.Details); err != nil {
+			return nil, fmt.Errorf("failed to decode audit details: %w", err)
+		}
+		entries[i] = entry
+	}
+	return entries, nil
+}
+
+func amountRef(a money.Amount) *money.Amount {
+	return &a
+}
+
+func nullableNumeric(a *money.Amount) (pgtype.Numeric, error) {
+	if a == nil {
+		return pgtype.Numeric{}, nil
+	}
+	return a.NumericValue()
+}
+
+func scanNullableNumeric(n pgtype.Numeric) (*money.Amount, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	var a money.Amount
+	if err := a.ScanNumeric(n); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// userEventsChannel is the notification channel that carries user events
+// between replicas. NotifyUserEvent sends on it too.
+const userEventsChannel = "user_events"
+
+// userEventPayload is a models.UserEvent as it travels in a notification.
+type userEventPayload struct {
+	UserID     int64        `json:"user_id"`
+	Kind       string       `json:"kind"`
+	Number     string       `json:"number,omitempty"`
+	Status     string       `json:"status,omitempty"`
+	Accrual    money.Amount `json:"accrual,omitempty"`
+	UploadedAt time.Time    `json:"uploaded_at"`
+	Current    money.Amount `json:"current,omitempty"`
+	Withdrawn  money.Amount `json:"withdrawn,omitempty"`
+}
+
+// ListenUserEvents passes the user events of every replica to fn until ctx is
+// done or the connection fails, and returns the reason. It holds a connection
+// of the pool all the while; events sent while no one listens are lost.
+func (s *Storage) ListenUserEvents(ctx context.Context, fn func(models.UserEvent)) error {
+	conn, err := s.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection keeps listening until it is closed, so it does not go
+	// back to the pool.
+	listener := conn.Hijack()
+	defer listener.Close(context.Background())
+
+	if _, err := listener.Exec(ctx, "LISTEN "+userEventsChannel); err != nil {
+		return err
+	}
+	for {
+		notification, err := listener.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var payload userEventPayload
+		if err := json.Unmarshal([]byte(notification.Payload), &payload); err != nil {
+			return fmt.Errorf("failed to decode user event: %w", err)
+		}
+		fn(models.UserEvent{
+			UserID: payload.UserID,
+			Kind:   payload.Kind,
+			Order: models.Order{
+				UserID:     payload.UserID,
+				Number:     payload.Number,
+				Status:     payload.Status,
+				Accrual:    payload.Accrual,
+				UploadedAt: pgtype.Timestamptz{Time: payload.UploadedAt, Valid: !payload.UploadedAt.IsZero()},
+			},
+			Current:   payload.Current,
+			Withdrawn: payload.Withdrawn,
+		})
+	}
+}
+
+// notifyOrder tells the listeners of every replica about the order as it now
+// is. The notification is delivered when the transaction commits, and not at
+// all if it rolls back.
+func notifyOrder(ctx context.Context, q *Queries, order Order) error {
+	return sendUserEvent(ctx, q, userEventPayload{
+		UserID:     order.UserID.Int64,
+		Kind:       constants.EventOrder,
+		Number:     order.Number,
+		Status:     order.Status,
+		Accrual:    order.Accrual,
+		UploadedAt: order.UploadedAt.Time,
+	})
+}
+
+// notifyBalance tells the listeners of every replica about the user's new
+// balance, once the transaction commits.
+func notifyBalance(ctx context.Context, q *Queries, userID int64, current, withdrawn money.Amount) error {
+	return sendUserEvent(ctx, q, userEventPayload{
+		UserID:    userID,
+		Kind:      constants.EventBalance,
+		Current:   current,
+		Withdrawn: withdrawn,
+	})
+}
+
+func sendUserEvent(ctx context.Context, q *Queries, payload userEventPayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode user event: %w", err)
+	}
+	return q.NotifyUserEvent(ctx, string(data))
+}
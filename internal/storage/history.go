@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// RecordAccrualCheck adds one check of an order by the accrual poller to the
+// order's history.
+func (s *Storage) RecordAccrualCheck(ctx context.Context, check models.AccrualCheck) error {
+	accrual, err := nullableNumeric(check.Accrual)
+	if err != nil {
+		return err
+	}
+	return s.queries.CreateOrderHistoryEntry(ctx, CreateOrderHistoryEntryParams{
+		OrderNumber: check.OrderNumber,
+		Kind:        constants.HistoryAccrualCheck,
+		Status:      pgtype.Text{String: check.Status, Valid: check.Status != ""},
+		Outcome:     pgtype.Text{String: check.Outcome, Valid: true},
+		Accrual:     accrual,
+		Error:       pgtype.Text{String: check.Error, Valid: check.Error != ""},
+	})
+}
+
+// GetUserOrder returns an order of userID together with its history. An
+// order of another user is reported as not found, like a missing one, so
+// the answer does not tell whether the number was taken.
+func (s *Storage) GetUserOrder(ctx context.Context, userID int64, number string) (models.OrderDetails, error) {
+	order, err := s.queries.GetOrderByNumber(ctx, number)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.OrderDetails{}, models.ErrOrderNotFound
+	}
+	if err != nil {
+		return models.OrderDetails{}, err
+	}
+	if order.UserID.Int64 != userID {
+		return models.OrderDetails{}, models.ErrOrderNotFound
+	}
+
+	rows, err := s.queries.ListOrderHistory(ctx, number)
+	if err != nil {
+		return models.OrderDetails{}, err
+	}
+	details := models.OrderDetails{
+		Order: models.Order{
+			ID:         order.ID,
+			UserID:     order.UserID.Int64,
+			Number:     order.Number,
+			Status:     order.Status,
+			Accrual:    order.Accrual,
+			UploadedAt: order.UploadedAt,
+		},
+		History: make([]models.OrderHistoryEntry, len(rows)),
+	}
+	for i, row := range rows {
+		accrual, err := scanNullableNumeric(row.Accrual)
+		if err != nil {
+			return models.OrderDetails{}, err
+		}
+		details.History[i] = models.OrderHistoryEntry{
+			Kind:       row.Kind,
+			FromStatus: row.FromStatus.String,
+			Status:     row.Status.String,
+			Outcome:    row.Outcome.String,
+			Accrual:    accrual,
+			Error:      row.Error.String,
+			CreatedAt:  row.CreatedAt.Time,
+		}
+	}
+	return details, nil
+}
+
+// writeStatusChange records in the order's history that it moved from one
+// status to another, in the same transaction as the move. from is empty for
+// the upload; accrual is set when the move credits one.
+func writeStatusChange(ctx context.Context, q *Queries, number, from, to string, accrual *money.Amount) error {
+	amount, err := nullableNumeric(accrual)
+	if err != nil {
+		return err
+	}
+	return q.CreateOrderHistoryEntry(ctx, CreateOrderHistoryEntryParams{
+		OrderNumber: number,
+		Kind:        constants.HistoryStatusChange,
+		FromStatus:  pgtype.Text{String: from, Valid: from != ""},
+		Status:      pgtype.Text{String: to, Valid: true},
+		Accrual:     amount,
+	})
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// LoginLockedUntil returns the latest lockout still in force for any of the
+// subjects, or the zero time if none of them is locked.
+func (s *Storage) LoginLockedUntil(ctx context.Context, subjects []string, now time.Time) (time.Time, error) {
+	lockedUntil, err := s.queries.GetLoginLockout(ctx, GetLoginLockoutParams{
+		Subjects: subjects,
+		Now:      pgtype.Timestamptz{Time: now, Valid: true},
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !lockedUntil.Valid {
+		return time.Time{}, nil
+	}
+	return lockedUntil.Time, nil
+}
+
+// RecordLoginFailure counts a failed attempt for subject and returns the
+// number of failures in a row. The count starts over when the previous
+// failure is older than windowStart.
+func (s *Storage) RecordLoginFailure(ctx context.Context, subject string, now, windowStart time.Time) (int, error) {
+	failures, err := s.queries.RecordLoginFailure(ctx, RecordLoginFailureParams{
+		Subject:     subject,
+		Now:         pgtype.Timestamptz{Time: now, Valid: true},
+		WindowStart: pgtype.Timestamptz{Time: windowStart, Valid: true},
+	})
+	return int(failures), err
+}
+
+// LockLogin locks subject until the given time. A longer lockout already in
+// place, e.g. recorded by another replica, is kept.
+func (s *Storage) LockLogin(ctx context.Context, subject string, until time.Time) error {
+	return s.queries.LockLoginSubject(ctx, LockLoginSubjectParams{
+		LockedUntil: pgtype.Timestamptz{Time: until, Valid: true},
+		Subject:     subject,
+	})
+}
+
+func (s *Storage) ResetLoginFailures(ctx context.Context, subject string) error {
+	return s.queries.ResetLoginFailures(ctx, subject)
+}
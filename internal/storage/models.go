@@ -5,30 +5,151 @@
 package storage
 
 import (
+	"github.com/AlenaMolokova/diploma/internal/money"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AccrualJob struct {
+	OrderNumber   string             `json:"order_number"`
+	State         string             `json:"state"`
+	Attempts      int32              `json:"attempts"`
+	NotFound      int32              `json:"not_found"`
+	NextAttemptAt pgtype.Timestamptz `json:"next_attempt_at"`
+	LockedBy      pgtype.Text        `json:"locked_by"`
+	LockedUntil   pgtype.Timestamptz `json:"locked_until"`
+	LastError     pgtype.Text        `json:"last_error"`
+	UpdatedAt     pgtype.Timestamptz `json:"updated_at"`
+	TraceParent   pgtype.Text        `json:"trace_parent"`
+}
+
+type AuditLog struct {
+	ID            int64              `json:"id"`
+	ActorID       pgtype.Int8        `json:"actor_id"`
+	Action        string             `json:"action"`
+	TargetUserID  pgtype.Int8        `json:"target_user_id"`
+	OrderNumber   pgtype.Text        `json:"order_number"`
+	Details       []byte             `json:"details"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	SourceIp      pgtype.Text        `json:"source_ip"`
+	BalanceBefore pgtype.Numeric     `json:"balance_before"`
+	BalanceAfter  pgtype.Numeric     `json:"balance_after"`
+}
+
+type LedgerEntry struct {
+	ID           int64              `json:"id"`
+	UserID       int64              `json:"user_id"`
+	Kind         string             `json:"kind"`
+	Amount       money.Amount       `json:"amount"`
+	OrderNumber  pgtype.Text        `json:"order_number"`
+	WithdrawalID pgtype.Int8        `json:"withdrawal_id"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+}
+
+type LoginAttempt struct {
+	Subject     string             `json:"subject"`
+	Failures    int32              `json:"failures"`
+	LockedUntil pgtype.Timestamptz `json:"locked_until"`
+	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+}
+
 type Order struct {
 	ID         int64              `json:"id"`
 	UserID     pgtype.Int8        `json:"user_id"`
 	Number     string             `json:"number"`
 	Status     string             `json:"status"`
-	Accrual    pgtype.Float8      `json:"accrual"`
+	Accrual    money.Amount       `json:"accrual"`
 	UploadedAt pgtype.Timestamptz `json:"uploaded_at"`
 }
 
+type OrderStatusHistory struct {
+	ID          int64              `json:"id"`
+	OrderNumber string             `json:"order_number"`
+	Kind        string             `json:"kind"`
+	FromStatus  pgtype.Text        `json:"from_status"`
+	Status      pgtype.Text        `json:"status"`
+	Outcome     pgtype.Text        `json:"outcome"`
+	Accrual     pgtype.Numeric     `json:"accrual"`
+	Error       pgtype.Text        `json:"error"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+}
+
+type PasswordReset struct {
+	ID        int64              `json:"id"`
+	UserID    int64              `json:"user_id"`
+	TokenHash string             `json:"token_hash"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type RefreshToken struct {
+	ID        int64              `json:"id"`
+	UserID    int64              `json:"user_id"`
+	FamilyID  string             `json:"family_id"`
+	TokenHash string             `json:"token_hash"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	RevokedAt pgtype.Timestamptz `json:"revoked_at"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type RevokedToken struct {
+	Jti       string             `json:"jti"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
 type User struct {
-	ID        int64         `json:"id"`
-	Login     string        `json:"login"`
-	Password  string        `json:"password"`
-	Balance   pgtype.Float8 `json:"balance"`
-	Withdrawn pgtype.Float8 `json:"withdrawn"`
+	ID       int64  `json:"id"`
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+type Webhook struct {
+	ID        int64              `json:"id"`
+	UserID    pgtype.Int8        `json:"user_id"`
+	Url       string             `json:"url"`
+	Secret    string             `json:"secret"`
+	Events    []string           `json:"events"`
+	CreatedBy int64              `json:"created_by"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	DeletedAt pgtype.Timestamptz `json:"deleted_at"`
+}
+
+type WebhookDelivery struct {
+	ID            int64              `json:"id"`
+	OutboxID      int64              `json:"outbox_id"`
+	WebhookID     int64              `json:"webhook_id"`
+	State         string             `json:"state"`
+	Attempts      int32              `json:"attempts"`
+	NextAttemptAt pgtype.Timestamptz `json:"next_attempt_at"`
+	LockedBy      pgtype.Text        `json:"locked_by"`
+	LockedUntil   pgtype.Timestamptz `json:"locked_until"`
+	LastError     pgtype.Text        `json:"last_error"`
+	UpdatedAt     pgtype.Timestamptz `json:"updated_at"`
+}
+
+type WebhookDeliveryAttempt struct {
+	ID         int64              `json:"id"`
+	DeliveryID int64              `json:"delivery_id"`
+	StatusCode pgtype.Int4        `json:"status_code"`
+	Error      pgtype.Text        `json:"error"`
+	DurationMs int32              `json:"duration_ms"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+}
+
+type WebhookOutbox struct {
+	ID        int64              `json:"id"`
+	Event     string             `json:"event"`
+	UserID    int64              `json:"user_id"`
+	Payload   []byte             `json:"payload"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
 }
 
 type Withdrawal struct {
 	ID          int64              `json:"id"`
 	UserID      pgtype.Int8        `json:"user_id"`
 	OrderNumber string             `json:"order_number"`
-	Sum         float64            `json:"sum"`
+	Sum         money.Amount       `json:"sum"`
 	ProcessedAt pgtype.Timestamptz `json:"processed_at"`
 }
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func (s *Storage) GetUserByID(ctx context.Context, id int64) (models.User, error) {
+	user, err := s.queries.GetUserByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.User{}, models.ErrUserNotFound
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	return models.User{
+		ID:       user.ID,
+		Login:    user.Login,
+		Password: user.Password,
+		Role:     user.Role,
+	}, nil
+}
+
+// ChangePassword stores the new password hash and, in the same transaction,
+// revokes every session of the user and any outstanding reset tokens.
+func (s *Storage) ChangePassword(ctx context.Context, userID int64, passwordHash string) error {
+	return s.inTx(ctx, func(q *Queries) error {
+		return setPassword(ctx, q, userID, passwordHash, constants.AuditUserPasswordChange)
+	})
+}
+
+// CreatePasswordReset stores a reset token, invalidating the user's earlier ones.
+func (s *Storage) CreatePasswordReset(ctx context.Context, reset models.PasswordReset) error {
+	return s.inTx(ctx, func(q *Queries) error {
+		if err := q.ExpirePasswordResets(ctx, reset.UserID); err != nil {
+			return err
+		}
+		return q.CreatePasswordReset(ctx, CreatePasswordResetParams{
+			UserID:    reset.UserID,
+			TokenHash: reset.TokenHash,
+			ExpiresAt: pgtype.Timestamptz{Time: reset.ExpiresAt, Valid: true},
+		})
+	})
+}
+
+// GetPasswordReset returns the user a live reset token belongs to without
+// spending it.
+func (s *Storage) GetPasswordReset(ctx context.Context, tokenHash string, now time.Time) (models.User, error) {
+	row, err := s.queries.GetPasswordReset(ctx, GetPasswordResetParams{
+		TokenHash: tokenHash,
+		Now:       pgtype.Timestamptz{Time: now, Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.User{}, models.ErrResetTokenInvalid
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	return models.User{ID: row.ID, Login: row.Login}, nil
+}
+
+// ResetPassword spends the reset token and sets the new password hash. A
+// token can be spent once, so concurrent resets with it cannot both succeed.
+func (s *Storage) ResetPassword(ctx context.Context, tokenHash, passwordHash string, now time.Time) (int64, error) {
+	var userID int64
+	err := s.inTx(ctx, func(q *Queries) error {
+		id, err := q.UsePasswordReset(ctx, UsePasswordResetParams{
+			TokenHash: tokenHash,
+			Now:       pgtype.Timestamptz{Time: now, Valid: true},
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.ErrResetTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+		userID = id
+		return setPassword(ctx, q, id, passwordHash, constants.AuditUserPasswordReset)
+	})
+	return userID, err
+}
+
+func setPassword(ctx context.Context, q *Queries, userID int64, passwordHash, action string) error {
+	if err := q.UpdateUserPassword(ctx, UpdateUserPasswordParams{
+		ID:       userID,
+		Password: passwordHash,
+	}); err != nil {
+		return err
+	}
+	if err := q.RevokeUserTokens(ctx, userID); err != nil {
+		return err
+	}
+	if err := q.ExpirePasswordResets(ctx, userID); err != nil {
+		return err
+	}
+	return writeAudit(ctx, q, models.AuditEntry{
+		ActorID:      userID,
+		Action:       action,
+		TargetUserID: userID,
+	})
+}
@@ -7,6 +7,17 @@ RETURNING id;
 INSERT INTO orders (user_id, number, status, accrual, uploaded_at)
 VALUES ($1, $2, $3, $4, $5);
 
+-- name: CreateOrders :many
+INSERT INTO orders (user_id, number, status, uploaded_at)
+SELECT sqlc.arg(user_id), unnest(sqlc.arg(numbers)::text[]), sqlc.arg(status), sqlc.arg(uploaded_at)
+ON CONFLICT (number) DO NOTHING
+RETURNING number;
+
+-- name: GetOrdersByNumbers :many
+SELECT id, user_id, number, status, accrual, uploaded_at
+FROM orders
+WHERE number = ANY(sqlc.arg(numbers)::text[]);
+
 -- name: GetOrderByNumber :one
 SELECT id, user_id, number, status, accrual, uploaded_at
 FROM orders
@@ -18,14 +29,23 @@ FROM orders
 WHERE user_id = $1
 ORDER BY uploaded_at DESC;
 
--- name: GetAllOrders :many
-SELECT id, user_id, number, status, accrual, uploaded_at
+-- name: ListOrdersByUser :many
+SELECT id, number, status, accrual, uploaded_at
 FROM orders
-ORDER BY uploaded_at DESC;
+WHERE user_id = sqlc.arg(user_id)
+  AND uploaded_at >= sqlc.arg(since)
+  AND uploaded_at < sqlc.arg(until)
+  AND (uploaded_at, id) < (sqlc.arg(before_at)::timestamptz, sqlc.arg(before_id)::bigint)
+  AND (sqlc.narg(statuses)::text[] IS NULL OR status = ANY(sqlc.narg(statuses)::text[]))
+  AND (sqlc.narg(min_accrual)::numeric IS NULL OR accrual >= sqlc.narg(min_accrual))
+  AND (sqlc.narg(max_accrual)::numeric IS NULL OR accrual <= sqlc.narg(max_accrual))
+ORDER BY uploaded_at DESC, id DESC
+LIMIT sqlc.narg('limit');
 
--- name: CreateWithdrawal :exec
+-- name: CreateWithdrawal :one
 INSERT INTO withdrawals (user_id, order_number, sum, processed_at)
-VALUES ($1, $2, $3, $4);
+VALUES ($1, $2, $3, $4)
+RETURNING id;
 
 -- name: GetWithdrawalsByUser :many
 SELECT order_number, sum, processed_at
@@ -33,28 +53,407 @@ FROM withdrawals
 WHERE user_id = $1
 ORDER BY processed_at DESC;
 
+-- name: ListWithdrawalsByUser :many
+SELECT id, order_number, sum, processed_at
+FROM withdrawals
+WHERE user_id = sqlc.arg(user_id)
+  AND processed_at >= sqlc.arg(since)
+  AND processed_at < sqlc.arg(until)
+  AND (processed_at, id) < (sqlc.arg(before_at)::timestamptz, sqlc.arg(before_id)::bigint)
+  AND (sqlc.narg(min_sum)::numeric IS NULL OR sum >= sqlc.narg(min_sum))
+  AND (sqlc.narg(max_sum)::numeric IS NULL OR sum <= sqlc.narg(max_sum))
+ORDER BY processed_at DESC, id DESC
+LIMIT sqlc.narg('limit');
+
 -- name: GetUserByLogin :one
-SELECT id, login, password, balance, withdrawn
+SELECT id, login, password, role
 FROM users
 WHERE login = $1;
 
--- name: GetUserBalance :one
-SELECT balance, withdrawn
+-- name: LockUser :one
+SELECT id
 FROM users
 WHERE id = $1
 FOR UPDATE;
 
--- name: UpdateBalance :exec
-UPDATE users
-SET balance = $2
+-- name: CreateLedgerEntry :exec
+INSERT INTO ledger_entries (user_id, kind, amount, order_number, withdrawal_id)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetUserBalance :one
+SELECT COALESCE(SUM(amount), 0)::numeric AS current,
+       COALESCE(-SUM(amount) FILTER (WHERE kind = 'withdrawal'), 0)::numeric AS withdrawn
+FROM ledger_entries
+WHERE user_id = $1;
+
+-- name: GetOrderByNumberForUpdate :one
+SELECT id, user_id, number, status, accrual, uploaded_at
+FROM orders
+WHERE number = $1
+FOR UPDATE;
+
+-- name: SetOrderAccrual :exec
+UPDATE orders
+SET status = $2, accrual = $3
+WHERE number = $1;
+
+-- name: CreateAccrualEntry :execrows
+INSERT INTO ledger_entries (user_id, kind, amount, order_number)
+VALUES ($1, 'accrual', $2, $3)
+ON CONFLICT (order_number) WHERE kind = 'accrual' DO NOTHING;
+
+-- name: EnqueueAccrualJob :exec
+INSERT INTO accrual_jobs (order_number, trace_parent)
+VALUES ($1, $2)
+ON CONFLICT (order_number) DO NOTHING;
+
+-- name: EnqueueAccrualJobs :exec
+INSERT INTO accrual_jobs (order_number, trace_parent)
+SELECT unnest(sqlc.arg(order_numbers)::text[]), sqlc.narg(trace_parent)
+ON CONFLICT (order_number) DO NOTHING;
+
+-- name: ClaimAccrualJobs :many
+UPDATE accrual_jobs AS j
+SET locked_by = sqlc.arg(owner),
+    locked_until = now() + sqlc.arg(lease_seconds)::int * interval '1 second',
+    updated_at = now()
+FROM (
+    SELECT order_number
+    FROM accrual_jobs
+    WHERE state = 'pending'
+      AND next_attempt_at <= now()
+      AND (locked_until IS NULL OR locked_until < now())
+    ORDER BY next_attempt_at
+    LIMIT sqlc.arg('limit')
+    FOR UPDATE SKIP LOCKED
+) AS c, orders AS o
+WHERE j.order_number = c.order_number
+  AND o.number = j.order_number
+RETURNING j.order_number, o.user_id, j.attempts, j.not_found, j.trace_parent;
+
+-- name: RescheduleAccrualJob :exec
+UPDATE accrual_jobs
+SET next_attempt_at = sqlc.arg(next_attempt_at),
+    not_found = 0,
+    locked_by = NULL,
+    locked_until = NULL,
+    updated_at = now()
+WHERE order_number = sqlc.arg(order_number)
+  AND locked_by = sqlc.arg(owner)
+  AND state = 'pending';
+
+-- name: FailAccrualJob :one
+UPDATE accrual_jobs
+SET attempts = attempts + 1,
+    not_found = CASE WHEN sqlc.arg(not_found)::boolean THEN not_found + 1 ELSE 0 END,
+    state = CASE
+        WHEN attempts + 1 >= sqlc.arg(max_attempts)::int THEN 'dead'
+        WHEN sqlc.arg(not_found)::boolean AND not_found + 1 >= sqlc.arg(max_not_found)::int THEN 'dead'
+        ELSE 'pending'
+    END,
+    next_attempt_at = sqlc.arg(next_attempt_at),
+    last_error = sqlc.arg(last_error),
+    locked_by = NULL,
+    locked_until = NULL,
+    updated_at = now()
+WHERE order_number = sqlc.arg(order_number)
+  AND locked_by = sqlc.arg(owner)
+  AND state = 'pending'
+RETURNING state;
+
+-- name: FinishAccrualJob :exec
+UPDATE accrual_jobs
+SET state = 'done',
+    locked_by = NULL,
+    locked_until = NULL,
+    last_error = NULL,
+    updated_at = now()
+WHERE order_number = $1;
+
+-- name: CountPendingAccrualJobs :many
+SELECT o.status, count(*) AS jobs
+FROM accrual_jobs AS j
+JOIN orders AS o ON o.number = j.order_number
+WHERE j.state = 'pending'
+GROUP BY o.status;
+
+-- name: CreateRefreshToken :exec
+INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+VALUES ($1, $2, $3, $4);
+
+-- name: GetRefreshTokenForUpdate :one
+SELECT id, user_id, family_id, token_hash, expires_at, used_at, revoked_at, created_at
+FROM refresh_tokens
+WHERE token_hash = $1
+FOR UPDATE;
+
+-- name: MarkRefreshTokenUsed :exec
+UPDATE refresh_tokens
+SET used_at = now()
 WHERE id = $1;
 
--- name: UpdateWithdrawn :exec
+-- name: RevokeTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = now()
+WHERE family_id = $1
+  AND revoked_at IS NULL;
+
+-- name: RevokeAccessToken :exec
+INSERT INTO revoked_tokens (jti, expires_at)
+VALUES ($1, $2)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: IsTokenRevoked :one
+SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = sqlc.arg(jti))
+    OR EXISTS (
+        SELECT 1
+        FROM refresh_tokens
+        WHERE family_id = sqlc.arg(family_id)
+          AND revoked_at IS NOT NULL
+    ) AS revoked;
+
+-- name: PruneRevokedTokens :execrows
+DELETE FROM revoked_tokens
+WHERE expires_at < now();
+
+-- name: PruneRefreshTokens :execrows
+DELETE FROM refresh_tokens
+WHERE expires_at < now();
+
+-- name: GetLoginLockout :one
+SELECT MAX(locked_until)::timestamptz AS locked_until
+FROM login_attempts
+WHERE subject = ANY(sqlc.arg(subjects)::text[])
+  AND locked_until > sqlc.arg(now);
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_attempts (subject, failures, updated_at)
+VALUES (sqlc.arg(subject), 1, sqlc.arg(now))
+ON CONFLICT (subject) DO UPDATE
+SET failures = CASE
+        WHEN login_attempts.updated_at < sqlc.arg(window_start) THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    updated_at = EXCLUDED.updated_at
+RETURNING failures;
+
+-- name: LockLoginSubject :exec
+UPDATE login_attempts
+SET locked_until = GREATEST(locked_until, sqlc.arg(locked_until))
+WHERE subject = sqlc.arg(subject);
+
+-- name: ResetLoginFailures :exec
+DELETE FROM login_attempts
+WHERE subject = $1;
+
+-- name: GetUserByID :one
+SELECT id, login, password, role
+FROM users
+WHERE id = $1;
+
+-- name: UpdateUserPassword :exec
 UPDATE users
-SET withdrawn = $2
+SET password = $2
 WHERE id = $1;
 
--- name: UpdateOrder :exec
-UPDATE orders
-SET status = $1, accrual = $2, uploaded_at = $3
-WHERE number = $4;
\ No newline at end of file
+-- name: RevokeUserTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = now()
+WHERE user_id = $1
+  AND revoked_at IS NULL;
+
+-- name: ExpirePasswordResets :exec
+UPDATE password_resets
+SET used_at = now()
+WHERE user_id = $1
+  AND used_at IS NULL;
+
+-- name: CreatePasswordReset :exec
+INSERT INTO password_resets (user_id, token_hash, expires_at)
+VALUES ($1, $2, $3);
+
+-- name: GetPasswordReset :one
+SELECT u.id, u.login
+FROM password_resets pr
+JOIN users u ON u.id = pr.user_id
+WHERE pr.token_hash = sqlc.arg(token_hash)
+  AND pr.used_at IS NULL
+  AND pr.expires_at > sqlc.arg(now);
+
+-- name: UsePasswordReset :one
+UPDATE password_resets
+SET used_at = now()
+WHERE token_hash = sqlc.arg(token_hash)
+  AND used_at IS NULL
+  AND expires_at > sqlc.arg(now)
+RETURNING user_id;
+
+-- name: GetAccrualJob :one
+SELECT order_number, state, attempts, not_found, next_attempt_at, locked_by, locked_until, last_error, updated_at, trace_parent
+FROM accrual_jobs
+WHERE order_number = $1;
+
+-- name: CreateAuditEntry :exec
+INSERT INTO audit_log (actor_id, action, target_user_id, order_number, details, source_ip, balance_before, balance_after)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+
+-- name: CreateOrderAuditEntries :exec
+INSERT INTO audit_log (actor_id, action, target_user_id, order_number, details, source_ip)
+SELECT sqlc.arg(actor_id), sqlc.arg(action), sqlc.arg(target_user_id), unnest(sqlc.arg(order_numbers)::text[]), '{}', sqlc.narg(source_ip);
+
+-- name: ListAuditEntries :many
+SELECT id, actor_id, action, target_user_id, order_number, details, created_at, source_ip, balance_before, balance_after
+FROM audit_log
+WHERE (sqlc.narg(user_id)::bigint IS NULL OR actor_id = sqlc.narg(user_id) OR target_user_id = sqlc.narg(user_id))
+  AND (sqlc.narg(action)::text IS NULL OR action = sqlc.narg(action))
+  AND (sqlc.narg(order_number)::text IS NULL OR order_number = sqlc.narg(order_number))
+  AND (sqlc.narg(since)::timestamptz IS NULL OR created_at >= sqlc.narg(since))
+  AND (sqlc.narg(until)::timestamptz IS NULL OR created_at < sqlc.narg(until))
+  AND (sqlc.narg(before_id)::bigint IS NULL OR id < sqlc.narg(before_id))
+ORDER BY id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListUserAuditEntries :many
+SELECT id, actor_id, action, target_user_id, order_number, details, created_at, source_ip, balance_before, balance_after
+FROM audit_log
+WHERE (actor_id = sqlc.arg(user_id)
+    OR (target_user_id = sqlc.arg(user_id) AND (actor_id IS NULL OR action = ANY(sqlc.arg(admin_actions)::text[]))))
+  AND (sqlc.narg(action)::text IS NULL OR action = sqlc.narg(action))
+  AND (sqlc.narg(order_number)::text IS NULL OR order_number = sqlc.narg(order_number))
+  AND (sqlc.narg(since)::timestamptz IS NULL OR created_at >= sqlc.narg(since))
+  AND (sqlc.narg(until)::timestamptz IS NULL OR created_at < sqlc.narg(until))
+  AND (sqlc.narg(before_id)::bigint IS NULL OR id < sqlc.narg(before_id))
+ORDER BY id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: CreateOrderHistoryEntry :exec
+INSERT INTO order_status_history (order_number, kind, from_status, status, outcome, accrual, error)
+VALUES ($1, $2, $3, $4, $5, $6, $7);
+
+-- name: CreateOrderStatusEntries :exec
+INSERT INTO order_status_history (order_number, kind, status)
+SELECT unnest(sqlc.arg(order_numbers)::text[]), 'status_change', sqlc.arg(status);
+
+-- name: ListOrderHistory :many
+SELECT id, order_number, kind, from_status, status, outcome, accrual, error, created_at
+FROM order_status_history
+WHERE order_number = $1
+ORDER BY id;
+
+-- name: NotifyUserEvent :exec
+SELECT pg_notify('user_events', sqlc.arg(payload)::text);
+
+-- name: CreateWebhook :one
+INSERT INTO webhooks (user_id, url, secret, events, created_by)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, created_at;
+
+-- name: CountUserWebhooks :one
+SELECT count(*)
+FROM webhooks
+WHERE user_id = $1
+  AND deleted_at IS NULL;
+
+-- name: ListWebhooks :many
+SELECT id, user_id, url, secret, events, created_by, created_at, deleted_at
+FROM webhooks
+WHERE user_id IS NOT DISTINCT FROM sqlc.narg(user_id)
+  AND deleted_at IS NULL
+ORDER BY id;
+
+-- name: GetWebhook :one
+SELECT id, user_id, url, secret, events, created_by, created_at, deleted_at
+FROM webhooks
+WHERE id = sqlc.arg(id)
+  AND user_id IS NOT DISTINCT FROM sqlc.narg(user_id)
+  AND deleted_at IS NULL;
+
+-- name: DeleteWebhook :one
+UPDATE webhooks
+SET deleted_at = now()
+WHERE id = sqlc.arg(id)
+  AND user_id IS NOT DISTINCT FROM sqlc.narg(user_id)
+  AND deleted_at IS NULL
+RETURNING url;
+
+-- name: AbandonWebhookDeliveries :exec
+UPDATE webhook_deliveries
+SET state = 'dead',
+    last_error = 'webhook deleted',
+    locked_by = NULL,
+    locked_until = NULL,
+    updated_at = now()
+WHERE webhook_id = $1
+  AND state = 'pending';
+
+-- name: CreateWebhookEvent :execrows
+WITH event AS (
+    INSERT INTO webhook_outbox (event, user_id, payload)
+    VALUES (sqlc.arg(event), sqlc.arg(user_id), sqlc.arg(payload))
+    RETURNING id
+)
+INSERT INTO webhook_deliveries (outbox_id, webhook_id)
+SELECT event.id, w.id
+FROM event, webhooks AS w
+WHERE w.deleted_at IS NULL
+  AND (w.user_id IS NULL OR w.user_id = sqlc.arg(user_id))
+  AND sqlc.arg(event) = ANY (w.events);
+
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries AS d
+SET locked_by = sqlc.arg(owner),
+    locked_until = now() + sqlc.arg(lease_seconds)::int * interval '1 second',
+    updated_at = now()
+FROM (
+    SELECT id
+    FROM webhook_deliveries
+    WHERE state = 'pending'
+      AND next_attempt_at <= now()
+      AND (locked_until IS NULL OR locked_until < now())
+    ORDER BY next_attempt_at
+    LIMIT sqlc.arg('limit')
+    FOR UPDATE SKIP LOCKED
+) AS c, webhook_outbox AS e, webhooks AS w
+WHERE d.id = c.id
+  AND e.id = d.outbox_id
+  AND w.id = d.webhook_id
+RETURNING d.id, d.attempts, e.id AS event_id, e.event, e.user_id, e.payload, e.created_at AS occurred_at, w.url, w.secret;
+
+-- name: CreateWebhookAttempt :exec
+INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, duration_ms)
+VALUES ($1, $2, $3, $4);
+
+-- name: FinishWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET state = 'done',
+    attempts = attempts + 1,
+    locked_by = NULL,
+    locked_until = NULL,
+    last_error = NULL,
+    updated_at = now()
+WHERE id = sqlc.arg(id)
+  AND locked_by = sqlc.arg(owner)
+  AND state = 'pending';
+
+-- name: FailWebhookDelivery :one
+UPDATE webhook_deliveries
+SET attempts = attempts + 1,
+    state = CASE WHEN attempts + 1 >= sqlc.arg(max_attempts)::int THEN 'dead' ELSE 'pending' END,
+    next_attempt_at = sqlc.arg(next_attempt_at),
+    last_error = sqlc.arg(last_error),
+    locked_by = NULL,
+    locked_until = NULL,
+    updated_at = now()
+WHERE id = sqlc.arg(id)
+  AND locked_by = sqlc.arg(owner)
+  AND state = 'pending'
+RETURNING state;
+
+-- name: ListWebhookAttempts :many
+SELECT a.id, a.delivery_id, d.outbox_id, e.event, d.state, a.status_code, a.error, a.duration_ms, a.created_at
+FROM webhook_delivery_attempts AS a
+JOIN webhook_deliveries AS d ON d.id = a.delivery_id
+JOIN webhook_outbox AS e ON e.id = d.outbox_id
+WHERE d.webhook_id = sqlc.arg(webhook_id)
+ORDER BY a.id DESC
+LIMIT sqlc.arg('limit');
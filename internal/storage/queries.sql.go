@@ -8,9 +8,276 @@ package storage
 import (
 	"context"
 
+	"github.com/AlenaMolokova/diploma/internal/money"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const abandonWebhookDeliveries = `-- name: AbandonWebhookDeliveries :exec
+UPDATE webhook_deliveries
+SET state = 'dead',
+    last_error = 'webhook deleted',
+    locked_by = NULL,
+    locked_until = NULL,
+    updated_at = now()
+WHERE webhook_id = $1
+  AND state = 'pending'
+`
+
+func (q *Queries) AbandonWebhookDeliveries(ctx context.Context, webhookID int64) error {
+	_, err := q.db.Exec(ctx, abandonWebhookDeliveries, webhookID)
+	return err
+}
+
+const claimAccrualJobs = `-- name: ClaimAccrualJobs :many
+UPDATE accrual_jobs AS j
+SET locked_by = $1,
+    locked_until = now() + $2::int * interval '1 second',
+    updated_at = now()
+FROM (
+    SELECT order_number
+    FROM accrual_jobs
+    WHERE state = 'pending'
+      AND next_attempt_at <= now()
+      AND (locked_until IS NULL OR locked_until < now())
+    ORDER BY next_attempt_at
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+) AS c, orders AS o
+WHERE j.order_number = c.order_number
+  AND o.number = j.order_number
+RETURNING j.order_number, o.user_id, j.attempts, j.not_found, j.trace_parent
+`
+
+type ClaimAccrualJobsParams struct {
+	Owner        pgtype.Text `json:"owner"`
+	LeaseSeconds int32       `json:"lease_seconds"`
+	Limit        int32       `json:"limit"`
+}
+
+type ClaimAccrualJobsRow struct {
+	OrderNumber string      `json:"order_number"`
+	UserID      pgtype.Int8 `json:"user_id"`
+	Attempts    int32       `json:"attempts"`
+	NotFound    int32       `json:"not_found"`
+	TraceParent pgtype.Text `json:"trace_parent"`
+}
+
+func (q *Queries) ClaimAccrualJobs(ctx context.Context, arg ClaimAccrualJobsParams) ([]ClaimAccrualJobsRow, error) {
+	rows, err := q.db.Query(ctx, claimAccrualJobs, arg.Owner, arg.LeaseSeconds, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClaimAccrualJobsRow
+	for rows.Next() {
+		var i ClaimAccrualJobsRow
+		if err := rows.Scan(
+			&i.OrderNumber,
+			&i.UserID,
+			&i.Attempts,
+			&i.NotFound,
+			&i.TraceParent,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimWebhookDeliveries = `-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries AS d
+SET locked_by = $1,
+    locked_until = now() + $2::int * interval '1 second',
+    updated_at = now()
+FROM (
+    SELECT id
+    FROM webhook_deliveries
+    WHERE state = 'pending'
+      AND next_attempt_at <= now()
+      AND (locked_until IS NULL OR locked_until < now())
+    ORDER BY next_attempt_at
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+) AS c, webhook_outbox AS e, webhooks AS w
+WHERE d.id = c.id
+  AND e.id = d.outbox_id
+  AND w.id = d.webhook_id
+RETURNING d.id, d.attempts, e.id AS event_id, e.event, e.user_id, e.payload, e.created_at AS occurred_at, w.url, w.secret
+`
+
+type ClaimWebhookDeliveriesParams struct {
+	Owner        pgtype.Text `json:"owner"`
+	LeaseSeconds int32       `json:"lease_seconds"`
+	Limit        int32       `json:"limit"`
+}
+
+type ClaimWebhookDeliveriesRow struct {
+	ID         int64              `json:"id"`
+	Attempts   int32              `json:"attempts"`
+	EventID    int64              `json:"event_id"`
+	Event      string             `json:"event"`
+	UserID     int64              `json:"user_id"`
+	Payload    []byte             `json:"payload"`
+	OccurredAt pgtype.Timestamptz `json:"occurred_at"`
+	Url        string             `json:"url"`
+	Secret     string             `json:"secret"`
+}
+
+func (q *Queries) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]ClaimWebhookDeliveriesRow, error) {
+	rows, err := q.db.Query(ctx, claimWebhookDeliveries, arg.Owner, arg.LeaseSeconds, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClaimWebhookDeliveriesRow
+	for rows.Next() {
+		var i ClaimWebhookDeliveriesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Attempts,
+			&i.EventID,
+			&i.Event,
+			&i.UserID,
+			&i.Payload,
+			&i.OccurredAt,
+			&i.Url,
+			&i.Secret,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countPendingAccrualJobs = `-- name: CountPendingAccrualJobs :many
+SELECT o.status, count(*) AS jobs
+FROM accrual_jobs AS j
+JOIN orders AS o ON o.number = j.order_number
+WHERE j.state = 'pending'
+GROUP BY o.status
+`
+
+type CountPendingAccrualJobsRow struct {
+	Status string `json:"status"`
+	Jobs   int64  `json:"jobs"`
+}
+
+func (q *Queries) CountPendingAccrualJobs(ctx context.Context) ([]CountPendingAccrualJobsRow, error) {
+	rows, err := q.db.Query(ctx, countPendingAccrualJobs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountPendingAccrualJobsRow
+	for rows.Next() {
+		var i CountPendingAccrualJobsRow
+		if err := rows.Scan(&i.Status, &i.Jobs); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countUserWebhooks = `-- name: CountUserWebhooks :one
+SELECT count(*)
+FROM webhooks
+WHERE user_id = $1
+  AND deleted_at IS NULL
+`
+
+func (q *Queries) CountUserWebhooks(ctx context.Context, userID pgtype.Int8) (int64, error) {
+	row := q.db.QueryRow(ctx, countUserWebhooks, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createAccrualEntry = `-- name: CreateAccrualEntry :execrows
+INSERT INTO ledger_entries (user_id, kind, amount, order_number)
+VALUES ($1, 'accrual', $2, $3)
+ON CONFLICT (order_number) WHERE kind = 'accrual' DO NOTHING
+`
+
+type CreateAccrualEntryParams struct {
+	UserID      int64        `json:"user_id"`
+	Amount      money.Amount `json:"amount"`
+	OrderNumber pgtype.Text  `json:"order_number"`
+}
+
+func (q *Queries) CreateAccrualEntry(ctx context.Context, arg CreateAccrualEntryParams) (int64, error) {
+	result, err := q.db.Exec(ctx, createAccrualEntry, arg.UserID, arg.Amount, arg.OrderNumber)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const createAuditEntry = `-- name: CreateAuditEntry :exec
+INSERT INTO audit_log (actor_id, action, target_user_id, order_number, details, source_ip, balance_before, balance_after)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+`
+
+type CreateAuditEntryParams struct {
+	ActorID       pgtype.Int8    `json:"actor_id"`
+	Action        string         `json:"action"`
+	TargetUserID  pgtype.Int8    `json:"target_user_id"`
+	OrderNumber   pgtype.Text    `json:"order_number"`
+	Details       []byte         `json:"details"`
+	SourceIp      pgtype.Text    `json:"source_ip"`
+	BalanceBefore pgtype.Numeric `json:"balance_before"`
+	BalanceAfter  pgtype.Numeric `json:"balance_after"`
+}
+
+func (q *Queries) CreateAuditEntry(ctx context.Context, arg CreateAuditEntryParams) error {
+	_, err := q.db.Exec(ctx, createAuditEntry,
+		arg.ActorID,
+		arg.Action,
+		arg.TargetUserID,
+		arg.OrderNumber,
+		arg.Details,
+		arg.SourceIp,
+		arg.BalanceBefore,
+		arg.BalanceAfter,
+	)
+	return err
+}
+
+const createLedgerEntry = `-- name: CreateLedgerEntry :exec
+INSERT INTO ledger_entries (user_id, kind, amount, order_number, withdrawal_id)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+type CreateLedgerEntryParams struct {
+	UserID       int64        `json:"user_id"`
+	Kind         string       `json:"kind"`
+	Amount       money.Amount `json:"amount"`
+	OrderNumber  pgtype.Text  `json:"order_number"`
+	WithdrawalID pgtype.Int8  `json:"withdrawal_id"`
+}
+
+func (q *Queries) CreateLedgerEntry(ctx context.Context, arg CreateLedgerEntryParams) error {
+	_, err := q.db.Exec(ctx, createLedgerEntry,
+		arg.UserID,
+		arg.Kind,
+		arg.Amount,
+		arg.OrderNumber,
+		arg.WithdrawalID,
+	)
+	return err
+}
+
 const createOrder = `-- name: CreateOrder :exec
 INSERT INTO orders (user_id, number, status, accrual, uploaded_at)
 VALUES ($1, $2, $3, $4, $5)
@@ -20,7 +287,7 @@ type CreateOrderParams struct {
 	UserID     pgtype.Int8        `json:"user_id"`
 	Number     string             `json:"number"`
 	Status     string             `json:"status"`
-	Accrual    pgtype.Float8      `json:"accrual"`
+	Accrual    money.Amount       `json:"accrual"`
 	UploadedAt pgtype.Timestamptz `json:"uploaded_at"`
 }
 
@@ -35,68 +302,891 @@ func (q *Queries) CreateOrder(ctx context.Context, arg CreateOrderParams) error
 	return err
 }
 
-const createUser = `-- name: CreateUser :one
-INSERT INTO users (login, password)
-VALUES ($1, $2)
-RETURNING id
+const createOrderAuditEntries = `-- name: CreateOrderAuditEntries :exec
+INSERT INTO audit_log (actor_id, action, target_user_id, order_number, details, source_ip)
+SELECT $1, $2, $3, unnest($4::text[]), '{}', $5
+`
+
+type CreateOrderAuditEntriesParams struct {
+	ActorID      pgtype.Int8 `json:"actor_id"`
+	Action       string      `json:"action"`
+	TargetUserID pgtype.Int8 `json:"target_user_id"`
+	OrderNumbers []string    `json:"order_numbers"`
+	SourceIp     pgtype.Text `json:"source_ip"`
+}
+
+func (q *Queries) CreateOrderAuditEntries(ctx context.Context, arg CreateOrderAuditEntriesParams) error {
+	_, err := q.db.Exec(ctx, createOrderAuditEntries,
+		arg.ActorID,
+		arg.Action,
+		arg.TargetUserID,
+		arg.OrderNumbers,
+		arg.SourceIp,
+	)
+	return err
+}
+
+const createOrderHistoryEntry = `-- name: CreateOrderHistoryEntry :exec
+INSERT INTO order_status_history (order_number, kind, from_status, status, outcome, accrual, error)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+`
+
+type CreateOrderHistoryEntryParams struct {
+	OrderNumber string         `json:"order_number"`
+	Kind        string         `json:"kind"`
+	FromStatus  pgtype.Text    `json:"from_status"`
+	Status      pgtype.Text    `json:"status"`
+	Outcome     pgtype.Text    `json:"outcome"`
+	Accrual     pgtype.Numeric `json:"accrual"`
+	Error       pgtype.Text    `json:"error"`
+}
+
+func (q *Queries) CreateOrderHistoryEntry(ctx context.Context, arg CreateOrderHistoryEntryParams) error {
+	_, err := q.db.Exec(ctx, createOrderHistoryEntry,
+		arg.OrderNumber,
+		arg.Kind,
+		arg.FromStatus,
+		arg.Status,
+		arg.Outcome,
+		arg.Accrual,
+		arg.Error,
+	)
+	return err
+}
+
+const createOrderStatusEntries = `-- name: CreateOrderStatusEntries :exec
+INSERT INTO order_status_history (order_number, kind, status)
+SELECT unnest($1::text[]), 'status_change', $2
+`
+
+type CreateOrderStatusEntriesParams struct {
+	OrderNumbers []string    `json:"order_numbers"`
+	Status       pgtype.Text `json:"status"`
+}
+
+func (q *Queries) CreateOrderStatusEntries(ctx context.Context, arg CreateOrderStatusEntriesParams) error {
+	_, err := q.db.Exec(ctx, createOrderStatusEntries, arg.OrderNumbers, arg.Status)
+	return err
+}
+
+const createOrders = `-- name: CreateOrders :many
+INSERT INTO orders (user_id, number, status, uploaded_at)
+SELECT $1, unnest($2::text[]), $3, $4
+ON CONFLICT (number) DO NOTHING
+RETURNING number
+`
+
+type CreateOrdersParams struct {
+	UserID     pgtype.Int8        `json:"user_id"`
+	Numbers    []string           `json:"numbers"`
+	Status     string             `json:"status"`
+	UploadedAt pgtype.Timestamptz `json:"uploaded_at"`
+}
+
+func (q *Queries) CreateOrders(ctx context.Context, arg CreateOrdersParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, createOrders,
+		arg.UserID,
+		arg.Numbers,
+		arg.Status,
+		arg.UploadedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var number string
+		if err := rows.Scan(&number); err != nil {
+			return nil, err
+		}
+		items = append(items, number)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createPasswordReset = `-- name: CreatePasswordReset :exec
+INSERT INTO password_resets (user_id, token_hash, expires_at)
+VALUES ($1, $2, $3)
+`
+
+type CreatePasswordResetParams struct {
+	UserID    int64              `json:"user_id"`
+	TokenHash string             `json:"token_hash"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreatePasswordReset(ctx context.Context, arg CreatePasswordResetParams) error {
+	_, err := q.db.Exec(ctx, createPasswordReset, arg.UserID, arg.TokenHash, arg.ExpiresAt)
+	return err
+}
+
+const createRefreshToken = `-- name: CreateRefreshToken :exec
+INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+VALUES ($1, $2, $3, $4)
+`
+
+type CreateRefreshTokenParams struct {
+	UserID    int64              `json:"user_id"`
+	FamilyID  string             `json:"family_id"`
+	TokenHash string             `json:"token_hash"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) error {
+	_, err := q.db.Exec(ctx, createRefreshToken,
+		arg.UserID,
+		arg.FamilyID,
+		arg.TokenHash,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createUser = `-- name: CreateUser :one
+INSERT INTO users (login, password)
+VALUES ($1, $2)
+RETURNING id
+`
+
+type CreateUserParams struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (int64, error) {
+	row := q.db.QueryRow(ctx, createUser, arg.Login, arg.Password)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createWebhook = `-- name: CreateWebhook :one
+INSERT INTO webhooks (user_id, url, secret, events, created_by)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, created_at
+`
+
+type CreateWebhookParams struct {
+	UserID    pgtype.Int8 `json:"user_id"`
+	Url       string      `json:"url"`
+	Secret    string      `json:"secret"`
+	Events    []string    `json:"events"`
+	CreatedBy int64       `json:"created_by"`
+}
+
+type CreateWebhookRow struct {
+	ID        int64              `json:"id"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+func (q *Queries) CreateWebhook(ctx context.Context, arg CreateWebhookParams) (CreateWebhookRow, error) {
+	row := q.db.QueryRow(ctx, createWebhook,
+		arg.UserID,
+		arg.Url,
+		arg.Secret,
+		arg.Events,
+		arg.CreatedBy,
+	)
+	var i CreateWebhookRow
+	err := row.Scan(&i.ID, &i.CreatedAt)
+	return i, err
+}
+
+const createWebhookAttempt = `-- name: CreateWebhookAttempt :exec
+INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, duration_ms)
+VALUES ($1, $2, $3, $4)
+`
+
+type CreateWebhookAttemptParams struct {
+	DeliveryID int64       `json:"delivery_id"`
+	StatusCode pgtype.Int4 `json:"status_code"`
+	Error      pgtype.Text `json:"error"`
+	DurationMs int32       `json:"duration_ms"`
+}
+
+func (q *Queries) CreateWebhookAttempt(ctx context.Context, arg CreateWebhookAttemptParams) error {
+	_, err := q.db.Exec(ctx, createWebhookAttempt,
+		arg.DeliveryID,
+		arg.StatusCode,
+		arg.Error,
+		arg.DurationMs,
+	)
+	return err
+}
+
+const createWebhookEvent = `-- name: CreateWebhookEvent :execrows
+WITH event AS (
+    INSERT INTO webhook_outbox (event, user_id, payload)
+    VALUES ($1, $2, $3)
+    RETURNING id
+)
+INSERT INTO webhook_deliveries (outbox_id, webhook_id)
+SELECT event.id, w.id
+FROM event, webhooks AS w
+WHERE w.deleted_at IS NULL
+  AND (w.user_id IS NULL OR w.user_id = $2)
+  AND $1 = ANY (w.events)
+`
+
+type CreateWebhookEventParams struct {
+	Event   string `json:"event"`
+	UserID  int64  `json:"user_id"`
+	Payload []byte `json:"payload"`
+}
+
+func (q *Queries) CreateWebhookEvent(ctx context.Context, arg CreateWebhookEventParams) (int64, error) {
+	result, err := q.db.Exec(ctx, createWebhookEvent, arg.Event, arg.UserID, arg.Payload)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const createWithdrawal = `-- name: CreateWithdrawal :one
+INSERT INTO withdrawals (user_id, order_number, sum, processed_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id
+`
+
+type CreateWithdrawalParams struct {
+	UserID      pgtype.Int8        `json:"user_id"`
+	OrderNumber string             `json:"order_number"`
+	Sum         money.Amount       `json:"sum"`
+	ProcessedAt pgtype.Timestamptz `json:"processed_at"`
+}
+
+func (q *Queries) CreateWithdrawal(ctx context.Context, arg CreateWithdrawalParams) (int64, error) {
+	row := q.db.QueryRow(ctx, createWithdrawal,
+		arg.UserID,
+		arg.OrderNumber,
+		arg.Sum,
+		arg.ProcessedAt,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const deleteWebhook = `-- name: DeleteWebhook :one
+UPDATE webhooks
+SET deleted_at = now()
+WHERE id = $1
+  AND user_id IS NOT DISTINCT FROM $2
+  AND deleted_at IS NULL
+RETURNING url
+`
+
+type DeleteWebhookParams struct {
+	ID     int64       `json:"id"`
+	UserID pgtype.Int8 `json:"user_id"`
+}
+
+func (q *Queries) DeleteWebhook(ctx context.Context, arg DeleteWebhookParams) (string, error) {
+	row := q.db.QueryRow(ctx, deleteWebhook, arg.ID, arg.UserID)
+	var url string
+	err := row.Scan(&url)
+	return url, err
+}
+
+const enqueueAccrualJob = `-- name: EnqueueAccrualJob :exec
+INSERT INTO accrual_jobs (order_number, trace_parent)
+VALUES ($1, $2)
+ON CONFLICT (order_number) DO NOTHING
+`
+
+type EnqueueAccrualJobParams struct {
+	OrderNumber string      `json:"order_number"`
+	TraceParent pgtype.Text `json:"trace_parent"`
+}
+
+func (q *Queries) EnqueueAccrualJob(ctx context.Context, arg EnqueueAccrualJobParams) error {
+	_, err := q.db.Exec(ctx, enqueueAccrualJob, arg.OrderNumber, arg.TraceParent)
+	return err
+}
+
+const enqueueAccrualJobs = `-- name: EnqueueAccrualJobs :exec
+INSERT INTO accrual_jobs (order_number, trace_parent)
+SELECT unnest($1::text[]), $2
+ON CONFLICT (order_number) DO NOTHING
+`
+
+type EnqueueAccrualJobsParams struct {
+	OrderNumbers []string    `json:"order_numbers"`
+	TraceParent  pgtype.Text `json:"trace_parent"`
+}
+
+func (q *Queries) EnqueueAccrualJobs(ctx context.Context, arg EnqueueAccrualJobsParams) error {
+	_, err := q.db.Exec(ctx, enqueueAccrualJobs, arg.OrderNumbers, arg.TraceParent)
+	return err
+}
+
+const expirePasswordResets = `-- name: ExpirePasswordResets :exec
+UPDATE password_resets
+SET used_at = now()
+WHERE user_id = $1
+  AND used_at IS NULL
+`
+
+func (q *Queries) ExpirePasswordResets(ctx context.Context, userID int64) error {
+	_, err := q.db.Exec(ctx, expirePasswordResets, userID)
+	return err
+}
+
+const failAccrualJob = `-- name: FailAccrualJob :one
+UPDATE accrual_jobs
+SET attempts = attempts + 1,
+    not_found = CASE WHEN $1::boolean THEN not_found + 1 ELSE 0 END,
+    state = CASE
+        WHEN attempts + 1 >= $2::int THEN 'dead'
+        WHEN $1::boolean AND not_found + 1 >= $3::int THEN 'dead'
+        ELSE 'pending'
+    END,
+    next_attempt_at = $4,
+    last_error = $5,
+    locked_by = NULL,
+    locked_until = NULL,
+    updated_at = now()
+WHERE order_number = $6
+  AND locked_by = $7
+  AND state = 'pending'
+RETURNING state
+`
+
+type FailAccrualJobParams struct {
+	NotFound      bool               `json:"not_found"`
+	MaxAttempts   int32              `json:"max_attempts"`
+	MaxNotFound   int32              `json:"max_not_found"`
+	NextAttemptAt pgtype.Timestamptz `json:"next_attempt_at"`
+	LastError     pgtype.Text        `json:"last_error"`
+	OrderNumber   string             `json:"order_number"`
+	Owner         pgtype.Text        `json:"owner"`
+}
+
+func (q *Queries) FailAccrualJob(ctx context.Context, arg FailAccrualJobParams) (string, error) {
+	row := q.db.QueryRow(ctx, failAccrualJob,
+		arg.NotFound,
+		arg.MaxAttempts,
+		arg.MaxNotFound,
+		arg.NextAttemptAt,
+		arg.LastError,
+		arg.OrderNumber,
+		arg.Owner,
+	)
+	var state string
+	err := row.Scan(&state)
+	return state, err
+}
+
+const failWebhookDelivery = `-- name: FailWebhookDelivery :one
+UPDATE webhook_deliveries
+SET attempts = attempts + 1,
+    state = CASE WHEN attempts + 1 >= $1::int THEN 'dead' ELSE 'pending' END,
+    next_attempt_at = $2,
+    last_error = $3,
+    locked_by = NULL,
+    locked_until = NULL,
+    updated_at = now()
+WHERE id = $4
+  AND locked_by = $5
+  AND state = 'pending'
+RETURNING state
+`
+
+type FailWebhookDeliveryParams struct {
+	MaxAttempts   int32              `json:"max_attempts"`
+	NextAttemptAt pgtype.Timestamptz `json:"next_attempt_at"`
+	LastError     pgtype.Text        `json:"last_error"`
+	ID            int64              `json:"id"`
+	Owner         pgtype.Text        `json:"owner"`
+}
+
+func (q *Queries) FailWebhookDelivery(ctx context.Context, arg FailWebhookDeliveryParams) (string, error) {
+	row := q.db.QueryRow(ctx, failWebhookDelivery,
+		arg.MaxAttempts,
+		arg.NextAttemptAt,
+		arg.LastError,
+		arg.ID,
+		arg.Owner,
+	)
+	var state string
+	err := row.Scan(&state)
+	return state, err
+}
+
+const finishAccrualJob = `-- name: FinishAccrualJob :exec
+UPDATE accrual_jobs
+SET state = 'done',
+    locked_by = NULL,
+    locked_until = NULL,
+    last_error = NULL,
+    updated_at = now()
+WHERE order_number = $1
+`
+
+func (q *Queries) FinishAccrualJob(ctx context.Context, orderNumber string) error {
+	_, err := q.db.Exec(ctx, finishAccrualJob, orderNumber)
+	return err
+}
+
+const finishWebhookDelivery = `-- name: FinishWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET state = 'done',
+    attempts = attempts + 1,
+    locked_by = NULL,
+    locked_until = NULL,
+    last_error = NULL,
+    updated_at = now()
+WHERE id = $1
+  AND locked_by = $2
+  AND state = 'pending'
+`
+
+type FinishWebhookDeliveryParams struct {
+	ID    int64       `json:"id"`
+	Owner pgtype.Text `json:"owner"`
+}
+
+func (q *Queries) FinishWebhookDelivery(ctx context.Context, arg FinishWebhookDeliveryParams) error {
+	_, err := q.db.Exec(ctx, finishWebhookDelivery, arg.ID, arg.Owner)
+	return err
+}
+
+const getAccrualJob = `-- name: GetAccrualJob :one
+SELECT order_number, state, attempts, not_found, next_attempt_at, locked_by, locked_until, last_error, updated_at, trace_parent
+FROM accrual_jobs
+WHERE order_number = $1
+`
+
+func (q *Queries) GetAccrualJob(ctx context.Context, orderNumber string) (AccrualJob, error) {
+	row := q.db.QueryRow(ctx, getAccrualJob, orderNumber)
+	var i AccrualJob
+	err := row.Scan(
+		&i.OrderNumber,
+		&i.State,
+		&i.Attempts,
+		&i.NotFound,
+		&i.NextAttemptAt,
+		&i.LockedBy,
+		&i.LockedUntil,
+		&i.LastError,
+		&i.UpdatedAt,
+		&i.TraceParent,
+	)
+	return i, err
+}
+
+const getLoginLockout = `-- name: GetLoginLockout :one
+SELECT MAX(locked_until)::timestamptz AS locked_until
+FROM login_attempts
+WHERE subject = ANY($1::text[])
+  AND locked_until > $2
+`
+
+type GetLoginLockoutParams struct {
+	Subjects []string           `json:"subjects"`
+	Now      pgtype.Timestamptz `json:"now"`
+}
+
+func (q *Queries) GetLoginLockout(ctx context.Context, arg GetLoginLockoutParams) (pgtype.Timestamptz, error) {
+	row := q.db.QueryRow(ctx, getLoginLockout, arg.Subjects, arg.Now)
+	var locked_until pgtype.Timestamptz
+	err := row.Scan(&locked_until)
+	return locked_until, err
+}
+
+const getOrderByNumber = `-- name: GetOrderByNumber :one
+SELECT id, user_id, number, status, accrual, uploaded_at
+FROM orders
+WHERE number = $1
+`
+
+func (q *Queries) GetOrderByNumber(ctx context.Context, number string) (Order, error) {
+	row := q.db.QueryRow(ctx, getOrderByNumber, number)
+	var i Order
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Number,
+		&i.Status,
+		&i.Accrual,
+		&i.UploadedAt,
+	)
+	return i, err
+}
+
+const getOrderByNumberForUpdate = `-- name: GetOrderByNumberForUpdate :one
+SELECT id, user_id, number, status, accrual, uploaded_at
+FROM orders
+WHERE number = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetOrderByNumberForUpdate(ctx context.Context, number string) (Order, error) {
+	row := q.db.QueryRow(ctx, getOrderByNumberForUpdate, number)
+	var i Order
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Number,
+		&i.Status,
+		&i.Accrual,
+		&i.UploadedAt,
+	)
+	return i, err
+}
+
+const getOrdersByNumbers = `-- name: GetOrdersByNumbers :many
+SELECT id, user_id, number, status, accrual, uploaded_at
+FROM orders
+WHERE number = ANY($1::text[])
+`
+
+func (q *Queries) GetOrdersByNumbers(ctx context.Context, numbers []string) ([]Order, error) {
+	rows, err := q.db.Query(ctx, getOrdersByNumbers, numbers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Order
+	for rows.Next() {
+		var i Order
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Number,
+			&i.Status,
+			&i.Accrual,
+			&i.UploadedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOrdersByUser = `-- name: GetOrdersByUser :many
+SELECT number, status, accrual, uploaded_at
+FROM orders
+WHERE user_id = $1
+ORDER BY uploaded_at DESC
+`
+
+type GetOrdersByUserRow struct {
+	Number     string             `json:"number"`
+	Status     string             `json:"status"`
+	Accrual    money.Amount       `json:"accrual"`
+	UploadedAt pgtype.Timestamptz `json:"uploaded_at"`
+}
+
+func (q *Queries) GetOrdersByUser(ctx context.Context, userID pgtype.Int8) ([]GetOrdersByUserRow, error) {
+	rows, err := q.db.Query(ctx, getOrdersByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetOrdersByUserRow
+	for rows.Next() {
+		var i GetOrdersByUserRow
+		if err := rows.Scan(
+			&i.Number,
+			&i.Status,
+			&i.Accrual,
+			&i.UploadedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPasswordReset = `-- name: GetPasswordReset :one
+SELECT u.id, u.login
+FROM password_resets pr
+JOIN users u ON u.id = pr.user_id
+WHERE pr.token_hash = $1
+  AND pr.used_at IS NULL
+  AND pr.expires_at > $2
+`
+
+type GetPasswordResetParams struct {
+	TokenHash string             `json:"token_hash"`
+	Now       pgtype.Timestamptz `json:"now"`
+}
+
+type GetPasswordResetRow struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+}
+
+func (q *Queries) GetPasswordReset(ctx context.Context, arg GetPasswordResetParams) (GetPasswordResetRow, error) {
+	row := q.db.QueryRow(ctx, getPasswordReset, arg.TokenHash, arg.Now)
+	var i GetPasswordResetRow
+	err := row.Scan(&i.ID, &i.Login)
+	return i, err
+}
+
+const getRefreshTokenForUpdate = `-- name: GetRefreshTokenForUpdate :one
+SELECT id, user_id, family_id, token_hash, expires_at, used_at, revoked_at, created_at
+FROM refresh_tokens
+WHERE token_hash = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetRefreshTokenForUpdate(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRow(ctx, getRefreshTokenForUpdate, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.FamilyID,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.RevokedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getUserBalance = `-- name: GetUserBalance :one
+SELECT COALESCE(SUM(amount), 0)::numeric AS current,
+       COALESCE(-SUM(amount) FILTER (WHERE kind = 'withdrawal'), 0)::numeric AS withdrawn
+FROM ledger_entries
+WHERE user_id = $1
+`
+
+type GetUserBalanceRow struct {
+	Current   money.Amount `json:"current"`
+	Withdrawn money.Amount `json:"withdrawn"`
+}
+
+func (q *Queries) GetUserBalance(ctx context.Context, userID int64) (GetUserBalanceRow, error) {
+	row := q.db.QueryRow(ctx, getUserBalance, userID)
+	var i GetUserBalanceRow
+	err := row.Scan(&i.Current, &i.Withdrawn)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, login, password, role
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id int64) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Login,
+		&i.Password,
+		&i.Role,
+	)
+	return i, err
+}
+
+const getUserByLogin = `-- name: GetUserByLogin :one
+SELECT id, login, password, role
+FROM users
+WHERE login = $1
+`
+
+func (q *Queries) GetUserByLogin(ctx context.Context, login string) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByLogin, login)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Login,
+		&i.Password,
+		&i.Role,
+	)
+	return i, err
+}
+
+const getWebhook = `-- name: GetWebhook :one
+SELECT id, user_id, url, secret, events, created_by, created_at, deleted_at
+FROM webhooks
+WHERE id = $1
+  AND user_id IS NOT DISTINCT FROM $2
+  AND deleted_at IS NULL
+`
+
+type GetWebhookParams struct {
+	ID     int64       `json:"id"`
+	UserID pgtype.Int8 `json:"user_id"`
+}
+
+func (q *Queries) GetWebhook(ctx context.Context, arg GetWebhookParams) (Webhook, error) {
+	row := q.db.QueryRow(ctx, getWebhook, arg.ID, arg.UserID)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Url,
+		&i.Secret,
+		&i.Events,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getWithdrawalsByUser = `-- name: GetWithdrawalsByUser :many
+SELECT order_number, sum, processed_at
+FROM withdrawals
+WHERE user_id = $1
+ORDER BY processed_at DESC
+`
+
+type GetWithdrawalsByUserRow struct {
+	OrderNumber string             `json:"order_number"`
+	Sum         money.Amount       `json:"sum"`
+	ProcessedAt pgtype.Timestamptz `json:"processed_at"`
+}
+
+func (q *Queries) GetWithdrawalsByUser(ctx context.Context, userID pgtype.Int8) ([]GetWithdrawalsByUserRow, error) {
+	rows, err := q.db.Query(ctx, getWithdrawalsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetWithdrawalsByUserRow
+	for rows.Next() {
+		var i GetWithdrawalsByUserRow
+		if err := rows.Scan(&i.OrderNumber, &i.Sum, &i.ProcessedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const isTokenRevoked = `-- name: IsTokenRevoked :one
+SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+    OR EXISTS (
+        SELECT 1
+        FROM refresh_tokens
+        WHERE family_id = $2
+          AND revoked_at IS NOT NULL
+    ) AS revoked
 `
 
-type CreateUserParams struct {
-	Login    string `json:"login"`
-	Password string `json:"password"`
+type IsTokenRevokedParams struct {
+	Jti      string `json:"jti"`
+	FamilyID string `json:"family_id"`
 }
 
-func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (int64, error) {
-	row := q.db.QueryRow(ctx, createUser, arg.Login, arg.Password)
-	var id int64
-	err := row.Scan(&id)
-	return id, err
+func (q *Queries) IsTokenRevoked(ctx context.Context, arg IsTokenRevokedParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isTokenRevoked, arg.Jti, arg.FamilyID)
+	var revoked bool
+	err := row.Scan(&revoked)
+	return revoked, err
 }
 
-const createWithdrawal = `-- name: CreateWithdrawal :exec
-INSERT INTO withdrawals (user_id, order_number, sum, processed_at)
-VALUES ($1, $2, $3, $4)
+const listAuditEntries = `-- name: ListAuditEntries :many
+SELECT id, actor_id, action, target_user_id, order_number, details, created_at, source_ip, balance_before, balance_after
+FROM audit_log
+WHERE ($1::bigint IS NULL OR actor_id = $1 OR target_user_id = $1)
+  AND ($2::text IS NULL OR action = $2)
+  AND ($3::text IS NULL OR order_number = $3)
+  AND ($4::timestamptz IS NULL OR created_at >= $4)
+  AND ($5::timestamptz IS NULL OR created_at < $5)
+  AND ($6::bigint IS NULL OR id < $6)
+ORDER BY id DESC
+LIMIT $7
 `
 
-type CreateWithdrawalParams struct {
+type ListAuditEntriesParams struct {
 	UserID      pgtype.Int8        `json:"user_id"`
-	OrderNumber string             `json:"order_number"`
-	Sum         float64            `json:"sum"`
-	ProcessedAt pgtype.Timestamptz `json:"processed_at"`
+	Action      pgtype.Text        `json:"action"`
+	OrderNumber pgtype.Text        `json:"order_number"`
+	Since       pgtype.Timestamptz `json:"since"`
+	Until       pgtype.Timestamptz `json:"until"`
+	BeforeID    pgtype.Int8        `json:"before_id"`
+	Limit       int32              `json:"limit"`
 }
 
-func (q *Queries) CreateWithdrawal(ctx context.Context, arg CreateWithdrawalParams) error {
-	_, err := q.db.Exec(ctx, createWithdrawal,
+func (q *Queries) ListAuditEntries(ctx context.Context, arg ListAuditEntriesParams) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx, listAuditEntries,
 		arg.UserID,
+		arg.Action,
 		arg.OrderNumber,
-		arg.Sum,
-		arg.ProcessedAt,
+		arg.Since,
+		arg.Until,
+		arg.BeforeID,
+		arg.Limit,
 	)
-	return err
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditLog
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.ActorID,
+			&i.Action,
+			&i.TargetUserID,
+			&i.OrderNumber,
+			&i.Details,
+			&i.CreatedAt,
+			&i.SourceIp,
+			&i.BalanceBefore,
+			&i.BalanceAfter,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const getAllOrders = `-- name: GetAllOrders :many
-SELECT id, user_id, number, status, accrual, uploaded_at
-FROM orders
-ORDER BY uploaded_at DESC
+const listOrderHistory = `-- name: ListOrderHistory :many
+SELECT id, order_number, kind, from_status, status, outcome, accrual, error, created_at
+FROM order_status_history
+WHERE order_number = $1
+ORDER BY id
 `
 
-func (q *Queries) GetAllOrders(ctx context.Context) ([]Order, error) {
-	rows, err := q.db.Query(ctx, getAllOrders)
+func (q *Queries) ListOrderHistory(ctx context.Context, orderNumber string) ([]OrderStatusHistory, error) {
+	rows, err := q.db.Query(ctx, listOrderHistory, orderNumber)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Order
+	var items []OrderStatusHistory
 	for rows.Next() {
-		var i Order
+		var i OrderStatusHistory
 		if err := rows.Scan(
 			&i.ID,
-			&i.UserID,
-			&i.Number,
+			&i.OrderNumber,
+			&i.Kind,
+			&i.FromStatus,
 			&i.Status,
+			&i.Outcome,
 			&i.Accrual,
-			&i.UploadedAt,
+			&i.Error,
+			&i.CreatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -108,50 +1198,61 @@ func (q *Queries) GetAllOrders(ctx context.Context) ([]Order, error) {
 	return items, nil
 }
 
-const getOrderByNumber = `-- name: GetOrderByNumber :one
-SELECT id, user_id, number, status, accrual, uploaded_at
+const listOrdersByUser = `-- name: ListOrdersByUser :many
+SELECT id, number, status, accrual, uploaded_at
 FROM orders
-WHERE number = $1
+WHERE user_id = $1
+  AND uploaded_at >= $2
+  AND uploaded_at < $3
+  AND (uploaded_at, id) < ($4::timestamptz, $5::bigint)
+  AND ($6::text[] IS NULL OR status = ANY($6::text[]))
+  AND ($7::numeric IS NULL OR accrual >= $7)
+  AND ($8::numeric IS NULL OR accrual <= $8)
+ORDER BY uploaded_at DESC, id DESC
+LIMIT $9
 `
 
-func (q *Queries) GetOrderByNumber(ctx context.Context, number string) (Order, error) {
-	row := q.db.QueryRow(ctx, getOrderByNumber, number)
-	var i Order
-	err := row.Scan(
-		&i.ID,
-		&i.UserID,
-		&i.Number,
-		&i.Status,
-		&i.Accrual,
-		&i.UploadedAt,
-	)
-	return i, err
+type ListOrdersByUserParams struct {
+	UserID     pgtype.Int8        `json:"user_id"`
+	Since      pgtype.Timestamptz `json:"since"`
+	Until      pgtype.Timestamptz `json:"until"`
+	BeforeAt   pgtype.Timestamptz `json:"before_at"`
+	BeforeID   int64              `json:"before_id"`
+	Statuses   []string           `json:"statuses"`
+	MinAccrual pgtype.Numeric     `json:"min_accrual"`
+	MaxAccrual pgtype.Numeric     `json:"max_accrual"`
+	Limit      pgtype.Int4        `json:"limit"`
 }
 
-const getOrdersByUser = `-- name: GetOrdersByUser :many
-SELECT number, status, accrual, uploaded_at
-FROM orders
-WHERE user_id = $1
-ORDER BY uploaded_at DESC
-`
-
-type GetOrdersByUserRow struct {
+type ListOrdersByUserRow struct {
+	ID         int64              `json:"id"`
 	Number     string             `json:"number"`
 	Status     string             `json:"status"`
-	Accrual    pgtype.Float8      `json:"accrual"`
+	Accrual    money.Amount       `json:"accrual"`
 	UploadedAt pgtype.Timestamptz `json:"uploaded_at"`
 }
 
-func (q *Queries) GetOrdersByUser(ctx context.Context, userID pgtype.Int8) ([]GetOrdersByUserRow, error) {
-	rows, err := q.db.Query(ctx, getOrdersByUser, userID)
+func (q *Queries) ListOrdersByUser(ctx context.Context, arg ListOrdersByUserParams) ([]ListOrdersByUserRow, error) {
+	rows, err := q.db.Query(ctx, listOrdersByUser,
+		arg.UserID,
+		arg.Since,
+		arg.Until,
+		arg.BeforeAt,
+		arg.BeforeID,
+		arg.Statuses,
+		arg.MinAccrual,
+		arg.MaxAccrual,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetOrdersByUserRow
+	var items []ListOrdersByUserRow
 	for rows.Next() {
-		var i GetOrdersByUserRow
+		var i ListOrdersByUserRow
 		if err := rows.Scan(
+			&i.ID,
 			&i.Number,
 			&i.Status,
 			&i.Accrual,
@@ -167,67 +1268,220 @@ func (q *Queries) GetOrdersByUser(ctx context.Context, userID pgtype.Int8) ([]Ge
 	return items, nil
 }
 
-const getUserBalance = `-- name: GetUserBalance :one
-SELECT balance, withdrawn
-FROM users
-WHERE id = $1
-FOR UPDATE
+const listUserAuditEntries = `-- name: ListUserAuditEntries :many
+SELECT id, actor_id, action, target_user_id, order_number, details, created_at, source_ip, balance_before, balance_after
+FROM audit_log
+WHERE (actor_id = $1
+    OR (target_user_id = $1 AND (actor_id IS NULL OR action = ANY($2::text[]))))
+  AND ($3::text IS NULL OR action = $3)
+  AND ($4::text IS NULL OR order_number = $4)
+  AND ($5::timestamptz IS NULL OR created_at >= $5)
+  AND ($6::timestamptz IS NULL OR created_at < $6)
+  AND ($7::bigint IS NULL OR id < $7)
+ORDER BY id DESC
+LIMIT $8
 `
 
-type GetUserBalanceRow struct {
-	Balance   pgtype.Float8 `json:"balance"`
-	Withdrawn pgtype.Float8 `json:"withdrawn"`
+type ListUserAuditEntriesParams struct {
+	UserID       pgtype.Int8        `json:"user_id"`
+	AdminActions []string           `json:"admin_actions"`
+	Action       pgtype.Text        `json:"action"`
+	OrderNumber  pgtype.Text        `json:"order_number"`
+	Since        pgtype.Timestamptz `json:"since"`
+	Until        pgtype.Timestamptz `json:"until"`
+	BeforeID     pgtype.Int8        `json:"before_id"`
+	Limit        int32              `json:"limit"`
 }
 
-func (q *Queries) GetUserBalance(ctx context.Context, id int64) (GetUserBalanceRow, error) {
-	row := q.db.QueryRow(ctx, getUserBalance, id)
-	var i GetUserBalanceRow
-	err := row.Scan(&i.Balance, &i.Withdrawn)
-	return i, err
+func (q *Queries) ListUserAuditEntries(ctx context.Context, arg ListUserAuditEntriesParams) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx, listUserAuditEntries,
+		arg.UserID,
+		arg.AdminActions,
+		arg.Action,
+		arg.OrderNumber,
+		arg.Since,
+		arg.Until,
+		arg.BeforeID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditLog
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.ActorID,
+			&i.Action,
+			&i.TargetUserID,
+			&i.OrderNumber,
+			&i.Details,
+			&i.CreatedAt,
+			&i.SourceIp,
+			&i.BalanceBefore,
+			&i.BalanceAfter,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const getUserByLogin = `-- name: GetUserByLogin :one
-SELECT id, login, password, balance, withdrawn
-FROM users
-WHERE login = $1
+const listWebhookAttempts = `-- name: ListWebhookAttempts :many
+SELECT a.id, a.delivery_id, d.outbox_id, e.event, d.state, a.status_code, a.error, a.duration_ms, a.created_at
+FROM webhook_delivery_attempts AS a
+JOIN webhook_deliveries AS d ON d.id = a.delivery_id
+JOIN webhook_outbox AS e ON e.id = d.outbox_id
+WHERE d.webhook_id = $1
+ORDER BY a.id DESC
+LIMIT $2
 `
 
-func (q *Queries) GetUserByLogin(ctx context.Context, login string) (User, error) {
-	row := q.db.QueryRow(ctx, getUserByLogin, login)
-	var i User
-	err := row.Scan(
-		&i.ID,
-		&i.Login,
-		&i.Password,
-		&i.Balance,
-		&i.Withdrawn,
-	)
-	return i, err
+type ListWebhookAttemptsParams struct {
+	WebhookID int64 `json:"webhook_id"`
+	Limit     int32 `json:"limit"`
 }
 
-const getWithdrawalsByUser = `-- name: GetWithdrawalsByUser :many
-SELECT order_number, sum, processed_at
+type ListWebhookAttemptsRow struct {
+	ID         int64              `json:"id"`
+	DeliveryID int64              `json:"delivery_id"`
+	OutboxID   int64              `json:"outbox_id"`
+	Event      string             `json:"event"`
+	State      string             `json:"state"`
+	StatusCode pgtype.Int4        `json:"status_code"`
+	Error      pgtype.Text        `json:"error"`
+	DurationMs int32              `json:"duration_ms"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+}
+
+func (q *Queries) ListWebhookAttempts(ctx context.Context, arg ListWebhookAttemptsParams) ([]ListWebhookAttemptsRow, error) {
+	rows, err := q.db.Query(ctx, listWebhookAttempts, arg.WebhookID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListWebhookAttemptsRow
+	for rows.Next() {
+		var i ListWebhookAttemptsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.DeliveryID,
+			&i.OutboxID,
+			&i.Event,
+			&i.State,
+			&i.StatusCode,
+			&i.Error,
+			&i.DurationMs,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhooks = `-- name: ListWebhooks :many
+SELECT id, user_id, url, secret, events, created_by, created_at, deleted_at
+FROM webhooks
+WHERE user_id IS NOT DISTINCT FROM $1
+  AND deleted_at IS NULL
+ORDER BY id
+`
+
+func (q *Queries) ListWebhooks(ctx context.Context, userID pgtype.Int8) ([]Webhook, error) {
+	rows, err := q.db.Query(ctx, listWebhooks, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Webhook
+	for rows.Next() {
+		var i Webhook
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Url,
+			&i.Secret,
+			&i.Events,
+			&i.CreatedBy,
+			&i.CreatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWithdrawalsByUser = `-- name: ListWithdrawalsByUser :many
+SELECT id, order_number, sum, processed_at
 FROM withdrawals
 WHERE user_id = $1
-ORDER BY processed_at DESC
+  AND processed_at >= $2
+  AND processed_at < $3
+  AND (processed_at, id) < ($4::timestamptz, $5::bigint)
+  AND ($6::numeric IS NULL OR sum >= $6)
+  AND ($7::numeric IS NULL OR sum <= $7)
+ORDER BY processed_at DESC, id DESC
+LIMIT $8
 `
 
-type GetWithdrawalsByUserRow struct {
+type ListWithdrawalsByUserParams struct {
+	UserID   pgtype.Int8        `json:"user_id"`
+	Since    pgtype.Timestamptz `json:"since"`
+	Until    pgtype.Timestamptz `json:"until"`
+	BeforeAt pgtype.Timestamptz `json:"before_at"`
+	BeforeID int64              `json:"before_id"`
+	MinSum   pgtype.Numeric     `json:"min_sum"`
+	MaxSum   pgtype.Numeric     `json:"max_sum"`
+	Limit    pgtype.Int4        `json:"limit"`
+}
+
+type ListWithdrawalsByUserRow struct {
+	ID          int64              `json:"id"`
 	OrderNumber string             `json:"order_number"`
-	Sum         float64            `json:"sum"`
+	Sum         money.Amount       `json:"sum"`
 	ProcessedAt pgtype.Timestamptz `json:"processed_at"`
 }
 
-func (q *Queries) GetWithdrawalsByUser(ctx context.Context, userID pgtype.Int8) ([]GetWithdrawalsByUserRow, error) {
-	rows, err := q.db.Query(ctx, getWithdrawalsByUser, userID)
+func (q *Queries) ListWithdrawalsByUser(ctx context.Context, arg ListWithdrawalsByUserParams) ([]ListWithdrawalsByUserRow, error) {
+	rows, err := q.db.Query(ctx, listWithdrawalsByUser,
+		arg.UserID,
+		arg.Since,
+		arg.Until,
+		arg.BeforeAt,
+		arg.BeforeID,
+		arg.MinSum,
+		arg.MaxSum,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetWithdrawalsByUserRow
+	var items []ListWithdrawalsByUserRow
 	for rows.Next() {
-		var i GetWithdrawalsByUserRow
-		if err := rows.Scan(&i.OrderNumber, &i.Sum, &i.ProcessedAt); err != nil {
+		var i ListWithdrawalsByUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.OrderNumber,
+			&i.Sum,
+			&i.ProcessedAt,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -238,57 +1492,229 @@ func (q *Queries) GetWithdrawalsByUser(ctx context.Context, userID pgtype.Int8)
 	return items, nil
 }
 
-const updateBalance = `-- name: UpdateBalance :exec
-UPDATE users
-SET balance = $2
+const lockLoginSubject = `-- name: LockLoginSubject :exec
+UPDATE login_attempts
+SET locked_until = GREATEST(locked_until, $1)
+WHERE subject = $2
+`
+
+type LockLoginSubjectParams struct {
+	LockedUntil pgtype.Timestamptz `json:"locked_until"`
+	Subject     string             `json:"subject"`
+}
+
+func (q *Queries) LockLoginSubject(ctx context.Context, arg LockLoginSubjectParams) error {
+	_, err := q.db.Exec(ctx, lockLoginSubject, arg.LockedUntil, arg.Subject)
+	return err
+}
+
+const lockUser = `-- name: LockUser :one
+SELECT id
+FROM users
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) LockUser(ctx context.Context, id int64) (int64, error) {
+	row := q.db.QueryRow(ctx, lockUser, id)
+	err := row.Scan(&id)
+	return id, err
+}
+
+const markRefreshTokenUsed = `-- name: MarkRefreshTokenUsed :exec
+UPDATE refresh_tokens
+SET used_at = now()
 WHERE id = $1
 `
 
-type UpdateBalanceParams struct {
-	ID      int64         `json:"id"`
-	Balance pgtype.Float8 `json:"balance"`
+func (q *Queries) MarkRefreshTokenUsed(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, markRefreshTokenUsed, id)
+	return err
+}
+
+const notifyUserEvent = `-- name: NotifyUserEvent :exec
+SELECT pg_notify('user_events', $1::text)
+`
+
+func (q *Queries) NotifyUserEvent(ctx context.Context, payload string) error {
+	_, err := q.db.Exec(ctx, notifyUserEvent, payload)
+	return err
+}
+
+const pruneRefreshTokens = `-- name: PruneRefreshTokens :execrows
+DELETE FROM refresh_tokens
+WHERE expires_at < now()
+`
+
+func (q *Queries) PruneRefreshTokens(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, pruneRefreshTokens)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const pruneRevokedTokens = `-- name: PruneRevokedTokens :execrows
+DELETE FROM revoked_tokens
+WHERE expires_at < now()
+`
+
+func (q *Queries) PruneRevokedTokens(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, pruneRevokedTokens)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const recordLoginFailure = `-- name: RecordLoginFailure :one
+INSERT INTO login_attempts (subject, failures, updated_at)
+VALUES ($1, 1, $2)
+ON CONFLICT (subject) DO UPDATE
+SET failures = CASE
+        WHEN login_attempts.updated_at < $3 THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    updated_at = EXCLUDED.updated_at
+RETURNING failures
+`
+
+type RecordLoginFailureParams struct {
+	Subject     string             `json:"subject"`
+	Now         pgtype.Timestamptz `json:"now"`
+	WindowStart pgtype.Timestamptz `json:"window_start"`
+}
+
+func (q *Queries) RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (int32, error) {
+	row := q.db.QueryRow(ctx, recordLoginFailure, arg.Subject, arg.Now, arg.WindowStart)
+	var failures int32
+	err := row.Scan(&failures)
+	return failures, err
+}
+
+const rescheduleAccrualJob = `-- name: RescheduleAccrualJob :exec
+UPDATE accrual_jobs
+SET next_attempt_at = $1,
+    not_found = 0,
+    locked_by = NULL,
+    locked_until = NULL,
+    updated_at = now()
+WHERE order_number = $2
+  AND locked_by = $3
+  AND state = 'pending'
+`
+
+type RescheduleAccrualJobParams struct {
+	NextAttemptAt pgtype.Timestamptz `json:"next_attempt_at"`
+	OrderNumber   string             `json:"order_number"`
+	Owner         pgtype.Text        `json:"owner"`
+}
+
+func (q *Queries) RescheduleAccrualJob(ctx context.Context, arg RescheduleAccrualJobParams) error {
+	_, err := q.db.Exec(ctx, rescheduleAccrualJob, arg.NextAttemptAt, arg.OrderNumber, arg.Owner)
+	return err
+}
+
+const resetLoginFailures = `-- name: ResetLoginFailures :exec
+DELETE FROM login_attempts
+WHERE subject = $1
+`
+
+func (q *Queries) ResetLoginFailures(ctx context.Context, subject string) error {
+	_, err := q.db.Exec(ctx, resetLoginFailures, subject)
+	return err
+}
+
+const revokeAccessToken = `-- name: RevokeAccessToken :exec
+INSERT INTO revoked_tokens (jti, expires_at)
+VALUES ($1, $2)
+ON CONFLICT (jti) DO NOTHING
+`
+
+type RevokeAccessTokenParams struct {
+	Jti       string             `json:"jti"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) RevokeAccessToken(ctx context.Context, arg RevokeAccessTokenParams) error {
+	_, err := q.db.Exec(ctx, revokeAccessToken, arg.Jti, arg.ExpiresAt)
+	return err
+}
+
+const revokeTokenFamily = `-- name: RevokeTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = now()
+WHERE family_id = $1
+  AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	_, err := q.db.Exec(ctx, revokeTokenFamily, familyID)
+	return err
 }
 
-func (q *Queries) UpdateBalance(ctx context.Context, arg UpdateBalanceParams) error {
-	_, err := q.db.Exec(ctx, updateBalance, arg.ID, arg.Balance)
+const revokeUserTokens = `-- name: RevokeUserTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = now()
+WHERE user_id = $1
+  AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserTokens(ctx context.Context, userID int64) error {
+	_, err := q.db.Exec(ctx, revokeUserTokens, userID)
 	return err
 }
 
-const updateOrder = `-- name: UpdateOrder :exec
+const setOrderAccrual = `-- name: SetOrderAccrual :exec
 UPDATE orders
-SET status = $1, accrual = $2, uploaded_at = $3
-WHERE number = $4
+SET status = $2, accrual = $3
+WHERE number = $1
 `
 
-type UpdateOrderParams struct {
-	Status     string             `json:"status"`
-	Accrual    pgtype.Float8      `json:"accrual"`
-	UploadedAt pgtype.Timestamptz `json:"uploaded_at"`
-	Number     string             `json:"number"`
+type SetOrderAccrualParams struct {
+	Number  string       `json:"number"`
+	Status  string       `json:"status"`
+	Accrual money.Amount `json:"accrual"`
 }
 
-func (q *Queries) UpdateOrder(ctx context.Context, arg UpdateOrderParams) error {
-	_, err := q.db.Exec(ctx, updateOrder,
-		arg.Status,
-		arg.Accrual,
-		arg.UploadedAt,
-		arg.Number,
-	)
+func (q *Queries) SetOrderAccrual(ctx context.Context, arg SetOrderAccrualParams) error {
+	_, err := q.db.Exec(ctx, setOrderAccrual, arg.Number, arg.Status, arg.Accrual)
 	return err
 }
 
-const updateWithdrawn = `-- name: UpdateWithdrawn :exec
+const updateUserPassword = `-- name: UpdateUserPassword :exec
 UPDATE users
-SET withdrawn = $2
+SET password = $2
 WHERE id = $1
 `
 
-type UpdateWithdrawnParams struct {
-	ID        int64         `json:"id"`
-	Withdrawn pgtype.Float8 `json:"withdrawn"`
+type UpdateUserPasswordParams struct {
+	ID       int64  `json:"id"`
+	Password string `json:"password"`
 }
 
-func (q *Queries) UpdateWithdrawn(ctx context.Context, arg UpdateWithdrawnParams) error {
-	_, err := q.db.Exec(ctx, updateWithdrawn, arg.ID, arg.Withdrawn)
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.Exec(ctx, updateUserPassword, arg.ID, arg.Password)
 	return err
 }
+
+const usePasswordReset = `-- name: UsePasswordReset :one
+UPDATE password_resets
+SET used_at = now()
+WHERE token_hash = $1
+  AND used_at IS NULL
+  AND expires_at > $2
+RETURNING user_id
+`
+
+type UsePasswordResetParams struct {
+	TokenHash string             `json:"token_hash"`
+	Now       pgtype.Timestamptz `json:"now"`
+}
+
+func (q *Queries) UsePasswordReset(ctx context.Context, arg UsePasswordResetParams) (int64, error) {
+	row := q.db.QueryRow(ctx, usePasswordReset, arg.TokenHash, arg.Now)
+	var user_id int64
+	err := row.Scan(&user_id)
+	return user_id, err
+}
@@ -2,8 +2,7 @@ CREATE TABLE users (
     id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
     login TEXT NOT NULL UNIQUE,
     password TEXT NOT NULL,
-    balance DOUBLE PRECISION DEFAULT 0.0,
-    withdrawn DOUBLE PRECISION DEFAULT 0.0
+    role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin'))
 );
 
 CREATE TABLE orders (
@@ -11,14 +10,176 @@ CREATE TABLE orders (
     user_id BIGINT REFERENCES users(id),
     number TEXT NOT NULL UNIQUE,
     status TEXT NOT NULL,
-    accrual DOUBLE PRECISION,
+    accrual NUMERIC(14, 2) NOT NULL DEFAULT 0,
     uploaded_at TIMESTAMP WITH TIME ZONE NOT NULL
 );
 
+CREATE INDEX orders_user_id_uploaded_at_idx ON orders (user_id, uploaded_at, id);
+
 CREATE TABLE withdrawals (
     id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
     user_id BIGINT REFERENCES users(id),
     order_number TEXT NOT NULL,
-    sum DOUBLE PRECISION NOT NULL,
+    sum NUMERIC(14, 2) NOT NULL,
     processed_at TIMESTAMP WITH TIME ZONE NOT NULL
-);
\ No newline at end of file
+);
+
+CREATE INDEX withdrawals_user_id_processed_at_idx ON withdrawals (user_id, processed_at, id);
+
+CREATE TABLE ledger_entries (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    kind TEXT NOT NULL CHECK (kind IN ('opening', 'accrual', 'withdrawal', 'adjustment')),
+    amount NUMERIC(14, 2) NOT NULL,
+    order_number TEXT,
+    withdrawal_id BIGINT REFERENCES withdrawals(id),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ledger_entries_user_id_kind_idx ON ledger_entries (user_id, kind);
+
+CREATE UNIQUE INDEX ledger_entries_accrual_order_number_idx
+ON ledger_entries (order_number)
+WHERE kind = 'accrual';
+
+CREATE TABLE accrual_jobs (
+    order_number TEXT PRIMARY KEY REFERENCES orders(number),
+    state TEXT NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'done', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    not_found INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    locked_by TEXT,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    trace_parent TEXT
+);
+
+CREATE INDEX accrual_jobs_ready_idx
+ON accrual_jobs (next_attempt_at)
+WHERE state = 'pending';
+
+CREATE TABLE refresh_tokens (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    family_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+CREATE TABLE revoked_tokens (
+    jti TEXT PRIMARY KEY,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE TABLE login_attempts (
+    subject TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE TABLE password_resets (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX password_resets_user_id_idx ON password_resets (user_id);
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+CREATE TABLE audit_log (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    actor_id BIGINT REFERENCES users(id),
+    action TEXT NOT NULL,
+    target_user_id BIGINT REFERENCES users(id),
+    order_number TEXT,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    source_ip TEXT,
+    balance_before NUMERIC(14, 2),
+    balance_after NUMERIC(14, 2)
+);
+
+CREATE INDEX audit_log_target_user_id_idx ON audit_log (target_user_id, id);
+
+CREATE INDEX audit_log_actor_id_idx ON audit_log (actor_id, id);
+
+CREATE INDEX audit_log_order_number_idx ON audit_log (order_number, id)
+WHERE order_number IS NOT NULL;
+
+CREATE TABLE order_status_history (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    order_number TEXT NOT NULL REFERENCES orders(number),
+    kind TEXT NOT NULL CHECK (kind IN ('status_change', 'accrual_check')),
+    from_status TEXT,
+    status TEXT,
+    outcome TEXT,
+    accrual NUMERIC(14, 2),
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX order_status_history_order_number_idx ON order_status_history (order_number, id);
+
+CREATE TABLE webhooks (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT REFERENCES users(id),
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT[] NOT NULL,
+    created_by BIGINT NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX webhooks_user_id_idx ON webhooks (user_id)
+WHERE deleted_at IS NULL;
+
+CREATE TABLE webhook_outbox (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    event TEXT NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE TABLE webhook_deliveries (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    outbox_id BIGINT NOT NULL REFERENCES webhook_outbox(id),
+    webhook_id BIGINT NOT NULL REFERENCES webhooks(id),
+    state TEXT NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'done', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    locked_by TEXT,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    UNIQUE (outbox_id, webhook_id)
+);
+
+CREATE INDEX webhook_deliveries_ready_idx
+ON webhook_deliveries (next_attempt_at)
+WHERE state = 'pending';
+
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id);
+
+CREATE TABLE webhook_delivery_attempts (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    delivery_id BIGINT NOT NULL REFERENCES webhook_deliveries(id),
+    status_code INTEGER,
+    error TEXT,
+    duration_ms INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX webhook_delivery_attempts_delivery_id_idx ON webhook_delivery_attempts (delivery_id, id);
@@ -3,22 +3,37 @@ package storage
 import (
 	"context"
 	"errors"
+	"math"
+	"time"
 
+	"github.com/AlenaMolokova/diploma/internal/audit"
+	"github.com/AlenaMolokova/diploma/internal/constants"
 	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/AlenaMolokova/diploma/internal/tracing"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-const (
-	queryUpdateBalance = "UPDATE users SET balance = $2 WHERE id = $1"
-	queryUpdateWithdrawn = "UPDATE users SET withdrawn = $2 WHERE id = $1"
-	queryCreateOrder = "INSERT INTO orders (user_id, number, status, accrual, uploaded_at) VALUES ($1, $2, $3, $4, $5)"
-)
+// Observer is told about accruals and withdrawals once they are committed.
+type Observer interface {
+	OrderProcessed(uploadedAt time.Time)
+	PointsAccrued(amount money.Amount)
+	PointsWithdrawn(amount money.Amount)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) OrderProcessed(time.Time)     {}
+func (nopObserver) PointsAccrued(money.Amount)   {}
+func (nopObserver) PointsWithdrawn(money.Amount) {}
 
 type Storage struct {
-	db      *pgxpool.Pool
-	queries *Queries
+	db       *pgxpool.Pool
+	queries  *Queries
+	observer Observer
 }
 
 func NewStorage(db *pgxpool.Pool) (*Storage, error) {
@@ -26,13 +41,59 @@ func NewStorage(db *pgxpool.Pool) (*Storage, error) {
 		return nil, errors.New("database pool is nil")
 	}
 	queries := New(db)
-	return &Storage{db: db, queries: queries}, nil
+	return &Storage{db: db, queries: queries, observer: nopObserver{}}, nil
+}
+
+func (s *Storage) SetObserver(observer Observer) {
+	s.observer = observer
+}
+
+// Stat reports the connection pool statistics.
+func (s *Storage) Stat() *pgxpool.Stat {
+	return s.db.Stat()
+}
+
+// Ping checks that a connection to the database can be acquired and used.
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.Ping(ctx)
+}
+
+// SchemaVersion reads the migration version golang-migrate recorded, and
+// whether the migration to it failed halfway.
+func (s *Storage) SchemaVersion(ctx context.Context) (version uint, dirty bool, err error) {
+	err = s.db.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	return version, dirty, err
+}
+
+func (s *Storage) inTx(ctx context.Context, fn func(q *Queries) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(s.queries.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 func (s *Storage) CreateUser(ctx context.Context, login, password string) (int64, error) {
-	id, err := s.queries.CreateUser(ctx, CreateUserParams{
-		Login:    login,
-		Password: password,
+	var id int64
+	err := s.inTx(ctx, func(q *Queries) error {
+		var err error
+		id, err = q.CreateUser(ctx, CreateUserParams{
+			Login:    login,
+			Password: password,
+		})
+		if err != nil {
+			return err
+		}
+		return writeAudit(ctx, q, models.AuditEntry{
+			ActorID:      id,
+			Action:       constants.AuditUserRegister,
+			TargetUserID: id,
+		})
 	})
 	if err != nil {
 		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" {
@@ -45,44 +106,139 @@ func (s *Storage) CreateUser(ctx context.Context, login, password string) (int64
 
 func (s *Storage) GetUserByLogin(ctx context.Context, login string) (models.User, error) {
 	user, err := s.queries.GetUserByLogin(ctx, login)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.User{}, models.ErrUserNotFound
+	}
 	if err != nil {
 		return models.User{}, err
 	}
 	return models.User{
-		ID:        user.ID,
-		Login:     user.Login,
-		Password:  user.Password,
-		Balance:   user.Balance,
-		Withdrawn: user.Withdrawn,
+		ID:       user.ID,
+		Login:    user.Login,
+		Password: user.Password,
+		Role:     user.Role,
 	}, nil
 }
 
-func (s *Storage) GetBalance(ctx context.Context, userID int64) (pgtype.Float8, pgtype.Float8, error) {
+func (s *Storage) GetBalance(ctx context.Context, userID int64) (money.Amount, money.Amount, error) {
 	bal, err := s.queries.GetUserBalance(ctx, userID)
 	if err != nil {
-		return pgtype.Float8{}, pgtype.Float8{}, err
+		return 0, 0, err
 	}
-	return bal.Balance, bal.Withdrawn, nil
+	return bal.Current, bal.Withdrawn, nil
 }
 
-func (s *Storage) UpdateBalance(ctx context.Context, userID int64, amount float64) error {
-	_, err := s.db.Exec(ctx, queryUpdateBalance, userID, amount)
-	return err
+// CreateOrder stores the order together with its accrual job, so the poller
+// picks up every order that has not reached a final status. The job keeps the
+// trace context of the upload, so the poller's checks can be linked to it. The
+// upload is also the first entry of the order's status history.
+func (s *Storage) CreateOrder(ctx context.Context, order models.Order) error {
+	return s.inTx(ctx, func(q *Queries) error {
+		if err := q.CreateOrder(ctx, CreateOrderParams{
+			UserID:     pgtype.Int8{Int64: order.UserID, Valid: true},
+			Number:     order.Number,
+			Status:     order.Status,
+			Accrual:    order.Accrual,
+			UploadedAt: order.UploadedAt,
+		}); err != nil {
+			return err
+		}
+		if err := writeAudit(ctx, q, models.AuditEntry{
+			ActorID:      order.UserID,
+			Action:       constants.AuditOrderUpload,
+			TargetUserID: order.UserID,
+			OrderNumber:  order.Number,
+		}); err != nil {
+			return err
+		}
+		if err := writeStatusChange(ctx, q, order.Number, "", order.Status, nil); err != nil {
+			return err
+		}
+		if order.Status == constants.StatusProcessed || order.Status == constants.StatusInvalid {
+			return nil
+		}
+		traceParent := tracing.Inject(ctx)
+		return q.EnqueueAccrualJob(ctx, EnqueueAccrualJobParams{
+			OrderNumber: order.Number,
+			TraceParent: pgtype.Text{String: traceParent, Valid: traceParent != ""},
+		})
+	})
 }
 
-func (s *Storage) UpdateWithdrawn(ctx context.Context, userID int64, withdrawn float64) error {
-	_, err := s.db.Exec(ctx, queryUpdateWithdrawn, userID, withdrawn)
-	return err
-}
+// CreateOrders uploads a batch of order numbers for userID in a single
+// transaction. Numbers that are already taken, by the user or by anyone else,
+// are left alone; the new orders are audited and queued for polling the way
+// CreateOrder does it. It returns the numbers it created, and the orders
+// that already held the others.
+func (s *Storage) CreateOrders(ctx context.Context, userID int64, numbers []string, uploadedAt time.Time) (created []string, existing []models.Order, err error) {
+	err = s.inTx(ctx, func(q *Queries) error {
+		var err error
+		created, err = q.CreateOrders(ctx, CreateOrdersParams{
+			UserID:     pgtype.Int8{Int64: userID, Valid: true},
+			Numbers:    numbers,
+			Status:     constants.StatusNew,
+			UploadedAt: pgtype.Timestamptz{Time: uploadedAt, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
 
-func (s *Storage) CreateOrder(ctx context.Context, order models.Order) error {
-	_, err := s.db.Exec(ctx, queryCreateOrder,
-		order.UserID,
-		order.Number,
-		order.Status,
-		order.Accrual,
-		order.UploadedAt)
-	return err
+		if len(created) > 0 {
+			sourceIP := audit.SourceIP(ctx)
+			if err := q.CreateOrderAuditEntries(ctx, CreateOrderAuditEntriesParams{
+				ActorID:      pgtype.Int8{Int64: userID, Valid: true},
+				Action:       constants.AuditOrderUpload,
+				TargetUserID: pgtype.Int8{Int64: userID, Valid: true},
+				OrderNumbers: created,
+				SourceIp:     pgtype.Text{String: sourceIP, Valid: sourceIP != ""},
+			}); err != nil {
+				return err
+			}
+			if err := q.CreateOrderStatusEntries(ctx, CreateOrderStatusEntriesParams{
+				OrderNumbers: created,
+				Status:       pgtype.Text{String: constants.StatusNew, Valid: true},
+			}); err != nil {
+				return err
+			}
+			traceParent := tracing.Inject(ctx)
+			if err := q.EnqueueAccrualJobs(ctx, EnqueueAccrualJobsParams{
+				OrderNumbers: created,
+				TraceParent:  pgtype.Text{String: traceParent, Valid: traceParent != ""},
+			}); err != nil {
+				return err
+			}
+		}
+
+		if len(created) == len(numbers) {
+			return nil
+		}
+		isNew := make(map[string]bool, len(created))
+		for _, number := range created {
+			isNew[number] = true
+		}
+		rows, err := q.GetOrdersByNumbers(ctx, numbers)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if isNew[row.Number] {
+				continue
+			}
+			existing = append(existing, models.Order{
+				ID:         row.ID,
+				UserID:     row.UserID.Int64,
+				Number:     row.Number,
+				Status:     row.Status,
+				Accrual:    row.Accrual,
+				UploadedAt: row.UploadedAt,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return created, existing, nil
 }
 
 func (s *Storage) GetOrderByNumber(ctx context.Context, number string) (models.Order, error) {
@@ -117,8 +273,32 @@ func (s *Storage) GetOrdersByUserID(ctx context.Context, userID int64) ([]models
 	return orders, nil
 }
 
-func (s *Storage) GetAllOrders(ctx context.Context) ([]models.Order, error) {
-	rows, err := s.queries.GetAllOrders(ctx)
+// ListOrders returns the user's orders matching filter, newest first. The
+// upload time range and the cursor are always applied, as infinities when
+// open, so the scan stays on the (user_id, uploaded_at, id) index; statuses
+// and the accrual range filter the rows it reads.
+func (s *Storage) ListOrders(ctx context.Context, filter models.OrderFilter) ([]models.Order, error) {
+	since, until, beforeAt, beforeID := listBounds(filter.Since, filter.Until, filter.After)
+	minAccrual, err := nullableNumeric(filter.MinAccrual)
+	if err != nil {
+		return nil, err
+	}
+	maxAccrual, err := nullableNumeric(filter.MaxAccrual)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.queries.ListOrdersByUser(ctx, ListOrdersByUserParams{
+		UserID:     pgtype.Int8{Int64: filter.UserID, Valid: true},
+		Since:      since,
+		Until:      until,
+		BeforeAt:   beforeAt,
+		BeforeID:   beforeID,
+		Statuses:   filter.Statuses,
+		MinAccrual: minAccrual,
+		MaxAccrual: maxAccrual,
+		Limit:      pgtype.Int4{Int32: int32(filter.Limit), Valid: filter.Limit > 0},
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -126,7 +306,7 @@ func (s *Storage) GetAllOrders(ctx context.Context) ([]models.Order, error) {
 	for i, row := range rows {
 		orders[i] = models.Order{
 			ID:         row.ID,
-			UserID:     row.UserID.Int64,
+			UserID:     filter.UserID,
 			Number:     row.Number,
 			Status:     row.Status,
 			Accrual:    row.Accrual,
@@ -136,13 +316,87 @@ func (s *Storage) GetAllOrders(ctx context.Context) ([]models.Order, error) {
 	return orders, nil
 }
 
-func (s *Storage) CreateWithdrawal(ctx context.Context, withdrawal models.Withdrawal) error {
-	return s.queries.CreateWithdrawal(ctx, CreateWithdrawalParams{
-		UserID:      pgtype.Int8{Int64: withdrawal.UserID, Valid: true},
-		OrderNumber: withdrawal.OrderNumber,
-		Sum:         withdrawal.Sum.Float64,
-		ProcessedAt: withdrawal.ProcessedAt,
+// listBounds turns a listing's time range and cursor into query arguments.
+// Open ends and the zero cursor become infinities, which match every row.
+func listBounds(since, until time.Time, after models.ListCursor) (lo, hi, beforeAt pgtype.Timestamptz, beforeID int64) {
+	lo = pgtype.Timestamptz{Time: since, Valid: true}
+	if since.IsZero() {
+		lo = pgtype.Timestamptz{InfinityModifier: pgtype.NegativeInfinity, Valid: true}
+	}
+	hi = pgtype.Timestamptz{Time: until, Valid: true}
+	if until.IsZero() {
+		hi = pgtype.Timestamptz{InfinityModifier: pgtype.Infinity, Valid: true}
+	}
+	if after.IsZero() {
+		return lo, hi, pgtype.Timestamptz{InfinityModifier: pgtype.Infinity, Valid: true}, math.MaxInt64
+	}
+	return lo, hi, pgtype.Timestamptz{Time: after.At, Valid: true}, after.ID
+}
+
+// Withdraw checks the balance, records the withdrawal and debits the ledger in
+// a single transaction. The user row is locked for the duration, so concurrent
+// withdrawals of the same user are serialized and cannot overdraw. Listeners
+// of user events are told about the new balance, and a withdrawal.created
+// webhook event is queued.
+func (s *Storage) Withdraw(ctx context.Context, withdrawal models.Withdrawal) error {
+	err := s.inTx(ctx, func(q *Queries) error {
+		if _, err := q.LockUser(ctx, withdrawal.UserID); err != nil {
+			return err
+		}
+
+		bal, err := q.GetUserBalance(ctx, withdrawal.UserID)
+		if err != nil {
+			return err
+		}
+		if bal.Current < withdrawal.Sum {
+			return models.ErrInsufficientBalance
+		}
+
+		id, err := q.CreateWithdrawal(ctx, CreateWithdrawalParams{
+			UserID:      pgtype.Int8{Int64: withdrawal.UserID, Valid: true},
+			OrderNumber: withdrawal.OrderNumber,
+			Sum:         withdrawal.Sum,
+			ProcessedAt: withdrawal.ProcessedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := q.CreateLedgerEntry(ctx, CreateLedgerEntryParams{
+			UserID:       withdrawal.UserID,
+			Kind:         constants.LedgerKindWithdrawal,
+			Amount:       -withdrawal.Sum,
+			OrderNumber:  pgtype.Text{String: withdrawal.OrderNumber, Valid: true},
+			WithdrawalID: pgtype.Int8{Int64: id, Valid: true},
+		}); err != nil {
+			return err
+		}
+
+		if err := writeAudit(ctx, q, models.AuditEntry{
+			ActorID:       withdrawal.UserID,
+			Action:        constants.AuditBalanceWithdrawal,
+			TargetUserID:  withdrawal.UserID,
+			OrderNumber:   withdrawal.OrderNumber,
+			BalanceBefore: amountRef(bal.Current),
+			BalanceAfter:  amountRef(bal.Current - withdrawal.Sum),
+		}); err != nil {
+			return err
+		}
+		if err := queueWebhookEvent(ctx, q, constants.WebhookWithdrawalCreated, withdrawal.UserID, withdrawalCreatedPayload{
+			UserID:      withdrawal.UserID,
+			Order:       withdrawal.OrderNumber,
+			Sum:         withdrawal.Sum,
+			ProcessedAt: withdrawal.ProcessedAt.Time,
+		}); err != nil {
+			return err
+		}
+		return notifyBalance(ctx, q, withdrawal.UserID, bal.Current-withdrawal.Sum, bal.Withdrawn+withdrawal.Sum)
 	})
+	if err != nil {
+		return err
+	}
+	s.observer.PointsWithdrawn(withdrawal.Sum)
+	return nil
 }
 
 func (s *Storage) GetWithdrawalsByUserID(ctx context.Context, userID int64) ([]models.Withdrawal, error) {
@@ -154,18 +408,232 @@ func (s *Storage) GetWithdrawalsByUserID(ctx context.Context, userID int64) ([]m
 	for i, row := range rows {
 		withdrawals[i] = models.Withdrawal{
 			OrderNumber: row.OrderNumber,
-			Sum:         pgtype.Float8{Float64: row.Sum, Valid: true},
+			Sum:         row.Sum,
 			ProcessedAt: row.ProcessedAt,
 		}
 	}
 	return withdrawals, nil
 }
 
-func (s *Storage) UpdateOrder(ctx context.Context, order models.Order) error {
-	return s.queries.UpdateOrder(ctx, UpdateOrderParams{
-		Number:     order.Number,
-		Status:     order.Status,
-		Accrual:    order.Accrual,
-		UploadedAt: order.UploadedAt,
+// ListWithdrawals returns the user's withdrawals matching filter, newest
+// first, on the (user_id, processed_at, id) index the way ListOrders does.
+func (s *Storage) ListWithdrawals(ctx context.Context, filter models.WithdrawalFilter) ([]models.Withdrawal, error) {
+	since, until, beforeAt, beforeID := listBounds(filter.Since, filter.Until, filter.After)
+	minSum, err := nullableNumeric(filter.MinSum)
+	if err != nil {
+		return nil, err
+	}
+	maxSum, err := nullableNumeric(filter.MaxSum)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.queries.ListWithdrawalsByUser(ctx, ListWithdrawalsByUserParams{
+		UserID:   pgtype.Int8{Int64: filter.UserID, Valid: true},
+		Since:    since,
+		Until:    until,
+		BeforeAt: beforeAt,
+		BeforeID: beforeID,
+		MinSum:   minSum,
+		MaxSum:   maxSum,
+		Limit:    pgtype.Int4{Int32: int32(filter.Limit), Valid: filter.Limit > 0},
+	})
+	if err != nil {
+		return nil, err
+	}
+	withdrawals := make([]models.Withdrawal, len(rows))
+	for i, row := range rows {
+		withdrawals[i] = models.Withdrawal{
+			ID:          row.ID,
+			UserID:      filter.UserID,
+			OrderNumber: row.OrderNumber,
+			Sum:         row.Sum,
+			ProcessedAt: row.ProcessedAt,
+		}
+	}
+	return withdrawals, nil
+}
+
+// ApplyAccrual moves an order to the reported status and credits its accrual
+// once when it becomes PROCESSED. Orders already in a final status are left
+// untouched, so the call is safe to retry. All side effects share the
+// transaction; it reports whether this call credited the balance.
+func (s *Storage) ApplyAccrual(ctx context.Context, number, status string, accrual money.Amount) (bool, error) {
+	credited := false
+	var processed pgtype.Timestamptz
+	err := s.inTx(ctx, func(q *Queries) error {
+		order, err := q.GetOrderByNumberForUpdate(ctx, number)
+		if err != nil {
+			return err
+		}
+		if order.Status == constants.StatusProcessed || order.Status == constants.StatusInvalid {
+			return q.FinishAccrualJob(ctx, number)
+		}
+
+		if err := q.SetOrderAccrual(ctx, SetOrderAccrualParams{
+			Number:  number,
+			Status:  status,
+			Accrual: accrual,
+		}); err != nil {
+			return err
+		}
+		if status != order.Status || accrual != order.Accrual {
+			updated := order
+			updated.Status, updated.Accrual = status, accrual
+			if err := notifyOrder(ctx, q, updated); err != nil {
+				return err
+			}
+		}
+		if status != order.Status {
+			if err := writeAudit(ctx, q, models.AuditEntry{
+				Action:       constants.AuditOrderStatus,
+				TargetUserID: order.UserID.Int64,
+				OrderNumber:  number,
+				Details:      map[string]any{"from": order.Status, "to": status},
+			}); err != nil {
+				return err
+			}
+			var credit *money.Amount
+			if status == constants.StatusProcessed {
+				credit = &accrual
+			}
+			if err := writeStatusChange(ctx, q, number, order.Status, status, credit); err != nil {
+				return err
+			}
+			if status == constants.StatusProcessed {
+				if err := queueWebhookEvent(ctx, q, constants.WebhookOrderProcessed, order.UserID.Int64, orderProcessedPayload{
+					UserID:     order.UserID.Int64,
+					Number:     number,
+					Status:     status,
+					Accrual:    accrual,
+					UploadedAt: order.UploadedAt.Time,
+				}); err != nil {
+					return err
+				}
+			}
+		}
+
+		if status == constants.StatusProcessed || status == constants.StatusInvalid {
+			if err := q.FinishAccrualJob(ctx, number); err != nil {
+				return err
+			}
+		}
+		if status == constants.StatusProcessed {
+			processed = order.UploadedAt
+		}
+		if status != constants.StatusProcessed || accrual <= 0 {
+			return nil
+		}
+
+		if _, err := q.LockUser(ctx, order.UserID.Int64); err != nil {
+			return err
+		}
+		bal, err := q.GetUserBalance(ctx, order.UserID.Int64)
+		if err != nil {
+			return err
+		}
+		rows, err := q.CreateAccrualEntry(ctx, CreateAccrualEntryParams{
+			UserID:      order.UserID.Int64,
+			Amount:      accrual,
+			OrderNumber: pgtype.Text{String: number, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		credited = rows > 0
+		if !credited {
+			return nil
+		}
+		if err := writeAudit(ctx, q, models.AuditEntry{
+			Action:        constants.AuditBalanceAccrual,
+			TargetUserID:  order.UserID.Int64,
+			OrderNumber:   number,
+			BalanceBefore: amountRef(bal.Current),
+			BalanceAfter:  amountRef(bal.Current + accrual),
+		}); err != nil {
+			return err
+		}
+		return notifyBalance(ctx, q, order.UserID.Int64, bal.Current+accrual, bal.Withdrawn)
+	})
+	if err != nil {
+		return false, err
+	}
+	if processed.Valid {
+		s.observer.OrderProcessed(processed.Time)
+	}
+	if credited {
+		s.observer.PointsAccrued(accrual)
+	}
+	return credited, nil
+}
+
+// ClaimAccrualJobs leases up to limit due jobs to owner. Rows already leased by
+// another replica are skipped rather than waited on, so each pending order is
+// checked by at most one replica until the lease expires.
+func (s *Storage) ClaimAccrualJobs(ctx context.Context, owner string, limit int, lease time.Duration) ([]models.AccrualJob, error) {
+	rows, err := s.queries.ClaimAccrualJobs(ctx, ClaimAccrualJobsParams{
+		Owner:        pgtype.Text{String: owner, Valid: true},
+		LeaseSeconds: int32(lease / time.Second),
+		Limit:        int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]models.AccrualJob, len(rows))
+	for i, row := range rows {
+		jobs[i] = models.AccrualJob{
+			OrderNumber: row.OrderNumber,
+			UserID:      row.UserID.Int64,
+			Attempts:    int(row.Attempts),
+			NotFound:    int(row.NotFound),
+			TraceParent: row.TraceParent.String,
+		}
+	}
+	return jobs, nil
+}
+
+// CountPendingAccrualJobs returns the number of accrual jobs still to be
+// polled, keyed by the status of their order.
+func (s *Storage) CountPendingAccrualJobs(ctx context.Context) (map[string]int64, error) {
+	rows, err := s.queries.CountPendingAccrualJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Jobs
+	}
+	return counts, nil
+}
+
+// RescheduleAccrualJob releases owner's lease and makes the job due again at the given time.
+func (s *Storage) RescheduleAccrualJob(ctx context.Context, number, owner string, at time.Time) error {
+	return s.queries.RescheduleAccrualJob(ctx, RescheduleAccrualJobParams{
+		NextAttemptAt: pgtype.Timestamptz{Time: at, Valid: true},
+		OrderNumber:   number,
+		Owner:         pgtype.Text{String: owner, Valid: true},
+	})
+}
+
+// FailAccrualJob records a failed check and releases the lease. The job is
+// dead-lettered once it reaches MaxAttempts failures or MaxNotFound 404s in a
+// row. It reports whether the job was dead-lettered; a lease that has already
+// passed to another replica is left alone.
+func (s *Storage) FailAccrualJob(ctx context.Context, failure models.AccrualJobFailure) (bool, error) {
+	state, err := s.queries.FailAccrualJob(ctx, FailAccrualJobParams{
+		NotFound:      failure.NotFound,
+		MaxAttempts:   int32(failure.MaxAttempts),
+		MaxNotFound:   int32(failure.MaxNotFound),
+		NextAttemptAt: pgtype.Timestamptz{Time: failure.RetryAt, Valid: true},
+		LastError:     pgtype.Text{String: failure.Error, Valid: failure.Error != ""},
+		OrderNumber:   failure.OrderNumber,
+		Owner:         pgtype.Text{String: failure.Owner, Valid: true},
 	})
-}
\ No newline at end of file
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return state == constants.JobStateDead, nil
+}
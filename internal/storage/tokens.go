@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func (s *Storage) GetUserRole(ctx context.Context, userID int64) (string, error) {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return user.Role, nil
+}
+
+func (s *Storage) CreateRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	return s.queries.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		UserID:    token.UserID,
+		FamilyID:  token.FamilyID,
+		TokenHash: token.TokenHash,
+		ExpiresAt: pgtype.Timestamptz{Time: token.ExpiresAt, Valid: true},
+	})
+}
+
+// RotateRefreshToken spends the refresh token with oldHash and stores next in
+// the same family. A token that was already spent or revoked is treated as
+// stolen: the whole family is revoked and ErrRefreshTokenReused is returned.
+func (s *Storage) RotateRefreshToken(ctx context.Context, oldHash string, next models.RefreshToken) (models.RefreshToken, error) {
+	reused := false
+	err := s.inTx(ctx, func(q *Queries) error {
+		old, err := q.GetRefreshTokenForUpdate(ctx, oldHash)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.ErrRefreshTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		if old.UsedAt.Valid || old.RevokedAt.Valid {
+			reused = true
+			return q.RevokeTokenFamily(ctx, old.FamilyID)
+		}
+		if !old.ExpiresAt.Time.After(time.Now()) {
+			return models.ErrRefreshTokenInvalid
+		}
+
+		if err := q.MarkRefreshTokenUsed(ctx, old.ID); err != nil {
+			return err
+		}
+
+		next.UserID = old.UserID
+		next.FamilyID = old.FamilyID
+		return q.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+			UserID:    next.UserID,
+			FamilyID:  next.FamilyID,
+			TokenHash: next.TokenHash,
+			ExpiresAt: pgtype.Timestamptz{Time: next.ExpiresAt, Valid: true},
+		})
+	})
+	if err != nil {
+		return models.RefreshToken{}, err
+	}
+	if reused {
+		return models.RefreshToken{}, models.ErrRefreshTokenReused
+	}
+	return next, nil
+}
+
+func (s *Storage) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	return s.queries.RevokeTokenFamily(ctx, familyID)
+}
+
+func (s *Storage) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return s.queries.RevokeAccessToken(ctx, RevokeAccessTokenParams{
+		Jti:       jti,
+		ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+	})
+}
+
+// PruneExpiredTokens deletes the denylisted access tokens and the refresh
+// tokens that have expired, and returns how many. A revoked session stays
+// known for as long as its newest refresh token is unexpired, which outlives
+// every access token issued from it.
+func (s *Storage) PruneExpiredTokens(ctx context.Context) (int64, error) {
+	var pruned int64
+	err := s.inTx(ctx, func(q *Queries) error {
+		revoked, err := q.PruneRevokedTokens(ctx)
+		if err != nil {
+			return err
+		}
+		refresh, err := q.PruneRefreshTokens(ctx)
+		if err != nil {
+			return err
+		}
+		pruned = revoked + refresh
+		return nil
+	})
+	return pruned, err
+}
+
+// IsTokenRevoked reports whether the access token is denylisted or its session has been revoked.
+func (s *Storage) IsTokenRevoked(ctx context.Context, jti, familyID string) (bool, error) {
+	return s.queries.IsTokenRevoked(ctx, IsTokenRevokedParams{
+		Jti:      jti,
+		FamilyID: familyID,
+	})
+}
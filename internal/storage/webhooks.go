@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// orderProcessedPayload is the data of an order.processed webhook event.
+type orderProcessedPayload struct {
+	UserID     int64        `json:"user_id"`
+	Number     string       `json:"number"`
+	Status     string       `json:"status"`
+	Accrual    money.Amount `json:"accrual"`
+	UploadedAt time.Time    `json:"uploaded_at"`
+}
+
+// withdrawalCreatedPayload is the data of a withdrawal.created webhook event.
+type withdrawalCreatedPayload struct {
+	UserID      int64        `json:"user_id"`
+	Order       string       `json:"order"`
+	Sum         money.Amount `json:"sum"`
+	ProcessedAt time.Time    `json:"processed_at"`
+}
+
+// CreateWebhook stores webhook and audits it in the same transaction. A
+// webhook without a user is a global one, created by an admin. A user with
+// constants.MaxWebhooksPerUser live webhooks gets ErrWebhookLimit. It
+// returns the webhook with its id and creation time.
+func (s *Storage) CreateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	err := s.inTx(ctx, func(q *Queries) error {
+		if webhook.UserID != 0 {
+			if _, err := q.LockUser(ctx, webhook.UserID); err != nil {
+				return err
+			}
+			count, err := q.CountUserWebhooks(ctx, webhookOwner(webhook.UserID))
+			if err != nil {
+				return err
+			}
+			if count >= constants.MaxWebhooksPerUser {
+				return models.ErrWebhookLimit
+			}
+		}
+
+		row, err := q.CreateWebhook(ctx, CreateWebhookParams{
+			UserID:    webhookOwner(webhook.UserID),
+			Url:       webhook.URL,
+			Secret:    webhook.Secret,
+			Events:    webhook.Events,
+			CreatedBy: webhook.CreatedBy,
+		})
+		if err != nil {
+			return err
+		}
+		webhook.ID = row.ID
+		webhook.CreatedAt = row.CreatedAt.Time
+
+		action := constants.AuditWebhookCreate
+		if webhook.UserID == 0 {
+			action = constants.AuditAdminWebhookCreate
+		}
+		return writeAudit(ctx, q, models.AuditEntry{
+			ActorID:      webhook.CreatedBy,
+			Action:       action,
+			TargetUserID: webhook.UserID,
+			Details: map[string]any{
+				"webhook_id": webhook.ID,
+				"url":        auditURL(webhook.URL),
+				"events":     webhook.Events,
+			},
+		})
+	})
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// ListWebhooks returns the live webhooks of userID, or the global ones when
+// userID is zero, oldest first.
+func (s *Storage) ListWebhooks(ctx context.Context, userID int64) ([]models.Webhook, error) {
+	rows, err := s.queries.ListWebhooks(ctx, webhookOwner(userID))
+	if err != nil {
+		return nil, err
+	}
+	webhooks := make([]models.Webhook, len(rows))
+	for i, row := range rows {
+		webhooks[i] = models.Webhook{
+			ID:        row.ID,
+			UserID:    row.UserID.Int64,
+			URL:       row.Url,
+			Secret:    row.Secret,
+			Events:    row.Events,
+			CreatedBy: row.CreatedBy,
+			CreatedAt: row.CreatedAt.Time,
+		}
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes a webhook of userID, or a global one when userID is
+// zero, on behalf of actorID. Its deliveries still pending are given up. A
+// webhook of someone else is reported as not found, like a missing one.
+func (s *Storage) DeleteWebhook(ctx context.Context, actorID, userID, id int64) error {
+	return s.inTx(ctx, func(q *Queries) error {
+		target, err := q.DeleteWebhook(ctx, DeleteWebhookParams{ID: id, UserID: webhookOwner(userID)})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.ErrWebhookNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := q.AbandonWebhookDeliveries(ctx, id); err != nil {
+			return err
+		}
+
+		action := constants.AuditWebhookDelete
+		if userID == 0 {
+			action = constants.AuditAdminWebhookDelete
+		}
+		return writeAudit(ctx, q, models.AuditEntry{
+			ActorID:      actorID,
+			Action:       action,
+			TargetUserID: userID,
+			Details:      map[string]any{"webhook_id": id, "url": auditURL(target)},
+		})
+	})
+}
+
+// ListWebhookLog returns the last limit delivery attempts of a webhook of
+// userID, or of a global one when userID is zero, newest first.
+func (s *Storage) ListWebhookLog(ctx context.Context, userID, id int64, limit int) ([]models.WebhookLogEntry, error) {
+	if _, err := s.queries.GetWebhook(ctx, GetWebhookParams{ID: id, UserID: webhookOwner(userID)}); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.ErrWebhookNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := s.queries.ListWebhookAttempts(ctx, ListWebhookAttemptsParams{
+		WebhookID: id,
+		Limit:     int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]models.WebhookLogEntry, len(rows))
+	for i, row := range rows {
+		entries[i] = models.WebhookLogEntry{
+			ID:         row.ID,
+			DeliveryID: row.DeliveryID,
+			EventID:    row.OutboxID,
+			Event:      row.Event,
+			State:      row.State,
+			StatusCode: int(row.StatusCode.Int32),
+			Error:      row.Error.String,
+			Duration:   time.Duration(row.DurationMs) * time.Millisecond,
+			CreatedAt:  row.CreatedAt.Time,
+		}
+	}
+	return entries, nil
+}
+
+// ClaimWebhookDeliveries leases up to limit due deliveries to owner, the way
+// ClaimAccrualJobs leases accrual jobs.
+func (s *Storage) ClaimWebhookDeliveries(ctx context.Context, owner string, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	rows, err := s.queries.ClaimWebhookDeliveries(ctx, ClaimWebhookDeliveriesParams{
+		Owner:        pgtype.Text{String: owner, Valid: true},
+		LeaseSeconds: int32(lease / time.Second),
+		Limit:        int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]models.WebhookDelivery, len(rows))
+	for i, row := range rows {
+		deliveries[i] = models.WebhookDelivery{
+			ID:         row.ID,
+			EventID:    row.EventID,
+			Event:      row.Event,
+			UserID:     row.UserID,
+			Payload:    row.Payload,
+			OccurredAt: row.OccurredAt.Time,
+			URL:        row.Url,
+			Secret:     row.Secret,
+			Attempts:   int(row.Attempts),
+		}
+	}
+	return deliveries, nil
+}
+
+// RecordWebhookAttempt adds the attempt to the delivery log and releases the
+// lease. A delivered event is done; a failed one is retried at RetryAt, or
+// dead-lettered once it has failed MaxAttempts times. It reports whether the
+// delivery was dead-lettered; a lease that has already passed to another
+// replica is left alone.
+func (s *Storage) RecordWebhookAttempt(ctx context.Context, attempt models.WebhookAttempt) (bool, error) {
+	dead := false
+	err := s.inTx(ctx, func(q *Queries) error {
+		if err := q.CreateWebhookAttempt(ctx, CreateWebhookAttemptParams{
+			DeliveryID: attempt.DeliveryID,
+			StatusCode: pgtype.Int4{Int32: int32(attempt.StatusCode), Valid: attempt.StatusCode != 0},
+			Error:      pgtype.Text{String: attempt.Error, Valid: attempt.Error != ""},
+			DurationMs: int32(attempt.Duration / time.Millisecond),
+		}); err != nil {
+			return err
+		}
+
+		owner := pgtype.Text{String: attempt.Owner, Valid: true}
+		if attempt.Delivered {
+			return q.FinishWebhookDelivery(ctx, FinishWebhookDeliveryParams{ID: attempt.DeliveryID, Owner: owner})
+		}
+		state, err := q.FailWebhookDelivery(ctx, FailWebhookDeliveryParams{
+			MaxAttempts:   int32(attempt.MaxAttempts),
+			NextAttemptAt: pgtype.Timestamptz{Time: attempt.RetryAt, Valid: true},
+			LastError:     pgtype.Text{String: attempt.Error, Valid: attempt.Error != ""},
+			ID:            attempt.DeliveryID,
+			Owner:         owner,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		dead = state == constants.JobStateDead
+		return nil
+	})
+	return dead, err
+}
+
+// queueWebhookEvent writes the event to the outbox, with a delivery for every
+// live webhook of the user, or global one, that subscribed to it. It is
+// called in the transaction of the change the event reports, so an event is
+// queued if and only if the change commits.
+func queueWebhookEvent(ctx context.Context, q *Queries, event string, userID int64, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook event: %w", err)
+	}
+	_, err = q.CreateWebhookEvent(ctx, CreateWebhookEventParams{
+		Event:   event,
+		UserID:  userID,
+		Payload: payload,
+	})
+	return err
+}
+
+// auditURL drops the credentials, query and fragment from a webhook url,
+// which may carry tokens that do not belong in the audit log.
+func auditURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
+
+// webhookOwner maps the zero user id of global webhooks to NULL.
+func webhookOwner(userID int64) pgtype.Int8 {
+	return pgtype.Int8{Int64: userID, Valid: userID != 0}
+}
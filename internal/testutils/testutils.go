@@ -2,10 +2,17 @@ package testutils
 
 import (
 	"context"
+	"testing"
+	"time"
 
+	"github.com/AlenaMolokova/diploma/internal/auth"
 	"github.com/AlenaMolokova/diploma/internal/models"
-	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/AlenaMolokova/diploma/internal/money"
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type MockOrderStorage struct {
@@ -17,6 +24,11 @@ func (m *MockOrderStorage) CreateOrder(ctx context.Context, order models.Order)
 	return args.Error(0)
 }
 
+func (m *MockOrderStorage) CreateOrders(ctx context.Context, userID int64, numbers []string, uploadedAt time.Time) ([]string, []models.Order, error) {
+	args := m.Called(ctx, userID, numbers, uploadedAt)
+	return args.Get(0).([]string), args.Get(1).([]models.Order), args.Error(2)
+}
+
 func (m *MockOrderStorage) GetOrderByNumber(ctx context.Context, number string) (models.Order, error) {
 	args := m.Called(ctx, number)
 	return args.Get(0).(models.Order), args.Error(1)
@@ -27,54 +39,246 @@ func (m *MockOrderStorage) GetOrdersByUserID(ctx context.Context, userID int64)
 	return args.Get(0).([]models.Order), args.Error(1)
 }
 
-func (m *MockOrderStorage) UpdateOrder(ctx context.Context, order models.Order) error {
-	args := m.Called(ctx, order)
+func (m *MockOrderStorage) ApplyAccrual(ctx context.Context, number, status string, accrual money.Amount) (bool, error) {
+	args := m.Called(ctx, number, status, accrual)
+	return args.Bool(0), args.Error(1)
+}
+
+type MockBalanceStorage struct {
+	mock.Mock
+}
+
+func (m *MockBalanceStorage) GetBalance(ctx context.Context, userID int64) (money.Amount, money.Amount, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(money.Amount), args.Get(1).(money.Amount), args.Error(2)
+}
+
+type MockWithdrawalStorage struct {
+	mock.Mock
+}
+
+func (m *MockWithdrawalStorage) Withdraw(ctx context.Context, withdrawal models.Withdrawal) error {
+	args := m.Called(ctx, withdrawal)
 	return args.Error(0)
 }
 
-func (m *MockOrderStorage) GetAllOrders(ctx context.Context) ([]models.Order, error) {
-	args := m.Called(ctx)
-	return args.Get(0).([]models.Order), args.Error(1)
+func (m *MockWithdrawalStorage) ListWithdrawals(ctx context.Context, filter models.WithdrawalFilter) ([]models.Withdrawal, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]models.Withdrawal), args.Error(1)
 }
 
-type MockBalanceStorage struct {
+type MockLoyaltyClient struct {
 	mock.Mock
 }
 
-func (m *MockBalanceStorage) GetBalance(ctx context.Context, userID int64) (pgtype.Float8, pgtype.Float8, error) {
+func (m *MockLoyaltyClient) CheckOrder(ctx context.Context, orderNumber string) (*models.LoyaltyResponse, error) {
+	args := m.Called(ctx, orderNumber)
+	return args.Get(0).(*models.LoyaltyResponse), args.Error(1)
+}
+
+type MockTokenStore struct {
+	mock.Mock
+}
+
+func (m *MockTokenStore) CreateRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockTokenStore) RotateRefreshToken(ctx context.Context, oldHash string, next models.RefreshToken) (models.RefreshToken, error) {
+	args := m.Called(ctx, oldHash, next)
+	return args.Get(0).(models.RefreshToken), args.Error(1)
+}
+
+func (m *MockTokenStore) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	args := m.Called(ctx, familyID)
+	return args.Error(0)
+}
+
+func (m *MockTokenStore) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	args := m.Called(ctx, jti, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockTokenStore) IsTokenRevoked(ctx context.Context, jti, familyID string) (bool, error) {
+	args := m.Called(ctx, jti, familyID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockTokenStore) GetUserRole(ctx context.Context, userID int64) (string, error) {
 	args := m.Called(ctx, userID)
-	return args.Get(0).(pgtype.Float8), args.Get(1).(pgtype.Float8), args.Error(2)
+	return args.String(0), args.Error(1)
 }
 
-func (m *MockBalanceStorage) UpdateBalance(ctx context.Context, userID int64, amount float64) error {
-	args := m.Called(ctx, userID, amount)
+func (m *MockTokenStore) PruneExpiredTokens(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockLoginAttemptStorage struct {
+	mock.Mock
+}
+
+func (m *MockLoginAttemptStorage) LoginLockedUntil(ctx context.Context, subjects []string, now time.Time) (time.Time, error) {
+	args := m.Called(ctx, subjects, now)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *MockLoginAttemptStorage) RecordLoginFailure(ctx context.Context, subject string, now, windowStart time.Time) (int, error) {
+	args := m.Called(ctx, subject, now, windowStart)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockLoginAttemptStorage) LockLogin(ctx context.Context, subject string, until time.Time) error {
+	args := m.Called(ctx, subject, until)
 	return args.Error(0)
 }
 
-func (m *MockBalanceStorage) UpdateWithdrawn(ctx context.Context, userID int64, amount float64) error {
-	args := m.Called(ctx, userID, amount)
+func (m *MockLoginAttemptStorage) ResetLoginFailures(ctx context.Context, subject string) error {
+	args := m.Called(ctx, subject)
 	return args.Error(0)
 }
 
-type MockWithdrawalStorage struct {
+type MockPasswordStorage struct {
 	mock.Mock
 }
 
-func (m *MockWithdrawalStorage) CreateWithdrawal(ctx context.Context, withdrawal models.Withdrawal) error {
-	args := m.Called(ctx, withdrawal)
+func (m *MockPasswordStorage) GetUserByID(ctx context.Context, id int64) (models.User, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *MockPasswordStorage) GetUserByLogin(ctx context.Context, login string) (models.User, error) {
+	args := m.Called(ctx, login)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *MockPasswordStorage) ChangePassword(ctx context.Context, userID int64, passwordHash string) error {
+	args := m.Called(ctx, userID, passwordHash)
+	return args.Error(0)
+}
+
+func (m *MockPasswordStorage) CreatePasswordReset(ctx context.Context, reset models.PasswordReset) error {
+	args := m.Called(ctx, reset)
+	return args.Error(0)
+}
+
+func (m *MockPasswordStorage) GetPasswordReset(ctx context.Context, tokenHash string, now time.Time) (models.User, error) {
+	args := m.Called(ctx, tokenHash, now)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *MockPasswordStorage) ResetPassword(ctx context.Context, tokenHash, passwordHash string, now time.Time) (int64, error) {
+	args := m.Called(ctx, tokenHash, passwordHash, now)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockNotifier struct {
+	mock.Mock
+}
+
+func (m *MockNotifier) SendPasswordReset(ctx context.Context, login, token string, expiresAt time.Time) error {
+	args := m.Called(ctx, login, token, expiresAt)
 	return args.Error(0)
 }
 
-func (m *MockWithdrawalStorage) GetWithdrawalsByUserID(ctx context.Context, userID int64) ([]models.Withdrawal, error) {
+type MockAdminStorage struct {
+	mock.Mock
+}
+
+func (m *MockAdminStorage) GetUserByID(ctx context.Context, id int64) (models.User, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *MockAdminStorage) GetUserByLogin(ctx context.Context, login string) (models.User, error) {
+	args := m.Called(ctx, login)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *MockAdminStorage) GetBalance(ctx context.Context, userID int64) (money.Amount, money.Amount, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(money.Amount), args.Get(1).(money.Amount), args.Error(2)
+}
+
+func (m *MockAdminStorage) GetOrdersByUserID(ctx context.Context, userID int64) ([]models.Order, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]models.Order), args.Error(1)
+}
+
+func (m *MockAdminStorage) GetWithdrawalsByUserID(ctx context.Context, userID int64) ([]models.Withdrawal, error) {
 	args := m.Called(ctx, userID)
 	return args.Get(0).([]models.Withdrawal), args.Error(1)
 }
 
-type MockLoyaltyClient struct {
+func (m *MockAdminStorage) GetAccrualJobState(ctx context.Context, number string) (models.AccrualJobState, error) {
+	args := m.Called(ctx, number)
+	return args.Get(0).(models.AccrualJobState), args.Error(1)
+}
+
+func (m *MockAdminStorage) AdjustBalance(ctx context.Context, adjustment models.BalanceAdjustment) (money.Amount, error) {
+	args := m.Called(ctx, adjustment)
+	return args.Get(0).(money.Amount), args.Error(1)
+}
+
+func (m *MockAdminStorage) RecordAudit(ctx context.Context, entry models.AuditEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+func (m *MockAdminStorage) ListAudit(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]models.AuditEntry), args.Error(1)
+}
+
+type MockWebhookStorage struct {
 	mock.Mock
 }
 
-func (m *MockLoyaltyClient) CheckOrder(ctx context.Context, orderNumber string) (*models.LoyaltyResponse, error) {
-	args := m.Called(ctx, orderNumber)
-	return args.Get(0).(*models.LoyaltyResponse), args.Error(1)
+func (m *MockWebhookStorage) CreateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	args := m.Called(ctx, webhook)
+	return args.Get(0).(models.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookStorage) ListWebhooks(ctx context.Context, userID int64) ([]models.Webhook, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]models.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookStorage) DeleteWebhook(ctx context.Context, actorID, userID, id int64) error {
+	args := m.Called(ctx, actorID, userID, id)
+	return args.Error(0)
+}
+
+func (m *MockWebhookStorage) ListWebhookLog(ctx context.Context, userID, id int64, limit int) ([]models.WebhookLogEntry, error) {
+	args := m.Called(ctx, userID, id, limit)
+	return args.Get(0).([]models.WebhookLogEntry), args.Error(1)
+}
+
+// HMACKeyring returns a keyring with a single HS256 key under auth.DefaultKeyID.
+func HMACKeyring(secret string) *auth.Keyring {
+	keys, err := auth.NewKeyring([]auth.Key{auth.NewHMACKey(auth.DefaultKeyID, []byte(secret))}, "")
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}
+
+// RecordSpans installs a tracer provider exporting to memory, and the W3C
+// trace context propagator, for the duration of the test.
+func RecordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previousProvider := otel.GetTracerProvider()
+	previousPropagator := otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+		provider.Shutdown(context.Background())
+	})
+	return exporter
 }
@@ -0,0 +1,184 @@
+// Package tracing sets up OpenTelemetry tracing and holds the helpers used to
+// trace incoming HTTP requests, use cases, database queries and requests to
+// the accrual service.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ServiceName = "gophermart"
+
+	instrumentationName = "github.com/AlenaMolokova/diploma"
+)
+
+// Exporters selectable with TRACE_EXPORTER. The OTLP exporter is configured
+// through the standard OTEL_EXPORTER_OTLP_* variables.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Span attributes shared across packages.
+const (
+	OrderKey       = attribute.Key("gophermart.order.number")
+	OrderStatusKey = attribute.Key("gophermart.order.status")
+	AttemptsKey    = attribute.Key("gophermart.accrual.attempts")
+	OrderCountKey  = attribute.Key("gophermart.order.count")
+	UserIDKey      = attribute.Key("enduser.id")
+)
+
+var queryName = regexp.MustCompile(`^-- name: (\w+)`)
+
+// Order returns the span attribute for an order number.
+func Order(number string) attribute.KeyValue {
+	return OrderKey.String(number)
+}
+
+// UserID returns the span attribute for a user ID.
+func UserID(id int64) attribute.KeyValue {
+	return UserIDKey.Int64(id)
+}
+
+// Setup installs the global tracer provider for the given exporter and the
+// W3C trace context propagator. With ExporterNone spans are not recorded, but
+// an incoming traceparent is still passed on to the accrual service. The
+// returned function flushes and stops the exporter.
+func Setup(ctx context.Context, exporter string, w io.Writer) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		exp sdktrace.SpanExporter
+		err error
+	)
+	switch exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(w))
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span with the global tracer provider.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err, if any, on the span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware traces incoming requests, continuing a trace started by the
+// caller. Spans are named after the chi route pattern rather than the raw
+// path, and the trace ID is added to the request's log fields. It has to be
+// mounted on the chi router.
+func Middleware(next http.Handler) http.Handler {
+	routed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+			ctx = logging.With(ctx, logging.TraceIDKey, sc.TraceID().String())
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			span := trace.SpanFromContext(ctx)
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(semconv.HTTPRoute(rctx.RoutePattern()))
+		}
+	})
+	return otelhttp.NewHandler(routed, "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return r.Method }))
+}
+
+// Transport traces outgoing requests and propagates the trace context to the
+// called service. It is meant for loyalty.Client's WrapTransport.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(next)
+}
+
+// Inject returns the traceparent of the span in ctx, so that work picked up
+// later, possibly by another replica, can be linked to it. It is empty when
+// ctx carries no span.
+func Inject(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// linkTo returns a link to the span recorded with Inject, if any.
+func linkTo(traceparent string) []trace.Link {
+	if traceparent == "" {
+		return nil
+	}
+	ctx := propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier{"traceparent": traceparent})
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []trace.Link{{SpanContext: sc}}
+}
+
+// StartLinked starts a new root span linked to the span recorded with Inject.
+func StartLinked(ctx context.Context, name, traceparent string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name,
+		trace.WithNewRoot(), trace.WithLinks(linkTo(traceparent)...), trace.WithAttributes(attrs...))
+}
+
+// QueryTracer traces pgx queries. Spans are named after the sqlc query name
+// when there is one; query arguments are never recorded.
+type QueryTracer struct{}
+
+func (QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	name := "db.query"
+	if m := queryName.FindStringSubmatch(data.SQL); m != nil {
+		name = m[1]
+	}
+	ctx, _ = otel.Tracer(instrumentationName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(name), semconv.DBQueryText(data.SQL)))
+	return ctx
+}
+
+func (QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	End(trace.SpanFromContext(ctx), data.Err)
+}
@@ -0,0 +1,165 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AlenaMolokova/diploma/internal/testutils"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func spanNamed(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("No span named %q among %d spans", name, len(spans))
+	return tracetest.SpanStub{}
+}
+
+func hasAttribute(span tracetest.SpanStub, kv attribute.KeyValue) bool {
+	for _, attr := range span.Attributes {
+		if attr == kv {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		name     string
+		exporter string
+		wantErr  bool
+	}{
+		{name: "без экспорта", exporter: ExporterNone},
+		{name: "пустое значение", exporter: ""},
+		{name: "stdout", exporter: ExporterStdout},
+		{name: "неизвестный экспортер", exporter: "zipkin", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutils.RecordSpans(t)
+
+			shutdown, err := Setup(context.Background(), tt.exporter, io.Discard)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, shutdown(context.Background()))
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	spans := testutils.RecordSpans(t)
+
+	var traceID trace.TraceID
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/api/admin/orders/{number}/accrual", func(w http.ResponseWriter, r *http.Request) {
+		traceID = trace.SpanContextFromContext(r.Context()).TraceID()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/orders/12345678903/accrual", nil)
+	req.Header.Set("traceparent", traceParent)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	span := spanNamed(t, spans.GetSpans(), "GET /api/admin/orders/{number}/accrual")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String(), "the caller's trace is continued")
+	assert.Equal(t, span.SpanContext.TraceID(), traceID)
+	assert.True(t, hasAttribute(span, attribute.String("http.route", "/api/admin/orders/{number}/accrual")))
+}
+
+func TestTransportPropagatesTraceContext(t *testing.T) {
+	spans := testutils.RecordSpans(t)
+
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	ctx, span := Start(context.Background(), "parent")
+	client := &http.Client{Transport: Transport(http.DefaultTransport)}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	span.End()
+
+	require.NotEmpty(t, header)
+	assert.Contains(t, header, span.SpanContext().TraceID().String())
+	assert.Len(t, spans.GetSpans(), 2)
+}
+
+func TestStartLinked(t *testing.T) {
+	spans := testutils.RecordSpans(t)
+
+	uploadCtx, upload := Start(context.Background(), "upload")
+	stored := Inject(uploadCtx)
+	upload.End()
+	require.NotEmpty(t, stored)
+
+	_, check := StartLinked(context.Background(), "check", stored, Order("12345678903"))
+	check.End()
+	_, orphan := StartLinked(context.Background(), "orphan", "")
+	orphan.End()
+
+	span := spanNamed(t, spans.GetSpans(), "check")
+	require.Len(t, span.Links, 1)
+	assert.Equal(t, upload.SpanContext().SpanID(), span.Links[0].SpanContext.SpanID())
+	assert.NotEqual(t, upload.SpanContext().TraceID(), span.SpanContext.TraceID(), "each check is a trace of its own")
+	assert.True(t, hasAttribute(span, Order("12345678903")))
+	assert.Empty(t, spanNamed(t, spans.GetSpans(), "orphan").Links)
+	assert.Empty(t, Inject(context.Background()))
+}
+
+func TestEnd(t *testing.T) {
+	spans := testutils.RecordSpans(t)
+
+	_, span := Start(context.Background(), "failing")
+	End(span, errors.New("db error"))
+
+	got := spanNamed(t, spans.GetSpans(), "failing")
+	assert.Equal(t, codes.Error, got.Status.Code)
+	assert.Len(t, got.Events, 1)
+}
+
+func TestQueryTracer(t *testing.T) {
+	spans := testutils.RecordSpans(t)
+	tracer := QueryTracer{}
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{
+		SQL:  "-- name: GetOrderByNumber :one\nSELECT id FROM orders WHERE number = $1",
+		Args: []any{"12345678903"},
+	})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	ctx = tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "begin"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("conn closed")})
+
+	query := spanNamed(t, spans.GetSpans(), "GetOrderByNumber")
+	assert.Equal(t, trace.SpanKindClient, query.SpanKind)
+	for _, attr := range query.Attributes {
+		assert.NotContains(t, attr.Value.Emit(), "12345678903", "query arguments are not recorded")
+	}
+	assert.Equal(t, codes.Error, spanNamed(t, spans.GetSpans(), "db.query").Status.Code)
+}
@@ -0,0 +1,196 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/AlenaMolokova/diploma/internal/tracing"
+)
+
+type AdminStorage interface {
+	GetUserByID(ctx context.Context, id int64) (models.User, error)
+	GetUserByLogin(ctx context.Context, login string) (models.User, error)
+	GetBalance(ctx context.Context, userID int64) (money.Amount, money.Amount, error)
+	GetOrdersByUserID(ctx context.Context, userID int64) ([]models.Order, error)
+	GetWithdrawalsByUserID(ctx context.Context, userID int64) ([]models.Withdrawal, error)
+	GetAccrualJobState(ctx context.Context, number string) (models.AccrualJobState, error)
+	AdjustBalance(ctx context.Context, adjustment models.BalanceAdjustment) (money.Amount, error)
+	RecordAudit(ctx context.Context, entry models.AuditEntry) error
+	ListAudit(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+// AdminUseCase backs the support API. Every call is made on behalf of
+// actorID and is written to the audit log; a lookup whose audit entry cannot
+// be written fails rather than going unrecorded.
+type AdminUseCase struct {
+	storage AdminStorage
+}
+
+func NewAdminUseCase(storage AdminStorage) *AdminUseCase {
+	return &AdminUseCase{storage: storage}
+}
+
+func (uc *AdminUseCase) GetUser(ctx context.Context, actorID, userID int64) (_ models.UserAccount, err error) {
+	ctx, span := tracing.Start(ctx, "AdminUseCase.GetUser", tracing.UserID(actorID))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := uc.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return models.UserAccount{}, fmt.Errorf("failed to get user: %w", err)
+	}
+	return uc.account(ctx, actorID, user)
+}
+
+func (uc *AdminUseCase) FindUser(ctx context.Context, actorID int64, login string) (_ models.UserAccount, err error) {
+	ctx, span := tracing.Start(ctx, "AdminUseCase.FindUser", tracing.UserID(actorID))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := uc.storage.GetUserByLogin(ctx, login)
+	if err != nil {
+		return models.UserAccount{}, fmt.Errorf("failed to get user: %w", err)
+	}
+	return uc.account(ctx, actorID, user)
+}
+
+func (uc *AdminUseCase) account(ctx context.Context, actorID int64, user models.User) (models.UserAccount, error) {
+	current, withdrawn, err := uc.storage.GetBalance(ctx, user.ID)
+	if err != nil {
+		return models.UserAccount{}, fmt.Errorf("failed to get balance: %w", err)
+	}
+	if err := uc.audit(ctx, models.AuditEntry{
+		ActorID:      actorID,
+		Action:       constants.AuditAdminUserLookup,
+		TargetUserID: user.ID,
+	}); err != nil {
+		return models.UserAccount{}, err
+	}
+	return models.UserAccount{
+		ID:        user.ID,
+		Login:     user.Login,
+		Role:      user.Role,
+		Current:   current,
+		Withdrawn: withdrawn,
+	}, nil
+}
+
+func (uc *AdminUseCase) GetUserOrders(ctx context.Context, actorID, userID int64) (_ []models.Order, err error) {
+	ctx, span := tracing.Start(ctx, "AdminUseCase.GetUserOrders", tracing.UserID(actorID))
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := uc.storage.GetUserByID(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	orders, err := uc.storage.GetOrdersByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+	if err := uc.audit(ctx, models.AuditEntry{
+		ActorID:      actorID,
+		Action:       constants.AuditAdminUserOrders,
+		TargetUserID: userID,
+	}); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (uc *AdminUseCase) GetUserWithdrawals(ctx context.Context, actorID, userID int64) (_ []models.Withdrawal, err error) {
+	ctx, span := tracing.Start(ctx, "AdminUseCase.GetUserWithdrawals", tracing.UserID(actorID))
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := uc.storage.GetUserByID(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	withdrawals, err := uc.storage.GetWithdrawalsByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get withdrawals: %w", err)
+	}
+	if err := uc.audit(ctx, models.AuditEntry{
+		ActorID:      actorID,
+		Action:       constants.AuditAdminUserWithdrawals,
+		TargetUserID: userID,
+	}); err != nil {
+		return nil, err
+	}
+	return withdrawals, nil
+}
+
+func (uc *AdminUseCase) GetOrderAccrual(ctx context.Context, actorID int64, number string) (_ models.AccrualJobState, err error) {
+	ctx, span := tracing.Start(ctx, "AdminUseCase.GetOrderAccrual", tracing.UserID(actorID), tracing.Order(number))
+	defer func() { tracing.End(span, err) }()
+
+	state, err := uc.storage.GetAccrualJobState(ctx, number)
+	if err != nil {
+		return models.AccrualJobState{}, fmt.Errorf("failed to get accrual state: %w", err)
+	}
+	if err := uc.audit(ctx, models.AuditEntry{
+		ActorID:      actorID,
+		Action:       constants.AuditAdminOrderAccrual,
+		TargetUserID: state.Order.UserID,
+		OrderNumber:  number,
+	}); err != nil {
+		return models.AccrualJobState{}, err
+	}
+	return state, nil
+}
+
+// AdjustBalance credits (or, with a negative amount, debits) the user's
+// balance. The storage audits the adjustment in the same transaction.
+func (uc *AdminUseCase) AdjustBalance(ctx context.Context, adjustment models.BalanceAdjustment) (_ money.Amount, err error) {
+	ctx, span := tracing.Start(ctx, "AdminUseCase.AdjustBalance", tracing.UserID(adjustment.ActorID))
+	defer func() { tracing.End(span, err) }()
+
+	if adjustment.Amount == 0 {
+		return 0, fmt.Errorf("adjustment amount must not be zero")
+	}
+	if adjustment.Reason == "" {
+		return 0, fmt.Errorf("adjustment reason is required")
+	}
+	current, err := uc.storage.AdjustBalance(ctx, adjustment)
+	if err != nil {
+		return 0, fmt.Errorf("failed to adjust balance: %w", err)
+	}
+	return current, nil
+}
+
+// ListAudit reads the audit log. Reading it is itself audited, with the
+// filter used.
+func (uc *AdminUseCase) ListAudit(ctx context.Context, actorID int64, filter models.AuditFilter) (_ []models.AuditEntry, err error) {
+	ctx, span := tracing.Start(ctx, "AdminUseCase.ListAudit", tracing.UserID(actorID))
+	defer func() { tracing.End(span, err) }()
+
+	entries, err := uc.storage.ListAudit(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	details := map[string]any{}
+	if filter.Action != "" {
+		details["action"] = filter.Action
+	}
+	if !filter.Since.IsZero() {
+		details["from"] = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		details["to"] = filter.Until
+	}
+	if err := uc.audit(ctx, models.AuditEntry{
+		ActorID:      actorID,
+		Action:       constants.AuditAdminAuditList,
+		TargetUserID: filter.UserID,
+		OrderNumber:  filter.OrderNumber,
+		Details:      details,
+	}); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (uc *AdminUseCase) audit(ctx context.Context, entry models.AuditEntry) error {
+	if err := uc.storage.RecordAudit(ctx, entry); err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/AlenaMolokova/diploma/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAdminUseCase_FindUser(t *testing.T) {
+	ctx := context.Background()
+	user := models.User{ID: 7, Login: "alice", Password: "hash", Role: constants.RoleUser}
+
+	tests := []struct {
+		name        string
+		setupMocks  func(*testutils.MockAdminStorage)
+		expected    models.UserAccount
+		expectedErr error
+	}{
+		{
+			name: "пользователь найден",
+			setupMocks: func(s *testutils.MockAdminStorage) {
+				s.On("GetUserByLogin", mock.Anything, "alice").Return(user, nil)
+				s.On("GetBalance", mock.Anything, int64(7)).Return(money.MustParse("100"), money.MustParse("20"), nil)
+				s.On("RecordAudit", mock.Anything, models.AuditEntry{
+					ActorID:      1,
+					Action:       constants.AuditAdminUserLookup,
+					TargetUserID: 7,
+				}).Return(nil)
+			},
+			expected: models.UserAccount{
+				ID:        7,
+				Login:     "alice",
+				Role:      constants.RoleUser,
+				Current:   money.MustParse("100"),
+				Withdrawn: money.MustParse("20"),
+			},
+		},
+		{
+			name: "пользователь не найден",
+			setupMocks: func(s *testutils.MockAdminStorage) {
+				s.On("GetUserByLogin", mock.Anything, "alice").Return(models.User{}, models.ErrUserNotFound)
+			},
+			expectedErr: models.ErrUserNotFound,
+		},
+		{
+			name: "ошибка записи аудита",
+			setupMocks: func(s *testutils.MockAdminStorage) {
+				s.On("GetUserByLogin", mock.Anything, "alice").Return(user, nil)
+				s.On("GetBalance", mock.Anything, int64(7)).Return(money.Amount(0), money.Amount(0), nil)
+				s.On("RecordAudit", mock.Anything, mock.Anything).Return(errors.New("db error"))
+			},
+			expectedErr: errors.New("failed to record audit entry: db error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &testutils.MockAdminStorage{}
+			tt.setupMocks(storage)
+			uc := NewAdminUseCase(storage)
+
+			account, err := uc.FindUser(ctx, 1, "alice")
+
+			switch {
+			case errors.Is(tt.expectedErr, models.ErrUserNotFound):
+				assert.ErrorIs(t, err, models.ErrUserNotFound)
+			case tt.expectedErr != nil:
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, account)
+			}
+			storage.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAdminUseCase_GetUserOrders(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("заказы пользователя", func(t *testing.T) {
+		storage := &testutils.MockAdminStorage{}
+		orders := []models.Order{{Number: "12345678903", Status: constants.StatusNew}}
+		storage.On("GetUserByID", mock.Anything, int64(7)).Return(models.User{ID: 7}, nil)
+		storage.On("GetOrdersByUserID", mock.Anything, int64(7)).Return(orders, nil)
+		storage.On("RecordAudit", mock.Anything, models.AuditEntry{
+			ActorID:      1,
+			Action:       constants.AuditAdminUserOrders,
+			TargetUserID: 7,
+		}).Return(nil)
+
+		got, err := NewAdminUseCase(storage).GetUserOrders(ctx, 1, 7)
+
+		assert.NoError(t, err)
+		assert.Equal(t, orders, got)
+		storage.AssertExpectations(t)
+	})
+
+	t.Run("неизвестный пользователь", func(t *testing.T) {
+		storage := &testutils.MockAdminStorage{}
+		storage.On("GetUserByID", mock.Anything, int64(7)).Return(models.User{}, models.ErrUserNotFound)
+
+		_, err := NewAdminUseCase(storage).GetUserOrders(ctx, 1, 7)
+
+		assert.ErrorIs(t, err, models.ErrUserNotFound)
+		storage.AssertNotCalled(t, "RecordAudit", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAdminUseCase_GetOrderAccrual(t *testing.T) {
+	ctx := context.Background()
+	storage := &testutils.MockAdminStorage{}
+	state := models.AccrualJobState{
+		Order: models.Order{UserID: 7, Number: "12345678903", Status: constants.StatusProcessing},
+		Job:   &models.AccrualJobStatus{State: constants.JobStatePending, Attempts: 2},
+	}
+	storage.On("GetAccrualJobState", mock.Anything, "12345678903").Return(state, nil)
+	storage.On("RecordAudit", mock.Anything, models.AuditEntry{
+		ActorID:      1,
+		Action:       constants.AuditAdminOrderAccrual,
+		TargetUserID: 7,
+		OrderNumber:  "12345678903",
+	}).Return(nil)
+
+	got, err := NewAdminUseCase(storage).GetOrderAccrual(ctx, 1, "12345678903")
+
+	assert.NoError(t, err)
+	assert.Equal(t, state, got)
+	storage.AssertExpectations(t)
+}
+
+func TestAdminUseCase_AdjustBalance(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		adjustment  models.BalanceAdjustment
+		setupMocks  func(*testutils.MockAdminStorage)
+		expected    money.Amount
+		expectedErr error
+	}{
+		{
+			name:       "начисление",
+			adjustment: models.BalanceAdjustment{UserID: 7, ActorID: 1, Amount: money.MustParse("10"), Reason: "goodwill"},
+			setupMocks: func(s *testutils.MockAdminStorage) {
+				s.On("AdjustBalance", mock.Anything, models.BalanceAdjustment{UserID: 7, ActorID: 1, Amount: money.MustParse("10"), Reason: "goodwill"}).
+					Return(money.MustParse("110"), nil)
+			},
+			expected: money.MustParse("110"),
+		},
+		{
+			name:       "списание больше баланса",
+			adjustment: models.BalanceAdjustment{UserID: 7, ActorID: 1, Amount: money.MustParse("-500"), Reason: "correction"},
+			setupMocks: func(s *testutils.MockAdminStorage) {
+				s.On("AdjustBalance", mock.Anything, mock.Anything).Return(money.Amount(0), models.ErrInsufficientBalance)
+			},
+			expectedErr: models.ErrInsufficientBalance,
+		},
+		{
+			name:        "без причины",
+			adjustment:  models.BalanceAdjustment{UserID: 7, ActorID: 1, Amount: money.MustParse("10")},
+			setupMocks:  func(s *testutils.MockAdminStorage) {},
+			expectedErr: errors.New("adjustment reason is required"),
+		},
+		{
+			name:        "нулевая сумма",
+			adjustment:  models.BalanceAdjustment{UserID: 7, ActorID: 1, Reason: "noop"},
+			setupMocks:  func(s *testutils.MockAdminStorage) {},
+			expectedErr: errors.New("adjustment amount must not be zero"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &testutils.MockAdminStorage{}
+			tt.setupMocks(storage)
+
+			current, err := NewAdminUseCase(storage).AdjustBalance(ctx, tt.adjustment)
+
+			switch {
+			case errors.Is(tt.expectedErr, models.ErrInsufficientBalance):
+				assert.ErrorIs(t, err, models.ErrInsufficientBalance)
+			case tt.expectedErr != nil:
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, current)
+			}
+			storage.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAdminUseCase_ListAudit(t *testing.T) {
+	ctx := context.Background()
+	filter := models.AuditFilter{UserID: 7, Action: constants.AuditUserLogin, Limit: 51}
+	entries := []models.AuditEntry{{ID: 3, Action: constants.AuditUserLogin, TargetUserID: 7}}
+
+	t.Run("чтение журнала тоже журналируется", func(t *testing.T) {
+		storage := &testutils.MockAdminStorage{}
+		storage.On("ListAudit", mock.Anything, filter).Return(entries, nil)
+		storage.On("RecordAudit", mock.Anything, models.AuditEntry{
+			ActorID:      1,
+			Action:       constants.AuditAdminAuditList,
+			TargetUserID: 7,
+			Details:      map[string]any{"action": constants.AuditUserLogin},
+		}).Return(nil)
+
+		got, err := NewAdminUseCase(storage).ListAudit(ctx, 1, filter)
+
+		assert.NoError(t, err)
+		assert.Equal(t, entries, got)
+		storage.AssertExpectations(t)
+	})
+
+	t.Run("ошибка записи в журнал", func(t *testing.T) {
+		storage := &testutils.MockAdminStorage{}
+		storage.On("ListAudit", mock.Anything, filter).Return(entries, nil)
+		storage.On("RecordAudit", mock.Anything, mock.Anything).Return(errors.New("db error"))
+
+		_, err := NewAdminUseCase(storage).ListAudit(ctx, 1, filter)
+
+		assert.Error(t, err)
+	})
+}
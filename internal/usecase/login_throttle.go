@@ -0,0 +1,156 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/tracing"
+)
+
+type LoginAttemptStorage interface {
+	LoginLockedUntil(ctx context.Context, subjects []string, now time.Time) (time.Time, error)
+	RecordLoginFailure(ctx context.Context, subject string, now, windowStart time.Time) (int, error)
+	LockLogin(ctx context.Context, subject string, until time.Time) error
+	ResetLoginFailures(ctx context.Context, subject string) error
+}
+
+// LoginPolicy sets how failed logins are throttled. The first DelayAfter
+// failures in a row are free; after that every failure locks the subject for
+// BaseDelay, doubling with each further failure, and MaxFailures (or
+// IPMaxFailures for a client address) failures lock it for Lockout. Failures
+// older than Window are forgotten.
+type LoginPolicy struct {
+	MaxFailures   int
+	IPMaxFailures int
+	DelayAfter    int
+	BaseDelay     time.Duration
+	Lockout       time.Duration
+	Window        time.Duration
+}
+
+// LoginThrottle tracks failed logins per login and per client address. The
+// counters live in the database, so every replica enforces the same limits.
+type LoginThrottle struct {
+	storage LoginAttemptStorage
+	policy  LoginPolicy
+	scope   string
+	now     func() time.Time
+	logger  *slog.Logger
+}
+
+func NewLoginThrottle(storage LoginAttemptStorage, policy LoginPolicy) *LoginThrottle {
+	return &LoginThrottle{
+		storage: storage,
+		policy:  policy,
+		now:     time.Now,
+		logger:  slog.Default(),
+	}
+}
+
+func (t *LoginThrottle) SetClock(now func() time.Time) {
+	t.now = now
+}
+
+func (t *LoginThrottle) SetLogger(logger *slog.Logger) {
+	t.logger = logger
+}
+
+// SetScope keeps the counters of this throttle apart from those of throttles
+// with another scope, so that one kind of attempt cannot lock out another.
+func (t *LoginThrottle) SetScope(scope string) {
+	t.scope = scope
+}
+
+// Check reports how long the caller has to wait before the next attempt for
+// login from ip is accepted; zero means it may go ahead.
+func (t *LoginThrottle) Check(ctx context.Context, login, ip string) (_ time.Duration, err error) {
+	ctx, span := tracing.Start(ctx, "LoginThrottle.Check")
+	defer func() { tracing.End(span, err) }()
+
+	now := t.now()
+	lockedUntil, err := t.storage.LoginLockedUntil(ctx, []string{t.subject(loginSubject(login)), t.subject(ipSubject(ip))}, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check login lockout: %w", err)
+	}
+	if !lockedUntil.After(now) {
+		return 0, nil
+	}
+	return lockedUntil.Sub(now), nil
+}
+
+// Fail records a failed attempt against both the login and the client address.
+func (t *LoginThrottle) Fail(ctx context.Context, login, ip string) (err error) {
+	ctx, span := tracing.Start(ctx, "LoginThrottle.Fail")
+	defer func() { tracing.End(span, err) }()
+
+	if err := t.fail(ctx, t.subject(loginSubject(login)), t.policy.MaxFailures); err != nil {
+		return err
+	}
+	return t.fail(ctx, t.subject(ipSubject(ip)), t.policy.IPMaxFailures)
+}
+
+// Succeed clears the failures of login. The client address keeps its count
+// until the window passes, otherwise an attacker could reset it by logging in
+// to an account of their own between guesses.
+func (t *LoginThrottle) Succeed(ctx context.Context, login string) (err error) {
+	ctx, span := tracing.Start(ctx, "LoginThrottle.Succeed")
+	defer func() { tracing.End(span, err) }()
+
+	if err := t.storage.ResetLoginFailures(ctx, t.subject(loginSubject(login))); err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+	return nil
+}
+
+func (t *LoginThrottle) fail(ctx context.Context, subject string, maxFailures int) error {
+	now := t.now()
+	failures, err := t.storage.RecordLoginFailure(ctx, subject, now, now.Add(-t.policy.Window))
+	if err != nil {
+		return fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	delay := t.policy.delay(failures, maxFailures)
+	if delay <= 0 {
+		return nil
+	}
+	if err := t.storage.LockLogin(ctx, subject, now.Add(delay)); err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+	t.logger.WarnContext(ctx, "Login locked",
+		slog.String("subject", subject), slog.Int("failures", failures), slog.Duration("delay", delay))
+	return nil
+}
+
+func (p LoginPolicy) delay(failures, maxFailures int) time.Duration {
+	if maxFailures > 0 && failures >= maxFailures {
+		return p.Lockout
+	}
+	if failures < p.DelayAfter || p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.DelayAfter; i < failures && delay < p.Lockout; i++ {
+		delay *= 2
+	}
+	if delay > p.Lockout {
+		delay = p.Lockout
+	}
+	return delay
+}
+
+func (t *LoginThrottle) subject(subject string) string {
+	if t.scope == "" {
+		return subject
+	}
+	return t.scope + ":" + subject
+}
+
+func loginSubject(login string) string {
+	return "login:" + login
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
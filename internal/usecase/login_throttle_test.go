@@ -0,0 +1,145 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var testLoginPolicy = LoginPolicy{
+	MaxFailures:   10,
+	IPMaxFailures: 50,
+	DelayAfter:    3,
+	BaseDelay:     time.Second,
+	Lockout:       15 * time.Minute,
+	Window:        15 * time.Minute,
+}
+
+func TestLoginPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		expected time.Duration
+	}{
+		{name: "первая неудача", failures: 1, expected: 0},
+		{name: "до порога задержки", failures: 2, expected: 0},
+		{name: "порог задержки", failures: 3, expected: time.Second},
+		{name: "задержка удваивается", failures: 4, expected: 2 * time.Second},
+		{name: "девятая неудача", failures: 9, expected: 64 * time.Second},
+		{name: "блокировка", failures: 10, expected: 15 * time.Minute},
+		{name: "после блокировки", failures: 25, expected: 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, testLoginPolicy.delay(tt.failures, testLoginPolicy.MaxFailures))
+		})
+	}
+
+	capped := LoginPolicy{DelayAfter: 1, BaseDelay: time.Minute, Lockout: 5 * time.Minute}
+	assert.Equal(t, 5*time.Minute, capped.delay(30, 0), "the delay never exceeds the lockout")
+}
+
+func TestLoginThrottleCheck(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	subjects := []string{"login:user", "ip:192.0.2.1"}
+
+	tests := []struct {
+		name        string
+		lockedUntil time.Time
+		err         error
+		expected    time.Duration
+		expectedErr bool
+	}{
+		{name: "не заблокирован", lockedUntil: time.Time{}, expected: 0},
+		{name: "заблокирован", lockedUntil: now.Add(30 * time.Second), expected: 30 * time.Second},
+		{name: "ошибка хранилища", err: errors.New("db error"), expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &testutils.MockLoginAttemptStorage{}
+			storage.On("LoginLockedUntil", mock.Anything, subjects, now).Return(tt.lockedUntil, tt.err)
+
+			throttle := NewLoginThrottle(storage, testLoginPolicy)
+			throttle.SetClock(func() time.Time { return now })
+
+			wait, err := throttle.Check(ctx, "user", "192.0.2.1")
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, wait)
+		})
+	}
+}
+
+func TestLoginThrottleFail(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	windowStart := now.Add(-testLoginPolicy.Window)
+
+	storage := &testutils.MockLoginAttemptStorage{}
+	storage.On("RecordLoginFailure", mock.Anything, "login:user", now, windowStart).Return(10, nil)
+	storage.On("LockLogin", mock.Anything, "login:user", now.Add(15*time.Minute)).Return(nil)
+	storage.On("RecordLoginFailure", mock.Anything, "ip:192.0.2.1", now, windowStart).Return(10, nil)
+	storage.On("LockLogin", mock.Anything, "ip:192.0.2.1", now.Add(128*time.Second)).Return(nil)
+
+	throttle := NewLoginThrottle(storage, testLoginPolicy)
+	throttle.SetClock(func() time.Time { return now })
+
+	assert.NoError(t, throttle.Fail(ctx, "user", "192.0.2.1"))
+	storage.AssertExpectations(t)
+}
+
+func TestLoginThrottleFailBelowThreshold(t *testing.T) {
+	ctx := context.Background()
+
+	storage := &testutils.MockLoginAttemptStorage{}
+	storage.On("RecordLoginFailure", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
+
+	throttle := NewLoginThrottle(storage, testLoginPolicy)
+
+	assert.NoError(t, throttle.Fail(ctx, "user", "192.0.2.1"))
+	storage.AssertNotCalled(t, "LockLogin", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestLoginThrottleSucceed(t *testing.T) {
+	ctx := context.Background()
+
+	storage := &testutils.MockLoginAttemptStorage{}
+	storage.On("ResetLoginFailures", mock.Anything, "login:user").Return(nil)
+
+	throttle := NewLoginThrottle(storage, testLoginPolicy)
+
+	assert.NoError(t, throttle.Succeed(ctx, "user"))
+	storage.AssertExpectations(t)
+	storage.AssertNotCalled(t, "ResetLoginFailures", mock.Anything, "ip:192.0.2.1")
+}
+
+func TestLoginThrottleScope(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	storage := &testutils.MockLoginAttemptStorage{}
+	storage.On("LoginLockedUntil", mock.Anything, []string{"reset:login:user", "reset:ip:192.0.2.1"}, now).Return(time.Time{}, nil)
+	storage.On("RecordLoginFailure", mock.Anything, "reset:login:user", now, now.Add(-testLoginPolicy.Window)).Return(1, nil)
+	storage.On("RecordLoginFailure", mock.Anything, "reset:ip:192.0.2.1", now, now.Add(-testLoginPolicy.Window)).Return(1, nil)
+
+	throttle := NewLoginThrottle(storage, testLoginPolicy)
+	throttle.SetClock(func() time.Time { return now })
+	throttle.SetScope("reset")
+
+	wait, err := throttle.Check(ctx, "user", "192.0.2.1")
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+	assert.NoError(t, throttle.Fail(ctx, "user", "192.0.2.1"))
+	storage.AssertExpectations(t)
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/AlenaMolokova/diploma/internal/constants"
 	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/AlenaMolokova/diploma/internal/tracing"
+	"github.com/AlenaMolokova/diploma/internal/validation"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
@@ -19,26 +23,49 @@ var (
 
 type OrderStorage interface {
 	CreateOrder(ctx context.Context, order models.Order) error
+	CreateOrders(ctx context.Context, userID int64, numbers []string, uploadedAt time.Time) (created []string, existing []models.Order, err error)
 	GetOrderByNumber(ctx context.Context, number string) (models.Order, error)
 	GetOrdersByUserID(ctx context.Context, userID int64) ([]models.Order, error)
-	UpdateOrder(ctx context.Context, order models.Order) error
+	ApplyAccrual(ctx context.Context, number, status string, accrual money.Amount) (bool, error)
+}
+
+// OrderUploadResult is the outcome of uploading one number of a batch, one
+// of the constants.Upload* values.
+type OrderUploadResult struct {
+	Number  string
+	Outcome string
 }
 
 type OrderUseCase struct {
 	storage      OrderStorage
 	loyaltyCheck LoyaltyChecker
-	balanceUC    BalanceUseCase
+	validator    validation.OrderValidator
+	now          func() time.Time
+	logger       *slog.Logger
 }
 
-func NewOrderUseCase(storage OrderStorage, loyaltyCheck LoyaltyChecker, balanceUC BalanceUseCase) *OrderUseCase {
+func NewOrderUseCase(storage OrderStorage, loyaltyCheck LoyaltyChecker) *OrderUseCase {
 	return &OrderUseCase{
 		storage:      storage,
 		loyaltyCheck: loyaltyCheck,
-		balanceUC:    balanceUC,
+		validator:    validation.NewLuhnValidator(),
+		now:          time.Now,
+		logger:       slog.Default(),
 	}
 }
 
-func (uc *OrderUseCase) ProcessNewOrder(ctx context.Context, userID int64, orderNumber string) error {
+func (uc *OrderUseCase) SetClock(now func() time.Time) {
+	uc.now = now
+}
+
+func (uc *OrderUseCase) SetLogger(logger *slog.Logger) {
+	uc.logger = logger
+}
+
+func (uc *OrderUseCase) ProcessNewOrder(ctx context.Context, userID int64, orderNumber string) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderUseCase.ProcessNewOrder", tracing.UserID(userID), tracing.Order(orderNumber))
+	defer func() { tracing.End(span, err) }()
+
 	existingOrder, err := uc.storage.GetOrderByNumber(ctx, orderNumber)
 	if err == nil {
 		if existingOrder.UserID == userID {
@@ -53,51 +80,114 @@ func (uc *OrderUseCase) ProcessNewOrder(ctx context.Context, userID int64, order
 		UserID:     userID,
 		Number:     orderNumber,
 		Status:     constants.StatusNew,
-		UploadedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
-	}
-
-	if err == nil && loyaltyResp != nil {
-		switch loyaltyResp.Status {
-		case constants.StatusRegistered, constants.StatusProcessing:
-			order.Status = loyaltyResp.Status
-		case constants.StatusProcessed:
-			order.Status = loyaltyResp.Status
-			order.Accrual = pgtype.Float8{Float64: loyaltyResp.Accrual, Valid: true}
-		case constants.StatusInvalid:
-			order.Status = loyaltyResp.Status
-		}
+		UploadedAt: pgtype.Timestamptz{Time: uc.now(), Valid: true},
 	}
 
 	if err := uc.storage.CreateOrder(ctx, order); err != nil {
 		return fmt.Errorf("failed to create order: %w", err)
 	}
 
-	if loyaltyResp != nil && loyaltyResp.Status == constants.StatusProcessed && loyaltyResp.Accrual > 0 {
-		if err := uc.balanceUC.AddToBalance(ctx, userID, loyaltyResp.Accrual); err != nil {
-			return fmt.Errorf("failed to update balance: %w", err)
+	if err != nil {
+		uc.logger.DebugContext(ctx, "Order left to the accrual poller", slog.Any("error", err))
+		return nil
+	}
+	if loyaltyResp == nil {
+		return nil
+	}
+
+	switch loyaltyResp.Status {
+	case constants.StatusRegistered, constants.StatusProcessing, constants.StatusProcessed, constants.StatusInvalid:
+		// The order is stored and queued by now, so the poller applies the
+		// verdict later if this fails; the upload itself has succeeded.
+		if _, err := uc.storage.ApplyAccrual(ctx, orderNumber, loyaltyResp.Status, loyaltyResp.Accrual); err != nil {
+			uc.logger.WarnContext(ctx, "Failed to apply accrual on upload, left to the poller", slog.Any("error", err))
+			return nil
 		}
+		uc.logger.InfoContext(ctx, "Order checked on upload", slog.String("status", loyaltyResp.Status))
 	}
 
 	return nil
 }
 
-func (uc *OrderUseCase) GetUserOrders(ctx context.Context, userID int64) ([]models.Order, error) {
-	return uc.storage.GetOrdersByUserID(ctx, userID)
-}
+// ProcessNewOrders uploads a batch of order numbers and reports an outcome
+// for each, in the order given. Valid numbers are inserted together in one
+// transaction; unlike a single upload they are not checked with the accrual
+// service right away but left to the poller, so a large batch does not
+// exhaust its quota. A number repeated within the batch counts as already
+// uploaded after its first occurrence.
+func (uc *OrderUseCase) ProcessNewOrders(ctx context.Context, userID int64, numbers []string) (_ []OrderUploadResult, err error) {
+	ctx, span := tracing.Start(ctx, "OrderUseCase.ProcessNewOrders", tracing.UserID(userID), tracing.OrderCountKey.Int(len(numbers)))
+	defer func() { tracing.End(span, err) }()
+
+	outcomes := make(map[string]string, len(numbers))
+	var valid []string
+	for _, number := range numbers {
+		if _, seen := outcomes[number]; seen {
+			continue
+		}
+		if !uc.validator.ValidateOrderNumber(number) {
+			outcomes[number] = constants.UploadInvalid
+			continue
+		}
+		outcomes[number] = ""
+		valid = append(valid, number)
+	}
 
-func (uc *OrderUseCase) UpdateOrderStatus(ctx context.Context, order models.Order, prevStatus string) error {
-	err := uc.storage.UpdateOrder(ctx, order)
-	if err != nil {
-		return fmt.Errorf("failed to update order: %w", err)
+	if len(valid) > 0 {
+		created, existing, err := uc.storage.CreateOrders(ctx, userID, valid, uc.now())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create orders: %w", err)
+		}
+		for _, number := range created {
+			outcomes[number] = constants.UploadAccepted
+		}
+		for _, order := range existing {
+			if order.UserID == userID {
+				outcomes[order.Number] = constants.UploadAlreadyUploaded
+			} else {
+				outcomes[order.Number] = constants.UploadOwnedByOther
+			}
+		}
+		for _, number := range valid {
+			if outcomes[number] == "" {
+				return nil, fmt.Errorf("order %s is missing after upload", number)
+			}
+		}
 	}
 
-	if order.Status == constants.StatusProcessed &&
-		prevStatus != constants.StatusProcessed &&
-		order.Accrual.Valid &&
-		order.Accrual.Float64 > 0 {
-		if err := uc.balanceUC.AddToBalance(ctx, order.UserID, order.Accrual.Float64); err != nil {
-			return fmt.Errorf("failed to update balance for processed order: %w", err)
+	results := make([]OrderUploadResult, len(numbers))
+	reported := make(map[string]bool, len(numbers))
+	accepted := 0
+	for i, number := range numbers {
+		outcome := outcomes[number]
+		if reported[number] && outcome == constants.UploadAccepted {
+			outcome = constants.UploadAlreadyUploaded
+		} else if outcome == constants.UploadAccepted {
+			accepted++
 		}
+		reported[number] = true
+		results[i] = OrderUploadResult{Number: number, Outcome: outcome}
+	}
+
+	uc.logger.InfoContext(ctx, "Order batch uploaded", slog.Int("count", len(numbers)), slog.Int("accepted", accepted))
+	return results, nil
+}
+
+func (uc *OrderUseCase) GetUserOrders(ctx context.Context, userID int64) (_ []models.Order, err error) {
+	ctx, span := tracing.Start(ctx, "OrderUseCase.GetUserOrders", tracing.UserID(userID))
+	defer func() { tracing.End(span, err) }()
+
+	return uc.storage.GetOrdersByUserID(ctx, userID)
+}
+
+// UpdateOrderStatus records the accrual service's verdict for an order. The
+// balance is credited at most once per order no matter how often it is called.
+func (uc *OrderUseCase) UpdateOrderStatus(ctx context.Context, order models.Order) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderUseCase.UpdateOrderStatus", tracing.Order(order.Number), tracing.OrderStatusKey.String(order.Status))
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := uc.storage.ApplyAccrual(ctx, order.Number, order.Status, order.Accrual); err != nil {
+		return fmt.Errorf("failed to update order: %w", err)
 	}
 
 	return nil
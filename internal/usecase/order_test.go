@@ -4,14 +4,18 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/logging"
 	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
 	"github.com/AlenaMolokova/diploma/internal/testutils"
+	"github.com/AlenaMolokova/diploma/internal/tracing"
 	"github.com/AlenaMolokova/diploma/internal/usecase"
-	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type MockLoyaltyClientWrapper struct {
@@ -26,13 +30,13 @@ func TestOrderUseCaseProcessNewOrder(t *testing.T) {
 	tests := []struct {
 		name        string
 		orderNumber string
-		setupMocks  func(*testutils.MockOrderStorage, *testutils.MockLoyaltyClient, *testutils.MockBalanceStorage)
+		setupMocks  func(*testutils.MockOrderStorage, *testutils.MockLoyaltyClient)
 		expectedErr error
 	}{
 		{
 			name:        "успешное создание заказа - StatusNew",
 			orderNumber: validOrderNumber,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return((*models.LoyaltyResponse)(nil), errors.New("not found"))
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
@@ -42,58 +46,60 @@ func TestOrderUseCaseProcessNewOrder(t *testing.T) {
 		{
 			name:        "успешное создание заказа - StatusRegistered",
 			orderNumber: validOrderNumber,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return(&models.LoyaltyResponse{
 					Status: constants.StatusRegistered,
 				}, nil)
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
+				os.On("ApplyAccrual", mock.Anything, validOrderNumber, constants.StatusRegistered, money.Amount(0)).Return(false, nil)
 			},
 			expectedErr: nil,
 		},
 		{
 			name:        "успешное создание заказа - StatusProcessing",
 			orderNumber: validOrderNumber,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return(&models.LoyaltyResponse{
 					Status: constants.StatusProcessing,
 				}, nil)
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
+				os.On("ApplyAccrual", mock.Anything, validOrderNumber, constants.StatusProcessing, money.Amount(0)).Return(false, nil)
 			},
 			expectedErr: nil,
 		},
 		{
 			name:        "успешное создание заказа - StatusProcessed",
 			orderNumber: validOrderNumber,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return(&models.LoyaltyResponse{
 					Status:  constants.StatusProcessed,
-					Accrual: 100.0,
+					Accrual: money.MustParse("100"),
 				}, nil)
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
-				bs.On("GetBalance", mock.Anything, userID).Return(pgtype.Float8{Float64: 0, Valid: true}, pgtype.Float8{}, nil)
-				bs.On("UpdateBalance", mock.Anything, userID, 100.0).Return(nil)
+				os.On("ApplyAccrual", mock.Anything, validOrderNumber, constants.StatusProcessed, money.MustParse("100")).Return(true, nil)
 			},
 			expectedErr: nil,
 		},
 		{
 			name:        "успешное создание заказа - StatusInvalid",
 			orderNumber: validOrderNumber,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return(&models.LoyaltyResponse{
 					Status: constants.StatusInvalid,
 				}, nil)
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
+				os.On("ApplyAccrual", mock.Anything, validOrderNumber, constants.StatusInvalid, money.Amount(0)).Return(false, nil)
 			},
 			expectedErr: nil,
 		},
 		{
 			name:        "ошибка проверки заказа",
 			orderNumber: validOrderNumber,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return((*models.LoyaltyResponse)(nil), errors.New("rate limit"))
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
@@ -103,7 +109,7 @@ func TestOrderUseCaseProcessNewOrder(t *testing.T) {
 		{
 			name:        "заказ уже существует",
 			orderNumber: validOrderNumber,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{UserID: userID}, nil)
 			},
 			expectedErr: usecase.ErrOrderAlreadyExists,
@@ -111,7 +117,7 @@ func TestOrderUseCaseProcessNewOrder(t *testing.T) {
 		{
 			name:        "заказ принадлежит другому пользователю",
 			orderNumber: validOrderNumber,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{UserID: 2}, nil)
 			},
 			expectedErr: usecase.ErrOrderBelongsToOtherUser,
@@ -119,7 +125,7 @@ func TestOrderUseCaseProcessNewOrder(t *testing.T) {
 		{
 			name:        "ошибка создания заказа",
 			orderNumber: validOrderNumber,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return((*models.LoyaltyResponse)(nil), errors.New("not found"))
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(errors.New("db error"))
@@ -127,19 +133,17 @@ func TestOrderUseCaseProcessNewOrder(t *testing.T) {
 			expectedErr: errors.New("failed to create order: db error"),
 		},
 		{
-			name:        "ошибка обновления баланса",
+			name:        "ошибка обновления баланса не отменяет загрузку",
 			orderNumber: validOrderNumber,
-			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient, bs *testutils.MockBalanceStorage) {
+			setupMocks: func(os *testutils.MockOrderStorage, lc *testutils.MockLoyaltyClient) {
 				os.On("GetOrderByNumber", mock.Anything, validOrderNumber).Return(models.Order{}, errors.New("not found"))
 				lc.On("CheckOrder", mock.Anything, validOrderNumber).Return(&models.LoyaltyResponse{
 					Status:  constants.StatusProcessed,
-					Accrual: 100.0,
+					Accrual: money.MustParse("100"),
 				}, nil)
 				os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
-				bs.On("GetBalance", mock.Anything, userID).Return(pgtype.Float8{Float64: 0, Valid: true}, pgtype.Float8{}, nil)
-				bs.On("UpdateBalance", mock.Anything, userID, 100.0).Return(errors.New("db error"))
+				os.On("ApplyAccrual", mock.Anything, validOrderNumber, constants.StatusProcessed, money.MustParse("100")).Return(false, errors.New("db error"))
 			},
-			expectedErr: errors.New("failed to update balance: db error"),
 		},
 	}
 
@@ -147,11 +151,9 @@ func TestOrderUseCaseProcessNewOrder(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			os := &testutils.MockOrderStorage{}
 			lc := &testutils.MockLoyaltyClient{}
-			bs := &testutils.MockBalanceStorage{}
-			tt.setupMocks(os, lc, bs)
+			tt.setupMocks(os, lc)
 
-			balanceUC := usecase.NewBalanceUseCase(bs)
-			uc := usecase.NewOrderUseCase(os, &MockLoyaltyClientWrapper{lc}, balanceUC)
+			uc := usecase.NewOrderUseCase(os, &MockLoyaltyClientWrapper{lc})
 
 			err := uc.ProcessNewOrder(ctx, userID, tt.orderNumber)
 
@@ -164,7 +166,108 @@ func TestOrderUseCaseProcessNewOrder(t *testing.T) {
 
 			os.AssertExpectations(t)
 			lc.AssertExpectations(t)
-			bs.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOrderUseCaseProcessNewOrderTraced(t *testing.T) {
+	spans := testutils.RecordSpans(t)
+	orderNumber := "4532015112830366"
+
+	var checkTrace, createTrace trace.TraceID
+	os := &testutils.MockOrderStorage{}
+	lc := &testutils.MockLoyaltyClient{}
+	os.On("GetOrderByNumber", mock.Anything, orderNumber).Return(models.Order{}, errors.New("not found"))
+	lc.On("CheckOrder", mock.Anything, orderNumber).Return((*models.LoyaltyResponse)(nil), errors.New("rate limit")).
+		Run(func(args mock.Arguments) {
+			checkTrace = trace.SpanContextFromContext(args.Get(0).(context.Context)).TraceID()
+		})
+	os.On("CreateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil).
+		Run(func(args mock.Arguments) {
+			createTrace = trace.SpanContextFromContext(args.Get(0).(context.Context)).TraceID()
+		})
+
+	uc := usecase.NewOrderUseCase(os, &MockLoyaltyClientWrapper{lc})
+	assert.NoError(t, uc.ProcessNewOrder(context.Background(), 1, orderNumber))
+
+	recorded := spans.GetSpans()
+	assert.Len(t, recorded, 1)
+	span := recorded[0]
+	assert.Equal(t, "OrderUseCase.ProcessNewOrder", span.Name)
+	assert.Contains(t, span.Attributes, tracing.Order(orderNumber))
+	assert.Equal(t, span.SpanContext.TraceID(), checkTrace, "the accrual check runs in the upload's trace")
+	assert.Equal(t, span.SpanContext.TraceID(), createTrace, "the order is stored in the upload's trace")
+}
+
+func TestOrderUseCaseProcessNewOrders(t *testing.T) {
+	userID := int64(1)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	const (
+		fresh   = "4532015112830366"
+		mine    = "79927398713"
+		theirs  = "12345678903"
+		invalid = "12345678900"
+	)
+
+	tests := []struct {
+		name       string
+		numbers    []string
+		setupMocks func(*testutils.MockOrderStorage)
+		expected   []usecase.OrderUploadResult
+		wantErr    bool
+	}{
+		{
+			name:    "все исходы в одной пачке",
+			numbers: []string{fresh, mine, invalid, theirs, fresh, "abc"},
+			setupMocks: func(os *testutils.MockOrderStorage) {
+				os.On("CreateOrders", mock.Anything, userID, []string{fresh, mine, theirs}, now).Return(
+					[]string{fresh},
+					[]models.Order{{UserID: userID, Number: mine}, {UserID: 2, Number: theirs}},
+					nil,
+				)
+			},
+			expected: []usecase.OrderUploadResult{
+				{Number: fresh, Outcome: constants.UploadAccepted},
+				{Number: mine, Outcome: constants.UploadAlreadyUploaded},
+				{Number: invalid, Outcome: constants.UploadInvalid},
+				{Number: theirs, Outcome: constants.UploadOwnedByOther},
+				{Number: fresh, Outcome: constants.UploadAlreadyUploaded},
+				{Number: "abc", Outcome: constants.UploadInvalid},
+			},
+		},
+		{
+			name:       "только невалидные номера не трогают хранилище",
+			numbers:    []string{invalid},
+			setupMocks: func(os *testutils.MockOrderStorage) {},
+			expected:   []usecase.OrderUploadResult{{Number: invalid, Outcome: constants.UploadInvalid}},
+		},
+		{
+			name:    "ошибка хранилища",
+			numbers: []string{fresh},
+			setupMocks: func(os *testutils.MockOrderStorage) {
+				os.On("CreateOrders", mock.Anything, userID, []string{fresh}, now).Return([]string(nil), []models.Order(nil), errors.New("db error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderStorage := new(testutils.MockOrderStorage)
+			tt.setupMocks(orderStorage)
+
+			uc := usecase.NewOrderUseCase(orderStorage, new(testutils.MockLoyaltyClient))
+			uc.SetClock(func() time.Time { return now })
+			uc.SetLogger(logging.Discard())
+
+			results, err := uc.ProcessNewOrders(context.Background(), userID, tt.numbers)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, results)
+			}
+			orderStorage.AssertExpectations(t)
 		})
 	}
 }
@@ -212,7 +315,7 @@ func TestOrderUseCaseGetUserOrders(t *testing.T) {
 			os := &testutils.MockOrderStorage{}
 			tt.setupMocks(os)
 
-			uc := usecase.NewOrderUseCase(os, nil, nil)
+			uc := usecase.NewOrderUseCase(os, nil)
 			orders, err := uc.GetUserOrders(ctx, userID)
 
 			if tt.expectedErr != nil {
@@ -235,8 +338,7 @@ func TestOrderUseCaseUpdateOrderStatus(t *testing.T) {
 	tests := []struct {
 		name        string
 		order       models.Order
-		prevStatus  string
-		setupMocks  func(*testutils.MockOrderStorage, *testutils.MockBalanceStorage)
+		setupMocks  func(*testutils.MockOrderStorage)
 		expectedErr error
 	}{
 		{
@@ -245,56 +347,36 @@ func TestOrderUseCaseUpdateOrderStatus(t *testing.T) {
 				UserID:  userID,
 				Number:  "123",
 				Status:  constants.StatusProcessed,
-				Accrual: pgtype.Float8{Float64: 100.0, Valid: true},
+				Accrual: money.MustParse("100"),
 			},
-			prevStatus: constants.StatusProcessing,
-			setupMocks: func(os *testutils.MockOrderStorage, bs *testutils.MockBalanceStorage) {
-				os.On("UpdateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
-				bs.On("GetBalance", mock.Anything, userID).Return(pgtype.Float8{Float64: 0, Valid: true}, pgtype.Float8{}, nil)
-				bs.On("UpdateBalance", mock.Anything, userID, 100.0).Return(nil)
+			setupMocks: func(os *testutils.MockOrderStorage) {
+				os.On("ApplyAccrual", mock.Anything, "123", constants.StatusProcessed, money.MustParse("100")).Return(true, nil)
 			},
 			expectedErr: nil,
 		},
 		{
 			name: "ошибка обновления заказа",
-			order: models.Order{
-				UserID: userID,
-				Number: "123",
-				Status: constants.StatusProcessed,
-			},
-			prevStatus: constants.StatusProcessing,
-			setupMocks: func(os *testutils.MockOrderStorage, bs *testutils.MockBalanceStorage) {
-				os.On("UpdateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(errors.New("db error"))
-			},
-			expectedErr: errors.New("failed to update order: db error"),
-		},
-		{
-			name: "ошибка обновления баланса",
 			order: models.Order{
 				UserID:  userID,
 				Number:  "123",
 				Status:  constants.StatusProcessed,
-				Accrual: pgtype.Float8{Float64: 100.0, Valid: true},
+				Accrual: money.MustParse("100"),
 			},
-			prevStatus: constants.StatusProcessing,
-			setupMocks: func(os *testutils.MockOrderStorage, bs *testutils.MockBalanceStorage) {
-				os.On("UpdateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
-				bs.On("GetBalance", mock.Anything, userID).Return(pgtype.Float8{Float64: 0, Valid: true}, pgtype.Float8{}, nil)
-				bs.On("UpdateBalance", mock.Anything, userID, 100.0).Return(errors.New("db error"))
+			setupMocks: func(os *testutils.MockOrderStorage) {
+				os.On("ApplyAccrual", mock.Anything, "123", constants.StatusProcessed, money.MustParse("100")).Return(false, errors.New("db error"))
 			},
-			expectedErr: errors.New("failed to update balance for processed order: db error"),
+			expectedErr: errors.New("failed to update order: db error"),
 		},
 		{
-			name: "без обновления баланса (тот же статус)",
+			name: "повторное начисление не выполняется",
 			order: models.Order{
 				UserID:  userID,
 				Number:  "123",
 				Status:  constants.StatusProcessed,
-				Accrual: pgtype.Float8{Float64: 100.0, Valid: true},
+				Accrual: money.MustParse("100"),
 			},
-			prevStatus: constants.StatusProcessed,
-			setupMocks: func(os *testutils.MockOrderStorage, bs *testutils.MockBalanceStorage) {
-				os.On("UpdateOrder", mock.Anything, mock.AnythingOfType("models.Order")).Return(nil)
+			setupMocks: func(os *testutils.MockOrderStorage) {
+				os.On("ApplyAccrual", mock.Anything, "123", constants.StatusProcessed, money.MustParse("100")).Return(false, nil)
 			},
 			expectedErr: nil,
 		},
@@ -303,13 +385,11 @@ func TestOrderUseCaseUpdateOrderStatus(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			os := &testutils.MockOrderStorage{}
-			bs := &testutils.MockBalanceStorage{}
-			tt.setupMocks(os, bs)
+			tt.setupMocks(os)
 
-			balanceUC := usecase.NewBalanceUseCase(bs)
-			uc := usecase.NewOrderUseCase(os, &MockLoyaltyClientWrapper{nil}, balanceUC)
+			uc := usecase.NewOrderUseCase(os, &MockLoyaltyClientWrapper{nil})
 
-			err := uc.UpdateOrderStatus(ctx, tt.order, tt.prevStatus)
+			err := uc.UpdateOrderStatus(ctx, tt.order)
 
 			if tt.expectedErr != nil {
 				assert.Error(t, err)
@@ -319,7 +399,6 @@ func TestOrderUseCaseUpdateOrderStatus(t *testing.T) {
 			}
 
 			os.AssertExpectations(t)
-			bs.AssertExpectations(t)
 		})
 	}
 }
@@ -0,0 +1,152 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/auth"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/tracing"
+	"github.com/AlenaMolokova/diploma/internal/validation"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordStorage interface {
+	GetUserByID(ctx context.Context, id int64) (models.User, error)
+	GetUserByLogin(ctx context.Context, login string) (models.User, error)
+	ChangePassword(ctx context.Context, userID int64, passwordHash string) error
+	CreatePasswordReset(ctx context.Context, reset models.PasswordReset) error
+	GetPasswordReset(ctx context.Context, tokenHash string, now time.Time) (models.User, error)
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string, now time.Time) (int64, error)
+}
+
+type PasswordResetNotifier interface {
+	SendPasswordReset(ctx context.Context, login, token string, expiresAt time.Time) error
+}
+
+// PasswordUseCase changes and resets passwords. Either way every existing
+// session of the user is revoked.
+type PasswordUseCase struct {
+	storage   PasswordStorage
+	validator validation.PasswordValidator
+	notifier  PasswordResetNotifier
+	resetTTL  time.Duration
+	now       func() time.Time
+	logger    *slog.Logger
+}
+
+func NewPasswordUseCase(storage PasswordStorage, validator validation.PasswordValidator, notifier PasswordResetNotifier, resetTTL time.Duration) *PasswordUseCase {
+	return &PasswordUseCase{
+		storage:   storage,
+		validator: validator,
+		notifier:  notifier,
+		resetTTL:  resetTTL,
+		now:       time.Now,
+		logger:    slog.Default(),
+	}
+}
+
+func (uc *PasswordUseCase) SetClock(now func() time.Time) {
+	uc.now = now
+}
+
+func (uc *PasswordUseCase) SetLogger(logger *slog.Logger) {
+	uc.logger = logger
+}
+
+// ChangePassword replaces the password of userID after checking the old one.
+// It returns models.ErrWrongPassword for a wrong old password and a
+// *validation.PolicyError if the new one breaks the policy.
+func (uc *PasswordUseCase) ChangePassword(ctx context.Context, userID int64, oldPassword, newPassword string) (err error) {
+	ctx, span := tracing.Start(ctx, "PasswordUseCase.ChangePassword", tracing.UserID(userID))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := uc.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword)); err != nil {
+		return models.ErrWrongPassword
+	}
+	if err := uc.validator.ValidatePassword(user.Login, newPassword); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := uc.storage.ChangePassword(ctx, userID, string(hash)); err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+	return nil
+}
+
+// RequestPasswordReset sends a reset token to the owner of login. Unknown
+// logins are not reported, so the endpoint cannot be used to probe for them.
+func (uc *PasswordUseCase) RequestPasswordReset(ctx context.Context, login string) (err error) {
+	ctx, span := tracing.Start(ctx, "PasswordUseCase.RequestPasswordReset")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := uc.storage.GetUserByLogin(ctx, login)
+	if errors.Is(err, models.ErrUserNotFound) {
+		uc.logger.InfoContext(ctx, "Password reset requested for unknown login", slog.String("login", login))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := uc.now().Add(uc.resetTTL)
+	if err := uc.storage.CreatePasswordReset(ctx, models.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return fmt.Errorf("failed to store reset token: %w", err)
+	}
+
+	if err := uc.notifier.SendPasswordReset(ctx, user.Login, token, expiresAt); err != nil {
+		return fmt.Errorf("failed to send reset token: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token. It returns
+// models.ErrResetTokenInvalid for an unknown, spent or expired token and a
+// *validation.PolicyError if the new password breaks the policy.
+func (uc *PasswordUseCase) ResetPassword(ctx context.Context, token, newPassword string) (err error) {
+	ctx, span := tracing.Start(ctx, "PasswordUseCase.ResetPassword")
+	defer func() { tracing.End(span, err) }()
+
+	tokenHash := auth.HashToken(token)
+	user, err := uc.storage.GetPasswordReset(ctx, tokenHash, uc.now())
+	if err != nil {
+		if errors.Is(err, models.ErrResetTokenInvalid) {
+			return err
+		}
+		return fmt.Errorf("failed to get reset token: %w", err)
+	}
+	if err := uc.validator.ValidatePassword(user.Login, newPassword); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if _, err := uc.storage.ResetPassword(ctx, tokenHash, string(hash), uc.now()); err != nil {
+		if errors.Is(err, models.ErrResetTokenInvalid) {
+			return err
+		}
+		return fmt.Errorf("failed to reset password: %w", err)
+	}
+	return nil
+}
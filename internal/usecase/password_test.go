@@ -0,0 +1,215 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/auth"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/testutils"
+	"github.com/AlenaMolokova/diploma/internal/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	oldHash, _ := bcrypt.GenerateFromPassword([]byte("old-password"), bcrypt.MinCost)
+	user := models.User{ID: 1, Login: "alice", Password: string(oldHash)}
+
+	tests := []struct {
+		name        string
+		oldPassword string
+		newPassword string
+		setupMocks  func(*testutils.MockPasswordStorage)
+		expectedErr error
+		policyErr   bool
+	}{
+		{
+			name:        "успешная смена пароля",
+			oldPassword: "old-password",
+			newPassword: "new-password",
+			setupMocks: func(ps *testutils.MockPasswordStorage) {
+				ps.On("GetUserByID", mock.Anything, int64(1)).Return(user, nil)
+				ps.On("ChangePassword", mock.Anything, int64(1), mock.MatchedBy(func(hash string) bool {
+					return bcrypt.CompareHashAndPassword([]byte(hash), []byte("new-password")) == nil
+				})).Return(nil)
+			},
+		},
+		{
+			name:        "неверный старый пароль",
+			oldPassword: "wrong-password",
+			newPassword: "new-password",
+			setupMocks: func(ps *testutils.MockPasswordStorage) {
+				ps.On("GetUserByID", mock.Anything, int64(1)).Return(user, nil)
+			},
+			expectedErr: models.ErrWrongPassword,
+		},
+		{
+			name:        "новый пароль нарушает политику",
+			oldPassword: "old-password",
+			newPassword: "alice-2024",
+			setupMocks: func(ps *testutils.MockPasswordStorage) {
+				ps.On("GetUserByID", mock.Anything, int64(1)).Return(user, nil)
+			},
+			policyErr: true,
+		},
+		{
+			name:        "ошибка хранилища",
+			oldPassword: "old-password",
+			newPassword: "new-password",
+			setupMocks: func(ps *testutils.MockPasswordStorage) {
+				ps.On("GetUserByID", mock.Anything, int64(1)).Return(user, nil)
+				ps.On("ChangePassword", mock.Anything, int64(1), mock.Anything).Return(errors.New("db error"))
+			},
+			expectedErr: errors.New("failed to change password: db error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &testutils.MockPasswordStorage{}
+			tt.setupMocks(storage)
+			uc := NewPasswordUseCase(storage, validation.NewDefaultPasswordValidator(), &testutils.MockNotifier{}, time.Hour)
+
+			err := uc.ChangePassword(ctx, 1, tt.oldPassword, tt.newPassword)
+
+			switch {
+			case tt.policyErr:
+				var policyErr *validation.PolicyError
+				assert.ErrorAs(t, err, &policyErr)
+				storage.AssertNotCalled(t, "ChangePassword", mock.Anything, mock.Anything, mock.Anything)
+			case tt.expectedErr != nil:
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			default:
+				assert.NoError(t, err)
+			}
+			storage.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("токен отправлен владельцу", func(t *testing.T) {
+		storage := &testutils.MockPasswordStorage{}
+		notifier := &testutils.MockNotifier{}
+		var stored models.PasswordReset
+		storage.On("GetUserByLogin", mock.Anything, "alice").Return(models.User{ID: 1, Login: "alice"}, nil)
+		storage.On("CreatePasswordReset", mock.Anything, mock.AnythingOfType("models.PasswordReset")).
+			Run(func(args mock.Arguments) { stored = args.Get(1).(models.PasswordReset) }).
+			Return(nil)
+		var sent string
+		notifier.On("SendPasswordReset", mock.Anything, "alice", mock.Anything, now.Add(time.Hour)).
+			Run(func(args mock.Arguments) { sent = args.String(2) }).
+			Return(nil)
+
+		uc := NewPasswordUseCase(storage, validation.NewDefaultPasswordValidator(), notifier, time.Hour)
+		uc.SetClock(func() time.Time { return now })
+
+		require.NoError(t, uc.RequestPasswordReset(ctx, "alice"))
+		assert.Equal(t, int64(1), stored.UserID)
+		assert.Equal(t, now.Add(time.Hour), stored.ExpiresAt)
+		assert.NotEmpty(t, sent)
+		assert.Equal(t, auth.HashToken(sent), stored.TokenHash, "only the hash of the token is stored")
+	})
+
+	t.Run("неизвестный логин", func(t *testing.T) {
+		storage := &testutils.MockPasswordStorage{}
+		notifier := &testutils.MockNotifier{}
+		storage.On("GetUserByLogin", mock.Anything, "nobody").Return(models.User{}, models.ErrUserNotFound)
+
+		uc := NewPasswordUseCase(storage, validation.NewDefaultPasswordValidator(), notifier, time.Hour)
+
+		assert.NoError(t, uc.RequestPasswordReset(ctx, "nobody"))
+		notifier.AssertNotCalled(t, "SendPasswordReset", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("ошибка доставки", func(t *testing.T) {
+		storage := &testutils.MockPasswordStorage{}
+		notifier := &testutils.MockNotifier{}
+		storage.On("GetUserByLogin", mock.Anything, "alice").Return(models.User{ID: 1, Login: "alice"}, nil)
+		storage.On("CreatePasswordReset", mock.Anything, mock.Anything).Return(nil)
+		notifier.On("SendPasswordReset", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(errors.New("smtp down"))
+
+		uc := NewPasswordUseCase(storage, validation.NewDefaultPasswordValidator(), notifier, time.Hour)
+
+		assert.Error(t, uc.RequestPasswordReset(ctx, "alice"))
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tokenHash := auth.HashToken("reset-token")
+
+	tests := []struct {
+		name        string
+		newPassword string
+		setupMocks  func(*testutils.MockPasswordStorage)
+		expectedErr error
+		policyErr   bool
+	}{
+		{
+			name:        "успешный сброс",
+			newPassword: "new-password",
+			setupMocks: func(ps *testutils.MockPasswordStorage) {
+				ps.On("GetPasswordReset", mock.Anything, tokenHash, now).Return(models.User{ID: 1, Login: "alice"}, nil)
+				ps.On("ResetPassword", mock.Anything, tokenHash, mock.Anything, now).Return(int64(1), nil)
+			},
+		},
+		{
+			name:        "неизвестный токен",
+			newPassword: "new-password",
+			setupMocks: func(ps *testutils.MockPasswordStorage) {
+				ps.On("GetPasswordReset", mock.Anything, tokenHash, now).Return(models.User{}, models.ErrResetTokenInvalid)
+			},
+			expectedErr: models.ErrResetTokenInvalid,
+		},
+		{
+			name:        "токен потрачен параллельным запросом",
+			newPassword: "new-password",
+			setupMocks: func(ps *testutils.MockPasswordStorage) {
+				ps.On("GetPasswordReset", mock.Anything, tokenHash, now).Return(models.User{ID: 1, Login: "alice"}, nil)
+				ps.On("ResetPassword", mock.Anything, tokenHash, mock.Anything, now).Return(int64(0), models.ErrResetTokenInvalid)
+			},
+			expectedErr: models.ErrResetTokenInvalid,
+		},
+		{
+			name:        "пароль нарушает политику",
+			newPassword: "short",
+			setupMocks: func(ps *testutils.MockPasswordStorage) {
+				ps.On("GetPasswordReset", mock.Anything, tokenHash, now).Return(models.User{ID: 1, Login: "alice"}, nil)
+			},
+			policyErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &testutils.MockPasswordStorage{}
+			tt.setupMocks(storage)
+			uc := NewPasswordUseCase(storage, validation.NewDefaultPasswordValidator(), &testutils.MockNotifier{}, time.Hour)
+			uc.SetClock(func() time.Time { return now })
+
+			err := uc.ResetPassword(ctx, "reset-token", tt.newPassword)
+
+			switch {
+			case tt.policyErr:
+				var policyErr *validation.PolicyError
+				assert.ErrorAs(t, err, &policyErr)
+			case tt.expectedErr != nil:
+				assert.ErrorIs(t, err, tt.expectedErr)
+			default:
+				assert.NoError(t, err)
+			}
+			storage.AssertExpectations(t)
+		})
+	}
+}
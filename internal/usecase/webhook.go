@@ -0,0 +1,116 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/AlenaMolokova/diploma/internal/auth"
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/tracing"
+)
+
+var (
+	ErrInvalidWebhookURL    = errors.New("webhook url must be an absolute http or https url")
+	ErrInvalidWebhookEvents = errors.New("webhook events must be a non-empty list of known events")
+)
+
+// webhookEvents are the events a webhook can subscribe to.
+var webhookEvents = []string{
+	constants.WebhookOrderProcessed,
+	constants.WebhookWithdrawalCreated,
+}
+
+type WebhookStorage interface {
+	CreateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error)
+	ListWebhooks(ctx context.Context, userID int64) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, actorID, userID, id int64) error
+	ListWebhookLog(ctx context.Context, userID, id int64, limit int) ([]models.WebhookLogEntry, error)
+}
+
+// WebhookUseCase manages the webhooks of a user and, for admins, the global
+// webhooks, which are those with a zero user id. Creating and deleting a
+// webhook is audited by the storage.
+type WebhookUseCase struct {
+	storage WebhookStorage
+}
+
+func NewWebhookUseCase(storage WebhookStorage) *WebhookUseCase {
+	return &WebhookUseCase{storage: storage}
+}
+
+// CreateWebhook checks the url and events of webhook and stores it with a
+// fresh signing secret. The returned webhook is the only place the secret is
+// shown.
+func (uc *WebhookUseCase) CreateWebhook(ctx context.Context, webhook models.Webhook) (_ models.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookUseCase.CreateWebhook", tracing.UserID(webhook.CreatedBy))
+	defer func() { tracing.End(span, err) }()
+
+	target, err := url.Parse(webhook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return models.Webhook{}, ErrInvalidWebhookURL
+	}
+	if len(webhook.Events) == 0 {
+		return models.Webhook{}, ErrInvalidWebhookEvents
+	}
+	events := make([]string, 0, len(webhook.Events))
+	for _, event := range webhook.Events {
+		if !slices.Contains(webhookEvents, event) {
+			return models.Webhook{}, ErrInvalidWebhookEvents
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	webhook.Events = events
+
+	if webhook.Secret, err = auth.GenerateToken(); err != nil {
+		return models.Webhook{}, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	created, err := uc.storage.CreateWebhook(ctx, webhook)
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return created, nil
+}
+
+// ListWebhooks lists the webhooks of userID, or the global ones when userID
+// is zero.
+func (uc *WebhookUseCase) ListWebhooks(ctx context.Context, userID int64) (_ []models.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookUseCase.ListWebhooks", tracing.UserID(userID))
+	defer func() { tracing.End(span, err) }()
+
+	webhooks, err := uc.storage.ListWebhooks(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes the webhook id of userID, or a global one when userID
+// is zero, on behalf of actorID.
+func (uc *WebhookUseCase) DeleteWebhook(ctx context.Context, actorID, userID, id int64) (err error) {
+	ctx, span := tracing.Start(ctx, "WebhookUseCase.DeleteWebhook", tracing.UserID(actorID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := uc.storage.DeleteWebhook(ctx, actorID, userID, id); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	return nil
+}
+
+// GetWebhookLog returns the last limit delivery attempts of the webhook id
+// of userID, or of a global one when userID is zero.
+func (uc *WebhookUseCase) GetWebhookLog(ctx context.Context, userID, id int64, limit int) (_ []models.WebhookLogEntry, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookUseCase.GetWebhookLog", tracing.UserID(userID))
+	defer func() { tracing.End(span, err) }()
+
+	entries, err := uc.storage.ListWebhookLog(ctx, userID, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook log: %w", err)
+	}
+	return entries, nil
+}
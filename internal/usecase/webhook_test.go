@@ -0,0 +1,103 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookUseCase_CreateWebhook(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		webhook     models.Webhook
+		setupMocks  func(*testutils.MockWebhookStorage)
+		expectedErr error
+	}{
+		{
+			name: "вебхук создаётся с секретом, события без повторов",
+			webhook: models.Webhook{
+				UserID:    1,
+				URL:       "https://example.com/hook",
+				Events:    []string{constants.WebhookWithdrawalCreated, constants.WebhookOrderProcessed, constants.WebhookWithdrawalCreated},
+				CreatedBy: 1,
+			},
+			setupMocks: func(s *testutils.MockWebhookStorage) {
+				s.On("CreateWebhook", mock.Anything, mock.MatchedBy(func(w models.Webhook) bool {
+					return w.UserID == 1 && w.URL == "https://example.com/hook" && len(w.Secret) >= 32 &&
+						slices.Equal(w.Events, []string{constants.WebhookWithdrawalCreated, constants.WebhookOrderProcessed})
+				})).Return(models.Webhook{ID: 5}, nil)
+			},
+		},
+		{
+			name:        "адрес без схемы",
+			webhook:     models.Webhook{URL: "example.com/hook", Events: []string{constants.WebhookOrderProcessed}},
+			setupMocks:  func(s *testutils.MockWebhookStorage) {},
+			expectedErr: ErrInvalidWebhookURL,
+		},
+		{
+			name:        "неподдерживаемая схема",
+			webhook:     models.Webhook{URL: "file:///etc/passwd", Events: []string{constants.WebhookOrderProcessed}},
+			setupMocks:  func(s *testutils.MockWebhookStorage) {},
+			expectedErr: ErrInvalidWebhookURL,
+		},
+		{
+			name:        "без событий",
+			webhook:     models.Webhook{URL: "https://example.com/hook"},
+			setupMocks:  func(s *testutils.MockWebhookStorage) {},
+			expectedErr: ErrInvalidWebhookEvents,
+		},
+		{
+			name:        "неизвестное событие",
+			webhook:     models.Webhook{URL: "https://example.com/hook", Events: []string{"order.deleted"}},
+			setupMocks:  func(s *testutils.MockWebhookStorage) {},
+			expectedErr: ErrInvalidWebhookEvents,
+		},
+		{
+			name:    "ошибка хранилища",
+			webhook: models.Webhook{URL: "https://example.com/hook", Events: []string{constants.WebhookOrderProcessed}},
+			setupMocks: func(s *testutils.MockWebhookStorage) {
+				s.On("CreateWebhook", mock.Anything, mock.Anything).Return(models.Webhook{}, errors.New("db error"))
+			},
+			expectedErr: errors.New("failed to create webhook: db error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := new(testutils.MockWebhookStorage)
+			tt.setupMocks(storage)
+			uc := NewWebhookUseCase(storage)
+
+			webhook, err := uc.CreateWebhook(ctx, tt.webhook)
+
+			if tt.expectedErr != nil {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, int64(5), webhook.ID)
+			}
+			storage.AssertExpectations(t)
+		})
+	}
+}
+
+func TestWebhookUseCase_DeleteWebhook(t *testing.T) {
+	storage := new(testutils.MockWebhookStorage)
+	storage.On("DeleteWebhook", mock.Anything, int64(1), int64(0), int64(5)).Return(models.ErrWebhookNotFound)
+	uc := NewWebhookUseCase(storage)
+
+	err := uc.DeleteWebhook(context.Background(), 1, 0, 5)
+
+	assert.ErrorIs(t, err, models.ErrWebhookNotFound)
+	storage.AssertExpectations(t)
+}
@@ -2,34 +2,44 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
+	"github.com/AlenaMolokova/diploma/internal/tracing"
 	"github.com/AlenaMolokova/diploma/internal/validation"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type WithdrawalStorage interface {
-	CreateWithdrawal(ctx context.Context, withdrawal models.Withdrawal) error
-	GetWithdrawalsByUserID(ctx context.Context, userID int64) ([]models.Withdrawal, error)
+	Withdraw(ctx context.Context, withdrawal models.Withdrawal) error
+	ListWithdrawals(ctx context.Context, filter models.WithdrawalFilter) ([]models.Withdrawal, error)
 }
 
 type WithdrawalUseCase struct {
 	storage   WithdrawalStorage
-	balanceUC BalanceUseCase
 	validator validation.OrderValidator
+	now       func() time.Time
 }
 
-func NewWithdrawalUseCase(storage WithdrawalStorage, balanceUC BalanceUseCase) *WithdrawalUseCase {
+func NewWithdrawalUseCase(storage WithdrawalStorage) *WithdrawalUseCase {
 	return &WithdrawalUseCase{
 		storage:   storage,
-		balanceUC: balanceUC,
 		validator: validation.NewLuhnValidator(),
+		now:       time.Now,
 	}
 }
 
-func (uc *WithdrawalUseCase) ProcessWithdrawal(ctx context.Context, userID int64, orderNumber string, amount float64) error {
+func (uc *WithdrawalUseCase) SetClock(now func() time.Time) {
+	uc.now = now
+}
+
+func (uc *WithdrawalUseCase) ProcessWithdrawal(ctx context.Context, userID int64, orderNumber string, amount money.Amount) (err error) {
+	ctx, span := tracing.Start(ctx, "WithdrawalUseCase.ProcessWithdrawal", tracing.UserID(userID), tracing.Order(orderNumber))
+	defer func() { tracing.End(span, err) }()
+
 	if amount <= 0 {
 		return fmt.Errorf("withdrawal amount must be positive")
 	}
@@ -38,26 +48,29 @@ func (uc *WithdrawalUseCase) ProcessWithdrawal(ctx context.Context, userID int64
 		return fmt.Errorf("invalid order number")
 	}
 
-	if err := uc.balanceUC.WithdrawFromBalance(ctx, userID, amount, orderNumber); err != nil {
-		return err
-	}
-
 	withdrawal := models.Withdrawal{
 		UserID:      userID,
 		OrderNumber: orderNumber,
-		Sum:         pgtype.Float8{Float64: amount, Valid: true},
-		ProcessedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+		Sum:         amount,
+		ProcessedAt: pgtype.Timestamptz{Time: uc.now(), Valid: true},
 	}
 
-	if err := uc.storage.CreateWithdrawal(ctx, withdrawal); err != nil {
+	if err := uc.storage.Withdraw(ctx, withdrawal); err != nil {
+		if errors.Is(err, models.ErrInsufficientBalance) {
+			return err
+		}
 		return fmt.Errorf("failed to record withdrawal: %w", err)
 	}
 
 	return nil
 }
 
-func (uc *WithdrawalUseCase) GetUserWithdrawals(ctx context.Context, userID int64) ([]models.Withdrawal, error) {
-	withdrawals, err := uc.storage.GetWithdrawalsByUserID(ctx, userID)
+// GetUserWithdrawals lists the withdrawals of filter.UserID that match filter.
+func (uc *WithdrawalUseCase) GetUserWithdrawals(ctx context.Context, filter models.WithdrawalFilter) (_ []models.Withdrawal, err error) {
+	ctx, span := tracing.Start(ctx, "WithdrawalUseCase.GetUserWithdrawals", tracing.UserID(filter.UserID))
+	defer func() { tracing.End(span, err) }()
+
+	withdrawals, err := uc.storage.ListWithdrawals(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get withdrawals: %w", err)
 	}
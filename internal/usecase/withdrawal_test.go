@@ -6,8 +6,8 @@ import (
 	"testing"
 
 	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/money"
 	"github.com/AlenaMolokova/diploma/internal/testutils"
-	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -19,20 +19,19 @@ func TestProcessWithdrawal(t *testing.T) {
 
 	tests := []struct {
 		name        string
-		amount      float64
+		amount      money.Amount
 		orderNumber string
-		setupMocks  func(*testutils.MockWithdrawalStorage, *testutils.MockBalanceStorage)
+		setupMocks  func(*testutils.MockWithdrawalStorage)
 		expectedErr error
 	}{
 		{
 			name:        "успешное снятие средств",
-			amount:      100.0,
+			amount:      money.MustParse("100"),
 			orderNumber: validOrderNumber,
-			setupMocks: func(ws *testutils.MockWithdrawalStorage, bs *testutils.MockBalanceStorage) {
-				bs.On("GetBalance", mock.Anything, userID).Return(pgtype.Float8{Float64: 200.0, Valid: true}, pgtype.Float8{}, nil)
-				bs.On("UpdateBalance", mock.Anything, userID, 100.0).Return(nil)
-				bs.On("UpdateWithdrawn", mock.Anything, userID, 100.0).Return(nil)
-				ws.On("CreateWithdrawal", mock.Anything, mock.AnythingOfType("models.Withdrawal")).Return(nil)
+			setupMocks: func(ws *testutils.MockWithdrawalStorage) {
+				ws.On("Withdraw", mock.Anything, mock.MatchedBy(func(w models.Withdrawal) bool {
+					return w.UserID == userID && w.OrderNumber == validOrderNumber && w.Sum == money.MustParse("100")
+				})).Return(nil)
 			},
 			expectedErr: nil,
 		},
@@ -40,34 +39,31 @@ func TestProcessWithdrawal(t *testing.T) {
 			name:        "неположительная сумма",
 			amount:      0,
 			orderNumber: validOrderNumber,
-			setupMocks:  func(ws *testutils.MockWithdrawalStorage, bs *testutils.MockBalanceStorage) {},
+			setupMocks:  func(ws *testutils.MockWithdrawalStorage) {},
 			expectedErr: errors.New("withdrawal amount must be positive"),
 		},
 		{
 			name:        "недостаточный баланс",
-			amount:      100.0,
+			amount:      money.MustParse("100"),
 			orderNumber: validOrderNumber,
-			setupMocks: func(ws *testutils.MockWithdrawalStorage, bs *testutils.MockBalanceStorage) {
-				bs.On("GetBalance", mock.Anything, userID).Return(pgtype.Float8{Float64: 50.0, Valid: true}, pgtype.Float8{}, nil)
+			setupMocks: func(ws *testutils.MockWithdrawalStorage) {
+				ws.On("Withdraw", mock.Anything, mock.AnythingOfType("models.Withdrawal")).Return(models.ErrInsufficientBalance)
 			},
-			expectedErr: errors.New("insufficient balance"),
+			expectedErr: models.ErrInsufficientBalance,
 		},
 		{
 			name:        "неверный номер заказа",
-			amount:      100.0,
+			amount:      money.MustParse("100"),
 			orderNumber: "4532015112830367",
-			setupMocks:  func(ws *testutils.MockWithdrawalStorage, bs *testutils.MockBalanceStorage) {},
+			setupMocks:  func(ws *testutils.MockWithdrawalStorage) {},
 			expectedErr: errors.New("invalid order number"),
 		},
 		{
 			name:        "ошибка записи списания",
-			amount:      100.0,
+			amount:      money.MustParse("100"),
 			orderNumber: validOrderNumber,
-			setupMocks: func(ws *testutils.MockWithdrawalStorage, bs *testutils.MockBalanceStorage) {
-				bs.On("GetBalance", mock.Anything, userID).Return(pgtype.Float8{Float64: 200.0, Valid: true}, pgtype.Float8{}, nil)
-				bs.On("UpdateBalance", mock.Anything, userID, 100.0).Return(nil)
-				bs.On("UpdateWithdrawn", mock.Anything, userID, 100.0).Return(nil)
-				ws.On("CreateWithdrawal", mock.Anything, mock.AnythingOfType("models.Withdrawal")).Return(errors.New("db error"))
+			setupMocks: func(ws *testutils.MockWithdrawalStorage) {
+				ws.On("Withdraw", mock.Anything, mock.AnythingOfType("models.Withdrawal")).Return(errors.New("db error"))
 			},
 			expectedErr: errors.New("failed to record withdrawal: db error"),
 		},
@@ -76,11 +72,9 @@ func TestProcessWithdrawal(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ws := &testutils.MockWithdrawalStorage{}
-			bs := &testutils.MockBalanceStorage{}
-			tt.setupMocks(ws, bs)
+			tt.setupMocks(ws)
 
-			balanceUC := NewBalanceUseCase(bs)
-			uc := NewWithdrawalUseCase(ws, balanceUC)
+			uc := NewWithdrawalUseCase(ws)
 
 			err := uc.ProcessWithdrawal(ctx, userID, tt.orderNumber, tt.amount)
 
@@ -92,13 +86,13 @@ func TestProcessWithdrawal(t *testing.T) {
 			}
 
 			ws.AssertExpectations(t)
-			bs.AssertExpectations(t)
 		})
 	}
 }
 
 func TestGetUserWithdrawals(t *testing.T) {
 	userID := int64(1)
+	filter := models.WithdrawalFilter{UserID: userID, Limit: 10}
 	ctx := context.Background()
 
 	tests := []struct {
@@ -110,19 +104,19 @@ func TestGetUserWithdrawals(t *testing.T) {
 		{
 			name: "успешное получение списаний",
 			setupMocks: func(ws *testutils.MockWithdrawalStorage) {
-				ws.On("GetWithdrawalsByUserID", mock.Anything, userID).Return([]models.Withdrawal{
-					{UserID: userID, OrderNumber: "123", Sum: pgtype.Float8{Float64: 100.0, Valid: true}},
+				ws.On("ListWithdrawals", mock.Anything, filter).Return([]models.Withdrawal{
+					{UserID: userID, OrderNumber: "123", Sum: money.MustParse("100")},
 				}, nil)
 			},
 			expectedWithdrawals: []models.Withdrawal{
-				{UserID: userID, OrderNumber: "123", Sum: pgtype.Float8{Float64: 100.0, Valid: true}},
+				{UserID: userID, OrderNumber: "123", Sum: money.MustParse("100")},
 			},
 			expectedErr: nil,
 		},
 		{
 			name: "нет списаний",
 			setupMocks: func(ws *testutils.MockWithdrawalStorage) {
-				ws.On("GetWithdrawalsByUserID", mock.Anything, userID).Return([]models.Withdrawal{}, nil)
+				ws.On("ListWithdrawals", mock.Anything, filter).Return([]models.Withdrawal{}, nil)
 			},
 			expectedWithdrawals: []models.Withdrawal{},
 			expectedErr:         nil,
@@ -130,7 +124,7 @@ func TestGetUserWithdrawals(t *testing.T) {
 		{
 			name: "ошибка хранилища",
 			setupMocks: func(ws *testutils.MockWithdrawalStorage) {
-				ws.On("GetWithdrawalsByUserID", mock.Anything, userID).Return([]models.Withdrawal{}, errors.New("db error"))
+				ws.On("ListWithdrawals", mock.Anything, filter).Return([]models.Withdrawal{}, errors.New("db error"))
 			},
 			expectedWithdrawals: nil,
 			expectedErr:         errors.New("failed to get withdrawals: db error"),
@@ -142,8 +136,8 @@ func TestGetUserWithdrawals(t *testing.T) {
 			ws := &testutils.MockWithdrawalStorage{}
 			tt.setupMocks(ws)
 
-			uc := NewWithdrawalUseCase(ws, nil)
-			withdrawals, err := uc.GetUserWithdrawals(ctx, userID)
+			uc := NewWithdrawalUseCase(ws)
+			withdrawals, err := uc.GetUserWithdrawals(ctx, filter)
 
 			if tt.expectedErr != nil {
 				assert.Error(t, err)
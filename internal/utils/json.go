@@ -2,7 +2,7 @@ package utils
 
 import (
   "encoding/json"
-  "log"
+  "log/slog"
   "net/http"
 )
 
@@ -11,7 +11,7 @@ func WriteJSONError(w http.ResponseWriter, status int, message string) error {
   w.WriteHeader(status)
   err := json.NewEncoder(w).Encode(map[string]string{"error": message})
   if err != nil {
-    log.Printf("Failed to encode error response: %v", err)
+    slog.Error("Failed to encode error response", slog.Any("error", err))
   }
   return err
 }
\ No newline at end of file
@@ -1,15 +1,187 @@
 package validation
 
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcryptMaxBytes is the longest password bcrypt hashes in full.
+const bcryptMaxBytes = 72
+
+// Violation codes returned to clients, one per broken rule.
+const (
+	CodePasswordTooShort      = "password_too_short"
+	CodePasswordTooLong       = "password_too_long"
+	CodePasswordTooSimple     = "password_too_simple"
+	CodePasswordBanned        = "password_banned"
+	CodePasswordContainsLogin = "password_contains_login"
+)
+
+// DefaultBannedPasswords are rejected by every policy, whatever the length.
+var DefaultBannedPasswords = []string{
+	"password", "password1", "password123", "passw0rd",
+	"12345678", "123456789", "1234567890", "87654321", "11111111", "00000000",
+	"qwertyui", "qwerty123", "1q2w3e4r", "1qaz2wsx", "asdfghjk", "zxcvbnm1",
+	"iloveyou", "letmein1", "welcome1", "admin123", "abc12345", "football",
+	"baseball", "sunshine", "princess", "superman", "trustno1", "gophermart",
+}
+
 type PasswordValidator interface {
-	ValidatePassword(password string) bool
+	ValidatePassword(login, password string) error
+}
+
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
-type DefaultPasswordValidator struct{}
+// PolicyError lists every rule a password breaks.
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password rejected: " + strings.Join(messages, "; ")
+}
+
+// PasswordPolicy configures PolicyValidator. Lengths are counted in
+// characters; MaxLength is capped at the 72 bytes bcrypt can hash. MinClasses
+// is how many of lower case, upper case, digits and symbols a password must
+// mix.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	MinClasses    int
+	Banned        []string
+	DisallowLogin bool
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:     8,
+		MaxLength:     bcryptMaxBytes,
+		DisallowLogin: true,
+	}
+}
 
-func NewDefaultPasswordValidator() *DefaultPasswordValidator {
-	return &DefaultPasswordValidator{}
+type PolicyValidator struct {
+	policy PasswordPolicy
+	banned map[string]struct{}
 }
 
-func (v *DefaultPasswordValidator) ValidatePassword(password string) bool {
-	return len(password) >= 8
+func NewPolicyValidator(policy PasswordPolicy) *PolicyValidator {
+	banned := make(map[string]struct{}, len(DefaultBannedPasswords)+len(policy.Banned))
+	for _, list := range [][]string{DefaultBannedPasswords, policy.Banned} {
+		for _, p := range list {
+			banned[strings.ToLower(p)] = struct{}{}
+		}
+	}
+	return &PolicyValidator{policy: policy, banned: banned}
+}
+
+func NewDefaultPasswordValidator() *PolicyValidator {
+	return NewPolicyValidator(DefaultPasswordPolicy())
+}
+
+func (v *PolicyValidator) ValidatePassword(login, password string) error {
+	var violations []Violation
+	length := utf8.RuneCountInString(password)
+
+	if length < v.policy.MinLength {
+		violations = append(violations, Violation{
+			Code:    CodePasswordTooShort,
+			Message: fmt.Sprintf("Password must be at least %d characters long", v.policy.MinLength),
+		})
+	}
+	if (v.policy.MaxLength > 0 && length > v.policy.MaxLength) || len(password) > bcryptMaxBytes {
+		violations = append(violations, Violation{
+			Code:    CodePasswordTooLong,
+			Message: fmt.Sprintf("Password must be at most %d characters long", v.maxLength()),
+		})
+	}
+	if classes := characterClasses(password); classes < v.policy.MinClasses {
+		violations = append(violations, Violation{
+			Code:    CodePasswordTooSimple,
+			Message: fmt.Sprintf("Password must mix at least %d of lower case, upper case, digits and symbols", v.policy.MinClasses),
+		})
+	}
+	if _, ok := v.banned[strings.ToLower(password)]; ok {
+		violations = append(violations, Violation{
+			Code:    CodePasswordBanned,
+			Message: "Password is too common",
+		})
+	}
+	if v.policy.DisallowLogin && login != "" && strings.Contains(strings.ToLower(password), strings.ToLower(login)) {
+		violations = append(violations, Violation{
+			Code:    CodePasswordContainsLogin,
+			Message: "Password must not contain the login",
+		})
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func (v *PolicyValidator) maxLength() int {
+	if v.policy.MaxLength > 0 && v.policy.MaxLength < bcryptMaxBytes {
+		return v.policy.MaxLength
+	}
+	return bcryptMaxBytes
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	return classes
+}
+
+// LoadBannedPasswords reads one password per line, skipping blank lines and
+// lines starting with #.
+func LoadBannedPasswords(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open banned password list: %w", err)
+	}
+	defer file.Close()
+
+	var banned []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		banned = append(banned, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read banned password list: %w", err)
+	}
+	return banned, nil
 }
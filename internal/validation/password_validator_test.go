@@ -0,0 +1,75 @@
+package validation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyValidator(t *testing.T) {
+	validator := NewPolicyValidator(PasswordPolicy{
+		MinLength:     10,
+		MaxLength:     20,
+		MinClasses:    3,
+		Banned:        []string{"Correct-Horse-1"},
+		DisallowLogin: true,
+	})
+
+	tests := []struct {
+		name          string
+		login         string
+		password      string
+		expectedCodes []string
+	}{
+		{name: "валидный пароль", login: "alice", password: "Tr0ub4dor&3", expectedCodes: nil},
+		{name: "короткий пароль", login: "alice", password: "Ab1!", expectedCodes: []string{CodePasswordTooShort}},
+		{name: "длинный пароль", login: "alice", password: strings.Repeat("Ab1!", 6), expectedCodes: []string{CodePasswordTooLong}},
+		{name: "мало классов символов", login: "alice", password: "onlylowercase", expectedCodes: []string{CodePasswordTooSimple}},
+		{name: "пароль из списка запрещённых", login: "alice", password: "correct-horse-1", expectedCodes: []string{CodePasswordBanned}},
+		{name: "пароль содержит логин", login: "Alice", password: "xxALICE-2024x", expectedCodes: []string{CodePasswordContainsLogin}},
+		{name: "несколько нарушений", login: "bob", password: "bob", expectedCodes: []string{CodePasswordTooShort, CodePasswordTooSimple, CodePasswordContainsLogin}},
+		{name: "длина считается в символах", login: "alice", password: "Пароль-2024", expectedCodes: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.ValidatePassword(tt.login, tt.password)
+			if tt.expectedCodes == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var policyErr *PolicyError
+			require.ErrorAs(t, err, &policyErr)
+			codes := make([]string, len(policyErr.Violations))
+			for i, v := range policyErr.Violations {
+				codes[i] = v.Code
+			}
+			assert.Equal(t, tt.expectedCodes, codes)
+		})
+	}
+}
+
+func TestDefaultPasswordValidator(t *testing.T) {
+	validator := NewDefaultPasswordValidator()
+
+	assert.NoError(t, validator.ValidatePassword("user", "securepass"))
+	assert.Error(t, validator.ValidatePassword("user", "short"))
+	assert.Error(t, validator.ValidatePassword("user", "password123"), "built-in banned passwords are rejected")
+	assert.Error(t, validator.ValidatePassword("user", strings.Repeat("я", 40)), "bcrypt hashes at most 72 bytes")
+}
+
+func TestLoadBannedPasswords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "banned.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# common passwords\nhunter22\n\n  letmein!  \n"), 0o600))
+
+	banned, err := LoadBannedPasswords(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hunter22", "letmein!"}, banned)
+
+	_, err = LoadBannedPasswords(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,364 @@
+// Package webhook delivers the events queued in the webhook outbox to the
+// endpoints that subscribed to them.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/AlenaMolokova/diploma/internal/tracing"
+)
+
+// Headers of a delivery. The signature is "sha256=" followed by the hex
+// HMAC-SHA256, keyed with the webhook's secret, of the timestamp, a dot and
+// the body; see Sign.
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+const (
+	// deliveryLease bounds how long a claimed delivery stays invisible to
+	// other replicas.
+	deliveryLease = 2 * time.Minute
+	// batchSize is how many deliveries are claimed at a time.
+	batchSize = 100
+	// minRetryBackoff and maxRetryBackoff bound the exponential delay between
+	// failed attempts.
+	minRetryBackoff = 30 * time.Second
+	maxRetryBackoff = time.Hour
+	// maxResponseBody is how much of a response is read before the
+	// connection is closed.
+	maxResponseBody = 64 << 10
+)
+
+// errAddressNotAllowed is all a refused delivery records, so that the
+// delivery log does not tell the webhook's owner what a name resolved to.
+var errAddressNotAllowed = errors.New("destination not allowed")
+
+// blockedPrefixes are the ranges, besides the loopback, private, link-local,
+// unspecified and multicast ones, that a webhook may not reach: "this
+// network", shared address space, benchmarking and NAT64, which can all lead
+// into the local network.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+type DeliveryStorage interface {
+	ClaimWebhookDeliveries(ctx context.Context, owner string, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, attempt models.WebhookAttempt) (bool, error)
+}
+
+// Envelope is the body of a delivery. ID identifies the event: it is the
+// same in every delivery of the event, and in every retry of a delivery.
+type Envelope struct {
+	ID        int64           `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Dispatcher posts due deliveries to their webhooks. A 2xx response delivers
+// the event; any other response, or none, is retried with a growing delay
+// until the delivery has failed maxAttempts times. Every attempt goes to the
+// delivery log. Events are delivered at least once, so receivers should
+// ignore the ids they have already seen.
+type Dispatcher struct {
+	client       *http.Client
+	interval     time.Duration
+	workers      int
+	maxAttempts  int
+	allowPrivate bool
+	owner        string
+	now          func() time.Time
+	logger       *slog.Logger
+}
+
+func NewDispatcher() *Dispatcher {
+	d := &Dispatcher{
+		interval:    constants.DefaultWebhookInterval,
+		workers:     constants.DefaultWebhookWorkers,
+		maxAttempts: constants.DefaultWebhookAttempts,
+		owner:       workerID(),
+		now:         time.Now,
+		logger:      slog.Default(),
+	}
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: d.checkAddress}
+	d.client = &http.Client{
+		Timeout: constants.DefaultWebhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		// A redirect is answered like any other non-2xx response, so that a
+		// receiver cannot point the dispatcher somewhere else.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return d
+}
+
+// workerID identifies this replica as the owner of the deliveries it claims.
+func workerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "gophermart"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+func (d *Dispatcher) SetLogger(logger *slog.Logger) {
+	d.logger = logger
+}
+
+func (d *Dispatcher) SetClock(now func() time.Time) {
+	d.now = now
+}
+
+func (d *Dispatcher) SetInterval(interval time.Duration) {
+	if interval > 0 {
+		d.interval = interval
+	}
+}
+
+func (d *Dispatcher) SetTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		d.client.Timeout = timeout
+	}
+}
+
+// SetMaxAttempts sets after how many failed attempts a delivery is
+// dead-lettered.
+func (d *Dispatcher) SetMaxAttempts(n int) {
+	if n > 0 {
+		d.maxAttempts = n
+	}
+}
+
+// SetAllowPrivate lets webhooks reach loopback, private and other internal
+// addresses. They are refused by default, so that a user cannot make the
+// server call into its own network.
+func (d *Dispatcher) SetAllowPrivate(allow bool) {
+	d.allowPrivate = allow
+}
+
+// checkAddress refuses connections to internal addresses unless they are
+// allowed. It runs on the resolved address, so a host name pointing inside
+// the network is refused as well.
+func (d *Dispatcher) checkAddress(_, address string, _ syscall.RawConn) error {
+	if d.allowPrivate {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return errAddressNotAllowed
+	}
+	if !addressAllowed(addrPort.Addr()) {
+		return errAddressNotAllowed
+	}
+	return nil
+}
+
+func addressAllowed(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Sign returns the signature of a delivery with the given timestamp and body.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run delivers the due events every interval until ctx is cancelled. It
+// returns only after the deliveries in flight are recorded.
+func (d *Dispatcher) Run(ctx context.Context, store DeliveryStorage) {
+	d.logger.InfoContext(ctx, "Starting webhook dispatcher",
+		slog.Duration("interval", d.interval), slog.Int("workers", d.workers), slog.String("owner", d.owner))
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.logger.InfoContext(ctx, "Webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+			d.dispatch(ctx, store)
+		}
+	}
+}
+
+// dispatch claims due deliveries in batches and hands them to a bounded pool
+// of workers, until none is left.
+func (d *Dispatcher) dispatch(ctx context.Context, store DeliveryStorage) {
+	deliveries := make(chan models.WebhookDelivery)
+
+	var wg sync.WaitGroup
+	for i := 0; i < d.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for delivery := range deliveries {
+				d.process(ctx, store, delivery)
+			}
+		}()
+	}
+	defer func() {
+		close(deliveries)
+		wg.Wait()
+	}()
+
+	for {
+		claimed, err := store.ClaimWebhookDeliveries(ctx, d.owner, batchSize, deliveryLease)
+		if err != nil {
+			if ctx.Err() == nil {
+				d.logger.ErrorContext(ctx, "Failed to claim webhook deliveries", slog.Any("error", err))
+			}
+			return
+		}
+		for _, delivery := range claimed {
+			select {
+			case <-ctx.Done():
+				return
+			case deliveries <- delivery:
+			}
+		}
+		if len(claimed) < batchSize {
+			return
+		}
+	}
+}
+
+// process makes one attempt at a claimed delivery and records it. If the
+// worker is interrupted, the delivery is left leased and is claimed again
+// once the lease expires.
+func (d *Dispatcher) process(ctx context.Context, store DeliveryStorage, delivery models.WebhookDelivery) {
+	ctx, span := tracing.Start(ctx, "webhook.deliver", tracing.UserID(delivery.UserID))
+	defer span.End()
+
+	ctx = logging.With(ctx, logging.UserIDKey, delivery.UserID,
+		"delivery_id", delivery.ID, "event", delivery.Event)
+
+	started := time.Now()
+	status, err := d.send(ctx, delivery)
+	if ctx.Err() != nil {
+		return
+	}
+	attempt := models.WebhookAttempt{
+		DeliveryID:  delivery.ID,
+		Owner:       d.owner,
+		StatusCode:  status,
+		Duration:    time.Since(started),
+		Delivered:   err == nil,
+		MaxAttempts: d.maxAttempts,
+	}
+	if err != nil {
+		span.RecordError(err)
+		d.logger.WarnContext(ctx, "Failed to deliver webhook", slog.Any("error", err))
+		attempt.Error = err.Error()
+		attempt.RetryAt = d.now().Add(retryBackoff(delivery.Attempts))
+	} else {
+		d.logger.DebugContext(ctx, "Delivered webhook", slog.Int("status", status))
+	}
+
+	dead, err := store.RecordWebhookAttempt(ctx, attempt)
+	if err != nil {
+		d.logger.ErrorContext(ctx, "Failed to record webhook attempt", slog.Any("error", err))
+		return
+	}
+	if dead {
+		d.logger.ErrorContext(ctx, "Webhook delivery moved to dead letter", slog.Int("attempts", delivery.Attempts+1))
+	}
+}
+
+// send posts the delivery and returns the status code of the response, or
+// zero when there was none.
+func (d *Dispatcher) send(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(Envelope{
+		ID:        delivery.EventID,
+		Event:     delivery.Event,
+		CreatedAt: delivery.OccurredAt,
+		Data:      delivery.Payload,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode webhook event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Gophermart-Webhooks")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if errors.Is(err, errAddressNotAllowed) {
+		return 0, errAddressNotAllowed
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryBackoff doubles minRetryBackoff for every earlier failure, up to
+// maxRetryBackoff.
+func retryBackoff(attempts int) time.Duration {
+	backoff := minRetryBackoff
+	for i := 0; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxRetryBackoff)
+}
@@ -0,0 +1,250 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlenaMolokova/diploma/internal/constants"
+	"github.com/AlenaMolokova/diploma/internal/logging"
+	"github.com/AlenaMolokova/diploma/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore hands out its deliveries on the first claim and records the
+// attempts made at them.
+type fakeStore struct {
+	mu         sync.Mutex
+	deliveries []models.WebhookDelivery
+	attempts   []models.WebhookAttempt
+	dead       bool
+}
+
+func (s *fakeStore) ClaimWebhookDeliveries(_ context.Context, _ string, limit int, _ time.Duration) ([]models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claimed := s.deliveries[:min(limit, len(s.deliveries))]
+	s.deliveries = s.deliveries[len(claimed):]
+	return claimed, nil
+}
+
+func (s *fakeStore) RecordWebhookAttempt(_ context.Context, attempt models.WebhookAttempt) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = append(s.attempts, attempt)
+	return s.dead, nil
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// newReceiver starts a webhook receiver answering with status and passes
+// what it receives to the returned channel.
+func newReceiver(t *testing.T, status int) (*httptest.Server, <-chan receivedRequest) {
+	t.Helper()
+	received := make(chan receivedRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- receivedRequest{header: r.Header.Clone(), body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func newTestDispatcher(now time.Time) *Dispatcher {
+	d := NewDispatcher()
+	d.SetLogger(logging.Discard())
+	d.SetClock(func() time.Time { return now })
+	d.SetAllowPrivate(true)
+	d.SetMaxAttempts(3)
+	return d
+}
+
+func testDelivery(url string) models.WebhookDelivery {
+	return models.WebhookDelivery{
+		ID:         7,
+		EventID:    42,
+		Event:      constants.WebhookOrderProcessed,
+		UserID:     1,
+		Payload:    []byte(`{"number":"79927398713","accrual":500}`),
+		OccurredAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		URL:        url,
+		Secret:     "s3cret",
+		Attempts:   2,
+	}
+}
+
+func TestDispatcherDeliversSignedEvent(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 5, 0, time.UTC)
+	server, received := newReceiver(t, http.StatusNoContent)
+	store := &fakeStore{deliveries: []models.WebhookDelivery{testDelivery(server.URL)}}
+
+	newTestDispatcher(now).dispatch(context.Background(), store)
+
+	req := <-received
+	assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+	assert.Equal(t, constants.WebhookOrderProcessed, req.header.Get(EventHeader))
+	assert.Equal(t, "7", req.header.Get(DeliveryHeader))
+	assert.Equal(t, strconv.FormatInt(now.Unix(), 10), req.header.Get(TimestampHeader))
+	assert.Equal(t, Sign("s3cret", now.Unix(), req.body), req.header.Get(SignatureHeader),
+		"подпись проверяется секретом вебхука")
+	assert.JSONEq(t, `{
+		"id": 42,
+		"event": "order.processed",
+		"created_at": "2024-05-01T12:00:00Z",
+		"data": {"number": "79927398713", "accrual": 500}
+	}`, string(req.body))
+
+	require.Len(t, store.attempts, 1)
+	attempt := store.attempts[0]
+	assert.True(t, attempt.Delivered)
+	assert.Equal(t, int64(7), attempt.DeliveryID)
+	assert.Equal(t, http.StatusNoContent, attempt.StatusCode)
+	assert.Empty(t, attempt.Error)
+}
+
+func TestDispatcherRetriesFailedDelivery(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 5, 0, time.UTC)
+	tests := []struct {
+		name   string
+		status int
+	}{
+		{name: "Ошибка получателя", status: http.StatusInternalServerError},
+		{name: "Редирект не выполняется", status: http.StatusFound},
+		{name: "Клиентская ошибка", status: http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, received := newReceiver(t, tt.status)
+			store := &fakeStore{deliveries: []models.WebhookDelivery{testDelivery(server.URL)}}
+
+			newTestDispatcher(now).dispatch(context.Background(), store)
+
+			<-received
+			require.Len(t, store.attempts, 1)
+			attempt := store.attempts[0]
+			assert.False(t, attempt.Delivered)
+			assert.Equal(t, tt.status, attempt.StatusCode)
+			assert.Equal(t, "unexpected status code "+strconv.Itoa(tt.status), attempt.Error)
+			assert.Equal(t, now.Add(4*minRetryBackoff), attempt.RetryAt, "после двух неудач задержка растёт вчетверо")
+			assert.Equal(t, 3, attempt.MaxAttempts)
+		})
+	}
+}
+
+func TestDispatcherRefusesPrivateAddresses(t *testing.T) {
+	server, received := newReceiver(t, http.StatusOK)
+	store := &fakeStore{deliveries: []models.WebhookDelivery{testDelivery(server.URL)}}
+
+	d := newTestDispatcher(time.Now())
+	d.SetAllowPrivate(false)
+	d.dispatch(context.Background(), store)
+
+	assert.Empty(t, received, "запрос во внутреннюю сеть не отправляется")
+	require.Len(t, store.attempts, 1)
+	assert.False(t, store.attempts[0].Delivered)
+	assert.Zero(t, store.attempts[0].StatusCode)
+	assert.Equal(t, "destination not allowed", store.attempts[0].Error, "the log does not reveal the address")
+}
+
+func TestAddressAllowed(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{address: "93.184.216.34", allowed: true},
+		{address: "2606:2800:220:1:248:1893:25c8:1946", allowed: true},
+		{address: "127.0.0.1"},
+		{address: "10.1.2.3"},
+		{address: "172.16.0.1"},
+		{address: "192.168.1.1"},
+		{address: "169.254.169.254"},
+		{address: "0.0.0.0"},
+		{address: "0.1.2.3"},
+		{address: "100.64.0.1"},
+		{address: "100.127.255.254"},
+		{address: "198.18.0.1"},
+		{address: "198.19.255.254"},
+		{address: "224.0.0.1"},
+		{address: "::1"},
+		{address: "::"},
+		{address: "fc00::1"},
+		{address: "fe80::1"},
+		{address: "::ffff:10.1.2.3"},
+		{address: "64:ff9b::a01:203"},
+		{address: "64:ff9b:1::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			assert.Equal(t, tt.allowed, addressAllowed(netip.MustParseAddr(tt.address)))
+		})
+	}
+}
+
+func TestDispatcherRun(t *testing.T) {
+	server, received := newReceiver(t, http.StatusOK)
+	store := &fakeStore{deliveries: []models.WebhookDelivery{testDelivery(server.URL)}}
+
+	d := newTestDispatcher(time.Now())
+	d.SetInterval(10 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx, store)
+		close(done)
+	}()
+
+	select {
+	case req := <-received:
+		var envelope Envelope
+		require.NoError(t, json.Unmarshal(req.body, &envelope))
+		assert.Equal(t, int64(42), envelope.ID)
+	case <-time.After(time.Second):
+		t.Fatal("Expected the dispatcher to deliver the event")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Run to return once the context is cancelled")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: 30 * time.Second},
+		{attempts: 1, want: time.Minute},
+		{attempts: 3, want: 4 * time.Minute},
+		{attempts: 7, want: time.Hour},
+		{attempts: 20, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempts), func(t *testing.T) {
+			assert.Equal(t, tt.want, retryBackoff(tt.attempts))
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1714564800.{"id":1}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=113442f3b59eb48dd6b82d35b084174a901ce83a6a908384e7069ea6983ee3c6",
+		Sign("secret", 1714564800, []byte(`{"id":1}`)))
+}
@@ -0,0 +1,17 @@
+ALTER TABLE users
+ADD COLUMN balance DOUBLE PRECISION DEFAULT 0.0,
+ADD COLUMN withdrawn DOUBLE PRECISION DEFAULT 0.0;
+
+UPDATE users
+SET balance = COALESCE((
+    SELECT SUM(amount)
+    FROM ledger_entries
+    WHERE ledger_entries.user_id = users.id
+), 0.0),
+    withdrawn = COALESCE((
+    SELECT -SUM(amount)
+    FROM ledger_entries
+    WHERE ledger_entries.user_id = users.id AND kind = 'withdrawal'
+), 0.0);
+
+DROP TABLE ledger_entries;
@@ -0,0 +1,24 @@
+CREATE TABLE ledger_entries (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    kind TEXT NOT NULL CHECK (kind IN ('opening', 'accrual', 'withdrawal', 'adjustment')),
+    amount DOUBLE PRECISION NOT NULL,
+    order_number TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ledger_entries_user_id_kind_idx ON ledger_entries (user_id, kind);
+
+INSERT INTO ledger_entries (user_id, kind, amount)
+SELECT id, 'opening', COALESCE(balance, 0) + COALESCE(withdrawn, 0)
+FROM users
+WHERE COALESCE(balance, 0) + COALESCE(withdrawn, 0) <> 0;
+
+INSERT INTO ledger_entries (user_id, kind, amount)
+SELECT id, 'withdrawal', -withdrawn
+FROM users
+WHERE COALESCE(withdrawn, 0) <> 0;
+
+ALTER TABLE users
+DROP COLUMN balance,
+DROP COLUMN withdrawn;
@@ -0,0 +1,2 @@
+ALTER TABLE ledger_entries
+DROP COLUMN withdrawal_id;
@@ -0,0 +1,2 @@
+ALTER TABLE ledger_entries
+ADD COLUMN withdrawal_id BIGINT REFERENCES withdrawals(id);
@@ -0,0 +1,12 @@
+ALTER TABLE ledger_entries
+ALTER COLUMN amount TYPE DOUBLE PRECISION;
+
+ALTER TABLE withdrawals
+ALTER COLUMN sum TYPE DOUBLE PRECISION;
+
+ALTER TABLE orders
+ALTER COLUMN accrual DROP NOT NULL,
+ALTER COLUMN accrual DROP DEFAULT,
+ALTER COLUMN accrual TYPE DOUBLE PRECISION;
+
+UPDATE orders SET accrual = NULL WHERE accrual = 0;
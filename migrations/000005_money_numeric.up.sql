@@ -0,0 +1,12 @@
+UPDATE orders SET accrual = 0 WHERE accrual IS NULL;
+
+ALTER TABLE orders
+ALTER COLUMN accrual TYPE NUMERIC(14, 2) USING round(accrual::numeric, 2),
+ALTER COLUMN accrual SET DEFAULT 0,
+ALTER COLUMN accrual SET NOT NULL;
+
+ALTER TABLE withdrawals
+ALTER COLUMN sum TYPE NUMERIC(14, 2) USING round(sum::numeric, 2);
+
+ALTER TABLE ledger_entries
+ALTER COLUMN amount TYPE NUMERIC(14, 2) USING round(amount::numeric, 2);
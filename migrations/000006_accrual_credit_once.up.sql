@@ -0,0 +1,3 @@
+CREATE UNIQUE INDEX ledger_entries_accrual_order_number_idx
+ON ledger_entries (order_number)
+WHERE kind = 'accrual';
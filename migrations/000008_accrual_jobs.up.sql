@@ -0,0 +1,20 @@
+CREATE TABLE accrual_jobs (
+    order_number TEXT PRIMARY KEY REFERENCES orders(number),
+    state TEXT NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'done', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    not_found INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    locked_by TEXT,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX accrual_jobs_ready_idx
+ON accrual_jobs (next_attempt_at)
+WHERE state = 'pending';
+
+INSERT INTO accrual_jobs (order_number)
+SELECT number
+FROM orders
+WHERE status NOT IN ('PROCESSED', 'INVALID');
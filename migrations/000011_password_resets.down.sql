@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS refresh_tokens_user_id_idx;
+DROP TABLE IF EXISTS password_resets;
@@ -0,0 +1,12 @@
+CREATE TABLE password_resets (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX password_resets_user_id_idx ON password_resets (user_id);
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
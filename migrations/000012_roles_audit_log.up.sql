@@ -0,0 +1,14 @@
+ALTER TABLE users
+ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin'));
+
+CREATE TABLE audit_log (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    actor_id BIGINT REFERENCES users(id),
+    action TEXT NOT NULL,
+    target_user_id BIGINT REFERENCES users(id),
+    order_number TEXT,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX audit_log_target_user_id_idx ON audit_log (target_user_id, created_at);
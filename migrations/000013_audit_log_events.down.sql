@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS audit_log_order_number_idx;
+DROP INDEX IF EXISTS audit_log_actor_id_idx;
+
+DROP INDEX IF EXISTS audit_log_target_user_id_idx;
+CREATE INDEX audit_log_target_user_id_idx ON audit_log (target_user_id, created_at);
+
+ALTER TABLE audit_log
+DROP COLUMN IF EXISTS balance_after,
+DROP COLUMN IF EXISTS balance_before,
+DROP COLUMN IF EXISTS source_ip;
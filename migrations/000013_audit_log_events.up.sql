@@ -0,0 +1,12 @@
+ALTER TABLE audit_log
+ADD COLUMN source_ip TEXT,
+ADD COLUMN balance_before NUMERIC(14, 2),
+ADD COLUMN balance_after NUMERIC(14, 2);
+
+DROP INDEX IF EXISTS audit_log_target_user_id_idx;
+CREATE INDEX audit_log_target_user_id_idx ON audit_log (target_user_id, id);
+
+CREATE INDEX audit_log_actor_id_idx ON audit_log (actor_id, id);
+
+CREATE INDEX audit_log_order_number_idx ON audit_log (order_number, id)
+WHERE order_number IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE accrual_jobs ADD COLUMN trace_parent TEXT;
@@ -0,0 +1,25 @@
+CREATE TABLE order_status_history (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    order_number TEXT NOT NULL REFERENCES orders(number),
+    kind TEXT NOT NULL CHECK (kind IN ('status_change', 'accrual_check')),
+    from_status TEXT,
+    status TEXT,
+    outcome TEXT,
+    accrual NUMERIC(14, 2),
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX order_status_history_order_number_idx ON order_status_history (order_number, id);
+
+INSERT INTO order_status_history (order_number, kind, status, created_at)
+SELECT number, 'status_change', 'NEW', uploaded_at
+FROM orders
+ORDER BY id;
+
+INSERT INTO order_status_history (order_number, kind, from_status, status, created_at)
+SELECT order_number, 'status_change', details->>'from', details->>'to', created_at
+FROM audit_log
+WHERE action = 'order.status'
+  AND order_number IN (SELECT number FROM orders)
+ORDER BY id;